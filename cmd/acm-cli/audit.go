@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	acmv1 "github.com/ferg-cod3s/automated-compromise-mitigation/api/proto/acm/v1"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+)
+
+// runAuditSTH prints the latest signed tree head of the audit transparency log
+func runAuditSTH() {
+	conn, err := createClient()
+	if err != nil {
+		log.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	client := acmv1.NewAuditServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	resp, err := client.GetSignedTreeHead(ctx, &acmv1.SignedTreeHeadRequest{})
+	if err != nil {
+		log.Fatalf("Failed to get tree head: %v", err)
+	}
+	if resp.Status.Code != acmv1.StatusCode_STATUS_CODE_SUCCESS {
+		log.Fatalf("Failed to get tree head: %s", resp.Status.Message)
+	}
+
+	head := resp.TreeHead
+	fmt.Println("Audit Transparency Log")
+	fmt.Println(strings.Repeat("=", 50))
+	fmt.Printf("Tree size:  %d\n", head.TreeSize)
+	fmt.Printf("Signed at:  %s\n", time.UnixMilli(head.TimestampMs).Format(time.RFC3339))
+	fmt.Printf("Root hash:  %s\n", hex.EncodeToString(head.RootHash))
+	fmt.Printf("Signature:  %s\n", hex.EncodeToString(head.Signature))
+	fmt.Printf("Public key: %s\n", hex.EncodeToString(resp.PublicKey))
+}
+
+// runAuditProof fetches an inclusion or consistency proof and writes it as JSON
+func runAuditProof() {
+	if len(os.Args) < 4 || (os.Args[2] != audit.ProofTypeInclusion && os.Args[2] != audit.ProofTypeConsistency) {
+		fmt.Fprintf(os.Stderr, "Usage: %s audit-proof inclusion <event-id> [tree-size]\n", cliName)
+		fmt.Fprintf(os.Stderr, "       %s audit-proof consistency <first-size> [second-size]\n", cliName)
+		os.Exit(1)
+	}
+
+	var optionalSize int64
+	if len(os.Args) > 4 {
+		size, err := strconv.ParseInt(os.Args[4], 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid tree size: %s", os.Args[4])
+		}
+		optionalSize = size
+	}
+
+	conn, err := createClient()
+	if err != nil {
+		log.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	client := acmv1.NewAuditServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	bundle := audit.ProofBundle{Type: os.Args[2]}
+
+	if bundle.Type == audit.ProofTypeInclusion {
+		resp, err := client.GetInclusionProof(ctx, &acmv1.InclusionProofRequest{
+			EventId:  os.Args[3],
+			TreeSize: optionalSize,
+		})
+		if err != nil {
+			log.Fatalf("Failed to get inclusion proof: %v", err)
+		}
+		if resp.Status.Code != acmv1.StatusCode_STATUS_CODE_SUCCESS {
+			log.Fatalf("Failed to get inclusion proof: %s", resp.Status.Message)
+		}
+
+		bundle.Inclusion = &audit.InclusionProof{
+			EventID:   resp.EventId,
+			LeafIndex: resp.LeafIndex,
+			LeafData:  resp.LeafData,
+			AuditPath: resp.AuditPath,
+			TreeHead:  treeHeadFromProto(resp.TreeHead),
+		}
+	} else {
+		first, err := strconv.ParseInt(os.Args[3], 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid tree size: %s", os.Args[3])
+		}
+
+		resp, err := client.GetConsistencyProof(ctx, &acmv1.ConsistencyProofRequest{
+			FirstTreeSize:  first,
+			SecondTreeSize: optionalSize,
+		})
+		if err != nil {
+			log.Fatalf("Failed to get consistency proof: %v", err)
+		}
+		if resp.Status.Code != acmv1.StatusCode_STATUS_CODE_SUCCESS {
+			log.Fatalf("Failed to get consistency proof: %s", resp.Status.Message)
+		}
+
+		bundle.Consistency = &audit.ConsistencyProof{
+			FirstTreeHead:  treeHeadFromProto(resp.FirstTreeHead),
+			SecondTreeHead: treeHeadFromProto(resp.SecondTreeHead),
+			Proof:          resp.Proof,
+		}
+	}
+
+	out, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode proof: %v", err)
+	}
+	fmt.Println(string(out))
+}
+
+// runVerifyProof checks a proof bundle offline using only the public key.
+// For an inclusion proof, the proven leaf can also be compared with a copy
+// of the event: a JSON event, or a JSON audit report containing it.
+func runVerifyProof() {
+	if len(os.Args) < 4 {
+		fmt.Fprintf(os.Stderr, "Usage: %s verify-proof <public-key-hex|key-file> <proof.json> [event.json]\n", cliName)
+		os.Exit(1)
+	}
+
+	publicKey, err := loadPublicKey(os.Args[2])
+	if err != nil {
+		log.Fatalf("Failed to load public key: %v", err)
+	}
+
+	data, err := os.ReadFile(os.Args[3])
+	if err != nil {
+		log.Fatalf("Failed to read proof: %v", err)
+	}
+
+	var bundle audit.ProofBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		log.Fatalf("Failed to parse proof: %v", err)
+	}
+
+	if err := bundle.Verify(publicKey); err != nil {
+		fmt.Printf("✗ Proof verification FAILED: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch bundle.Type {
+	case audit.ProofTypeInclusion:
+		p := bundle.Inclusion
+		if len(os.Args) > 4 {
+			event, err := loadEvent(os.Args[4], p.EventID)
+			if err != nil {
+				log.Fatalf("Failed to load event: %v", err)
+			}
+			if err := p.VerifyEvent(publicKey, *event); err != nil {
+				fmt.Printf("✗ Proof verification FAILED: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		// Describe the event from the verified leaf, not the bundle's label
+		leaf, err := p.LeafEvent()
+		if err != nil {
+			log.Fatalf("Failed to decode leaf: %v", err)
+		}
+		fmt.Printf("✓ Event %s is leaf %d of the signed tree of size %d\n", leaf.ID, p.LeafIndex, p.TreeHead.TreeSize)
+		fmt.Printf("  Event:     %s %s at %s\n", leaf.Type, leaf.Status, leaf.Timestamp.Format(time.RFC3339))
+		if len(os.Args) > 4 {
+			fmt.Printf("  Matches:   %s\n", os.Args[4])
+		}
+		fmt.Printf("  Root hash: %s\n", hex.EncodeToString(p.TreeHead.RootHash))
+	case audit.ProofTypeConsistency:
+		p := bundle.Consistency
+		fmt.Printf("✓ Tree of size %d is a prefix of the tree of size %d\n", p.FirstTreeHead.TreeSize, p.SecondTreeHead.TreeSize)
+		fmt.Printf("  First root:  %s\n", hex.EncodeToString(p.FirstTreeHead.RootHash))
+		fmt.Printf("  Second root: %s\n", hex.EncodeToString(p.SecondTreeHead.RootHash))
+	}
+}
+
+// loadEvent reads the event with ID id from path, which holds either one
+// JSON event or a JSON audit report (an array of events).
+func loadEvent(path, id string) (*audit.Event, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []audit.Event
+	if err := json.Unmarshal(data, &events); err != nil {
+		var event audit.Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, fmt.Errorf("%s is neither an event nor a JSON audit report: %w", path, err)
+		}
+		events = []audit.Event{event}
+	}
+
+	for i := range events {
+		if events[i].ID == id {
+			return &events[i], nil
+		}
+	}
+	return nil, fmt.Errorf("event %s not found in %s", id, path)
+}
+
+// runAuditWatch streams audit events until interrupted
+func runAuditWatch() {
+	flags := flag.NewFlagSet("audit-watch", flag.ExitOnError)
+	eventType := flags.String("type", "", "only show events of this type (rotation, detection, compliance, him, auth)")
+	site := flags.String("site", "", "only show events for this site")
+	statusFilter := flags.String("status", "", "only show events with this status")
+	fromEvent := flags.String("from-event", "", "replay events after this event ID first")
+	since := flags.Duration("since", 0, "replay events from this long ago first (e.g. 1h)")
+	asJSON := flags.Bool("json", false, "print one JSON object per line")
+	flags.Parse(os.Args[2:])
+
+	req := &acmv1.WatchEventsRequest{FromEventId: *fromEvent}
+	if *eventType != "" {
+		t, ok := watchEventTypes[*eventType]
+		if !ok {
+			log.Fatalf("Unknown event type: %s", *eventType)
+		}
+		req.EventTypes = []acmv1.AuditEventType{t}
+	}
+	if *site != "" {
+		req.Sites = []string{*site}
+	}
+	if *statusFilter != "" {
+		req.Statuses = []string{*statusFilter}
+	}
+	if *since > 0 {
+		req.FromTime = time.Now().Add(-*since).Unix()
+	}
+
+	conn, err := createClient()
+	if err != nil {
+		log.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	stream, err := acmv1.NewAuditServiceClient(conn).WatchEvents(ctx, req)
+	if err != nil {
+		log.Fatalf("Failed to watch events: %v", err)
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() != nil || err == io.EOF {
+				return
+			}
+			log.Fatalf("Event stream ended: %v", err)
+		}
+
+		if *asJSON {
+			out, _ := json.Marshal(map[string]interface{}{
+				"id":        resp.EventId,
+				"timestamp": resp.Event.Timestamp,
+				"type":      resp.Event.EventType.String(),
+				"status":    resp.Event.Status,
+				"site":      resp.Event.Site,
+				"message":   resp.Message,
+				"replayed":  resp.Replayed,
+			})
+			fmt.Println(string(out))
+			continue
+		}
+
+		marker := " "
+		if resp.Replayed {
+			marker = "↺"
+		}
+		fmt.Printf("%s %s  %-10s %-8s %-24s %s\n",
+			marker,
+			time.Unix(resp.Event.Timestamp, 0).Format(time.RFC3339),
+			strings.TrimPrefix(resp.Event.EventType.String(), "AUDIT_EVENT_TYPE_"),
+			resp.Event.Status,
+			resp.Event.Site,
+			resp.Message,
+		)
+	}
+}
+
+// watchEventTypes maps CLI event type names to proto values
+var watchEventTypes = map[string]acmv1.AuditEventType{
+	"rotation":   acmv1.AuditEventType_AUDIT_EVENT_TYPE_ROTATION,
+	"detection":  acmv1.AuditEventType_AUDIT_EVENT_TYPE_DETECTION,
+	"compliance": acmv1.AuditEventType_AUDIT_EVENT_TYPE_COMPLIANCE_CHECK,
+	"him":        acmv1.AuditEventType_AUDIT_EVENT_TYPE_HIM_PROMPT,
+	"auth":       acmv1.AuditEventType_AUDIT_EVENT_TYPE_AUTHENTICATION,
+}
+
+// loadPublicKey accepts a hex-encoded Ed25519 key or a file containing one
+func loadPublicKey(arg string) (ed25519.PublicKey, error) {
+	value := arg
+	if data, err := os.ReadFile(arg); err == nil {
+		value = string(data)
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("public key must be hex-encoded: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+func treeHeadFromProto(head *acmv1.SignedTreeHead) audit.SignedTreeHead {
+	if head == nil {
+		return audit.SignedTreeHead{}
+	}
+	return audit.SignedTreeHead{
+		TreeSize:  head.TreeSize,
+		Timestamp: time.UnixMilli(head.TimestampMs).UTC(),
+		RootHash:  head.RootHash,
+		Signature: head.Signature,
+	}
+}
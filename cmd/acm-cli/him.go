@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	acmv1 "github.com/ferg-cod3s/automated-compromise-mitigation/api/proto/acm/v1"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/auth"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/him"
+)
+
+// runHIMListen keeps a PromptUser stream open and answers prompts from stdin.
+// Prompts are answered in the order they arrive; "cancel" cancels the
+// current session, "skip" skips its rotation and "show" shows the new
+// password of a manual rotation, once.
+func runHIMListen() {
+	conn, err := createClient()
+	if err != nil {
+		log.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	client := acmv1.NewHIMServiceClient(conn)
+	stream, err := client.PromptUser(ctx)
+	if err != nil {
+		log.Fatalf("Failed to open HIM stream: %v", err)
+	}
+
+	prompts := make(chan *acmv1.HIMPrompt)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			prompt, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			prompts <- prompt
+		}
+	}()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- strings.TrimSpace(scanner.Text())
+		}
+		close(lines)
+	}()
+
+	fmt.Println("Waiting for HIM prompts (Ctrl+C to stop)...")
+
+	var queue []*acmv1.HIMPrompt
+	for {
+		select {
+		case <-ctx.Done():
+			stream.CloseSend()
+			return
+		case err := <-recvErr:
+			if ctx.Err() != nil || err == io.EOF {
+				return
+			}
+			log.Fatalf("HIM stream ended: %v", err)
+		case prompt := <-prompts:
+			// A retry or suggestion replaces any queued prompt for the
+			// same session, keeping its place
+			replaced := false
+			for i, queued := range queue {
+				if queued.SessionId == prompt.SessionId {
+					queue[i] = prompt
+					replaced = true
+					if i == 0 {
+						printHIMPrompt(prompt)
+					}
+					break
+				}
+			}
+			if !replaced {
+				queue = append(queue, prompt)
+				if len(queue) == 1 {
+					printHIMPrompt(prompt)
+				}
+			}
+		case line, ok := <-lines:
+			if !ok {
+				stream.CloseSend()
+				return
+			}
+			if len(queue) == 0 {
+				continue
+			}
+			current := queue[0]
+			if strings.EqualFold(line, "show") && current.Context["password_available"] == "true" {
+				showHIMPassword(ctx, client, current)
+				continue
+			}
+			if line == "" {
+				// An empty line accepts the suggested response, if any
+				if line = current.Context["suggested_response"]; line == "" {
+					continue
+				}
+			}
+			queue = queue[1:]
+			if err := stream.Send(buildHIMResponse(current, line)); err != nil {
+				log.Fatalf("Failed to send response: %v", err)
+			}
+			if len(queue) > 0 {
+				printHIMPrompt(queue[0])
+			}
+		}
+	}
+}
+
+// showHIMPassword shows the new password attached to a prompt's session.
+// The service releases it once, so it can't be shown again.
+func showHIMPassword(ctx context.Context, client acmv1.HIMServiceClient, prompt *acmv1.HIMPrompt) {
+	resp, err := client.ReleasePassword(ctx, &acmv1.ReleasePasswordRequest{
+		SessionId:     prompt.SessionId,
+		SecurityToken: prompt.SecurityToken,
+	})
+	delete(prompt.Context, "password_available")
+	switch {
+	case err != nil:
+		fmt.Printf("Failed to get the new password: %v\n", err)
+	case resp.Status.Code != acmv1.StatusCode_STATUS_CODE_SUCCESS:
+		fmt.Printf("Failed to get the new password: %s\n", resp.Status.Message)
+	default:
+		fmt.Printf("New password: %s\n", resp.Password)
+		fmt.Println("It won't be shown again; enter it on the site now.")
+	}
+	fmt.Print("> ")
+}
+
+// printHIMPrompt displays a prompt. The session ID is shown so the user can
+// match it against the service's own logs; the security token never is.
+func printHIMPrompt(prompt *acmv1.HIMPrompt) {
+	fmt.Println()
+	fmt.Println(strings.Repeat("=", 50))
+	if prompt.IsRetry {
+		fmt.Printf("! Retry: %s\n", prompt.Context["rejected_reason"])
+	}
+	fmt.Printf("ACM needs your input for %s\n", prompt.Site)
+	fmt.Printf("Type:     %s\n", strings.TrimPrefix(prompt.HimType.String(), "HIM_TYPE_"))
+	fmt.Printf("Session:  %s\n", prompt.SessionId)
+	if prompt.TimeoutSeconds > 0 {
+		fmt.Printf("Expires:  in %s\n", time.Duration(prompt.TimeoutSeconds)*time.Second)
+	}
+	if prompt.AttemptsRemaining > 0 {
+		fmt.Printf("Attempts: %d remaining\n", prompt.AttemptsRemaining)
+	}
+	if prompt.ActionUrl != "" {
+		fmt.Printf("URL:      %s\n", prompt.ActionUrl)
+	}
+	fmt.Println()
+	fmt.Println(prompt.Message)
+	if prompt.Context["password_available"] == "true" {
+		fmt.Println("Type \"show\" to see the new password (shown once).")
+	}
+	if suggestion := prompt.Context["suggested_response"]; suggestion != "" {
+		fmt.Printf("Suggested: %s (press Enter to use it)\n", suggestion)
+	}
+	if prompt.ExpectedInputFormat != "" {
+		fmt.Printf("(%s; \"cancel\" or \"skip\" to abort)\n", prompt.ExpectedInputFormat)
+	} else {
+		fmt.Println("(\"cancel\" or \"skip\" to abort)")
+	}
+	fmt.Print("> ")
+}
+
+// buildHIMResponse turns an input line into the response for prompt.
+func buildHIMResponse(prompt *acmv1.HIMPrompt, line string) *acmv1.HIMResponse {
+	resp := &acmv1.HIMResponse{
+		SessionId:         prompt.SessionId,
+		SecurityToken:     prompt.SecurityToken,
+		ResponseTimestamp: time.Now().Unix(),
+	}
+
+	switch strings.ToLower(line) {
+	case "cancel":
+		resp.CancelRequested = true
+		return resp
+	case "skip":
+		resp.SkipRequested = true
+		return resp
+	}
+
+	confirmed := strings.EqualFold(line, "y") || strings.EqualFold(line, "yes")
+	resp.ResponseData = &acmv1.HIMResponseData{
+		TextInput:       line,
+		BooleanInput:    confirmed,
+		ActionCompleted: confirmed && prompt.HimType == acmv1.HIMType_HIM_TYPE_MANUAL_CHANGE,
+	}
+	return resp
+}
+
+// runHIMStatus lists HIM sessions
+func runHIMStatus() {
+	flags := flag.NewFlagSet("him-status", flag.ExitOnError)
+	all := flags.Bool("all", false, "include completed, cancelled and timed out sessions")
+	operation := flags.String("operation", "", "only show sessions for this operation ID")
+	flags.Parse(os.Args[2:])
+
+	conn, err := createClient()
+	if err != nil {
+		log.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	client := acmv1.NewHIMServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	resp, err := client.GetHIMStatus(ctx, &acmv1.HIMStatusRequest{
+		OperationId:      *operation,
+		IncludeCompleted: *all,
+	})
+	if err != nil {
+		log.Fatalf("Failed to get HIM status: %v", err)
+	}
+	if resp.Status.Code != acmv1.StatusCode_STATUS_CODE_SUCCESS {
+		log.Fatalf("Failed to get HIM status: %s", resp.Status.Message)
+	}
+
+	fmt.Printf("%d active HIM session(s)\n", resp.ActiveSessionsCount)
+	if len(resp.Sessions) == 0 {
+		return
+	}
+	fmt.Println()
+	for _, session := range resp.Sessions {
+		fmt.Printf("%s  %-18s %-16s %-24s %s\n",
+			session.SessionId,
+			strings.TrimPrefix(session.HimType.String(), "HIM_TYPE_"),
+			strings.TrimPrefix(session.State.String(), "HIM_STATE_"),
+			session.Site,
+			time.Unix(session.StartedAt, 0).Format(time.RFC3339),
+		)
+	}
+}
+
+// runHIMCancel cancels a pending HIM session
+func runHIMCancel() {
+	if len(os.Args) < 3 {
+		fmt.Fprintf(os.Stderr, "Usage: %s him-cancel <session-id>\n", cliName)
+		os.Exit(1)
+	}
+
+	conn, err := createClient()
+	if err != nil {
+		log.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	client := acmv1.NewHIMServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	resp, err := client.CancelHIM(ctx, &acmv1.CancelHIMRequest{
+		SessionId:          os.Args[2],
+		CancellationReason: "cancelled from CLI",
+	})
+	if err != nil {
+		log.Fatalf("Failed to cancel HIM session: %v", err)
+	}
+	if !resp.Cancelled {
+		log.Fatalf("Failed to cancel HIM session: %s", resp.Status.Message)
+	}
+
+	fmt.Printf("✓ Cancelled HIM session %s\n", resp.SessionId)
+}
+
+// runHIMApprovals lists multi-party approval requests
+func runHIMApprovals() {
+	flags := flag.NewFlagSet("him-approvals", flag.ExitOnError)
+	all := flags.Bool("all", false, "include completed, cancelled and timed out requests")
+	flags.Parse(os.Args[2:])
+
+	conn, err := createClient()
+	if err != nil {
+		log.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	client := acmv1.NewHIMServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	resp, err := client.ListApprovals(ctx, &acmv1.ListApprovalsRequest{IncludeCompleted: *all})
+	if err != nil {
+		log.Fatalf("Failed to list approvals: %v", err)
+	}
+	if resp.Status.Code != acmv1.StatusCode_STATUS_CODE_SUCCESS {
+		log.Fatalf("Failed to list approvals: %s", resp.Status.Message)
+	}
+
+	fmt.Printf("%d approval request(s)\n", len(resp.Requests))
+	for _, req := range resp.Requests {
+		fmt.Printf("\n%s  %-24s %-16s %d/%d approvals",
+			req.SessionId,
+			req.Site,
+			strings.TrimPrefix(req.State.String(), "HIM_STATE_"),
+			len(req.Approvals),
+			req.RequiredApprovals,
+		)
+		if req.Escalated {
+			fmt.Print("  ESCALATED")
+		}
+		if req.CanApprove {
+			fmt.Print("  (you can approve)")
+		}
+		fmt.Println()
+		fmt.Printf("  %s\n", req.Message)
+		fmt.Printf("  Expires: %s\n", time.Unix(req.ExpiresAt, 0).Format(time.RFC3339))
+		for _, a := range req.Approvals {
+			fmt.Printf("  ✓ %s at %s (evidence %s)\n", a.Approver, time.Unix(a.SignedAt, 0).Format(time.RFC3339), a.EvidenceEntryId)
+		}
+	}
+}
+
+// runHIMApprove signs an approval request with the private key of the
+// client certificate and submits it. The server checks the signature
+// against the certificate the connection was made with.
+func runHIMApprove() {
+	flags := flag.NewFlagSet("him-approve", flag.ExitOnError)
+	yes := flags.Bool("yes", false, "approve without asking for confirmation")
+	flags.Parse(os.Args[2:])
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s him-approve [--yes] <session-id>\n", cliName)
+		os.Exit(1)
+	}
+	sessionID := flags.Arg(0)
+
+	clientCert, err := loadClientCertificate()
+	if err != nil {
+		log.Fatalf("Failed to load client certificate: %v", err)
+	}
+	signer, ok := clientCert.PrivateKey.(crypto.Signer)
+	if !ok {
+		log.Fatalf("Client key cannot sign approvals")
+	}
+	leaf, err := x509.ParseCertificate(clientCert.Certificate[0])
+	if err != nil {
+		log.Fatalf("Failed to parse client certificate: %v", err)
+	}
+
+	conn, err := createClient()
+	if err != nil {
+		log.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	client := acmv1.NewHIMServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	list, err := client.ListApprovals(ctx, &acmv1.ListApprovalsRequest{})
+	if err != nil {
+		log.Fatalf("Failed to list approvals: %v", err)
+	}
+	var request *acmv1.ApprovalRequest
+	for _, req := range list.Requests {
+		if req.SessionId == sessionID {
+			request = req
+		}
+	}
+	if request == nil {
+		log.Fatalf("No pending approval request %s", sessionID)
+	}
+	if !request.CanApprove {
+		log.Fatalf("%s may not approve %s", leaf.Subject.CommonName, sessionID)
+	}
+
+	fmt.Printf("Approving as %s:\n\n%s\n\n%s", leaf.Subject.CommonName, request.Message, request.ApprovalPayload)
+	if !*yes {
+		fmt.Print("\nSign this approval? [y/N] ")
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer := strings.ToLower(strings.TrimSpace(line)); answer != "y" && answer != "yes" {
+			fmt.Println("Not approved")
+			return
+		}
+	}
+
+	signedAt := time.Now()
+	signature, err := him.SignApproval(signer, him.ApprovalMessage(request.ApprovalPayload, signedAt))
+	if err != nil {
+		log.Fatalf("Failed to sign approval: %v", err)
+	}
+
+	resp, err := client.Approve(ctx, &acmv1.ApproveRequest{
+		SessionId: sessionID,
+		SignedAt:  signedAt.Unix(),
+		Signature: signature,
+	})
+	if err != nil {
+		log.Fatalf("Failed to approve: %v", err)
+	}
+	if resp.Status.Code != acmv1.StatusCode_STATUS_CODE_SUCCESS {
+		log.Fatalf("Failed to approve: %s", resp.Status.Message)
+	}
+
+	fmt.Printf("✓ %s\n", resp.Status.Message)
+}
+
+// runIssueClientCert issues a personal client certificate, signed by the
+// local CA, for someone who approves HIM requests. The CA key is decrypted
+// with the passphrase acm-service was first started with
+func runIssueClientCert() {
+	if len(os.Args) < 3 {
+		fmt.Fprintf(os.Stderr, "Usage: %s=<passphrase> %s issue-client-cert <name>\n", auth.CAPassphraseEnv, cliName)
+		os.Exit(1)
+	}
+
+	dir, err := certDir()
+	if err != nil {
+		log.Fatalf("Failed to locate certificates: %v", err)
+	}
+	certMgr := auth.NewCertManager(dir)
+	certMgr.SetCAPassphrase([]byte(os.Getenv(auth.CAPassphraseEnv)))
+	certPath, keyPath, err := certMgr.IssueClientCertificate(os.Args[2])
+	if err != nil {
+		log.Fatalf("Failed to issue client certificate: %v", err)
+	}
+
+	fmt.Printf("✓ Issued client certificate for %s\n", os.Args[2])
+	fmt.Printf("  Certificate: %s\n  Key:         %s\n\n", certPath, keyPath)
+	fmt.Println("Give both files to the approver, who uses them with:")
+	fmt.Printf("  ACM_CLIENT_CERT=%s ACM_CLIENT_KEY=%s %s him-approve <session-id>\n", certPath, keyPath, cliName)
+}
+
+// runHIMWeb prints a one-time link that signs a browser in to the prompt
+// page served by acm-service
+func runHIMWeb() {
+	conn, err := createClient()
+	if err != nil {
+		log.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	client := acmv1.NewHIMServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	resp, err := client.GetWebPromptURL(ctx, &acmv1.GetWebPromptURLRequest{})
+	if err != nil {
+		log.Fatalf("Failed to get prompt page link: %v", err)
+	}
+	if resp.Status.Code != acmv1.StatusCode_STATUS_CODE_SUCCESS {
+		log.Fatalf("Failed to get prompt page link: %s", resp.Status.Message)
+	}
+
+	fmt.Println("Open this link in a browser on this machine. It works once, until",
+		time.Unix(resp.ExpiresAt, 0).Format("15:04:05")+":")
+	fmt.Printf("\n  %s\n\n", resp.Url)
+	if dir, err := certDir(); err == nil {
+		fmt.Printf("The page uses the ACM certificate; to avoid a browser warning, trust %s.\n",
+			filepath.Join(dir, "ca-cert.pem"))
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -50,6 +51,28 @@ func main() {
 		runRotate()
 	case "list":
 		runList()
+	case "audit-watch":
+		runAuditWatch()
+	case "audit-sth":
+		runAuditSTH()
+	case "audit-proof":
+		runAuditProof()
+	case "verify-proof":
+		runVerifyProof()
+	case "him-listen":
+		runHIMListen()
+	case "him-status":
+		runHIMStatus()
+	case "him-cancel":
+		runHIMCancel()
+	case "him-web":
+		runHIMWeb()
+	case "him-approvals":
+		runHIMApprovals()
+	case "him-approve":
+		runHIMApprove()
+	case "issue-client-cert":
+		runIssueClientCert()
 	case "version":
 		fmt.Printf("%s version %s\n", cliName, cliVersion)
 	case "help", "--help", "-h":
@@ -61,26 +84,54 @@ func main() {
 	}
 }
 
+// certDir returns the directory holding the ACM certificates
+func certDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".acm", "certs"), nil
+}
+
+// loadClientCertificate loads the client certificate used to connect. It
+// is the shared client certificate unless ACM_CLIENT_CERT and
+// ACM_CLIENT_KEY name a personal one, as issued by issue-client-cert.
+func loadClientCertificate() (tls.Certificate, error) {
+	dir, err := certDir()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	certPath := os.Getenv("ACM_CLIENT_CERT")
+	keyPath := os.Getenv("ACM_CLIENT_KEY")
+	if certPath == "" || keyPath == "" {
+		certPath = filepath.Join(dir, "client-cert.pem")
+		keyPath = filepath.Join(dir, "client-key.pem")
+	}
+
+	clientCert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to load client certificate: %w\nHave you started the ACM service first?", err)
+	}
+	return clientCert, nil
+}
+
 // createClient creates a gRPC client with mTLS
 func createClient() (*grpc.ClientConn, error) {
 	// Get certificate directory
-	home, err := os.UserHomeDir()
+	dir, err := certDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+		return nil, err
 	}
-	certDir := filepath.Join(home, ".acm", "certs")
 
 	// Load client certificate
-	clientCert, err := tls.LoadX509KeyPair(
-		filepath.Join(certDir, "client-cert.pem"),
-		filepath.Join(certDir, "client-key.pem"),
-	)
+	clientCert, err := loadClientCertificate()
 	if err != nil {
-		return nil, fmt.Errorf("failed to load client certificate: %w\nHave you started the ACM service first?", err)
+		return nil, err
 	}
 
 	// Load CA certificate
-	caCert, err := os.ReadFile(filepath.Join(certDir, "ca-cert.pem"))
+	caCert, err := os.ReadFile(filepath.Join(dir, "ca-cert.pem"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
 	}
@@ -190,12 +241,19 @@ func runDetect() {
 
 // runRotate rotates a specific credential
 func runRotate() {
-	if len(os.Args) < 3 {
-		fmt.Fprintf(os.Stderr, "Usage: %s rotate <credential-id-hash>\n", cliName)
+	flags := flag.NewFlagSet("rotate", flag.ExitOnError)
+	guided := flags.Bool("guided", false, "change the password on the site first, guided by a HIM prompt")
+	flags.Parse(os.Args[2:])
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s rotate [--guided] <credential-id-hash>\n", cliName)
 		os.Exit(1)
 	}
 
-	credentialID := os.Args[2]
+	credentialID := flags.Arg(0)
+	mode := acmv1.RotationMode_ROTATION_MODE_AUTOMATED
+	if *guided {
+		mode = acmv1.RotationMode_ROTATION_MODE_GUIDED
+	}
 
 	conn, err := createClient()
 	if err != nil {
@@ -228,11 +286,31 @@ func runRotate() {
 	resp, err := client.RotateCredential(ctx, &acmv1.RotateRequest{
 		CredentialIdHash: credentialID,
 		Policy:           policy,
+		Mode:             mode,
 	})
 	if err != nil {
 		log.Fatalf("Rotation failed: %v", err)
 	}
 
+	if resp.Error.GetCode() == acmv1.ErrorCode_ERROR_CODE_ROTATION_IN_PROGRESS {
+		fmt.Println("⚠ This credential is already being rotated.")
+		fmt.Printf("Holder: %s\n", resp.Error.Context["holder"])
+		fmt.Printf("Started: %s\n", resp.Error.Context["started_at"])
+		fmt.Printf("Lease expires: %s\n", resp.Error.Context["expires_at"])
+		fmt.Println("\nWait for that rotation to finish, or for its lease to expire, and try again.")
+		os.Exit(1)
+	}
+
+	if resp.Status.Code == acmv1.StatusCode_STATUS_CODE_HIM_REQUIRED && resp.OperationId != "" {
+		fmt.Println("⚠ Change the password on the site to finish this rotation.")
+		fmt.Printf("Session: %s\n", resp.OperationId)
+		fmt.Println("\nPlease:")
+		fmt.Printf("  1. Run '%s him-listen' to see the change-password page and the new password\n", cliName)
+		fmt.Println("  2. Change the password on the site")
+		fmt.Println("  3. Answer \"yes\" once the site has accepted it; the vault is updated then")
+		return
+	}
+
 	if resp.Status.Code == acmv1.StatusCode_STATUS_CODE_HIM_REQUIRED {
 		fmt.Println("⚠ Human intervention required!")
 		fmt.Printf("Reason: %s\n", resp.Status.Message)
@@ -300,9 +378,32 @@ Usage:
 Core Commands:
   health                       Check ACM service health
   detect                       Detect compromised credentials
-  rotate <id-hash>             Rotate specific credential
+  rotate [--guided] <id-hash>  Rotate specific credential (--guided: change it on the site first)
   list                         List all credentials (Phase I: limited)
 
+Audit Commands:
+  audit-watch [--type t] [--site s] [--status s] [--from-event id] [--since 1h] [--json]
+                               Stream audit events as they are logged
+  audit-sth                    Show the signed tree head of the audit log
+  audit-proof inclusion <event-id> [tree-size]
+                               Fetch an inclusion proof (JSON) for an event
+  audit-proof consistency <first-size> [second-size]
+                               Fetch a consistency proof (JSON) between tree heads
+  verify-proof <public-key> <proof.json> [event.json]
+                               Verify a proof offline using only the public key,
+                               optionally against a copy of the event
+
+HIM Commands:
+  him-listen                   Answer prompts that need human input as they arrive
+  him-status [--all] [--operation id]
+                               List pending (or all) HIM sessions
+  him-cancel <session-id>      Cancel a pending HIM session
+  him-web                      Print a one-time link to answer prompts in a browser
+  him-approvals [--all]        List multi-party approval requests
+  him-approve <session-id>     Sign and submit your approval of a request
+  issue-client-cert <name>     Issue a personal client certificate for an approver
+                               (use it with ACM_CLIENT_CERT and ACM_CLIENT_KEY)
+
 Other Commands:
   version                      Show version information
   help                         Show this help message
@@ -0,0 +1,270 @@
+// Package main is the native messaging host for the ACM browser extension.
+//
+// The browser starts acm-native-host when the extension connects to it and
+// exchanges length-prefixed JSON messages with it on stdin and stdout (see
+// internal/nativemsg). Each request is relayed to acm-service over mTLS, so
+// the extension can:
+//   - Show the pending HIM prompts for the site in the current tab
+//   - Answer or cancel a prompt in context
+//   - Fill the newly generated password into the site's change-password
+//     form; the service releases it once, and only to a tab on that site
+//
+// Requests carry an id, echoed in the reply, and a type:
+//
+//	{"id": "1", "type": "list_prompts", "origin": "https://github.com"}
+//	{"id": "2", "type": "respond", "session_id": "...", "security_token": "...", "response": "123456"}
+//	{"id": "3", "type": "cancel", "session_id": "...", "security_token": "..."}
+//	{"id": "4", "type": "release_password", "session_id": "...", "security_token": "...", "origin": "https://github.com"}
+//	{"id": "5", "type": "ping"}
+//
+// Replies are {"id": "...", "ok": true, ...} or {"id": "...", "ok": false,
+// "error": "..."}. Nothing but messages may be written to stdout, so the
+// host logs to stderr, which browsers keep in their own logs.
+//
+// Browsers find the host through a manifest; print one with:
+//
+//	acm-native-host manifest chrome <extension-id>
+//	acm-native-host manifest firefox <extension-id>
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	acmv1 "github.com/ferg-cod3s/automated-compromise-mitigation/api/proto/acm/v1"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/auth"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/nativemsg"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// hostName is the name the extension connects to.
+	hostName       = "acm.native_host"
+	serviceAddr    = "127.0.0.1:8443"
+	requestTimeout = 30 * time.Second
+)
+
+// request is a message from the extension.
+type request struct {
+	ID            string `json:"id"`
+	Type          string `json:"type"`
+	Origin        string `json:"origin,omitempty"`
+	SessionID     string `json:"session_id,omitempty"`
+	SecurityToken string `json:"security_token,omitempty"`
+	Response      string `json:"response,omitempty"`
+}
+
+// reply is a message to the extension.
+type reply struct {
+	ID       string   `json:"id"`
+	OK       bool     `json:"ok"`
+	Error    string   `json:"error,omitempty"`
+	Prompts  []prompt `json:"prompts,omitempty"`
+	Password string   `json:"password,omitempty"`
+}
+
+// prompt is a pending HIM prompt as the extension sees it.
+type prompt struct {
+	SessionID         string `json:"session_id"`
+	Site              string `json:"site"`
+	Type              string `json:"type"`
+	Message           string `json:"message"`
+	ActionURL         string `json:"action_url,omitempty"`
+	ExpectedInput     string `json:"expected_input"`
+	ExpiresAt         int64  `json:"expires_at"`
+	AttemptsRemaining int32  `json:"attempts_remaining"`
+	SecurityToken     string `json:"security_token"`
+	Suggested         string `json:"suggested_response,omitempty"`
+	PasswordAvailable bool   `json:"password_available"`
+}
+
+func main() {
+	log.SetOutput(os.Stderr)
+	log.SetPrefix("acm-native-host: ")
+
+	if len(os.Args) > 1 && os.Args[1] == "manifest" {
+		if err := printManifest(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Chrome passes the caller's origin, Firefox the manifest path and the
+	// extension ID; the browser has already checked them against the manifest
+	log.Printf("started by %v", os.Args[1:])
+
+	conn, err := createClient()
+	if err != nil {
+		log.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	if err := serve(os.Stdin, os.Stdout, acmv1.NewHIMServiceClient(conn)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve answers requests from in until the browser closes it. A request
+// that isn't valid JSON is answered with an error; only a broken stream
+// stops the host.
+func serve(in io.Reader, out io.Writer, client acmv1.HIMServiceClient) error {
+	for {
+		var req request
+		var resp reply
+		err := nativemsg.Read(in, &req)
+		switch {
+		case err == io.EOF:
+			return nil
+		case errors.Is(err, nativemsg.ErrMalformedMessage):
+			log.Printf("rejected request: %v", err)
+			resp = reply{Error: "malformed request"}
+		case err != nil:
+			return err
+		default:
+			ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+			resp = handle(ctx, client, req)
+			cancel()
+		}
+
+		resp.ID = req.ID
+		if err := nativemsg.Write(out, resp); err != nil {
+			return err
+		}
+	}
+}
+
+// handle relays one request to acm-service.
+func handle(ctx context.Context, client acmv1.HIMServiceClient, req request) reply {
+	switch req.Type {
+	case "ping":
+		return reply{OK: true}
+
+	case "list_prompts":
+		resp, err := client.ListOriginPrompts(ctx, &acmv1.ListOriginPromptsRequest{Origin: req.Origin})
+		if err != nil {
+			return failed(err)
+		}
+		if resp.Status.Code != acmv1.StatusCode_STATUS_CODE_SUCCESS {
+			return reply{Error: resp.Status.Message}
+		}
+		result := reply{OK: true, Prompts: []prompt{}}
+		for _, p := range resp.Prompts {
+			result.Prompts = append(result.Prompts, prompt{
+				SessionID:         p.SessionId,
+				Site:              p.Site,
+				Type:              p.HimType.String(),
+				Message:           p.Message,
+				ActionURL:         p.ActionUrl,
+				ExpectedInput:     p.ExpectedInputFormat,
+				ExpiresAt:         time.Now().Unix() + p.TimeoutSeconds,
+				AttemptsRemaining: p.AttemptsRemaining,
+				SecurityToken:     p.SecurityToken,
+				Suggested:         p.Context["suggested_response"],
+				PasswordAvailable: p.Context["password_available"] == "true",
+			})
+		}
+		return result
+
+	case "respond", "cancel":
+		resp, err := client.RespondHIM(ctx, &acmv1.HIMResponse{
+			SessionId:         req.SessionID,
+			SecurityToken:     req.SecurityToken,
+			ResponseData:      &acmv1.HIMResponseData{TextInput: req.Response},
+			ResponseTimestamp: time.Now().Unix(),
+			CancelRequested:   req.Type == "cancel",
+		})
+		if err != nil {
+			return failed(err)
+		}
+		if !resp.Accepted {
+			return reply{Error: resp.Status.Message}
+		}
+		return reply{OK: true}
+
+	case "release_password":
+		resp, err := client.ReleasePassword(ctx, &acmv1.ReleasePasswordRequest{
+			SessionId:     req.SessionID,
+			Origin:        req.Origin,
+			SecurityToken: req.SecurityToken,
+		})
+		if err != nil {
+			return failed(err)
+		}
+		if resp.Status.Code != acmv1.StatusCode_STATUS_CODE_SUCCESS {
+			return reply{Error: resp.Status.Message}
+		}
+		// Never log the password itself
+		log.Printf("released password for session %s to %s", req.SessionID, req.Origin)
+		return reply{OK: true, Password: resp.Password}
+
+	default:
+		return reply{Error: fmt.Sprintf("unknown request type %q", req.Type)}
+	}
+}
+
+func failed(err error) reply {
+	log.Printf("request failed: %v", err)
+	return reply{Error: "acm-service request failed; is acm-service running?"}
+}
+
+// createClient creates a gRPC client with mTLS
+func createClient() (*grpc.ClientConn, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	tlsConfig, err := auth.NewCertManager(filepath.Join(home, ".acm", "certs")).GetClientTLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+
+	conn, err := grpc.Dial(serviceAddr, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to service at %s: %w", serviceAddr, err)
+	}
+	return conn, nil
+}
+
+// printManifest prints the native messaging host manifest for a browser.
+func printManifest(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: acm-native-host manifest chrome|firefox <extension-id>")
+	}
+	browser, extensionID := args[0], args[1]
+
+	path, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	manifest := map[string]interface{}{
+		"name":        hostName,
+		"description": "ACM native messaging host",
+		"path":        path,
+		"type":        "stdio",
+	}
+	switch browser {
+	case "chrome", "chromium":
+		manifest["allowed_origins"] = []string{"chrome-extension://" + extensionID + "/"}
+	case "firefox":
+		manifest["allowed_extensions"] = []string{extensionID}
+	default:
+		return fmt.Errorf("unknown browser %q (want chrome or firefox)", browser)
+	}
+
+	out, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
@@ -12,13 +12,16 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"net"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -28,10 +31,14 @@ import (
 	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
 	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/auth"
 	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/crs"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/him"
 	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/logging"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/notify"
 	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/pwmanager"
 	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/pwmanager/bitwarden"
 	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/pwmanager/onepassword"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation/github"
 	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/server"
 )
 
@@ -40,6 +47,14 @@ const (
 	serviceVersion = "0.1.0-dev"
 )
 
+// Audit retention defaults for the live log.
+const (
+	auditRetentionMaxAge    = 30 * 24 * time.Hour
+	auditRetentionMaxEvents = 100000
+	auditRetentionInterval  = time.Hour
+	treeHeadPublishInterval = 10 * time.Minute
+)
+
 func main() {
 	printBanner()
 
@@ -85,6 +100,7 @@ func run(ctx context.Context, logger *logging.Logger) error {
 	// Initialize certificate manager
 	logger.Info("Setting up mTLS certificates", "cert_dir", filepath.Join(dataDir, "certs"))
 	certMgr := auth.NewCertManager(filepath.Join(dataDir, "certs"))
+	certMgr.SetCAPassphrase([]byte(os.Getenv(auth.CAPassphraseEnv)))
 	if err := certMgr.EnsureCertificates(); err != nil {
 		return fmt.Errorf("failed to setup certificates: %w", err)
 	}
@@ -94,14 +110,133 @@ func run(ctx context.Context, logger *logging.Logger) error {
 		return fmt.Errorf("failed to get TLS config: %w", err)
 	}
 
-	// Initialize audit logger (using in-memory for Phase I)
+	// Initialize audit logger (using in-memory for Phase I). The signing key
+	// is kept on disk so archived segments and published tree heads stay
+	// verifiable across restarts.
 	logger.Info("Initializing audit logger")
-	auditLogger, err := audit.NewMemoryLogger()
+	signingKey, err := audit.LoadOrCreateSigningKey(filepath.Join(dataDir, "audit-signing-key.pem"))
+	if err != nil {
+		return fmt.Errorf("failed to load audit signing key: %w", err)
+	}
+	auditLogger, err := audit.NewMemoryLoggerWithKey(signingKey)
 	if err != nil {
 		return fmt.Errorf("failed to create audit logger: %w", err)
 	}
 	defer auditLogger.Close()
 
+	// Optionally encrypt sensitive audit fields under a passphrase-wrapped data key
+	if passphrase := os.Getenv("ACM_AUDIT_PASSPHRASE"); passphrase != "" {
+		dataKey, err := audit.LoadOrCreateDataKey(filepath.Join(dataDir, "audit-data-key.json"), []byte(passphrase))
+		if err != nil {
+			return fmt.Errorf("failed to load audit data key: %w", err)
+		}
+		fieldCipher, err := audit.NewFieldCipher(dataKey)
+		if err != nil {
+			return fmt.Errorf("failed to create audit field cipher: %w", err)
+		}
+		auditLogger.EnableEncryption(fieldCipher)
+		logger.Info("Audit field encryption enabled")
+	}
+
+	// Seal old audit events into signed archive segments
+	archiveDir := filepath.Join(dataDir, "audit-archive")
+	if err := auditLogger.EnableArchive(archiveDir); err != nil {
+		return fmt.Errorf("failed to enable audit archive: %w", err)
+	}
+	go runAuditRetention(ctx, auditLogger, audit.RetentionPolicy{
+		MaxAge:    auditRetentionMaxAge,
+		MaxEvents: auditRetentionMaxEvents,
+	})
+
+	// Periodically publish signed tree heads of the audit transparency log
+	go publishTreeHeads(ctx, auditLogger.TransparencyLog())
+
+	// Optionally forward audit events to a SIEM
+	if dest := os.Getenv("ACM_AUDIT_FORWARD"); dest != "" {
+		sink, err := audit.NewSinkFromURL(dest)
+		if err != nil {
+			return fmt.Errorf("failed to create audit forward sink: %w", err)
+		}
+		forwarder, err := audit.NewForwarder(auditLogger, sink, audit.ForwarderConfig{
+			Format:     audit.ReportFormat(os.Getenv("ACM_AUDIT_FORWARD_FORMAT")),
+			CursorPath: filepath.Join(dataDir, "audit-forward.cursor"),
+		})
+		if err != nil {
+			sink.Close()
+			return fmt.Errorf("failed to create audit forwarder: %w", err)
+		}
+		defer forwarder.Close()
+
+		go forwarder.Run(ctx)
+		logger.Info("Audit forwarding enabled", "destination", dest)
+	}
+
+	// Initialize HIM service
+	himService := him.NewService(0)
+	defer himService.Close()
+
+	// Persist HIM sessions so pending prompts survive a restart
+	stateDB, err := openStateDB(ctx, filepath.Join(dataDir, "state.db"))
+	if err != nil {
+		return err
+	}
+	defer stateDB.Close()
+
+	himStore, err := him.NewSQLiteSessionStore(stateDB)
+	if err != nil {
+		return fmt.Errorf("failed to create HIM session store: %w", err)
+	}
+	restored, expired, err := himService.Restore(ctx, himStore, auditLogger)
+	if err != nil {
+		return fmt.Errorf("failed to restore HIM sessions: %w", err)
+	}
+	logger.Info("HIM sessions restored", "pending", restored, "expired", expired)
+
+	// Optionally offer verification codes found in a local Maildir
+	maildirConfigPath := os.Getenv("ACM_HIM_MAILDIR_CONFIG")
+	if maildirConfigPath == "" {
+		maildirConfigPath = filepath.Join(dataDir, "maildir.json")
+	}
+	if _, err := os.Stat(maildirConfigPath); err == nil {
+		maildirConfig, err := him.LoadMaildirConfig(maildirConfigPath)
+		if err != nil {
+			return err
+		}
+		watcher, err := him.NewMaildirWatcher(maildirConfig)
+		if err != nil {
+			return fmt.Errorf("failed to configure Maildir watcher: %w", err)
+		}
+		watcher.Attach(ctx, himService)
+		logger.Info("Maildir code lookup enabled", "maildir", maildirConfig.Path)
+	}
+
+	// Optionally dispatch notifications for security events and HIM prompts
+	notifyConfigPath := os.Getenv("ACM_NOTIFY_CONFIG")
+	if notifyConfigPath == "" {
+		notifyConfigPath = filepath.Join(dataDir, "notifications.json")
+	}
+	if _, err := os.Stat(notifyConfigPath); err == nil {
+		notifyConfig, err := notify.LoadConfig(notifyConfigPath)
+		if err != nil {
+			return err
+		}
+		routes, err := notifyConfig.Routes()
+		if err != nil {
+			return fmt.Errorf("failed to configure notifications: %w", err)
+		}
+		dispatcher := notify.NewDispatcher(routes)
+		defer dispatcher.Close()
+
+		himService.OnSessionCreated(dispatcher.NotifyHIMSession)
+		himService.OnEscalation(dispatcher.NotifyHIMSession)
+		go func() {
+			if err := dispatcher.WatchAudit(ctx, auditLogger); err != nil {
+				logger.Error("Notification dispatcher stopped", "error", err)
+			}
+		}()
+		logger.Info("Notifications enabled", "config", notifyConfigPath, "sinks", len(routes))
+	}
+
 	// Initialize password manager (try Bitwarden first)
 	logger.Info("Detecting password manager")
 	var pwManager pwmanager.PasswordManager
@@ -127,6 +262,70 @@ func run(ctx context.Context, logger *logging.Logger) error {
 	logger.Info("Initializing Credential Remediation Service")
 	crsService := crs.NewService(pwManager, auditLogger)
 
+	// Guided rotations pause on HIM sessions through the HIM manager
+	himPolicy := him.DefaultPolicy()
+	himPolicyPath := os.Getenv("ACM_HIM_POLICY")
+	if himPolicyPath == "" {
+		himPolicyPath = filepath.Join(dataDir, "him_policy.json")
+	}
+	if _, err := os.Stat(himPolicyPath); err == nil {
+		himPolicy, err = him.LoadPolicy(himPolicyPath)
+		if err != nil {
+			return err
+		}
+		logger.Info("HIM policy loaded", "policy", himPolicyPath)
+	}
+	himManager := him.NewManager(himService, himPolicy, nil)
+	if totp, ok := pwManager.(pwmanager.TOTPGenerator); ok {
+		himManager.SetTOTPSource(totp, auditLogger)
+	}
+	crsService.SetHIMManager(himManager)
+	logger.Info("Guided manual rotation", "enabled", crsService.ManualRotationEnabled())
+
+	// Every rotation step is journaled so interrupted rotations can be
+	// finished or rolled back here, before new ones are accepted
+	journal, err := rotation.NewJournal(stateDB)
+	if err != nil {
+		return fmt.Errorf("failed to open rotation journal: %w", err)
+	}
+	crsService.SetJournal(journal)
+
+	// Rotations lease their credential, so one credential is rotated once
+	// at a time across every process sharing the state database
+	locks, err := rotation.NewLockManager(stateDB)
+	if err != nil {
+		return fmt.Errorf("failed to open rotation locks: %w", err)
+	}
+	crsService.SetLockManager(locks)
+
+	rotationStore, err := rotation.NewSQLiteStateStore(stateDB)
+	if err != nil {
+		return fmt.Errorf("failed to open rotation state store: %w", err)
+	}
+	githubRotator := github.NewRotator(rotationStore, nil)
+	githubRotator.SetJournal(journal)
+	githubRotator.SetLockManager(locks)
+
+	// Rotation providers, served by the generic RotationService RPCs
+	providers := rotation.NewRegistry()
+	if err := providers.Register(githubRotator); err != nil {
+		return err
+	}
+
+	report, err := journal.Recover(ctx, map[string]rotation.Recoverer{
+		crs.JournalProvider: crsService,
+		github.ProviderName: githubRotator,
+	}, auditLogger)
+	if err != nil {
+		return fmt.Errorf("rotation recovery failed: %w", err)
+	}
+	logger.Info("Interrupted rotations recovered",
+		"completed", report.Completed,
+		"rolled_back", report.RolledBack,
+		"resumed", report.Resumed,
+		"failed", report.Failed,
+	)
+
 	// Initialize ACVS (Phase II)
 	logger.Info("Initializing Automated Compliance Validation Service")
 	acvsService, err := acvs.NewService()
@@ -135,6 +334,9 @@ func run(ctx context.Context, logger *logging.Logger) error {
 	}
 	logger.Info("ACVS initialized", "enabled_by_default", false)
 
+	// Multi-party approvals are signed into the ACVS evidence chain
+	himService.SetEvidenceRecorder(acvsService.EvidenceChain())
+
 	// Create gRPC server with mTLS and logging middleware
 	logger.Info("Starting gRPC server with middleware")
 	creds := credentials.NewTLS(tlsConfig)
@@ -162,12 +364,43 @@ func run(ctx context.Context, logger *logging.Logger) error {
 	acvsServer := server.NewACVSServiceServer(acvsService)
 	acmv1.RegisterACVSServiceServer(grpcServer, acvsServer)
 
+	// Audit service
+	auditServer := server.NewAuditServiceServer(auditLogger)
+	acmv1.RegisterAuditServiceServer(grpcServer, auditServer)
+
+	// Rotation service (GitHub PATs)
+	rotationServer := server.NewRotationServiceServer(githubRotator, providers)
+	acmv1.RegisterRotationServiceServer(grpcServer, rotationServer)
+
+	// HIM service
+	himServer := server.NewHIMServiceServer(himService)
+	acmv1.RegisterHIMServiceServer(grpcServer, himServer)
+
+	// Optionally serve HIM prompts to a browser on this machine
+	if webAddr := os.Getenv("ACM_HIM_WEB_ADDR"); webAddr != "" {
+		webTLSConfig, err := certMgr.GetWebTLSConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get web TLS config: %w", err)
+		}
+		webServer, err := him.NewWebServer(himService, webAddr, webTLSConfig)
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := webServer.Serve(ctx); err != nil {
+				logger.Error("HIM web server stopped", "error", err)
+			}
+		}()
+		himServer.SetWebServer(webServer)
+		logger.Info("Browser prompts enabled", "addr", webServer.Addr())
+	}
+
 	// Health service
 	healthServer := &server.HealthServiceServer{}
 	acmv1.RegisterHealthServiceServer(grpcServer, healthServer)
 
 	logger.Info("Services registered",
-		"services", []string{"CredentialService", "ACVSService", "HealthService"},
+		"services", []string{"CredentialService", "ACVSService", "AuditService", "RotationService", "HIMService", "HealthService"},
 	)
 
 	// Start listening
@@ -233,6 +466,87 @@ func run(ctx context.Context, logger *logging.Logger) error {
 	return nil
 }
 
+// runAuditRetention periodically archives old audit events until ctx is cancelled.
+func runAuditRetention(ctx context.Context, archiver audit.Archiver, policy audit.RetentionPolicy) {
+	logger := logging.NewLogger("audit-retention")
+
+	ticker := time.NewTicker(auditRetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		sealed, err := archiver.ApplyRetention(ctx, policy)
+		if err != nil {
+			logger.Error("Audit retention failed", "error", err)
+		}
+		for _, segment := range sealed {
+			logger.Info("Audit segment sealed",
+				"segment_id", segment.ID,
+				"events", segment.EventCount,
+				"merkle_root", segment.MerkleRoot,
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishTreeHeads signs and publishes a new tree head whenever the audit
+// transparency log has grown, until ctx is cancelled.
+func publishTreeHeads(ctx context.Context, tlog *audit.TransparencyLog) {
+	logger := logging.NewLogger("audit-transparency")
+
+	ticker := time.NewTicker(treeHeadPublishInterval)
+	defer ticker.Stop()
+
+	for {
+		head, err := tlog.PublishTreeHead()
+		if err != nil {
+			logger.Error("Failed to publish tree head", "error", err)
+		} else {
+			logger.Debug("Published tree head",
+				"tree_size", head.TreeSize,
+				"root_hash", fmt.Sprintf("%x", head.RootHash),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// openStateDB opens the SQLite database holding daemon state that must
+// survive a restart. The pragmas are part of the DSN so that every pooled
+// connection gets them, not just the first.
+func openStateDB(ctx context.Context, path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	pragmas := url.Values{"_pragma": {
+		"journal_mode(WAL)",
+		"busy_timeout(5000)",
+		"foreign_keys(1)",
+	}}
+	db, err := sql.Open("sqlite", path+"?"+pragmas.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database: %w", err)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open state database: %w", err)
+	}
+
+	return db, nil
+}
+
 // printBanner displays the ACM service banner on startup
 func printBanner() {
 	fmt.Println(`
@@ -70,6 +70,12 @@ func NewService() (*ACVSService, error) {
 	}, nil
 }
 
+// EvidenceChain returns the evidence chain, so other services can record
+// their own evidence in the same tamper-evident log.
+func (s *ACVSService) EvidenceChain() *evidence.ChainGenerator {
+	return s.evidenceChain
+}
+
 // IsEnabled returns whether ACVS is currently enabled.
 func (s *ACVSService) IsEnabled() bool {
 	s.mu.RLock()
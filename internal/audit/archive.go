@@ -0,0 +1,331 @@
+package audit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// segmentFileExt is the file extension of sealed archive segments.
+const segmentFileExt = ".seg.gz"
+
+// DefaultSegmentSize is the maximum number of events sealed into one segment.
+const DefaultSegmentSize = 10000
+
+// RetentionPolicy decides which live events are sealed into archive segments.
+// An event is archived if it is older than MaxAge, or if it falls outside the
+// newest MaxEvents live events. Zero values disable the respective rule.
+type RetentionPolicy struct {
+	// MaxAge is how long events stay in the live log.
+	MaxAge time.Duration
+
+	// MaxEvents is the maximum number of events kept in the live log.
+	MaxEvents int
+
+	// SegmentSize caps the number of events per segment (defaults to DefaultSegmentSize).
+	SegmentSize int
+}
+
+// SegmentHeader describes a sealed archive segment.
+type SegmentHeader struct {
+	// ID uniquely identifies the segment.
+	ID string `json:"id"`
+
+	// StartTime and EndTime are the timestamps of the first and last event.
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+
+	// EventCount is the number of events in the segment.
+	EventCount int `json:"event_count"`
+
+	// MerkleRoot is the hex RFC 6962 root over the segment's events.
+	MerkleRoot string `json:"merkle_root"`
+
+	// SealedAt is when the segment was written.
+	SealedAt time.Time `json:"sealed_at"`
+
+	// PublicKey is the Ed25519 key that signed the segment.
+	PublicKey []byte `json:"public_key"`
+
+	// Signature is the Ed25519 signature over the header fields above.
+	Signature []byte `json:"signature"`
+}
+
+// segmentFile is the on-disk (gzip-compressed JSON) layout of a segment.
+type segmentFile struct {
+	Header SegmentHeader `json:"header"`
+	Events []Event       `json:"events"`
+}
+
+// ArchiveStore manages sealed, compressed and signed archive segments in a
+// directory. Segment headers are indexed in memory when the store is opened.
+type ArchiveStore struct {
+	mu         sync.RWMutex
+	dir        string
+	signingKey ed25519.PrivateKey
+	segments   []SegmentHeader
+}
+
+// NewArchiveStore opens (or creates) an archive directory. Segments are
+// signed with signingKey.
+func NewArchiveStore(dir string, signingKey ed25519.PrivateKey) (*ArchiveStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	store := &ArchiveStore{
+		dir:        dir,
+		signingKey: signingKey,
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), segmentFileExt) {
+			continue
+		}
+		seg, err := readSegmentFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		store.segments = append(store.segments, seg.Header)
+	}
+	store.sortSegments()
+
+	return store, nil
+}
+
+// Segments returns the headers of all sealed segments, oldest first.
+func (s *ArchiveStore) Segments() []SegmentHeader {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]SegmentHeader(nil), s.segments...)
+}
+
+// Seal writes events (sorted by timestamp) to a new signed segment.
+func (s *ArchiveStore) Seal(events []Event) (*SegmentHeader, error) {
+	if len(events) == 0 {
+		return nil, fmt.Errorf("cannot seal an empty segment")
+	}
+
+	root, err := segmentMerkleRoot(events)
+	if err != nil {
+		return nil, err
+	}
+
+	header := SegmentHeader{
+		ID:         newSegmentID(events[0].Timestamp),
+		StartTime:  events[0].Timestamp,
+		EndTime:    events[len(events)-1].Timestamp,
+		EventCount: len(events),
+		MerkleRoot: hex.EncodeToString(root),
+		SealedAt:   time.Now(),
+		PublicKey:  s.signingKey.Public().(ed25519.PublicKey),
+	}
+	header.Signature = ed25519.Sign(s.signingKey, segmentSigningMessage(header))
+
+	if err := writeSegmentFile(s.segmentPath(header.ID), segmentFile{Header: header, Events: events}); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.segments = append(s.segments, header)
+	s.sortSegments()
+	s.mu.Unlock()
+
+	return &header, nil
+}
+
+// Query returns archived events matching filter, oldest first. Only segments
+// overlapping the filter's time range are read. Limit is not applied.
+func (s *ArchiveStore) Query(filter Filter) ([]Event, error) {
+	var results []Event
+	for _, header := range s.Segments() {
+		if !filter.StartTime.IsZero() && header.EndTime.Before(filter.StartTime) {
+			continue
+		}
+		if !filter.EndTime.IsZero() && header.StartTime.After(filter.EndTime) {
+			continue
+		}
+
+		seg, err := readSegmentFile(s.segmentPath(header.ID))
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range seg.Events {
+			if matchesFilter(event, filter) {
+				results = append(results, event)
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// FindEvent looks up an archived event by ID and returns it with the header
+// of the segment that contains it.
+func (s *ArchiveStore) FindEvent(eventID string) (*Event, *SegmentHeader, error) {
+	for _, header := range s.Segments() {
+		seg, err := readSegmentFile(s.segmentPath(header.ID))
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := range seg.Events {
+			if seg.Events[i].ID == eventID {
+				return &seg.Events[i], &seg.Header, nil
+			}
+		}
+	}
+
+	return nil, nil, fmt.Errorf("event not found: %s", eventID)
+}
+
+// VerifySegment checks a segment's header signature and recomputes its
+// Merkle root. If publicKey is nil the store's own signing key is used. The
+// key recorded in the header is never trusted: a segment whose header names
+// a different key is rejected, since anyone able to rewrite the segment
+// could re-sign it with a key of their own.
+func (s *ArchiveStore) VerifySegment(segmentID string, publicKey ed25519.PublicKey) error {
+	seg, err := readSegmentFile(s.segmentPath(segmentID))
+	if err != nil {
+		return err
+	}
+
+	if publicKey == nil {
+		publicKey = s.signingKey.Public().(ed25519.PublicKey)
+	}
+	if !publicKey.Equal(ed25519.PublicKey(seg.Header.PublicKey)) {
+		return fmt.Errorf("segment %s: signed with an unknown key", segmentID)
+	}
+	if len(publicKey) != ed25519.PublicKeySize ||
+		!ed25519.Verify(publicKey, segmentSigningMessage(seg.Header), seg.Header.Signature) {
+		return fmt.Errorf("segment %s: invalid header signature", segmentID)
+	}
+
+	if len(seg.Events) != seg.Header.EventCount {
+		return fmt.Errorf("segment %s: expected %d events, found %d", segmentID, seg.Header.EventCount, len(seg.Events))
+	}
+
+	root, err := segmentMerkleRoot(seg.Events)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(root) != seg.Header.MerkleRoot {
+		return fmt.Errorf("segment %s: Merkle root mismatch", segmentID)
+	}
+
+	return nil
+}
+
+func (s *ArchiveStore) segmentPath(id string) string {
+	return filepath.Join(s.dir, id+segmentFileExt)
+}
+
+// sortSegments orders the index by start time. Caller must hold s.mu.
+func (s *ArchiveStore) sortSegments() {
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].StartTime.Before(s.segments[j].StartTime)
+	})
+}
+
+// segmentMerkleRoot computes the Merkle root over the canonical JSON
+// encoding of each event, so any change to any field alters the root.
+func segmentMerkleRoot(events []Event) ([]byte, error) {
+	leaves := make([][]byte, len(events))
+	for i, event := range events {
+		data, err := eventLeafData(event)
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = MerkleLeafHash(data)
+	}
+	return MerkleTreeHash(leaves), nil
+}
+
+// segmentSigningMessage returns the bytes covered by a segment signature.
+func segmentSigningMessage(h SegmentHeader) []byte {
+	return []byte(fmt.Sprintf("%s|%d|%d|%d|%s|%d",
+		h.ID,
+		h.StartTime.UnixNano(),
+		h.EndTime.UnixNano(),
+		h.EventCount,
+		h.MerkleRoot,
+		h.SealedAt.UnixNano()))
+}
+
+func newSegmentID(start time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("seg-%s-%s", start.UTC().Format("20060102T150405Z"), hex.EncodeToString(suffix))
+}
+
+// writeSegmentFile writes a compressed segment atomically.
+func writeSegmentFile(path string, seg segmentFile) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(seg); err != nil {
+		return fmt.Errorf("failed to encode segment: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress segment: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0400)
+	if err != nil {
+		return fmt.Errorf("failed to create segment: %w", err)
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write segment: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to sync segment: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write segment: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to finalize segment: %w", err)
+	}
+	return nil
+}
+
+func readSegmentFile(path string) (*segmentFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment: %w", err)
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read segment %s: %w", filepath.Base(path), err)
+	}
+	defer zr.Close()
+
+	var seg segmentFile
+	if err := json.NewDecoder(zr).Decode(&seg); err != nil {
+		return nil, fmt.Errorf("failed to decode segment %s: %w", filepath.Base(path), err)
+	}
+	return &seg, nil
+}
@@ -0,0 +1,422 @@
+package audit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newArchiveTestLogger(t *testing.T, n int, base time.Time) *MemoryLogger {
+	t.Helper()
+
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	if err := logger.EnableArchive(t.TempDir()); err != nil {
+		t.Fatalf("Failed to enable archive: %v", err)
+	}
+
+	for i := 0; i < n; i++ {
+		event := Event{
+			Type:         EventTypeRotation,
+			Status:       StatusSuccess,
+			CredentialID: "cred-a",
+			Site:         "github.com",
+			Timestamp:    base.Add(time.Duration(i) * time.Hour),
+		}
+		if err := logger.LogEvent(context.Background(), event); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	return logger
+}
+
+// TestApplyRetentionByCount tests sealing events beyond MaxEvents
+func TestApplyRetentionByCount(t *testing.T) {
+	base := time.Now().Add(-24 * time.Hour)
+	logger := newArchiveTestLogger(t, 10, base)
+	defer logger.Close()
+
+	sealed, err := logger.ApplyRetention(context.Background(), RetentionPolicy{MaxEvents: 4, SegmentSize: 4})
+	if err != nil {
+		t.Fatalf("Failed to apply retention: %v", err)
+	}
+	if len(sealed) != 2 || sealed[0].EventCount != 4 || sealed[1].EventCount != 2 {
+		t.Fatalf("Expected segments of 4 and 2 events, got %+v", sealed)
+	}
+
+	// Live log holds the 4 newest events plus one "segment sealed" event per segment
+	live, _ := logger.QueryEvents(context.Background(), Filter{})
+	if len(live) != 6 {
+		t.Errorf("Expected 6 live events, got %d", len(live))
+	}
+
+	notices, _ := logger.QueryEvents(context.Background(), Filter{EventType: EventTypeSystem})
+	if len(notices) != 2 || notices[0].Metadata["segment_id"] != sealed[0].ID {
+		t.Errorf("Expected segment sealed events, got %+v", notices)
+	}
+	if notices[0].Metadata["merkle_root"] != sealed[0].MerkleRoot {
+		t.Error("Expected sealed event to record the Merkle root")
+	}
+
+	for _, header := range sealed {
+		if err := logger.Archive().VerifySegment(header.ID, logger.PublicKey()); err != nil {
+			t.Errorf("Failed to verify segment %s: %v", header.ID, err)
+		}
+	}
+}
+
+// TestApplyRetentionByAge tests sealing events older than MaxAge
+func TestApplyRetentionByAge(t *testing.T) {
+	base := time.Now().Add(-10 * time.Hour)
+	logger := newArchiveTestLogger(t, 10, base)
+	defer logger.Close()
+
+	sealed, err := logger.ApplyRetention(context.Background(), RetentionPolicy{MaxAge: 5*time.Hour + 30*time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to apply retention: %v", err)
+	}
+	if len(sealed) != 1 || sealed[0].EventCount != 5 {
+		t.Fatalf("Expected one segment of 5 events, got %+v", sealed)
+	}
+
+	// Nothing left to archive
+	sealed, err = logger.ApplyRetention(context.Background(), RetentionPolicy{MaxAge: 5*time.Hour + 30*time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to apply retention: %v", err)
+	}
+	if len(sealed) != 0 {
+		t.Errorf("Expected no new segments, got %d", len(sealed))
+	}
+}
+
+// TestQueryEventsReadsArchive tests that time filters reaching back include archived events
+func TestQueryEventsReadsArchive(t *testing.T) {
+	base := time.Now().Add(-24 * time.Hour)
+	logger := newArchiveTestLogger(t, 10, base)
+	defer logger.Close()
+
+	if _, err := logger.ApplyRetention(context.Background(), RetentionPolicy{MaxEvents: 4}); err != nil {
+		t.Fatalf("Failed to apply retention: %v", err)
+	}
+
+	events, err := logger.QueryEvents(context.Background(), Filter{
+		EventType: EventTypeRotation,
+		StartTime: base.Add(2 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to query events: %v", err)
+	}
+	if len(events) != 8 {
+		t.Errorf("Expected 8 events from archive and live log, got %d", len(events))
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Timestamp.Before(events[i-1].Timestamp) {
+			t.Fatal("Expected events in chronological order")
+		}
+	}
+
+	// An end time alone reaches back into the archive too
+	older, err := logger.QueryEvents(context.Background(), Filter{EventType: EventTypeRotation, EndTime: base.Add(3 * time.Hour)})
+	if err != nil {
+		t.Fatalf("Failed to query events: %v", err)
+	}
+	if len(older) != 4 {
+		t.Errorf("Expected 4 archived events before the end time, got %d", len(older))
+	}
+
+	limited, _ := logger.QueryEvents(context.Background(), Filter{EventType: EventTypeRotation, StartTime: base, Limit: 3})
+	if len(limited) != 3 || !limited[0].Timestamp.Equal(base) {
+		t.Errorf("Expected 3 oldest events, got %d", len(limited))
+	}
+
+	// Archived events still verify
+	valid, err := logger.VerifyIntegrity(context.Background(), events[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to verify archived event: %v", err)
+	}
+	if !valid {
+		t.Error("Expected archived event to verify")
+	}
+}
+
+// TestArchiveStoreReopen tests that segments are indexed when the store is reopened
+func TestArchiveStoreReopen(t *testing.T) {
+	base := time.Now().Add(-24 * time.Hour)
+	logger := newArchiveTestLogger(t, 5, base)
+	defer logger.Close()
+
+	sealed, err := logger.ApplyRetention(context.Background(), RetentionPolicy{MaxEvents: 1})
+	if err != nil {
+		t.Fatalf("Failed to apply retention: %v", err)
+	}
+
+	reopened, err := NewArchiveStore(logger.Archive().dir, logger.signingKey)
+	if err != nil {
+		t.Fatalf("Failed to reopen archive: %v", err)
+	}
+	segments := reopened.Segments()
+	if len(segments) != 1 || segments[0].ID != sealed[0].ID {
+		t.Fatalf("Expected reopened archive to list segment %s, got %+v", sealed[0].ID, segments)
+	}
+}
+
+// TestVerifySegmentDetectsTampering tests that modified archives fail verification
+func TestVerifySegmentDetectsTampering(t *testing.T) {
+	base := time.Now().Add(-24 * time.Hour)
+	logger := newArchiveTestLogger(t, 5, base)
+	defer logger.Close()
+
+	sealed, err := logger.ApplyRetention(context.Background(), RetentionPolicy{MaxEvents: 1})
+	if err != nil {
+		t.Fatalf("Failed to apply retention: %v", err)
+	}
+
+	store := logger.Archive()
+	path := store.segmentPath(sealed[0].ID)
+	seg, err := readSegmentFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read segment: %v", err)
+	}
+
+	// Change a field that is not covered by the per-event signature
+	seg.Events[2].Site = "evil.example"
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	json.NewEncoder(zw).Encode(seg)
+	zw.Close()
+	os.Chmod(path, 0600)
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("Failed to rewrite segment: %v", err)
+	}
+
+	if err := store.VerifySegment(sealed[0].ID, logger.PublicKey()); err == nil {
+		t.Error("Expected tampered segment to fail verification")
+	}
+	if valid, _ := logger.VerifyIntegrity(context.Background(), seg.Events[2].ID); valid {
+		t.Error("Expected event in tampered segment to fail integrity check")
+	}
+}
+
+// TestMerkleTreeHash tests RFC 6962 hashing against known values
+func TestMerkleTreeHash(t *testing.T) {
+	empty := hex.EncodeToString(MerkleTreeHash(nil))
+	if empty != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("Unexpected empty tree hash: %s", empty)
+	}
+
+	leaf := hex.EncodeToString(MerkleLeafHash(nil))
+	if leaf != "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d" {
+		t.Errorf("Unexpected empty leaf hash: %s", leaf)
+	}
+
+	// Three leaves split as ((a, b), c)
+	a, b, c := MerkleLeafHash([]byte("a")), MerkleLeafHash([]byte("b")), MerkleLeafHash([]byte("c"))
+	want := merkleNodeHash(merkleNodeHash(a, b), c)
+	if !bytes.Equal(MerkleTreeHash([][]byte{a, b, c}), want) {
+		t.Error("Unexpected root for three leaves")
+	}
+}
+
+// TestArchiveIgnoresOtherFiles tests that unrelated files in the archive directory are skipped
+func TestArchiveIgnoresOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "README"), []byte("not a segment"), 0600)
+
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	if err := logger.EnableArchive(dir); err != nil {
+		t.Fatalf("Failed to enable archive: %v", err)
+	}
+	if len(logger.Archive().Segments()) != 0 {
+		t.Error("Expected empty archive")
+	}
+}
+
+// TestVerifySegmentRejectsForeignKey tests that a segment re-signed with
+// another key fails verification even though it is internally consistent
+func TestVerifySegmentRejectsForeignKey(t *testing.T) {
+	base := time.Now().Add(-24 * time.Hour)
+	logger := newArchiveTestLogger(t, 5, base)
+	defer logger.Close()
+
+	sealed, err := logger.ApplyRetention(context.Background(), RetentionPolicy{MaxEvents: 1})
+	if err != nil {
+		t.Fatalf("Failed to apply retention: %v", err)
+	}
+
+	store := logger.Archive()
+	path := store.segmentPath(sealed[0].ID)
+	seg, err := readSegmentFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read segment: %v", err)
+	}
+
+	// Rewrite an event and re-sign everything with a key of our own
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	seg.Events[0].Status = StatusFailure
+	seg.Events[0].Signature = ed25519.Sign(privateKey, signingMessage(seg.Events[0]))
+	root, err := segmentMerkleRoot(seg.Events)
+	if err != nil {
+		t.Fatalf("Failed to compute Merkle root: %v", err)
+	}
+	seg.Header.MerkleRoot = hex.EncodeToString(root)
+	seg.Header.PublicKey = publicKey
+	seg.Header.Signature = ed25519.Sign(privateKey, segmentSigningMessage(seg.Header))
+	if err := writeSegmentFile(path, *seg); err != nil {
+		t.Fatalf("Failed to rewrite segment: %v", err)
+	}
+
+	if err := store.VerifySegment(sealed[0].ID, nil); err == nil {
+		t.Error("Expected a segment signed with another key to fail verification")
+	}
+	if valid, _ := logger.VerifyIntegrity(context.Background(), seg.Events[0].ID); valid {
+		t.Error("Expected event in re-signed segment to fail integrity check")
+	}
+}
+
+// TestSigningKeyPersists tests that a reloaded signing key still verifies
+// segments sealed before a restart
+func TestSigningKeyPersists(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "audit-signing-key.pem")
+
+	key, err := LoadOrCreateSigningKey(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to create signing key: %v", err)
+	}
+	if info, err := os.Stat(keyPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected key file with 0600 permissions, got %v (%v)", info, err)
+	}
+
+	logger, err := NewMemoryLoggerWithKey(key)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	if err := logger.EnableArchive(filepath.Join(dir, "archive")); err != nil {
+		t.Fatalf("Failed to enable archive: %v", err)
+	}
+	for i := 2; i > 0; i-- {
+		event := Event{Type: EventTypeRotation, Status: StatusSuccess, Timestamp: time.Now().Add(-time.Duration(i) * time.Hour)}
+		if err := logger.LogEvent(context.Background(), event); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+	sealed, err := logger.ApplyRetention(context.Background(), RetentionPolicy{MaxEvents: 1})
+	if err != nil || len(sealed) != 1 {
+		t.Fatalf("Failed to seal segment: %v", err)
+	}
+
+	reloaded, err := LoadOrCreateSigningKey(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to load signing key: %v", err)
+	}
+	if !reloaded.Equal(key) {
+		t.Fatal("Expected the same key after reloading")
+	}
+	restarted, err := NewMemoryLoggerWithKey(reloaded)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer restarted.Close()
+	if err := restarted.EnableArchive(filepath.Join(dir, "archive")); err != nil {
+		t.Fatalf("Failed to enable archive: %v", err)
+	}
+	if err := restarted.Archive().VerifySegment(sealed[0].ID, nil); err != nil {
+		t.Errorf("Failed to verify segment after restart: %v", err)
+	}
+}
+
+// TestZeroCursorReadsArchive tests that a forwarder and an aggregator
+// starting from scratch include events already sealed into the archive
+func TestZeroCursorReadsArchive(t *testing.T) {
+	base := time.Now().Add(-24 * time.Hour)
+	logger := newArchiveTestLogger(t, 10, base)
+	defer logger.Close()
+
+	if _, err := logger.ApplyRetention(context.Background(), RetentionPolicy{MaxEvents: 4}); err != nil {
+		t.Fatalf("Failed to apply retention: %v", err)
+	}
+
+	dir := t.TempDir()
+	sink, err := NewFileSink(filepath.Join(dir, "siem.log"))
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+	forwarder, err := NewForwarder(logger, sink, ForwarderConfig{
+		Format:     ReportFormatNDJSON,
+		CursorPath: filepath.Join(dir, "forward.cursor"),
+		Filter:     Filter{EventType: EventTypeRotation},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %v", err)
+	}
+	defer forwarder.Close()
+
+	n, err := forwarder.ForwardPending(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to forward events: %v", err)
+	}
+	if n != 10 {
+		t.Errorf("Expected 10 events forwarded from archive and live log, got %d", n)
+	}
+
+	stats, err := NewAggregator(logger).Statistics(context.Background(), time.Time{}, time.Time{}, PeriodNone)
+	if err != nil {
+		t.Fatalf("Failed to compute statistics: %v", err)
+	}
+	if stats.EventsByType[EventTypeRotation] != 10 {
+		t.Errorf("Expected 10 rotations counted, got %d", stats.EventsByType[EventTypeRotation])
+	}
+}
+
+// TestQueryDuringRetention tests that queries running while segments are
+// sealed neither lose nor duplicate events
+func TestQueryDuringRetention(t *testing.T) {
+	base := time.Now().Add(-24 * time.Hour)
+	logger := newArchiveTestLogger(t, 200, base.Add(-200*time.Hour))
+	defer logger.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := logger.ApplyRetention(context.Background(), RetentionPolicy{MaxEvents: 10, SegmentSize: 5})
+		done <- err
+	}()
+
+	filter := Filter{EventType: EventTypeRotation, IncludeArchive: true}
+	for {
+		events, err := logger.QueryEvents(context.Background(), filter)
+		if err != nil {
+			t.Fatalf("Failed to query events: %v", err)
+		}
+		if len(events) != 200 {
+			t.Fatalf("Expected 200 events while sealing, got %d", len(events))
+		}
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Failed to apply retention: %v", err)
+			}
+			return
+		default:
+		}
+	}
+}
@@ -35,9 +35,23 @@
 //
 //   - Credential IDs are always SHA-256 hashed before storage
 //   - Passwords and tokens are NEVER logged (even encrypted)
-//   - Sensitive details fields are encrypted with AES-256-GCM
+//   - Site, username, message and metadata values can be encrypted with
+//     XChaCha20-Poly1305 (see FieldCipher); the field name is bound as
+//     associated data
+//   - Encrypted sites stay searchable through a keyed HMAC blind index, so
+//     Filter.Site works without decrypting every event
+//   - The data key is wrapped with an Argon2id passphrase key and stored
+//     with 0600 permissions (LoadOrCreateDataKey)
 //   - User input is sanitized and masked
 //
+// # Querying
+//
+// A Filter selects events by type, status, credential, time range, site
+// (exact host or registrable domain, eTLD+1), metadata predicates, message
+// substring and username hash. Results are sorted by timestamp in either
+// direction; QueryPage returns an opaque cursor that resumes after the last
+// event of the page, even while new events are being logged.
+//
 // # Compliance Reporting
 //
 // The audit log supports exporting compliance reports in multiple formats:
@@ -47,6 +61,46 @@
 //   - CSV: Spreadsheet-compatible format for analysis
 //   - HTML: Web-viewable format with filtering
 //
+// # SIEM Export
+//
+// Events can also be exported as one record per line for SIEM ingestion:
+// NDJSON, ArcSight CEF and OCSF Account Change events. A Forwarder
+// continuously ships new events to a file, a Unix socket or an RFC 5424
+// syslog receiver, persisting a cursor so events are not sent twice.
+//
+// # Retention and Archival
+//
+// A RetentionPolicy (by age and/or event count) moves old events out of the
+// live log into gzip-compressed archive segments. Each segment header
+// records an RFC 6962 Merkle root over its events and is signed with
+// Ed25519, and a "segment sealed" system event is written to the live log.
+// QueryEvents reads matching archived events when the filter's time range
+// reaches into sealed ranges, or when it sets IncludeArchive; the SIEM
+// forwarder and the statistics aggregator always do. Segments are verified
+// against the logger's own key, which LoadOrCreateSigningKey keeps across
+// restarts.
+//
+// # Transparency Log
+//
+// Every logged event is also appended to an RFC 6962 Merkle tree. Signed
+// tree heads are published periodically, and inclusion proofs (an event is
+// in the tree) and consistency proofs (an older tree is a prefix of a newer
+// one) can be checked offline with only the Ed25519 public key, e.g. with
+// "acm verify-proof". An inclusion proof is bound to its event ID, and can
+// be checked against a copy of the event too. With an archive enabled, leaf
+// hashes are persisted next to the segments, so the tree continues across
+// restarts and consistency proofs link heads published by earlier runs.
+// Hashes of complete subtrees are cached, so heads and proofs cost
+// O(log n) hashes.
+//
+// # Live Subscriptions
+//
+// A Broker fans logged events out to in-process subscribers (and the
+// WatchEvents RPC) with optional type/site/status filters and replay from
+// an event ID or timestamp. Publishing never blocks; a subscriber that
+// falls too far behind is ended with ErrSubscriberLagged and resumes from
+// its last event ID, so no event is dropped silently.
+//
 // # Example Usage
 //
 //	ctx := context.Background()
@@ -0,0 +1,311 @@
+package audit
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// encryptedPrefix marks a field value as ciphertext.
+const encryptedPrefix = "enc:v1:"
+
+// Reserved metadata keys holding the blind indexes of an encrypted event's
+// site and registrable domain. They are removed when the event is decrypted.
+const (
+	siteIndexKey   = "_site_idx"
+	domainIndexKey = "_site_domain_idx"
+)
+
+// Field names bound into the ciphertext as associated data, so a value
+// cannot be moved from one field to another.
+const (
+	fieldSite     = "site"
+	fieldUsername = "username"
+	fieldMessage  = "message"
+	fieldMetadata = "metadata:"
+)
+
+// DataKeySize is the size of an audit data encryption key.
+const DataKeySize = chacha20poly1305.KeySize
+
+// ErrDecryptionFailed is returned when a field cannot be decrypted with the
+// configured key.
+var ErrDecryptionFailed = errors.New("failed to decrypt audit field")
+
+// FieldCipher encrypts the sensitive fields of audit events (site,
+// username, message and metadata values) with XChaCha20-Poly1305, and
+// computes keyed blind indexes so encrypted sites can still be matched.
+type FieldCipher struct {
+	aead     cipher.AEAD
+	indexKey []byte
+}
+
+// NewFieldCipher creates a cipher from a data key. Separate encryption and
+// blind-index keys are derived from it.
+func NewFieldCipher(dataKey []byte) (*FieldCipher, error) {
+	if len(dataKey) != DataKeySize {
+		return nil, fmt.Errorf("data key must be %d bytes, got %d", DataKeySize, len(dataKey))
+	}
+
+	aead, err := chacha20poly1305.NewX(deriveKey(dataKey, "acm-audit-field-encryption-v1"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return &FieldCipher{
+		aead:     aead,
+		indexKey: deriveKey(dataKey, "acm-audit-blind-index-v1"),
+	}, nil
+}
+
+// EncryptEvent returns a copy of event with its sensitive fields encrypted
+// and the site blind index recorded in metadata.
+func (c *FieldCipher) EncryptEvent(event Event) (Event, error) {
+	var err error
+	out := event
+
+	siteIndex, domainIndex := "", ""
+	if event.Site != "" {
+		siteIndex = c.BlindIndex(event.Site)
+		domainIndex = c.blindIndex("domain", RegistrableDomain(event.Site))
+	}
+
+	if out.Site, err = c.encryptField(event.Site, fieldSite); err != nil {
+		return event, err
+	}
+	if out.Username, err = c.encryptField(event.Username, fieldUsername); err != nil {
+		return event, err
+	}
+	if out.Message, err = c.encryptField(event.Message, fieldMessage); err != nil {
+		return event, err
+	}
+
+	if len(event.Metadata) > 0 || siteIndex != "" {
+		out.Metadata = make(map[string]string, len(event.Metadata)+2)
+		for k, v := range event.Metadata {
+			if out.Metadata[k], err = c.encryptField(v, fieldMetadata+k); err != nil {
+				return event, err
+			}
+		}
+		if siteIndex != "" {
+			out.Metadata[siteIndexKey] = siteIndex
+			out.Metadata[domainIndexKey] = domainIndex
+		}
+	}
+
+	return out, nil
+}
+
+// DecryptEvent reverses EncryptEvent. Fields that are not encrypted are
+// returned unchanged, so plaintext events pass through.
+func (c *FieldCipher) DecryptEvent(event Event) (Event, error) {
+	var err error
+	out := event
+
+	if out.Site, err = c.decryptField(event.Site, fieldSite); err != nil {
+		return event, err
+	}
+	if out.Username, err = c.decryptField(event.Username, fieldUsername); err != nil {
+		return event, err
+	}
+	if out.Message, err = c.decryptField(event.Message, fieldMessage); err != nil {
+		return event, err
+	}
+
+	if len(event.Metadata) > 0 {
+		out.Metadata = make(map[string]string, len(event.Metadata))
+		for k, v := range event.Metadata {
+			if k == siteIndexKey || k == domainIndexKey {
+				continue
+			}
+			if out.Metadata[k], err = c.decryptField(v, fieldMetadata+k); err != nil {
+				return event, err
+			}
+		}
+		if len(out.Metadata) == 0 {
+			out.Metadata = nil
+		}
+	}
+
+	return out, nil
+}
+
+// BlindIndex returns a keyed, deterministic index of a site name. Sites are
+// normalized first (see NormalizeSite).
+func (c *FieldCipher) BlindIndex(site string) string {
+	return c.blindIndex("site", NormalizeSite(site))
+}
+
+// MatchesSite reports whether a stored (possibly encrypted) event is for
+// site, without decrypting it.
+func (c *FieldCipher) MatchesSite(stored Event, site string, mode SiteMatch) bool {
+	if !IsEncryptedField(stored.Site) {
+		return siteMatches(stored.Site, site, mode)
+	}
+	if mode == SiteMatchDomain {
+		want := c.blindIndex("domain", RegistrableDomain(site))
+		return hmac.Equal([]byte(stored.Metadata[domainIndexKey]), []byte(want))
+	}
+	return hmac.Equal([]byte(stored.Metadata[siteIndexKey]), []byte(c.BlindIndex(site)))
+}
+
+func (c *FieldCipher) blindIndex(kind, value string) string {
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(kind + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// IsEncryptedField reports whether a field value is ciphertext.
+func IsEncryptedField(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+func (c *FieldCipher) encryptField(plaintext, field string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), []byte(field))
+	return encryptedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *FieldCipher) decryptField(value, field string) (string, error) {
+	if !IsEncryptedField(value) {
+		return value, nil
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return "", fmt.Errorf("%w: malformed %s", ErrDecryptionFailed, strings.TrimSuffix(field, ":"))
+	}
+
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, []byte(field))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrDecryptionFailed, strings.TrimSuffix(field, ":"))
+	}
+	return string(plaintext), nil
+}
+
+// deriveKey derives a purpose-specific subkey from the data key.
+func deriveKey(dataKey []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// Argon2id parameters for wrapping the data key with a passphrase.
+const (
+	kekTime    = 3
+	kekMemory  = 64 * 1024
+	kekThreads = 4
+)
+
+// wrappedDataKey is the on-disk form of an envelope-encrypted data key.
+type wrappedDataKey struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	WrappedKey []byte `json:"wrapped_key"`
+}
+
+// LoadOrCreateDataKey returns the audit data key stored at path, unwrapping
+// it with a key derived from passphrase (Argon2id). If the file does not
+// exist a new random data key is generated, wrapped and written with 0600
+// permissions.
+func LoadOrCreateDataKey(path string, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase is required")
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createDataKey(path, passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data key: %w", err)
+	}
+
+	var wrapped wrappedDataKey
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, fmt.Errorf("failed to parse data key file: %w", err)
+	}
+	if wrapped.Version != 1 || wrapped.KDF != "argon2id" {
+		return nil, fmt.Errorf("unsupported data key file version %d (%s)", wrapped.Version, wrapped.KDF)
+	}
+
+	kek, err := chacha20poly1305.NewX(passphraseKey(passphrase, wrapped.Salt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key wrapping cipher: %w", err)
+	}
+	if len(wrapped.WrappedKey) < kek.NonceSize() {
+		return nil, fmt.Errorf("data key file is corrupt")
+	}
+
+	nonce, ciphertext := wrapped.WrappedKey[:kek.NonceSize()], wrapped.WrappedKey[kek.NonceSize():]
+	dataKey, err := kek.Open(nil, nonce, ciphertext, []byte("acm-audit-data-key-v1"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key (wrong passphrase?)")
+	}
+	return dataKey, nil
+}
+
+func createDataKey(path string, passphrase []byte) ([]byte, error) {
+	dataKey := make([]byte, DataKeySize)
+	salt := make([]byte, 16)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	kek, err := chacha20poly1305.NewX(passphraseKey(passphrase, salt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key wrapping cipher: %w", err)
+	}
+	nonce := make([]byte, kek.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	data, err := json.MarshalIndent(wrappedDataKey{
+		Version:    1,
+		KDF:        "argon2id",
+		Salt:       salt,
+		WrappedKey: kek.Seal(nonce, nonce, dataKey, []byte("acm-audit-data-key-v1")),
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode data key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write data key: %w", err)
+	}
+
+	return dataKey, nil
+}
+
+func passphraseKey(passphrase, salt []byte) []byte {
+	return argon2.IDKey(passphrase, salt, kekTime, kekMemory, kekThreads, chacha20poly1305.KeySize)
+}
@@ -0,0 +1,229 @@
+package audit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestFieldCipher(t *testing.T) *FieldCipher {
+	t.Helper()
+
+	key := make([]byte, DataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	cipher, err := NewFieldCipher(key)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %v", err)
+	}
+	return cipher
+}
+
+// TestFieldCipherRoundTrip tests encrypting and decrypting event fields
+func TestFieldCipherRoundTrip(t *testing.T) {
+	cipher := newTestFieldCipher(t)
+
+	event := Event{
+		ID:       "evt-1",
+		Type:     EventTypeRotation,
+		Status:   StatusSuccess,
+		Site:     "github.com",
+		Username: "alice",
+		Message:  "Rotated credential",
+		Metadata: map[string]string{"reason": "breach"},
+	}
+
+	encrypted, err := cipher.EncryptEvent(event)
+	if err != nil {
+		t.Fatalf("Failed to encrypt event: %v", err)
+	}
+	for name, value := range map[string]string{
+		"site":     encrypted.Site,
+		"username": encrypted.Username,
+		"message":  encrypted.Message,
+		"metadata": encrypted.Metadata["reason"],
+	} {
+		if !IsEncryptedField(value) {
+			t.Errorf("Expected %s to be encrypted, got %q", name, value)
+		}
+	}
+	if encrypted.Metadata[siteIndexKey] == "" {
+		t.Error("Expected site blind index in metadata")
+	}
+
+	decrypted, err := cipher.DecryptEvent(encrypted)
+	if err != nil {
+		t.Fatalf("Failed to decrypt event: %v", err)
+	}
+	if decrypted.Site != event.Site || decrypted.Username != event.Username || decrypted.Message != event.Message {
+		t.Errorf("Round trip mismatch: %+v", decrypted)
+	}
+	if len(decrypted.Metadata) != 1 || decrypted.Metadata["reason"] != "breach" {
+		t.Errorf("Unexpected metadata after decryption: %v", decrypted.Metadata)
+	}
+}
+
+// TestFieldCipherRejectsTampering tests wrong keys and swapped fields
+func TestFieldCipherRejectsTampering(t *testing.T) {
+	cipher := newTestFieldCipher(t)
+
+	encrypted, err := cipher.EncryptEvent(Event{Site: "github.com", Username: "alice"})
+	if err != nil {
+		t.Fatalf("Failed to encrypt event: %v", err)
+	}
+
+	t.Run("wrong key", func(t *testing.T) {
+		other := newTestFieldCipher(t)
+		if _, err := other.DecryptEvent(encrypted); !errors.Is(err, ErrDecryptionFailed) {
+			t.Errorf("Expected ErrDecryptionFailed, got %v", err)
+		}
+	})
+
+	t.Run("swapped fields", func(t *testing.T) {
+		swapped := encrypted
+		swapped.Site, swapped.Username = encrypted.Username, encrypted.Site
+		if _, err := cipher.DecryptEvent(swapped); !errors.Is(err, ErrDecryptionFailed) {
+			t.Errorf("Expected ErrDecryptionFailed, got %v", err)
+		}
+	})
+
+	t.Run("plaintext passthrough", func(t *testing.T) {
+		plain := Event{Site: "github.com"}
+		decrypted, err := cipher.DecryptEvent(plain)
+		if err != nil || decrypted.Site != "github.com" {
+			t.Errorf("Expected plaintext passthrough, got %q, %v", decrypted.Site, err)
+		}
+	})
+}
+
+// TestEncryptedLoggerQuery tests site lookups by blind index, including archived events
+func TestEncryptedLoggerQuery(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	archiveDir := t.TempDir()
+	if err := logger.EnableArchive(archiveDir); err != nil {
+		t.Fatalf("Failed to enable archive: %v", err)
+	}
+	logger.EnableEncryption(newTestFieldCipher(t))
+
+	base := time.Now().Add(-24 * time.Hour)
+	sites := []string{"github.com", "gitlab.com", "github.com", "example.com"}
+	for i, site := range sites {
+		event := Event{
+			Type:      EventTypeRotation,
+			Status:    StatusSuccess,
+			Site:      site,
+			Username:  "alice@example.org",
+			Timestamp: base.Add(time.Duration(i) * time.Hour),
+		}
+		if err := logger.LogEvent(context.Background(), event); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	// Stored events must not contain plaintext
+	logger.mu.RLock()
+	for _, stored := range logger.events {
+		if strings.Contains(stored.Site, ".com") || strings.Contains(stored.Username, "alice") {
+			t.Errorf("Stored event contains plaintext: %+v", stored)
+		}
+	}
+	logger.mu.RUnlock()
+
+	events, err := logger.QueryEvents(context.Background(), Filter{Site: "github.com"})
+	if err != nil {
+		t.Fatalf("Failed to query events: %v", err)
+	}
+	if len(events) != 2 || events[0].Site != "github.com" || events[0].Username != "alice@example.org" {
+		t.Fatalf("Expected 2 decrypted github.com events, got %+v", events)
+	}
+
+	// Archive the oldest events and query across segments
+	if _, err := logger.ApplyRetention(context.Background(), RetentionPolicy{MaxEvents: 1}); err != nil {
+		t.Fatalf("Failed to apply retention: %v", err)
+	}
+	events, err = logger.QueryEvents(context.Background(), Filter{Site: "github.com", StartTime: base})
+	if err != nil {
+		t.Fatalf("Failed to query archive: %v", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("Expected 2 archived github.com events, got %d", len(events))
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(archiveDir, "*.seg.gz"))
+	for _, path := range segments {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Failed to open segment: %v", err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("Failed to read segment: %v", err)
+		}
+		data, _ := io.ReadAll(zr)
+		f.Close()
+		if bytes.Contains(data, []byte("github.com")) || bytes.Contains(data, []byte("alice")) {
+			t.Errorf("Segment %s contains plaintext", filepath.Base(path))
+		}
+	}
+
+	// Inclusion proofs still verify against the plaintext leaf
+	proof, err := logger.EventInclusionProof(context.Background(), events[0].ID, 0)
+	if err != nil {
+		t.Fatalf("Failed to build inclusion proof: %v", err)
+	}
+	if err := proof.Verify(logger.PublicKey()); err != nil {
+		t.Errorf("Failed to verify inclusion proof: %v", err)
+	}
+}
+
+// TestLoadOrCreateDataKey tests persisting and unwrapping the data key
+func TestLoadOrCreateDataKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit-data-key.json")
+
+	key, err := LoadOrCreateDataKey(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Failed to create data key: %v", err)
+	}
+	if len(key) != DataKeySize {
+		t.Fatalf("Expected %d-byte key, got %d", DataKeySize, len(key))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat key file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, key) {
+		t.Error("Key file contains the raw data key")
+	}
+
+	again, err := LoadOrCreateDataKey(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Failed to reload data key: %v", err)
+	}
+	if !bytes.Equal(key, again) {
+		t.Error("Reloaded key differs from the original")
+	}
+
+	if _, err := LoadOrCreateDataKey(path, []byte("wrong")); err == nil {
+		t.Error("Expected wrong passphrase to fail")
+	}
+}
@@ -0,0 +1,260 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// SiteMatch selects how Filter.Site is compared with event sites.
+type SiteMatch string
+
+const (
+	// SiteMatchExact matches the same host name.
+	SiteMatchExact SiteMatch = ""
+
+	// SiteMatchDomain matches any host with the same registrable domain
+	// (eTLD+1), so "github.com" matches "api.github.com".
+	SiteMatchDomain SiteMatch = "domain"
+)
+
+// SortOrder specifies the order of query results.
+type SortOrder string
+
+const (
+	// SortAscending returns the oldest events first (the default).
+	SortAscending SortOrder = "asc"
+
+	// SortDescending returns the newest events first.
+	SortDescending SortOrder = "desc"
+)
+
+// MetadataOp is the comparison applied by a MetadataPredicate.
+type MetadataOp string
+
+const (
+	// MetadataEquals requires the key to be present with exactly Value.
+	MetadataEquals MetadataOp = "eq"
+
+	// MetadataNotEquals requires the key to be absent or differ from Value.
+	MetadataNotEquals MetadataOp = "ne"
+
+	// MetadataExists requires the key to be present.
+	MetadataExists MetadataOp = "exists"
+
+	// MetadataContains requires the value to contain Value (case-insensitive).
+	MetadataContains MetadataOp = "contains"
+)
+
+// MetadataPredicate is a condition on one event metadata key. An empty Op
+// means MetadataEquals.
+type MetadataPredicate struct {
+	Key   string
+	Op    MetadataOp
+	Value string
+}
+
+// ErrInvalidCursor is returned for a malformed cursor, or one issued for a
+// different sort order.
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// Page is one page of query results.
+type Page struct {
+	Events []Event
+
+	// NextCursor fetches the following page; empty on the last page.
+	NextCursor string
+}
+
+// HashUsername returns the hex SHA-256 of a username, for use in
+// Filter.UsernameHash.
+func HashUsername(username string) string {
+	hash := sha256.Sum256([]byte(username))
+	return hex.EncodeToString(hash[:])
+}
+
+// NormalizeSite reduces a site name or URL to a lowercase host name.
+func NormalizeSite(site string) string {
+	site = strings.ToLower(strings.TrimSpace(site))
+	if i := strings.Index(site, "://"); i >= 0 {
+		site = site[i+3:]
+	}
+	if i := strings.IndexAny(site, "/?#"); i >= 0 {
+		site = site[:i]
+	}
+	if i := strings.LastIndex(site, "@"); i >= 0 {
+		site = site[i+1:]
+	}
+	if host, _, err := net.SplitHostPort(site); err == nil {
+		site = host
+	}
+	return strings.TrimSuffix(site, ".")
+}
+
+// RegistrableDomain returns the eTLD+1 of a site, or the normalized host if
+// it has none (IP addresses, single-label names).
+func RegistrableDomain(site string) string {
+	host := NormalizeSite(site)
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return domain
+	}
+	return host
+}
+
+// siteMatches compares an event site with a filter site.
+func siteMatches(eventSite, filterSite string, mode SiteMatch) bool {
+	if mode == SiteMatchDomain {
+		return RegistrableDomain(eventSite) == RegistrableDomain(filterSite)
+	}
+	return NormalizeSite(eventSite) == NormalizeSite(filterSite)
+}
+
+// matches reports whether metadata satisfies the predicate.
+func (p MetadataPredicate) matches(metadata map[string]string) bool {
+	value, ok := metadata[p.Key]
+	switch p.Op {
+	case MetadataExists:
+		return ok
+	case MetadataNotEquals:
+		return !ok || value != p.Value
+	case MetadataContains:
+		return ok && strings.Contains(strings.ToLower(value), strings.ToLower(p.Value))
+	default:
+		return ok && value == p.Value
+	}
+}
+
+// matchesFilter applies every predicate of filter to a plaintext event.
+// Order, Cursor and Limit are applied separately by paginate.
+func matchesFilter(event Event, filter Filter) bool {
+	if filter.EventType != "" && event.Type != filter.EventType {
+		return false
+	}
+	if filter.Status != "" && event.Status != filter.Status {
+		return false
+	}
+	if filter.CredentialID != "" && event.CredentialID != filter.CredentialID {
+		return false
+	}
+	if len(filter.EventTypes) > 0 && !containsValue(filter.EventTypes, event.Type) {
+		return false
+	}
+	if len(filter.Statuses) > 0 && !containsValue(filter.Statuses, event.Status) {
+		return false
+	}
+	if len(filter.CredentialIDs) > 0 && !containsValue(filter.CredentialIDs, event.CredentialID) {
+		return false
+	}
+	if filter.Site != "" && !siteMatches(event.Site, filter.Site, filter.SiteMatch) {
+		return false
+	}
+	if filter.UsernameHash != "" && !strings.EqualFold(HashUsername(event.Username), filter.UsernameHash) {
+		return false
+	}
+	if filter.MessageContains != "" && !strings.Contains(strings.ToLower(event.Message), strings.ToLower(filter.MessageContains)) {
+		return false
+	}
+	for _, predicate := range filter.Metadata {
+		if !predicate.matches(event.Metadata) {
+			return false
+		}
+	}
+	if !filter.StartTime.IsZero() && event.Timestamp.Before(filter.StartTime) {
+		return false
+	}
+	if !filter.EndTime.IsZero() && event.Timestamp.After(filter.EndTime) {
+		return false
+	}
+	return true
+}
+
+// pageCursor is the decoded form of a pagination cursor: the position of
+// the last event returned.
+type pageCursor struct {
+	Timestamp int64     `json:"t"`
+	EventID   string    `json:"id"`
+	Order     SortOrder `json:"o"`
+}
+
+func encodeCursor(event Event, order SortOrder) string {
+	data, _ := json.Marshal(pageCursor{
+		Timestamp: event.Timestamp.UnixNano(),
+		EventID:   event.ID,
+		Order:     order,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string, order SortOrder) (pageCursor, error) {
+	var c pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(data, &c) != nil || c.EventID == "" {
+		return c, ErrInvalidCursor
+	}
+	if c.Order != order {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// paginate sorts matched events, skips past filter.Cursor and applies
+// filter.Limit. Events with equal timestamps keep their logging order.
+func paginate(events []Event, filter Filter) (*Page, error) {
+	order := filter.Order
+	if order == "" {
+		order = SortAscending
+	}
+	if order != SortAscending && order != SortDescending {
+		return nil, fmt.Errorf("unsupported sort order: %s", order)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	if order == SortDescending {
+		for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+			events[i], events[j] = events[j], events[i]
+		}
+	}
+
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter.Cursor, order)
+		if err != nil {
+			return nil, err
+		}
+		position := time.Unix(0, c.Timestamp)
+
+		start := len(events)
+		for i, event := range events {
+			if event.ID == c.EventID {
+				start = i + 1
+				break
+			}
+			beyond := event.Timestamp.After(position)
+			if order == SortDescending {
+				beyond = event.Timestamp.Before(position)
+			}
+			if beyond {
+				start = i
+				break
+			}
+		}
+		events = events[start:]
+	}
+
+	page := &Page{Events: events}
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		page.Events = events[:filter.Limit]
+		page.NextCursor = encodeCursor(page.Events[filter.Limit-1], order)
+	}
+	return page, nil
+}
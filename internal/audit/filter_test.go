@@ -0,0 +1,190 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newFilterTestLogger(t *testing.T) *MemoryLogger {
+	t.Helper()
+
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	base := time.Now().Add(-time.Hour)
+	events := []Event{
+		{Site: "github.com", Username: "alice", Message: "Rotated GitHub token", Metadata: map[string]string{"action": "rotate", "provider": "github"}},
+		{Site: "https://api.github.com/v3", Username: "bob", Message: "API key revoked", Metadata: map[string]string{"action": "revoke"}},
+		{Site: "GitLab.com", Username: "alice", Message: "Password changed"},
+		{Type: EventTypeDetection, Status: StatusFailure, Site: "example.co.uk", Username: "carol", Message: "Breach detected", Metadata: map[string]string{"action": "detect", "source": "hibp"}},
+		{Site: "login.example.co.uk:8443", Username: "carol", Message: "Manual rotation pending"},
+	}
+	for i, event := range events {
+		if event.Type == "" {
+			event.Type = EventTypeRotation
+			event.Status = StatusSuccess
+		}
+		event.CredentialID = fmt.Sprintf("cred-%d", i)
+		event.Timestamp = base.Add(time.Duration(i) * time.Minute)
+		if err := logger.LogEvent(context.Background(), event); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+	return logger
+}
+
+// TestQueryFilters tests site, metadata, message and username predicates
+func TestQueryFilters(t *testing.T) {
+	logger := newFilterTestLogger(t)
+	defer logger.Close()
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"exact site", Filter{Site: "github.com"}, []string{"Rotated GitHub token"}},
+		{"exact site is case-insensitive", Filter{Site: "gitlab.com"}, []string{"Password changed"}},
+		{"exact site from URL", Filter{Site: "https://api.github.com"}, []string{"API key revoked"}},
+		{"registrable domain", Filter{Site: "github.com", SiteMatch: SiteMatchDomain}, []string{"Rotated GitHub token", "API key revoked"}},
+		{"multi-label public suffix", Filter{Site: "www.example.co.uk", SiteMatch: SiteMatchDomain}, []string{"Breach detected", "Manual rotation pending"}},
+		{"metadata equals", Filter{Metadata: []MetadataPredicate{{Key: "action", Op: MetadataEquals, Value: "revoke"}}}, []string{"API key revoked"}},
+		{"metadata exists", Filter{Metadata: []MetadataPredicate{{Key: "source", Op: MetadataExists}}}, []string{"Breach detected"}},
+		{"metadata not equals", Filter{Metadata: []MetadataPredicate{{Key: "action", Op: MetadataNotEquals, Value: "rotate"}}}, []string{"API key revoked", "Password changed", "Breach detected", "Manual rotation pending"}},
+		{"metadata contains", Filter{Metadata: []MetadataPredicate{{Key: "provider", Op: MetadataContains, Value: "HUB"}}}, []string{"Rotated GitHub token"}},
+		{"message substring", Filter{MessageContains: "ROTAT"}, []string{"Rotated GitHub token", "Manual rotation pending"}},
+		{"username hash", Filter{UsernameHash: HashUsername("carol")}, []string{"Breach detected", "Manual rotation pending"}},
+		{"combined", Filter{UsernameHash: HashUsername("alice"), MessageContains: "password"}, []string{"Password changed"}},
+		{"any event type", Filter{EventTypes: []EventType{EventTypeDetection, EventTypeHIM}}, []string{"Breach detected"}},
+		{"any status", Filter{Statuses: []EventStatus{StatusFailure, StatusPending}}, []string{"Breach detected"}},
+		{"any credential", Filter{CredentialIDs: []string{"cred-0", "cred-2"}}, []string{"Rotated GitHub token", "Password changed"}},
+		{"lists combine", Filter{CredentialIDs: []string{"cred-0", "cred-3"}, EventTypes: []EventType{EventTypeRotation}}, []string{"Rotated GitHub token"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := logger.QueryEvents(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("Failed to query events: %v", err)
+			}
+			if len(events) != len(tt.want) {
+				t.Fatalf("Expected %d events, got %d", len(tt.want), len(events))
+			}
+			for i, event := range events {
+				if event.Message != tt.want[i] {
+					t.Errorf("Event %d: expected %q, got %q", i, tt.want[i], event.Message)
+				}
+			}
+		})
+	}
+}
+
+// TestQueryPagination tests sort order and cursor pagination
+func TestQueryPagination(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	// Log out of order, with a run of identical timestamps
+	base := time.Now().Add(-time.Hour)
+	offsets := []int{3, 0, 5, 2, 2, 2, 1, 4}
+	for i, offset := range offsets {
+		event := Event{
+			Type:      EventTypeSystem,
+			Status:    StatusSuccess,
+			Message:   fmt.Sprint(i),
+			Timestamp: base.Add(time.Duration(offset) * time.Minute),
+		}
+		if err := logger.LogEvent(context.Background(), event); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	collect := func(order SortOrder) []string {
+		var got []string
+		filter := Filter{Order: order, Limit: 3}
+		for pages := 0; ; pages++ {
+			if pages > len(offsets) {
+				t.Fatal("Pagination did not terminate")
+			}
+			page, err := logger.QueryPage(context.Background(), filter)
+			if err != nil {
+				t.Fatalf("Failed to query page: %v", err)
+			}
+			for _, event := range page.Events {
+				got = append(got, event.Message)
+			}
+			if page.NextCursor == "" {
+				return got
+			}
+			filter.Cursor = page.NextCursor
+		}
+	}
+
+	if got := fmt.Sprint(collect(SortAscending)); got != "[1 6 3 4 5 0 7 2]" {
+		t.Errorf("Unexpected ascending order: %s", got)
+	}
+	if got := fmt.Sprint(collect(SortDescending)); got != "[2 7 0 5 4 3 6 1]" {
+		t.Errorf("Unexpected descending order: %s", got)
+	}
+
+	t.Run("cursor survives new events", func(t *testing.T) {
+		page, _ := logger.QueryPage(context.Background(), Filter{Limit: 4})
+		logger.LogEvent(context.Background(), Event{Type: EventTypeSystem, Status: StatusSuccess, Message: "late", Timestamp: base})
+
+		next, err := logger.QueryPage(context.Background(), Filter{Limit: 4, Cursor: page.NextCursor})
+		if err != nil {
+			t.Fatalf("Failed to query page: %v", err)
+		}
+		if next.Events[0].Message != "5" {
+			t.Errorf("Expected page to resume at event 5, got %q", next.Events[0].Message)
+		}
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		page, _ := logger.QueryPage(context.Background(), Filter{Limit: 2})
+
+		if _, err := logger.QueryPage(context.Background(), Filter{Cursor: "not-a-cursor"}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Expected ErrInvalidCursor, got %v", err)
+		}
+		if _, err := logger.QueryPage(context.Background(), Filter{Order: SortDescending, Cursor: page.NextCursor}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Expected ErrInvalidCursor for mismatched order, got %v", err)
+		}
+	})
+}
+
+// TestEncryptedDomainFilter tests eTLD+1 matching through blind indexes
+func TestEncryptedDomainFilter(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	logger.EnableEncryption(newTestFieldCipher(t))
+
+	for _, site := range []string{"github.com", "gist.github.com", "gitlab.com"} {
+		if err := logger.LogEvent(context.Background(), Event{Type: EventTypeRotation, Status: StatusSuccess, Site: site, Metadata: map[string]string{"site": site}}); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	events, err := logger.QueryEvents(context.Background(), Filter{Site: "www.github.com", SiteMatch: SiteMatchDomain})
+	if err != nil {
+		t.Fatalf("Failed to query events: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 github.com events, got %d", len(events))
+	}
+
+	events, _ = logger.QueryEvents(context.Background(), Filter{Metadata: []MetadataPredicate{{Key: "site", Value: "gitlab.com"}}})
+	if len(events) != 1 || events[0].Site != "gitlab.com" {
+		t.Errorf("Expected metadata match on decrypted value, got %+v", events)
+	}
+}
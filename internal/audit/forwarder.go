@@ -0,0 +1,448 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/logging"
+)
+
+// DefaultForwardInterval is how often a running Forwarder polls for new events.
+const DefaultForwardInterval = 5 * time.Second
+
+// ForwardSink delivers encoded SIEM records to a destination.
+type ForwardSink interface {
+	// Send delivers a single encoded record for event.
+	Send(event Event, record []byte) error
+
+	// Close releases the sink's resources.
+	Close() error
+}
+
+// ForwarderConfig configures a Forwarder.
+type ForwarderConfig struct {
+	// Format is the SIEM format records are encoded in (ndjson, cef or ocsf).
+	Format ReportFormat
+
+	// CursorPath is where the forwarding position is persisted. If empty the
+	// cursor is kept in memory only and forwarding restarts from the
+	// beginning after a restart.
+	CursorPath string
+
+	// Interval is the polling interval used by Run.
+	Interval time.Duration
+
+	// Filter restricts which events are forwarded. StartTime is managed by
+	// the cursor and Limit is ignored.
+	Filter Filter
+}
+
+// ForwardCursor records the position of the last forwarded event.
+//
+// Events are forwarded in timestamp order. EventIDs lists the events already
+// forwarded at exactly Timestamp so that events sharing a timestamp are not
+// sent twice. Events logged later with a timestamp before the cursor are not
+// forwarded.
+type ForwardCursor struct {
+	Timestamp time.Time `json:"timestamp"`
+	EventIDs  []string  `json:"event_ids,omitempty"`
+}
+
+// Forwarder continuously forwards new audit events to a SIEM sink.
+type Forwarder struct {
+	mu     sync.Mutex
+	logger Logger
+	sink   ForwardSink
+	config ForwarderConfig
+	cursor ForwardCursor
+	seen   map[string]bool
+	closed bool
+}
+
+// ErrForwarderClosed is returned by ForwardPending after Close.
+var ErrForwarderClosed = errors.New("audit forwarder closed")
+
+// NewForwarder creates a forwarder and loads its persisted cursor.
+func NewForwarder(logger Logger, sink ForwardSink, config ForwarderConfig) (*Forwarder, error) {
+	if config.Format == "" {
+		config.Format = ReportFormatNDJSON
+	}
+	if !IsStreamFormat(config.Format) {
+		return nil, fmt.Errorf("unsupported SIEM format: %s", config.Format)
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultForwardInterval
+	}
+
+	f := &Forwarder{
+		logger: logger,
+		sink:   sink,
+		config: config,
+		seen:   make(map[string]bool),
+	}
+
+	if config.CursorPath != "" {
+		cursor, err := loadForwardCursor(config.CursorPath)
+		if err != nil {
+			return nil, err
+		}
+		f.cursor = cursor
+		for _, id := range cursor.EventIDs {
+			f.seen[id] = true
+		}
+	}
+
+	return f, nil
+}
+
+// Cursor returns the current forwarding position.
+func (f *Forwarder) Cursor() ForwardCursor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cursor := f.cursor
+	cursor.EventIDs = append([]string(nil), f.cursor.EventIDs...)
+	return cursor
+}
+
+// ForwardPending sends every event logged since the cursor and returns the
+// number of events forwarded, including events already sealed into the
+// archive. The cursor is persisted after each event, so a failure part-way
+// through resumes from the first unsent event.
+func (f *Forwarder) ForwardPending(ctx context.Context) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, ErrForwarderClosed
+	}
+
+	filter := f.config.Filter
+	filter.StartTime = f.cursor.Timestamp
+	filter.IncludeArchive = true
+	filter.Limit = 0
+
+	events, err := f.logger.QueryEvents(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query events: %w", err)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+
+	sent := 0
+	for _, event := range events {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+		if event.Timestamp.Equal(f.cursor.Timestamp) && f.seen[event.ID] {
+			continue
+		}
+
+		record, err := EncodeEvent(event, f.config.Format)
+		if err != nil {
+			return sent, fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+		}
+		if err := f.sink.Send(event, record); err != nil {
+			return sent, fmt.Errorf("failed to forward event %s: %w", event.ID, err)
+		}
+
+		f.advance(event)
+		if err := f.saveCursor(); err != nil {
+			return sent + 1, err
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// Run forwards events every Interval until ctx is cancelled. Delivery errors
+// are logged and retried on the next tick.
+func (f *Forwarder) Run(ctx context.Context) error {
+	log := logging.NewLogger("audit-forwarder")
+
+	ticker := time.NewTicker(f.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := f.ForwardPending(ctx); err != nil {
+			if ctx.Err() != nil || errors.Is(err, ErrForwarderClosed) {
+				return nil
+			}
+			log.Warn("Failed to forward audit events", "error", err, "forwarded", n)
+		} else if n > 0 {
+			log.Debug("Forwarded audit events", "count", n, "format", string(f.config.Format))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the underlying sink, waiting for a forward in progress to
+// finish. A running Run returns at its next poll.
+func (f *Forwarder) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	return f.sink.Close()
+}
+
+// advance moves the cursor past event. Caller must hold f.mu.
+func (f *Forwarder) advance(event Event) {
+	if event.Timestamp.After(f.cursor.Timestamp) {
+		f.cursor.Timestamp = event.Timestamp
+		f.cursor.EventIDs = nil
+		f.seen = make(map[string]bool)
+	}
+	f.cursor.EventIDs = append(f.cursor.EventIDs, event.ID)
+	f.seen[event.ID] = true
+}
+
+// saveCursor persists the cursor atomically. Caller must hold f.mu.
+func (f *Forwarder) saveCursor() error {
+	if f.config.CursorPath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(f.cursor)
+	if err != nil {
+		return fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	tmp := f.config.CursorPath + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write cursor: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write cursor: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync cursor: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write cursor: %w", err)
+	}
+
+	if err := os.Rename(tmp, f.config.CursorPath); err != nil {
+		return fmt.Errorf("failed to replace cursor: %w", err)
+	}
+	return nil
+}
+
+func loadForwardCursor(path string) (ForwardCursor, error) {
+	var cursor ForwardCursor
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cursor, nil
+	}
+	if err != nil {
+		return cursor, fmt.Errorf("failed to read cursor: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, fmt.Errorf("failed to parse cursor %s: %w", path, err)
+	}
+	return cursor, nil
+}
+
+// NewSinkFromURL creates a sink from a destination URL:
+//
+//	file:///var/log/acm/audit.log   (or a bare path)
+//	unix:///run/siem.sock
+//	syslog://siem.example:514       (UDP)
+//	syslog+tcp://siem.example:6514
+func NewSinkFromURL(raw string) (ForwardSink, error) {
+	if !strings.Contains(raw, "://") {
+		return NewFileSink(raw)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid forward destination %q: %w", raw, err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewFileSink(u.Path)
+	case "unix":
+		return NewUnixSink(u.Path), nil
+	case "syslog", "syslog+udp":
+		return NewSyslogSink("udp", u.Host, ""), nil
+	case "syslog+tcp":
+		return NewSyslogSink("tcp", u.Host, ""), nil
+	default:
+		return nil, fmt.Errorf("unsupported forward destination scheme: %s", u.Scheme)
+	}
+}
+
+// FileSink appends records, one per line, to a local file.
+type FileSink struct {
+	file *os.File
+}
+
+// NewFileSink opens (or creates) path for appending.
+func NewFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	return &FileSink{file: file}, nil
+}
+
+// Send appends record and syncs it to disk.
+func (s *FileSink) Send(event Event, record []byte) error {
+	if _, err := s.file.Write(append(record, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// UnixSink writes records, one per line, to a Unix stream socket. The
+// connection is re-established on the next send after a failure.
+type UnixSink struct {
+	path string
+	conn net.Conn
+}
+
+// NewUnixSink creates a sink for the socket at path. It connects lazily.
+func NewUnixSink(path string) *UnixSink {
+	return &UnixSink{path: path}
+}
+
+// Send writes record to the socket.
+func (s *UnixSink) Send(event Event, record []byte) error {
+	return sendWithReconnect(&s.conn, "unix", s.path, append(record, '\n'))
+}
+
+// Close closes the socket connection.
+func (s *UnixSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// Syslog facility used for forwarded events (13: log audit).
+const syslogFacilityAudit = 13
+
+// SyslogSink sends records to an RFC 5424 syslog receiver over UDP or TCP.
+// TCP messages use octet-counting framing (RFC 6587).
+type SyslogSink struct {
+	network  string
+	address  string
+	appName  string
+	hostname string
+	conn     net.Conn
+}
+
+// NewSyslogSink creates a syslog sink. An empty appName defaults to "acm".
+func NewSyslogSink(network, address, appName string) *SyslogSink {
+	if appName == "" {
+		appName = "acm"
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	return &SyslogSink{
+		network:  network,
+		address:  address,
+		appName:  appName,
+		hostname: hostname,
+	}
+}
+
+// Send formats record as an RFC 5424 message and sends it.
+func (s *SyslogSink) Send(event Event, record []byte) error {
+	msg := formatRFC5424(event, record, s.hostname, s.appName)
+	if s.network == "tcp" {
+		msg = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+	}
+	return sendWithReconnect(&s.conn, s.network, s.address, msg)
+}
+
+// Close closes the syslog connection.
+func (s *SyslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// formatRFC5424 builds a syslog message with record as the MSG part.
+func formatRFC5424(event Event, record []byte, hostname, appName string) []byte {
+	severity := 5 // notice
+	if event.Status == StatusFailure {
+		severity = 4 // warning
+	}
+
+	msgID := string(event.Type)
+	if msgID == "" {
+		msgID = "-"
+	}
+
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s - ",
+		syslogFacilityAudit*8+severity,
+		event.Timestamp.UTC().Format(time.RFC3339Nano),
+		hostname,
+		appName,
+		os.Getpid(),
+		msgID)
+
+	return append([]byte(header), record...)
+}
+
+// sendWithReconnect writes data on *conn, dialing first if needed. On a write
+// failure the connection is dropped so the next call redials.
+func sendWithReconnect(conn *net.Conn, network, address string, data []byte) error {
+	if *conn == nil {
+		c, err := net.DialTimeout(network, address, 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", address, err)
+		}
+		*conn = c
+	}
+
+	(*conn).SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := (*conn).Write(data); err != nil {
+		(*conn).Close()
+		*conn = nil
+		return fmt.Errorf("failed to write to %s: %w", address, err)
+	}
+	return nil
+}
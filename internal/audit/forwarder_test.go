@@ -0,0 +1,202 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestForwarderCursor tests that a restarted forwarder does not resend events
+func TestForwarderCursor(t *testing.T) {
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "siem.log")
+	cursorPath := filepath.Join(dir, "forward.cursor")
+
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	ts := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	logEvents := func(n int) {
+		for i := 0; i < n; i++ {
+			// Share a timestamp to exercise the same-timestamp dedupe
+			if err := logger.LogEvent(context.Background(), Event{Type: EventTypeRotation, Status: StatusSuccess, Timestamp: ts}); err != nil {
+				t.Fatalf("Failed to log event: %v", err)
+			}
+		}
+	}
+
+	forward := func() int {
+		sink, err := NewFileSink(outPath)
+		if err != nil {
+			t.Fatalf("Failed to create sink: %v", err)
+		}
+		forwarder, err := NewForwarder(logger, sink, ForwarderConfig{Format: ReportFormatNDJSON, CursorPath: cursorPath})
+		if err != nil {
+			t.Fatalf("Failed to create forwarder: %v", err)
+		}
+		defer forwarder.Close()
+
+		n, err := forwarder.ForwardPending(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to forward events: %v", err)
+		}
+		return n
+	}
+
+	logEvents(2)
+	if n := forward(); n != 2 {
+		t.Errorf("Expected 2 events forwarded, got %d", n)
+	}
+	if n := forward(); n != 0 {
+		t.Errorf("Expected no events after restart, got %d", n)
+	}
+
+	logEvents(1)
+	ts = ts.Add(time.Minute)
+	logEvents(1)
+	if n := forward(); n != 2 {
+		t.Errorf("Expected 2 new events forwarded, got %d", n)
+	}
+
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 4 {
+		t.Errorf("Expected 4 lines in output, got %d", len(lines))
+	}
+}
+
+// TestForwarderCloseWhileRunning tests that Close doesn't race a running forwarder
+func TestForwarderCloseWhileRunning(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	for i := 0; i < 50; i++ {
+		logger.LogEvent(context.Background(), Event{Type: EventTypeRotation, Status: StatusSuccess})
+	}
+
+	sink, err := NewFileSink(filepath.Join(t.TempDir(), "siem.log"))
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+	forwarder, err := NewForwarder(logger, sink, ForwarderConfig{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- forwarder.Run(context.Background()) }()
+
+	if err := forwarder.Close(); err != nil {
+		t.Fatalf("Failed to close forwarder: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected Run to stop cleanly, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for Run to stop after Close")
+	}
+
+	if _, err := forwarder.ForwardPending(context.Background()); !errors.Is(err, ErrForwarderClosed) {
+		t.Errorf("Expected ErrForwarderClosed, got %v", err)
+	}
+}
+
+// TestForwarderUnixSocket tests forwarding to a Unix socket
+func TestForwarderUnixSocket(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "siem.sock")
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Skipf("Unix sockets unavailable: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	logger.LogEvent(context.Background(), Event{Type: EventTypeDetection, Status: StatusSuccess, Message: "breach"})
+
+	sink, err := NewSinkFromURL("unix://" + sockPath)
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+	forwarder, err := NewForwarder(logger, sink, ForwarderConfig{Format: ReportFormatCEF})
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %v", err)
+	}
+	defer forwarder.Close()
+
+	if _, err := forwarder.ForwardPending(context.Background()); err != nil {
+		t.Fatalf("Failed to forward events: %v", err)
+	}
+
+	select {
+	case line := <-received:
+		if !strings.HasPrefix(line, "CEF:0|") {
+			t.Errorf("Expected CEF record, got %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for record")
+	}
+}
+
+// TestSyslogSink tests RFC 5424 framing over UDP
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP unavailable: %v", err)
+	}
+	defer conn.Close()
+
+	sink := NewSyslogSink("udp", conn.LocalAddr().String(), "acm-test")
+	defer sink.Close()
+
+	event := Event{ID: "evt-1", Type: EventTypeRotation, Status: StatusFailure, Timestamp: time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)}
+	if err := sink.Send(event, []byte(`{"id":"evt-1"}`)); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to read datagram: %v", err)
+	}
+
+	msg := string(buf[:n])
+	// facility 13 (log audit) * 8 + severity 4 (warning) = 108
+	if !strings.HasPrefix(msg, "<108>1 2025-03-10T09:00:00Z ") {
+		t.Errorf("Unexpected syslog header: %q", msg)
+	}
+	if !strings.Contains(msg, " acm-test ") || !strings.HasSuffix(msg, ` rotation - {"id":"evt-1"}`) {
+		t.Errorf("Unexpected syslog message: %q", msg)
+	}
+}
@@ -2,6 +2,7 @@ package audit
 
 import (
 	"context"
+	"crypto/ed25519"
 )
 
 // Logger provides audit logging capabilities with cryptographic signatures.
@@ -12,6 +13,10 @@ type Logger interface {
 	// QueryEvents retrieves events matching the specified filter.
 	QueryEvents(ctx context.Context, filter Filter) ([]Event, error)
 
+	// QueryPage retrieves one page of matching events and a cursor for the
+	// next page.
+	QueryPage(ctx context.Context, filter Filter) (*Page, error)
+
 	// VerifyIntegrity verifies the cryptographic signature of an event.
 	VerifyIntegrity(ctx context.Context, eventID string) (bool, error)
 
@@ -21,3 +26,37 @@ type Logger interface {
 	// Close closes the audit logger and releases resources.
 	Close() error
 }
+
+// ReportExporter is implemented by loggers that can render compliance
+// reports with a caller-supplied title and metadata.
+type ReportExporter interface {
+	// ExportReportWithOptions generates a report using the given options
+	// and returns it with the number of events it includes.
+	ExportReportWithOptions(ctx context.Context, filter Filter, format ReportFormat, opts ReportOptions) ([]byte, int, error)
+}
+
+// Archiver is implemented by loggers that can seal old events into signed
+// archive segments.
+type Archiver interface {
+	// ApplyRetention archives live events selected by policy.
+	ApplyRetention(ctx context.Context, policy RetentionPolicy) ([]SegmentHeader, error)
+}
+
+// TransparencyProvider is implemented by loggers that maintain a Merkle
+// transparency log over their events.
+type TransparencyProvider interface {
+	// TransparencyLog returns the underlying transparency log.
+	TransparencyLog() *TransparencyLog
+
+	// EventInclusionProof proves that an event is included in the log.
+	EventInclusionProof(ctx context.Context, eventID string, treeSize int64) (*InclusionProof, error)
+
+	// PublicKey returns the key that signs tree heads.
+	PublicKey() ed25519.PublicKey
+}
+
+// Watcher is implemented by loggers that can stream events as they are logged.
+type Watcher interface {
+	// Subscribe starts a live subscription, optionally replaying history first.
+	Subscribe(ctx context.Context, opts SubscribeOptions) (*Subscription, error)
+}
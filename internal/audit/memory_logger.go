@@ -1,13 +1,17 @@
 package audit
 
 import (
+	"bytes"
 	"context"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 )
@@ -15,25 +19,45 @@ import (
 // MemoryLogger implements Logger using in-memory storage.
 // This is suitable for Phase I testing. Phase II will use SQLite.
 type MemoryLogger struct {
-	mu         sync.RWMutex
-	events     []Event
-	signingKey ed25519.PrivateKey
-	publicKey  ed25519.PublicKey
+	mu          sync.RWMutex
+	retentionMu sync.Mutex // serializes ApplyRetention
+	events      []Event
+	signingKey  ed25519.PrivateKey
+	publicKey   ed25519.PublicKey
+	archive     *ArchiveStore
+	tlog        *TransparencyLog
+	broker      *Broker
+	cipher      *FieldCipher
 }
 
-// NewMemoryLogger creates a new in-memory audit logger.
+// NewMemoryLogger creates a new in-memory audit logger with a fresh
+// signing key. Use NewMemoryLoggerWithKey to keep signatures verifiable
+// across restarts.
 func NewMemoryLogger() (*MemoryLogger, error) {
 	// Generate signing keys
-	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate keys: %w", err)
 	}
+	return NewMemoryLoggerWithKey(privateKey)
+}
+
+// NewMemoryLoggerWithKey creates a new in-memory audit logger that signs
+// with signingKey (see LoadOrCreateSigningKey).
+func NewMemoryLoggerWithKey(signingKey ed25519.PrivateKey) (*MemoryLogger, error) {
+	if len(signingKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid signing key size %d", len(signingKey))
+	}
 
-	return &MemoryLogger{
+	logger := &MemoryLogger{
 		events:     make([]Event, 0),
-		signingKey: privateKey,
-		publicKey:  publicKey,
-	}, nil
+		signingKey: signingKey,
+		publicKey:  signingKey.Public().(ed25519.PublicKey),
+		tlog:       NewTransparencyLog(signingKey),
+	}
+	logger.broker = NewBroker(logger, DefaultBrokerCapacity)
+
+	return logger, nil
 }
 
 // LogEvent logs an event to the audit trail with a cryptographic signature.
@@ -51,57 +75,119 @@ func (l *MemoryLogger) LogEvent(ctx context.Context, event Event) error {
 		event.Timestamp = time.Now()
 	}
 
+	// Decrypted metadata is nil when empty; normalize so the transparency
+	// log leaf can be reproduced from the stored event
+	if len(event.Metadata) == 0 {
+		event.Metadata = nil
+	}
+
 	// Create signature
-	message := fmt.Sprintf("%s|%d|%s|%s|%s",
-		event.ID,
-		event.Timestamp.Unix(),
-		event.CredentialID,
-		event.Type,
-		event.Status)
-	event.Signature = ed25519.Sign(l.signingKey, []byte(message))
+	event.Signature = ed25519.Sign(l.signingKey, signingMessage(event))
+
+	stored := event
+	if l.cipher != nil {
+		var err error
+		if stored, err = l.cipher.EncryptEvent(event); err != nil {
+			return fmt.Errorf("failed to encrypt event: %w", err)
+		}
+	}
+
+	// Add to the transparency log before the event becomes visible
+	if err := l.tlog.Append(event); err != nil {
+		return err
+	}
 
 	// Append to events
-	l.events = append(l.events, event)
+	l.events = append(l.events, stored)
+
+	// Notify subscribers (never blocks)
+	l.broker.Publish(event)
 
 	return nil
 }
 
-// QueryEvents retrieves events matching the specified filter.
+// QueryEvents retrieves events matching the specified filter. See QueryPage.
 func (l *MemoryLogger) QueryEvents(ctx context.Context, filter Filter) ([]Event, error) {
+	page, err := l.QueryPage(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return page.Events, nil
+}
+
+// QueryPage retrieves one page of events matching the specified filter. If
+// an archive is enabled and the filter's time range (StartTime, EndTime or
+// both) overlaps sealed segments, matching events are read from them too; a
+// filter without a time range reads only the live log unless IncludeArchive
+// is set. Encrypted events are returned decrypted.
+//
+// Archive segments are read without holding the logger lock, so logging is
+// not blocked by archive I/O.
+func (l *MemoryLogger) QueryPage(ctx context.Context, filter Filter) (*Page, error) {
 	l.mu.RLock()
-	defer l.mu.RUnlock()
+	live := append([]Event(nil), l.events...)
+	archive, cipher := l.archive, l.cipher
+	l.mu.RUnlock()
 
+	// The live snapshot is taken before the archive is read: an event being
+	// sealed concurrently is then in the snapshot, the archive or both,
+	// never neither.
 	var results []Event
-	for _, event := range l.events {
-		if matchesFilter(event, filter) {
-			results = append(results, event)
+	archivedIDs := make(map[string]bool)
+	if archive != nil && reachesArchive(archive.Segments(), filter) {
+		archiveFilter := filter
+		if cipher != nil {
+			// Encrypted fields can only be matched after decryption
+			archiveFilter = Filter{StartTime: filter.StartTime, EndTime: filter.EndTime}
 		}
-		if filter.Limit > 0 && len(results) >= filter.Limit {
-			break
+		archived, err := archive.Query(archiveFilter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query archive: %w", err)
+		}
+		for _, stored := range archived {
+			archivedIDs[stored.ID] = true
+			event, ok, err := matchStored(cipher, stored, filter)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				results = append(results, event)
+			}
 		}
 	}
 
-	return results, nil
+	for _, stored := range live {
+		if archivedIDs[stored.ID] {
+			continue
+		}
+		event, ok, err := matchStored(cipher, stored, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			results = append(results, event)
+		}
+	}
+
+	return paginate(results, filter)
 }
 
 // VerifyIntegrity verifies the cryptographic signature of an event.
 func (l *MemoryLogger) VerifyIntegrity(ctx context.Context, eventID string) (bool, error) {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
+	event, archive, found := l.findLive(eventID)
+	if found {
+		return ed25519.Verify(l.publicKey, signingMessage(event), event.Signature), nil
+	}
 
-	for _, event := range l.events {
-		if event.ID == eventID {
-			// Recreate the message
-			message := fmt.Sprintf("%s|%d|%s|%s|%s",
-				event.ID,
-				event.Timestamp.Unix(),
-				event.CredentialID,
-				event.Type,
-				event.Status)
-
-			// Verify signature
-			return ed25519.Verify(l.publicKey, []byte(message), event.Signature), nil
+	if archive != nil {
+		event, header, err := archive.FindEvent(eventID)
+		if err != nil {
+			return false, err
 		}
+		if err := archive.VerifySegment(header.ID, l.publicKey); err != nil {
+			return false, nil
+		}
+		return ed25519.Verify(l.publicKey, signingMessage(*event), event.Signature), nil
 	}
 
 	return false, fmt.Errorf("event not found: %s", eventID)
@@ -109,46 +195,314 @@ func (l *MemoryLogger) VerifyIntegrity(ctx context.Context, eventID string) (boo
 
 // ExportReport generates a compliance report for the specified time range.
 func (l *MemoryLogger) ExportReport(ctx context.Context, filter Filter, format ReportFormat) ([]byte, error) {
+	content, _, err := l.ExportReportWithOptions(ctx, filter, format, ReportOptions{})
+	return content, err
+}
+
+// ExportReportWithOptions generates a compliance report with a custom title
+// and metadata, and returns it with the number of events it includes.
+// Signatures are verified with the logger's key.
+func (l *MemoryLogger) ExportReportWithOptions(ctx context.Context, filter Filter, format ReportFormat, opts ReportOptions) ([]byte, int, error) {
 	events, err := l.QueryEvents(ctx, filter)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
+	var content []byte
 	switch format {
 	case ReportFormatJSON:
-		return json.MarshalIndent(events, "", "  ")
+		content, err = json.MarshalIndent(events, "", "  ")
 	case ReportFormatCSV:
-		return exportCSV(events)
+		content, err = exportCSV(events)
+	case ReportFormatHTML, ReportFormatPDF:
+		content, err = RenderReport(BuildReport(events, l.publicKey, opts), format)
+	case ReportFormatNDJSON, ReportFormatCEF, ReportFormatOCSF:
+		var buf bytes.Buffer
+		err = WriteEvents(&buf, events, format)
+		content = buf.Bytes()
 	default:
-		return nil, fmt.Errorf("unsupported format: %s", format)
+		err = fmt.Errorf("unsupported format: %s", format)
+	}
+	if err != nil {
+		return nil, 0, err
 	}
+	return content, len(events), nil
 }
 
-// Close closes the audit logger.
-func (l *MemoryLogger) Close() error {
-	// Nothing to close for memory logger
+// EnableArchive stores sealed segments in dir. Segments are signed with the
+// logger's signing key. The transparency log's leaves are persisted in dir
+// too, so it must be enabled before any event is logged.
+func (l *MemoryLogger) EnableArchive(dir string) error {
+	archive, err := NewArchiveStore(dir, l.signingKey)
+	if err != nil {
+		return err
+	}
+	if err := l.tlog.Persist(filepath.Join(dir, transparencyLeavesFile)); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.archive = archive
+	l.mu.Unlock()
 	return nil
 }
 
+// EnableEncryption encrypts the site, username, message and metadata of
+// events logged from now on. Sites remain searchable through a blind index,
+// and QueryEvents returns decrypted events.
+func (l *MemoryLogger) EnableEncryption(cipher *FieldCipher) {
+	l.mu.Lock()
+	l.cipher = cipher
+	l.mu.Unlock()
+}
+
+// Archive returns the archive store, or nil if archiving is not enabled.
+func (l *MemoryLogger) Archive() *ArchiveStore {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.archive
+}
+
+// ApplyRetention seals live events selected by policy into archive segments
+// and removes them from the live log. A "segment sealed" system event is
+// logged for every segment written. Segments are written without holding
+// the logger lock; events logged meanwhile are kept.
+func (l *MemoryLogger) ApplyRetention(ctx context.Context, policy RetentionPolicy) ([]SegmentHeader, error) {
+	l.retentionMu.Lock()
+	defer l.retentionMu.Unlock()
+
+	l.mu.Lock()
+	archive := l.archive
+	if archive == nil {
+		l.mu.Unlock()
+		return nil, fmt.Errorf("archiving is not enabled")
+	}
+
+	sort.SliceStable(l.events, func(i, j int) bool {
+		return l.events[i].Timestamp.Before(l.events[j].Timestamp)
+	})
+
+	expired := 0
+	if policy.MaxAge > 0 {
+		cutoff := time.Now().Add(-policy.MaxAge)
+		for expired < len(l.events) && l.events[expired].Timestamp.Before(cutoff) {
+			expired++
+		}
+	}
+	if policy.MaxEvents > 0 && len(l.events)-expired > policy.MaxEvents {
+		expired = len(l.events) - policy.MaxEvents
+	}
+	pending := append([]Event(nil), l.events[:expired]...)
+	l.mu.Unlock()
+
+	segmentSize := policy.SegmentSize
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+
+	var sealed []SegmentHeader
+	var sealErr error
+	archived := 0
+	for archived < len(pending) {
+		end := archived + segmentSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+
+		header, err := archive.Seal(pending[archived:end])
+		if err != nil {
+			sealErr = fmt.Errorf("failed to seal segment: %w", err)
+			break
+		}
+		sealed = append(sealed, *header)
+		archived = end
+	}
+
+	// LogEvent only appends and retention runs are serialized, so the
+	// sealed events are still the first archived entries of the live log.
+	l.mu.Lock()
+	l.events = append([]Event(nil), l.events[archived:]...)
+	l.mu.Unlock()
+
+	for _, header := range sealed {
+		err := l.LogEvent(ctx, Event{
+			Type:    EventTypeSystem,
+			Status:  StatusSuccess,
+			Message: "Audit segment sealed",
+			Metadata: map[string]string{
+				"action":      "segment_sealed",
+				"segment_id":  header.ID,
+				"merkle_root": header.MerkleRoot,
+				"event_count": fmt.Sprint(header.EventCount),
+				"start_time":  header.StartTime.UTC().Format(time.RFC3339Nano),
+				"end_time":    header.EndTime.UTC().Format(time.RFC3339Nano),
+			},
+		})
+		if err != nil {
+			return sealed, fmt.Errorf("failed to log segment seal: %w", err)
+		}
+	}
+
+	return sealed, sealErr
+}
+
+// TransparencyLog returns the Merkle transparency log over all logged events.
+func (l *MemoryLogger) TransparencyLog() *TransparencyLog {
+	return l.tlog
+}
+
+// EventInclusionProof returns a proof that eventID is included in the tree
+// of treeSize leaves (zero means the current size).
+func (l *MemoryLogger) EventInclusionProof(ctx context.Context, eventID string, treeSize int64) (*InclusionProof, error) {
+	event, err := l.findEvent(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	index, ok := l.tlog.LeafIndex(eventID)
+	if !ok {
+		return nil, fmt.Errorf("event not in transparency log: %s", eventID)
+	}
+
+	data, err := eventLeafData(*event)
+	if err != nil {
+		return nil, err
+	}
+
+	path, head, err := l.tlog.InclusionProof(index, treeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InclusionProof{
+		EventID:   eventID,
+		LeafIndex: index,
+		LeafData:  data,
+		AuditPath: path,
+		TreeHead:  *head,
+	}, nil
+}
+
+// PublicKey returns the Ed25519 public key used to verify event signatures.
+func (l *MemoryLogger) PublicKey() ed25519.PublicKey {
+	return l.publicKey
+}
+
+// Subscribe streams events as they are logged. See Broker.Subscribe.
+func (l *MemoryLogger) Subscribe(ctx context.Context, opts SubscribeOptions) (*Subscription, error) {
+	return l.broker.Subscribe(ctx, opts)
+}
+
+// logPosition returns the position the next logged event will take in
+// logging order. See positionReader.
+func (l *MemoryLogger) logPosition() int64 {
+	return l.broker.sequence()
+}
+
+// eventsSince returns the events logged from position on, in logging
+// order. See positionReader.
+func (l *MemoryLogger) eventsSince(position int64) ([]Event, int64, bool) {
+	return l.broker.since(position)
+}
+
+// Close closes the audit logger and ends all subscriptions.
+func (l *MemoryLogger) Close() error {
+	l.broker.Close()
+	return l.tlog.Close()
+}
+
 // Helper functions
 
-func matchesFilter(event Event, filter Filter) bool {
-	if filter.EventType != "" && event.Type != filter.EventType {
-		return false
+// findEvent looks up an event in the live log, then in the archive.
+func (l *MemoryLogger) findEvent(eventID string) (*Event, error) {
+	stored, archive, found := l.findLive(eventID)
+	l.mu.RLock()
+	cipher := l.cipher
+	l.mu.RUnlock()
+
+	if found {
+		return decrypt(cipher, stored)
 	}
-	if filter.Status != "" && event.Status != filter.Status {
-		return false
+
+	if archive != nil {
+		event, _, err := archive.FindEvent(eventID)
+		if err != nil {
+			return nil, err
+		}
+		return decrypt(cipher, *event)
 	}
-	if filter.CredentialID != "" && event.CredentialID != filter.CredentialID {
-		return false
+
+	return nil, fmt.Errorf("event not found: %s", eventID)
+}
+
+// findLive returns the stored form of a live event and the archive to search
+// if it is not live.
+func (l *MemoryLogger) findLive(eventID string) (Event, *ArchiveStore, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, event := range l.events {
+		if event.ID == eventID {
+			return event, l.archive, true
+		}
+	}
+	return Event{}, l.archive, false
+}
+
+// decrypt returns the plaintext form of a stored event.
+func decrypt(cipher *FieldCipher, stored Event) (*Event, error) {
+	if cipher == nil {
+		return &stored, nil
+	}
+	event, err := cipher.DecryptEvent(stored)
+	if err != nil {
+		return nil, err
 	}
-	if !filter.StartTime.IsZero() && event.Timestamp.Before(filter.StartTime) {
+	return &event, nil
+}
+
+// matchStored applies filter to a stored event and returns its plaintext
+// form. Encrypted sites are compared by blind index before decrypting.
+func matchStored(cipher *FieldCipher, stored Event, filter Filter) (Event, bool, error) {
+	if cipher == nil {
+		return stored, matchesFilter(stored, filter), nil
+	}
+	if filter.Site != "" && !cipher.MatchesSite(stored, filter.Site, filter.SiteMatch) {
+		return Event{}, false, nil
+	}
+
+	event, err := decrypt(cipher, stored)
+	if err != nil {
+		return Event{}, false, err
+	}
+	return *event, matchesFilter(*event, filter), nil
+}
+
+// reachesArchive reports whether filter may include events from segments.
+// A filter with neither time bound reads only the live log unless it sets
+// IncludeArchive.
+func reachesArchive(segments []SegmentHeader, filter Filter) bool {
+	start, end := filter.StartTime, filter.EndTime
+	if len(segments) == 0 {
 		return false
 	}
-	if !filter.EndTime.IsZero() && event.Timestamp.After(filter.EndTime) {
+	if start.IsZero() && end.IsZero() {
+		return filter.IncludeArchive
+	}
+	if !start.IsZero() && start.After(segments[len(segments)-1].EndTime) {
 		return false
 	}
-	return true
+	return end.IsZero() || !end.Before(segments[0].StartTime)
+}
+
+// signingMessage returns the canonical byte string covered by an event's signature.
+func signingMessage(event Event) []byte {
+	return []byte(fmt.Sprintf("%s|%d|%s|%s|%s",
+		event.ID,
+		event.Timestamp.Unix(),
+		event.CredentialID,
+		event.Type,
+		event.Status))
 }
 
 func generateEventID() string {
@@ -159,18 +513,26 @@ func generateEventID() string {
 }
 
 func exportCSV(events []Event) ([]byte, error) {
-	csv := "ID,Timestamp,Type,Status,CredentialID,Site,Username,Message\n"
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	w.Write([]string{"ID", "Timestamp", "Type", "Status", "CredentialID", "Site", "Username", "Message"})
 	for _, event := range events {
-		csv += fmt.Sprintf("%s,%s,%s,%s,%s,%s,%s,%q\n",
+		w.Write([]string{
 			event.ID,
 			event.Timestamp.Format(time.RFC3339),
-			event.Type,
-			event.Status,
+			string(event.Type),
+			string(event.Status),
 			event.CredentialID,
 			event.Site,
 			event.Username,
 			event.Message,
-		)
+		})
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
 	}
-	return []byte(csv), nil
+	return buf.Bytes(), nil
 }
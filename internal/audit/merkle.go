@@ -0,0 +1,48 @@
+package audit
+
+import "crypto/sha256"
+
+// Merkle tree hashing as defined in RFC 6962 section 2.1. Leaves and
+// interior nodes use distinct prefixes so a leaf can never be confused
+// with a node.
+
+// MerkleLeafHash returns the RFC 6962 hash of a leaf: SHA-256(0x00 || data).
+func MerkleLeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// merkleNodeHash returns SHA-256(0x01 || left || right).
+func merkleNodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// MerkleTreeHash computes the root of a tree over already-hashed leaves.
+// The root of an empty tree is the hash of the empty string.
+func MerkleTreeHash(leafHashes [][]byte) []byte {
+	switch len(leafHashes) {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return leafHashes[0]
+	}
+
+	k := largestPowerOfTwoBelow(len(leafHashes))
+	return merkleNodeHash(MerkleTreeHash(leafHashes[:k]), MerkleTreeHash(leafHashes[k:]))
+}
+
+// largestPowerOfTwoBelow returns the largest power of two strictly less than n (n > 1).
+func largestPowerOfTwoBelow(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
@@ -0,0 +1,359 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultBrokerCapacity is the number of recent events a Broker retains for
+// subscribers that fall behind.
+const DefaultBrokerCapacity = 4096
+
+// DefaultSubscriptionBuffer is the channel buffer of a subscription.
+const DefaultSubscriptionBuffer = 64
+
+// Errors returned by subscriptions.
+var (
+	// ErrSubscriberLagged is returned when a subscriber falls more than the
+	// broker capacity behind. No event is skipped silently: the subscription
+	// ends and the consumer can resubscribe with FromEventID set to the last
+	// event it received.
+	ErrSubscriberLagged = errors.New("subscriber fell too far behind")
+
+	// ErrBrokerClosed is returned when the broker shuts down.
+	ErrBrokerClosed = errors.New("event broker closed")
+)
+
+// SubscribeOptions selects which events a subscription receives.
+type SubscribeOptions struct {
+	// EventTypes, Sites and Statuses restrict delivered events. An empty
+	// slice matches everything.
+	EventTypes []EventType
+	Sites      []string
+	Statuses   []EventStatus
+
+	// FromEventID replays logged events that follow this event before
+	// switching to live delivery. The event may already be archived.
+	FromEventID string
+
+	// FromTime replays logged events at or after this time before switching
+	// to live delivery. Ignored if FromEventID is set.
+	FromTime time.Time
+
+	// BufferSize is the subscription channel buffer (defaults to DefaultSubscriptionBuffer).
+	BufferSize int
+}
+
+// Delivery is a single event delivered to a subscriber.
+type Delivery struct {
+	Event Event
+
+	// Replayed is true for historical events sent before live delivery.
+	Replayed bool
+}
+
+// Subscription receives events from a Broker.
+type Subscription struct {
+	events chan Delivery
+	done   chan struct{}
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	err    error
+	lastID string
+}
+
+// Events returns the delivery channel. It is closed when the subscription
+// ends; call Err to find out why.
+func (s *Subscription) Events() <-chan Delivery {
+	return s.events
+}
+
+// Err returns the reason the subscription ended, or nil if it was closed by
+// the subscriber (or is still running).
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// LastEventID returns the ID of the last event delivered, for resuming.
+func (s *Subscription) LastEventID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastID
+}
+
+// Close ends the subscription and waits for its delivery goroutine to exit.
+func (s *Subscription) Close() {
+	s.cancel()
+	<-s.done
+}
+
+func (s *Subscription) finish(err error) {
+	s.cancel()
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	close(s.events)
+	close(s.done)
+}
+
+// Broker fans audit events out to subscribers. Publishing never blocks:
+// events are appended to a bounded ring and every subscriber reads from it
+// at its own pace. A subscriber that falls more than the ring capacity
+// behind is ended with ErrSubscriberLagged.
+type Broker struct {
+	mu      sync.Mutex
+	history Logger
+	ring    []Event // circular; event with sequence n is at ring[n%len(ring)]
+	next    int64   // sequence number of the next published event
+	notify  chan struct{}
+	closed  bool
+}
+
+// NewBroker creates a broker. history is used to replay events logged before
+// a subscription was made; capacity bounds how far a subscriber may lag.
+func NewBroker(history Logger, capacity int) *Broker {
+	if capacity <= 0 {
+		capacity = DefaultBrokerCapacity
+	}
+	return &Broker{
+		history: history,
+		ring:    make([]Event, capacity),
+		notify:  make(chan struct{}),
+	}
+}
+
+// Publish delivers event to all current subscribers. It never blocks.
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.ring[b.next%int64(len(b.ring))] = event
+	b.next++
+
+	// Wake every waiting subscriber
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// sequence returns the sequence number of the next published event.
+func (b *Broker) sequence() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.next
+}
+
+// since returns the events published from sequence number position on, in
+// publishing order, and the sequence number of the next event. ok is false
+// if some of them have already been overwritten in the ring.
+func (b *Broker) since(position int64) (events []Event, next int64, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if position < b.next-int64(len(b.ring)) || position > b.next {
+		return nil, b.next, false
+	}
+	for seq := position; seq < b.next; seq++ {
+		events = append(events, b.ring[seq%int64(len(b.ring))])
+	}
+	return events, b.next, true
+}
+
+// Close ends all subscriptions with ErrBrokerClosed.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		close(b.notify)
+	}
+}
+
+// Subscribe starts a subscription. Every event published after Subscribe
+// returns is delivered, in order, unless the subscription ends with an
+// error. Replayed events are delivered first and never duplicated.
+func (b *Broker) Subscribe(ctx context.Context, opts SubscribeOptions) (*Subscription, error) {
+	bufferSize := opts.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultSubscriptionBuffer
+	}
+
+	// Register the live cursor before reading history so nothing logged in
+	// between is missed; duplicates are removed by ID below.
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil, ErrBrokerClosed
+	}
+	cursor := b.next
+	b.mu.Unlock()
+
+	var replay []Event
+	if opts.FromEventID != "" || !opts.FromTime.IsZero() {
+		var err error
+		replay, err = b.replay(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &Subscription{
+		events: make(chan Delivery, bufferSize),
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+
+	go b.deliver(ctx, sub, cursor, replay, opts)
+
+	return sub, nil
+}
+
+// replay reads matching historical events from the history logger,
+// including sealed archive segments, so a subscriber can resume from an
+// event retention has since moved out of the live log.
+func (b *Broker) replay(ctx context.Context, opts SubscribeOptions) ([]Event, error) {
+	if b.history == nil {
+		return nil, fmt.Errorf("replay not available: no history logger")
+	}
+
+	filter := Filter{IncludeArchive: true}
+	if opts.FromEventID == "" {
+		filter.StartTime = opts.FromTime
+	}
+
+	events, err := b.history.QueryEvents(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+
+	if opts.FromEventID != "" {
+		found := false
+		for i, event := range events {
+			if event.ID == opts.FromEventID {
+				events = events[i+1:]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("replay event not found: %s", opts.FromEventID)
+		}
+	}
+
+	var matched []Event
+	for _, event := range events {
+		if opts.matches(event) {
+			matched = append(matched, event)
+		}
+	}
+	return matched, nil
+}
+
+// deliver runs for the lifetime of a subscription.
+func (b *Broker) deliver(ctx context.Context, sub *Subscription, cursor int64, replay []Event, opts SubscribeOptions) {
+	replayed := make(map[string]bool, len(replay))
+	for _, event := range replay {
+		if !b.send(ctx, sub, Delivery{Event: event, Replayed: true}) {
+			sub.finish(nil)
+			return
+		}
+		replayed[event.ID] = true
+	}
+
+	for {
+		b.mu.Lock()
+		if cursor < b.next-int64(len(b.ring)) {
+			b.mu.Unlock()
+			sub.finish(ErrSubscriberLagged)
+			return
+		}
+		if cursor == b.next {
+			if b.closed {
+				b.mu.Unlock()
+				sub.finish(ErrBrokerClosed)
+				return
+			}
+			wait := b.notify
+			b.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				sub.finish(nil)
+				return
+			case <-wait:
+			}
+			continue
+		}
+		event := b.ring[cursor%int64(len(b.ring))]
+		b.mu.Unlock()
+
+		cursor++
+		if replayed[event.ID] || !opts.matches(event) {
+			continue
+		}
+		if !b.send(ctx, sub, Delivery{Event: event}) {
+			sub.finish(nil)
+			return
+		}
+	}
+}
+
+// send blocks until the subscriber accepts d or ctx ends.
+func (b *Broker) send(ctx context.Context, sub *Subscription, d Delivery) bool {
+	select {
+	case sub.events <- d:
+		sub.mu.Lock()
+		sub.lastID = d.Event.ID
+		sub.mu.Unlock()
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// matches reports whether an event passes the subscription filters.
+func (o SubscribeOptions) matches(event Event) bool {
+	if len(o.EventTypes) > 0 && !containsValue(o.EventTypes, event.Type) {
+		return false
+	}
+	if len(o.Statuses) > 0 && !containsValue(o.Statuses, event.Status) {
+		return false
+	}
+	if len(o.Sites) > 0 {
+		matched := false
+		for _, site := range o.Sites {
+			if siteMatches(event.Site, site, SiteMatchExact) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func containsValue[T comparable](values []T, v T) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receive reads n deliveries or fails after a timeout.
+func receive(t *testing.T, sub *Subscription, n int) []Delivery {
+	t.Helper()
+
+	var got []Delivery
+	timeout := time.After(5 * time.Second)
+	for len(got) < n {
+		select {
+		case d, ok := <-sub.Events():
+			if !ok {
+				t.Fatalf("Subscription ended after %d of %d events: %v", len(got), n, sub.Err())
+			}
+			got = append(got, d)
+		case <-timeout:
+			t.Fatalf("Timed out after %d of %d events", len(got), n)
+		}
+	}
+	return got
+}
+
+// TestSubscribeFilters tests live delivery with type, site and status filters
+func TestSubscribeFilters(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	sub, err := logger.Subscribe(context.Background(), SubscribeOptions{
+		EventTypes: []EventType{EventTypeRotation},
+		Sites:      []string{"github.com"},
+		Statuses:   []EventStatus{StatusFailure},
+	})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	events := []Event{
+		{Type: EventTypeRotation, Status: StatusFailure, Site: "github.com", Message: "match-1"},
+		{Type: EventTypeRotation, Status: StatusSuccess, Site: "github.com"},
+		{Type: EventTypeDetection, Status: StatusFailure, Site: "github.com"},
+		{Type: EventTypeRotation, Status: StatusFailure, Site: "gitlab.com"},
+		{Type: EventTypeRotation, Status: StatusFailure, Site: "github.com", Message: "match-2"},
+	}
+	for _, event := range events {
+		if err := logger.LogEvent(context.Background(), event); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	got := receive(t, sub, 2)
+	if got[0].Event.Message != "match-1" || got[1].Event.Message != "match-2" {
+		t.Errorf("Unexpected deliveries: %q, %q", got[0].Event.Message, got[1].Event.Message)
+	}
+	if got[0].Replayed {
+		t.Error("Expected live delivery")
+	}
+
+	select {
+	case d := <-sub.Events():
+		t.Errorf("Unexpected extra delivery: %+v", d.Event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestSubscribeReplay tests replay from an event ID and from a timestamp
+func TestSubscribeReplay(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		event := Event{Type: EventTypeRotation, Status: StatusSuccess, Message: fmt.Sprint(i), Timestamp: base.Add(time.Duration(i) * time.Minute)}
+		if err := logger.LogEvent(context.Background(), event); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+	history, _ := logger.QueryEvents(context.Background(), Filter{})
+
+	t.Run("from event ID", func(t *testing.T) {
+		sub, err := logger.Subscribe(context.Background(), SubscribeOptions{FromEventID: history[2].ID})
+		if err != nil {
+			t.Fatalf("Failed to subscribe: %v", err)
+		}
+		defer sub.Close()
+
+		logger.LogEvent(context.Background(), Event{Type: EventTypeRotation, Status: StatusSuccess, Message: "live"})
+
+		got := receive(t, sub, 3)
+		if got[0].Event.Message != "3" || got[1].Event.Message != "4" || got[2].Event.Message != "live" {
+			t.Errorf("Unexpected order: %q %q %q", got[0].Event.Message, got[1].Event.Message, got[2].Event.Message)
+		}
+		if !got[0].Replayed || got[2].Replayed {
+			t.Error("Expected replayed history followed by live events")
+		}
+	})
+
+	t.Run("from time", func(t *testing.T) {
+		sub, err := logger.Subscribe(context.Background(), SubscribeOptions{FromTime: base.Add(4 * time.Minute)})
+		if err != nil {
+			t.Fatalf("Failed to subscribe: %v", err)
+		}
+		defer sub.Close()
+
+		got := receive(t, sub, 2)
+		if got[0].Event.Message != "4" || got[1].Event.Message != "live" {
+			t.Errorf("Unexpected replay: %q %q", got[0].Event.Message, got[1].Event.Message)
+		}
+	})
+
+	t.Run("unknown event ID", func(t *testing.T) {
+		if _, err := logger.Subscribe(context.Background(), SubscribeOptions{FromEventID: "missing"}); err == nil {
+			t.Error("Expected error for unknown replay event")
+		}
+	})
+}
+
+// TestSubscribeGuaranteedDelivery tests that concurrent writers lose no events
+func TestSubscribeGuaranteedDelivery(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	sub, err := logger.Subscribe(context.Background(), SubscribeOptions{BufferSize: 1})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	const writers, perWriter = 8, 200
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				logger.LogEvent(context.Background(), Event{Type: EventTypeSystem, Status: StatusSuccess})
+			}
+		}()
+	}
+
+	got := receive(t, sub, writers*perWriter)
+	wg.Wait()
+
+	seen := make(map[string]bool, len(got))
+	for _, d := range got {
+		if seen[d.Event.ID] {
+			t.Fatalf("Duplicate delivery of %s", d.Event.ID)
+		}
+		seen[d.Event.ID] = true
+	}
+}
+
+// TestSubscribeSlowConsumer tests that a lagging subscriber is ended, not silently skipped
+func TestSubscribeSlowConsumer(t *testing.T) {
+	broker := NewBroker(nil, 8)
+
+	sub, err := broker.Subscribe(context.Background(), SubscribeOptions{BufferSize: 1})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	// Publishing must never block, even with a stalled subscriber
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			broker.Publish(Event{ID: fmt.Sprint(i)})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+
+	// Drain: deliveries must be a gap-free prefix followed by a lag error
+	next := 0
+	for d := range sub.Events() {
+		if d.Event.ID != fmt.Sprint(next) {
+			t.Fatalf("Expected event %d, got %s", next, d.Event.ID)
+		}
+		next++
+	}
+	if !errors.Is(sub.Err(), ErrSubscriberLagged) {
+		t.Errorf("Expected ErrSubscriberLagged, got %v", sub.Err())
+	}
+	wantLast := ""
+	if next > 0 {
+		wantLast = fmt.Sprint(next - 1)
+	}
+	if sub.LastEventID() != wantLast {
+		t.Errorf("Expected last event %q, got %q", wantLast, sub.LastEventID())
+	}
+}
+
+// TestBrokerClose tests that closing the logger ends subscriptions after draining
+func TestBrokerClose(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	sub, err := logger.Subscribe(context.Background(), SubscribeOptions{})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	logger.LogEvent(context.Background(), Event{Type: EventTypeSystem, Status: StatusSuccess})
+	logger.Close()
+
+	got := 0
+	for range sub.Events() {
+		got++
+	}
+	if got != 1 {
+		t.Errorf("Expected 1 event before close, got %d", got)
+	}
+	if !errors.Is(sub.Err(), ErrBrokerClosed) {
+		t.Errorf("Expected ErrBrokerClosed, got %v", sub.Err())
+	}
+
+	if _, err := logger.Subscribe(context.Background(), SubscribeOptions{}); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("Expected ErrBrokerClosed for new subscription, got %v", err)
+	}
+}
+
+// TestSubscribeReplayFromArchive tests resuming from an event that retention
+// has already sealed into the archive
+func TestSubscribeReplayFromArchive(t *testing.T) {
+	base := time.Now().Add(-24 * time.Hour)
+	logger := newArchiveTestLogger(t, 10, base)
+	defer logger.Close()
+
+	logged, err := logger.QueryEvents(context.Background(), Filter{})
+	if err != nil {
+		t.Fatalf("Failed to query events: %v", err)
+	}
+	if _, err := logger.ApplyRetention(context.Background(), RetentionPolicy{MaxEvents: 4}); err != nil {
+		t.Fatalf("Failed to apply retention: %v", err)
+	}
+
+	sub, err := logger.Subscribe(context.Background(), SubscribeOptions{
+		EventTypes:  []EventType{EventTypeRotation},
+		FromEventID: logged[2].ID,
+	})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	got := receive(t, sub, 7)
+	for i, d := range got {
+		if d.Event.ID != logged[i+3].ID || !d.Replayed {
+			t.Errorf("Delivery %d: expected replayed %s, got %s", i, logged[i+3].ID, d.Event.ID)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"sort"
+	"time"
+)
+
+//go:embed templates/report.html.tmpl
+var reportHTMLTemplate string
+
+// DefaultReportTitle is used when ReportOptions.Title is empty.
+const DefaultReportTitle = "ACM Audit Compliance Report"
+
+// ReportOptions customizes a rendered compliance report.
+type ReportOptions struct {
+	// Title is printed at the top of the report.
+	Title string
+
+	// Metadata is printed as key/value pairs below the title.
+	Metadata map[string]string
+
+	// GeneratedAt overrides the generation timestamp (defaults to now).
+	GeneratedAt time.Time
+}
+
+// Report is the renderer-independent model of a compliance report.
+type Report struct {
+	Title       string
+	Metadata    []ReportMetadataEntry
+	GeneratedAt time.Time
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+
+	// Summary rows, one per event type, sorted by type.
+	Summary []ReportSummaryRow
+
+	// TotalEvents is the number of events included in the report.
+	TotalEvents int
+
+	// Timelines holds the rotation history of each credential.
+	Timelines []CredentialTimeline
+
+	// Verification summarizes the signature checks.
+	Verification VerificationSummary
+
+	// PublicKeyFingerprint identifies the key used for verification.
+	PublicKeyFingerprint string
+}
+
+// ReportMetadataEntry is a single key/value pair of report metadata.
+type ReportMetadataEntry struct {
+	Key   string
+	Value string
+}
+
+// ReportSummaryRow counts the events of one type by outcome.
+type ReportSummaryRow struct {
+	Type    EventType
+	Total   int
+	Success int
+	Failure int
+	Pending int
+	Skipped int
+}
+
+// CredentialTimeline lists the rotation events of a single credential.
+type CredentialTimeline struct {
+	CredentialID string
+	Site         string
+	Entries      []TimelineEntry
+}
+
+// TimelineEntry is a single rotation event on a credential timeline.
+type TimelineEntry struct {
+	Timestamp time.Time
+	Status    EventStatus
+	Message   string
+	Verified  bool
+}
+
+// VerificationSummary reports the outcome of signature verification.
+type VerificationSummary struct {
+	// Performed is false when no public key was available.
+	Performed bool
+	Verified  int
+	Failed    int
+
+	// FailedEventIDs lists the events whose signature did not verify.
+	FailedEventIDs []string
+}
+
+// BuildReport assembles a report from events. If publicKey is nil the
+// signature verification section is marked as not performed.
+func BuildReport(events []Event, publicKey ed25519.PublicKey, opts ReportOptions) *Report {
+	report := &Report{
+		Title:       opts.Title,
+		GeneratedAt: opts.GeneratedAt,
+		TotalEvents: len(events),
+	}
+	if report.Title == "" {
+		report.Title = DefaultReportTitle
+	}
+	if report.GeneratedAt.IsZero() {
+		report.GeneratedAt = time.Now()
+	}
+
+	keys := make([]string, 0, len(opts.Metadata))
+	for k := range opts.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		report.Metadata = append(report.Metadata, ReportMetadataEntry{Key: k, Value: opts.Metadata[k]})
+	}
+
+	if publicKey != nil {
+		report.Verification.Performed = true
+		report.PublicKeyFingerprint = PublicKeyFingerprint(publicKey)
+	}
+
+	summary := make(map[EventType]*ReportSummaryRow)
+	timelines := make(map[string]*CredentialTimeline)
+
+	for _, event := range events {
+		if report.PeriodStart.IsZero() || event.Timestamp.Before(report.PeriodStart) {
+			report.PeriodStart = event.Timestamp
+		}
+		if event.Timestamp.After(report.PeriodEnd) {
+			report.PeriodEnd = event.Timestamp
+		}
+
+		row, ok := summary[event.Type]
+		if !ok {
+			row = &ReportSummaryRow{Type: event.Type}
+			summary[event.Type] = row
+		}
+		row.Total++
+		switch event.Status {
+		case StatusSuccess:
+			row.Success++
+		case StatusFailure:
+			row.Failure++
+		case StatusPending:
+			row.Pending++
+		case StatusSkipped:
+			row.Skipped++
+		}
+
+		verified := false
+		if publicKey != nil {
+			verified = ed25519.Verify(publicKey, signingMessage(event), event.Signature)
+			if verified {
+				report.Verification.Verified++
+			} else {
+				report.Verification.Failed++
+				report.Verification.FailedEventIDs = append(report.Verification.FailedEventIDs, event.ID)
+			}
+		}
+
+		if event.Type != EventTypeRotation || event.CredentialID == "" {
+			continue
+		}
+
+		timeline, ok := timelines[event.CredentialID]
+		if !ok {
+			timeline = &CredentialTimeline{CredentialID: event.CredentialID}
+			timelines[event.CredentialID] = timeline
+		}
+		if timeline.Site == "" {
+			timeline.Site = event.Site
+		}
+		timeline.Entries = append(timeline.Entries, TimelineEntry{
+			Timestamp: event.Timestamp,
+			Status:    event.Status,
+			Message:   event.Message,
+			Verified:  verified,
+		})
+	}
+
+	for _, row := range summary {
+		report.Summary = append(report.Summary, *row)
+	}
+	sort.Slice(report.Summary, func(i, j int) bool {
+		return report.Summary[i].Type < report.Summary[j].Type
+	})
+
+	for _, timeline := range timelines {
+		sort.Slice(timeline.Entries, func(i, j int) bool {
+			return timeline.Entries[i].Timestamp.Before(timeline.Entries[j].Timestamp)
+		})
+		report.Timelines = append(report.Timelines, *timeline)
+	}
+	sort.Slice(report.Timelines, func(i, j int) bool {
+		if report.Timelines[i].Site != report.Timelines[j].Site {
+			return report.Timelines[i].Site < report.Timelines[j].Site
+		}
+		return report.Timelines[i].CredentialID < report.Timelines[j].CredentialID
+	})
+
+	return report
+}
+
+// RenderReport renders a report as HTML or PDF.
+func RenderReport(report *Report, format ReportFormat) ([]byte, error) {
+	switch format {
+	case ReportFormatHTML:
+		return renderHTML(report)
+	case ReportFormatPDF:
+		return renderPDF(report)
+	default:
+		return nil, fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// PublicKeyFingerprint returns the SHA-256 fingerprint of an Ed25519 public key.
+func PublicKeyFingerprint(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func renderHTML(report *Report) ([]byte, error) {
+	tmpl, err := template.New("report").Funcs(template.FuncMap{
+		"formatTime": formatReportTime,
+	}).Parse(reportHTMLTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse report template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, report); err != nil {
+		return nil, fmt.Errorf("failed to render HTML report: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// formatReportTime formats timestamps consistently across report formats.
+func formatReportTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}
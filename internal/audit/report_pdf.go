@@ -0,0 +1,245 @@
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// PDF page geometry (US Letter, points).
+const (
+	pdfPageWidth    = 612.0
+	pdfPageHeight   = 792.0
+	pdfMargin       = 50.0
+	pdfBodySize     = 9.0
+	pdfLineSpacing  = 1.35
+	pdfCourierWidth = 0.6 // Courier glyph advance as a fraction of font size
+)
+
+// Standard Type 1 fonts; these are built into every PDF reader, so nothing is embedded.
+const (
+	pdfFontBody = "F1" // Courier
+	pdfFontBold = "F2" // Helvetica-Bold
+)
+
+// pdfDocument is a minimal PDF 1.4 writer for text-only reports.
+// It lays out lines top to bottom and starts a new page when one fills up.
+type pdfDocument struct {
+	title string
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+}
+
+func newPDFDocument(title string) *pdfDocument {
+	d := &pdfDocument{title: title}
+	d.newPage()
+	return d
+}
+
+func (d *pdfDocument) newPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// line writes a single line of text, breaking the page if necessary.
+func (d *pdfDocument) line(font string, size float64, text string) {
+	height := size * pdfLineSpacing
+	if d.y-height < pdfMargin {
+		d.newPage()
+	}
+	d.y -= height
+	fmt.Fprintf(d.page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, pdfMargin, d.y, pdfEscape(text))
+}
+
+// heading writes a bold heading with some space above it.
+func (d *pdfDocument) heading(size float64, text string) {
+	if d.y < pdfPageHeight-pdfMargin {
+		d.y -= size * 0.6
+	}
+	d.line(pdfFontBold, size, text)
+}
+
+// text writes monospaced body text wrapped to the page width.
+func (d *pdfDocument) text(text string) {
+	width := (pdfPageWidth - 2*pdfMargin) / (pdfBodySize * pdfCourierWidth)
+	maxChars := int(width)
+	for _, l := range wrapText(text, maxChars) {
+		d.line(pdfFontBody, pdfBodySize, l)
+	}
+}
+
+// rule draws a horizontal line across the text area.
+func (d *pdfDocument) rule() {
+	d.y -= 4
+	fmt.Fprintf(d.page, "0.5 w %.2f %.2f m %.2f %.2f l S\n", pdfMargin, d.y, pdfPageWidth-pdfMargin, d.y)
+	d.y -= 2
+}
+
+// bytes serializes the document with a valid cross-reference table.
+func (d *pdfDocument) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Fixed objects: 1 catalog, 2 page tree, 3-4 fonts, 5 info.
+	// Each page then uses two objects: the page and its content stream.
+	const firstPageObj = 6
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageObj+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title (%s) /Producer (ACM Audit Logger) >>", pdfEscape(d.title)))
+
+	for i, page := range d.pages {
+		footer := fmt.Sprintf("BT /%s 8.0 Tf %.2f %.2f Td (Page %d of %d) Tj ET\n",
+			pdfFontBody, pdfPageWidth-pdfMargin-70, pdfMargin/2, i+1, len(d.pages))
+		content := page.String() + footer
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, pdfFontBody, pdfFontBold, firstPageObj+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes()
+}
+
+// pdfEscape escapes a string for use in a PDF literal string. Characters
+// outside printable ASCII are replaced because the standard fonts only
+// cover WinAnsi.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// wrapText splits text into lines of at most width characters, breaking on
+// spaces where possible.
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		for len(paragraph) > width {
+			cut := strings.LastIndex(paragraph[:width], " ")
+			if cut <= 0 {
+				cut = width
+			}
+			lines = append(lines, paragraph[:cut])
+			paragraph = strings.TrimLeft(paragraph[cut:], " ")
+		}
+		lines = append(lines, paragraph)
+	}
+	return lines
+}
+
+// padColumns formats a table row with fixed-width, left-aligned columns.
+func padColumns(widths []int, cols ...string) string {
+	var b strings.Builder
+	for i, col := range cols {
+		if len(col) > widths[i] {
+			col = col[:widths[i]-1] + "~"
+		}
+		b.WriteString(col)
+		if i < len(cols)-1 {
+			b.WriteString(strings.Repeat(" ", widths[i]-len(col)+1))
+		}
+	}
+	return b.String()
+}
+
+func renderPDF(report *Report) ([]byte, error) {
+	doc := newPDFDocument(report.Title)
+
+	doc.line(pdfFontBold, 16, report.Title)
+	doc.rule()
+	doc.text("Generated: " + formatReportTime(report.GeneratedAt))
+	doc.text("Period:    " + formatReportTime(report.PeriodStart) + " - " + formatReportTime(report.PeriodEnd))
+	doc.text(fmt.Sprintf("Events:    %d", report.TotalEvents))
+	for _, m := range report.Metadata {
+		doc.text(m.Key + ": " + m.Value)
+	}
+
+	doc.heading(12, "Summary")
+	summaryWidths := []int{16, 8, 8, 8, 8, 8}
+	doc.text(padColumns(summaryWidths, "Event type", "Total", "Success", "Failure", "Pending", "Skipped"))
+	if len(report.Summary) == 0 {
+		doc.text("No events in range.")
+	}
+	for _, row := range report.Summary {
+		doc.text(padColumns(summaryWidths, string(row.Type),
+			fmt.Sprint(row.Total), fmt.Sprint(row.Success), fmt.Sprint(row.Failure),
+			fmt.Sprint(row.Pending), fmt.Sprint(row.Skipped)))
+	}
+
+	doc.heading(12, "Rotation Timeline")
+	if len(report.Timelines) == 0 {
+		doc.text("No rotation events in range.")
+	}
+	timelineWidths := []int{23, 8, 10, 49}
+	for _, timeline := range report.Timelines {
+		site := timeline.Site
+		if site == "" {
+			site = "(unknown site)"
+		}
+		doc.heading(10, site)
+		doc.text("Credential: " + timeline.CredentialID)
+		doc.text(padColumns(timelineWidths, "Time", "Status", "Signature", "Message"))
+		for _, entry := range timeline.Entries {
+			sig := "unverified"
+			if entry.Verified {
+				sig = "valid"
+			}
+			doc.text(padColumns(timelineWidths, formatReportTime(entry.Timestamp), string(entry.Status), sig, entry.Message))
+		}
+	}
+
+	doc.heading(12, "Signature Verification")
+	if report.Verification.Performed {
+		doc.text(fmt.Sprintf("Valid signatures:   %d", report.Verification.Verified))
+		doc.text(fmt.Sprintf("Invalid signatures: %d", report.Verification.Failed))
+		for _, id := range report.Verification.FailedEventIDs {
+			doc.text("  - " + id)
+		}
+	} else {
+		doc.text("Signature verification was not performed (no public key available).")
+	}
+
+	doc.heading(12, "Public Key")
+	if report.PublicKeyFingerprint != "" {
+		doc.text("Ed25519 public key fingerprint:")
+		doc.text(report.PublicKeyFingerprint)
+	} else {
+		doc.text("No public key supplied.")
+	}
+
+	return doc.bytes(), nil
+}
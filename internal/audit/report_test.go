@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newReportTestLogger(t *testing.T) *MemoryLogger {
+	t.Helper()
+
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	base := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Type: EventTypeRotation, Status: StatusFailure, CredentialID: "cred-a", Site: "github.com", Message: "Vault locked", Timestamp: base},
+		{Type: EventTypeRotation, Status: StatusSuccess, CredentialID: "cred-a", Site: "github.com", Message: "Password rotated successfully", Timestamp: base.Add(time.Hour)},
+		{Type: EventTypeRotation, Status: StatusSuccess, CredentialID: "cred-b", Site: "example.com", Message: "<script>alert(1)</script>", Timestamp: base.Add(2 * time.Hour)},
+		{Type: EventTypeDetection, Status: StatusSuccess, Message: "Detected 2 compromised credentials", Timestamp: base.Add(3 * time.Hour)},
+	}
+	for _, event := range events {
+		if err := logger.LogEvent(context.Background(), event); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	return logger
+}
+
+// TestBuildReport tests the report model
+func TestBuildReport(t *testing.T) {
+	logger := newReportTestLogger(t)
+	defer logger.Close()
+
+	events, err := logger.QueryEvents(context.Background(), Filter{})
+	if err != nil {
+		t.Fatalf("Failed to query events: %v", err)
+	}
+
+	// Tamper with one event so its signature no longer verifies
+	events[1].Status = StatusFailure
+
+	report := BuildReport(events, logger.PublicKey(), ReportOptions{})
+
+	if report.Title != DefaultReportTitle {
+		t.Errorf("Expected default title, got %q", report.Title)
+	}
+	if len(report.Summary) != 2 {
+		t.Fatalf("Expected 2 summary rows, got %d", len(report.Summary))
+	}
+	if len(report.Timelines) != 2 {
+		t.Fatalf("Expected 2 credential timelines, got %d", len(report.Timelines))
+	}
+	if report.Timelines[1].Site != "github.com" || len(report.Timelines[1].Entries) != 2 {
+		t.Errorf("Expected github.com timeline with 2 entries, got %+v", report.Timelines[1])
+	}
+	if !report.Verification.Performed {
+		t.Fatal("Expected verification to be performed")
+	}
+	if report.Verification.Verified != 3 || report.Verification.Failed != 1 {
+		t.Errorf("Expected 3 valid and 1 invalid signature, got %d/%d", report.Verification.Verified, report.Verification.Failed)
+	}
+	if len(report.Verification.FailedEventIDs) != 1 || report.Verification.FailedEventIDs[0] != events[1].ID {
+		t.Errorf("Expected failed event %s, got %v", events[1].ID, report.Verification.FailedEventIDs)
+	}
+	if !strings.HasPrefix(report.PublicKeyFingerprint, "sha256:") {
+		t.Errorf("Expected sha256 fingerprint, got %q", report.PublicKeyFingerprint)
+	}
+}
+
+// TestExportHTMLReport tests HTML rendering
+func TestExportHTMLReport(t *testing.T) {
+	logger := newReportTestLogger(t)
+	defer logger.Close()
+
+	data, count, err := logger.ExportReportWithOptions(context.Background(), Filter{}, ReportFormatHTML, ReportOptions{
+		Title:    "Q1 Credential Audit",
+		Metadata: map[string]string{"auditor": "Jane Doe"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to export HTML report: %v", err)
+	}
+	if count != 4 {
+		t.Errorf("Expected 4 events in report, got %d", count)
+	}
+
+	html := string(data)
+	for _, want := range []string{
+		"<title>Q1 Credential Audit</title>",
+		"Jane Doe",
+		"github.com",
+		PublicKeyFingerprint(logger.PublicKey()),
+		"&lt;script&gt;",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected HTML report to contain %q", want)
+		}
+	}
+	if strings.Contains(html, "<script>alert") {
+		t.Error("Expected event messages to be HTML-escaped")
+	}
+}
+
+// TestExportPDFReport tests that the PDF output is structurally valid
+func TestExportPDFReport(t *testing.T) {
+	logger := newReportTestLogger(t)
+	defer logger.Close()
+
+	// Enough events to force a second page
+	for i := 0; i < 120; i++ {
+		event := Event{Type: EventTypeRotation, Status: StatusSuccess, CredentialID: "cred-c", Site: "bulk.example", Message: "(rotated)"}
+		if err := logger.LogEvent(context.Background(), event); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	data, err := logger.ExportReport(context.Background(), Filter{}, ReportFormatPDF)
+	if err != nil {
+		t.Fatalf("Failed to export PDF report: %v", err)
+	}
+
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4")) {
+		t.Error("Expected PDF header")
+	}
+	if !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Error("Expected PDF trailer")
+	}
+	if !bytes.Contains(data, []byte(`\(rotated\)`)) {
+		t.Error("Expected parentheses to be escaped")
+	}
+
+	// Every xref entry must point at the start of its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+	if m == nil {
+		t.Fatal("Expected startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref does not point at xref table")
+	}
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[xref:], -1)
+	if len(entries) < 8 {
+		t.Fatalf("Expected at least 8 objects (2+ pages), got %d", len(entries))
+	}
+	for i, entry := range entries {
+		off, _ := strconv.Atoi(string(entry[1]))
+		want := fmt.Sprintf("%d 0 obj", i+1)
+		if !bytes.HasPrefix(data[off:], []byte(want)) {
+			t.Errorf("xref entry %d does not point at %q", i+1, want)
+		}
+	}
+	if !bytes.Contains(data, []byte("/Count 2")) && !bytes.Contains(data, []byte("/Count 3")) {
+		t.Error("Expected report to span multiple pages")
+	}
+}
+
+// TestWrapText tests line wrapping for PDF output
+func TestWrapText(t *testing.T) {
+	lines := wrapText("the quick brown fox jumps over the lazy dog", 10)
+	for _, l := range lines {
+		if len(l) > 10 {
+			t.Errorf("Line exceeds width: %q", l)
+		}
+	}
+	if strings.Join(lines, " ") != "the quick brown fox jumps over the lazy dog" {
+		t.Errorf("Unexpected wrapped text: %v", lines)
+	}
+}
@@ -0,0 +1,299 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Product identification used in SIEM records.
+const (
+	SIEMVendor         = "ACM"
+	SIEMProduct        = "Automated Compromise Mitigation"
+	SIEMProductVersion = "0.1.0"
+)
+
+// OCSF identifiers for the Account Change class (Identity & Access Management).
+const (
+	ocsfVersion            = "1.1.0"
+	ocsfCategoryIAM        = 3
+	ocsfClassAccountChange = 3001
+	ocsfActivityPassword   = 3  // Password Change
+	ocsfActivityOther      = 99 // Other
+)
+
+// IsStreamFormat reports whether format is a line-oriented SIEM format that
+// can be written event by event.
+func IsStreamFormat(format ReportFormat) bool {
+	switch format {
+	case ReportFormatNDJSON, ReportFormatCEF, ReportFormatOCSF:
+		return true
+	default:
+		return false
+	}
+}
+
+// EncodeEvent encodes a single event as one record (without a trailing
+// newline) in the given SIEM format.
+func EncodeEvent(event Event, format ReportFormat) ([]byte, error) {
+	switch format {
+	case ReportFormatNDJSON:
+		return json.Marshal(newNDJSONRecord(event))
+	case ReportFormatCEF:
+		return []byte(encodeCEF(event)), nil
+	case ReportFormatOCSF:
+		return json.Marshal(newOCSFAccountChange(event))
+	default:
+		return nil, fmt.Errorf("unsupported SIEM format: %s", format)
+	}
+}
+
+// WriteEvents streams events to w in a SIEM format, one record per line.
+func WriteEvents(w io.Writer, events []Event, format ReportFormat) error {
+	if !IsStreamFormat(format) {
+		return fmt.Errorf("unsupported SIEM format: %s", format)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, event := range events {
+		record, err := EncodeEvent(event, format)
+		if err != nil {
+			return fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+		}
+		bw.Write(record)
+		if err := bw.WriteByte('\n'); err != nil {
+			return fmt.Errorf("failed to write event %s: %w", event.ID, err)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ndjsonRecord is the stable wire schema for NDJSON export.
+type ndjsonRecord struct {
+	ID           string            `json:"id"`
+	Timestamp    string            `json:"timestamp"`
+	Type         EventType         `json:"type"`
+	Status       EventStatus       `json:"status"`
+	CredentialID string            `json:"credential_id,omitempty"`
+	Site         string            `json:"site,omitempty"`
+	Username     string            `json:"username,omitempty"`
+	Message      string            `json:"message,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Signature    string            `json:"signature,omitempty"`
+}
+
+func newNDJSONRecord(event Event) ndjsonRecord {
+	return ndjsonRecord{
+		ID:           event.ID,
+		Timestamp:    event.Timestamp.UTC().Format(time.RFC3339Nano),
+		Type:         event.Type,
+		Status:       event.Status,
+		CredentialID: event.CredentialID,
+		Site:         event.Site,
+		Username:     event.Username,
+		Message:      event.Message,
+		Metadata:     event.Metadata,
+		Signature:    hex.EncodeToString(event.Signature),
+	}
+}
+
+// encodeCEF formats an event as an ArcSight CEF:0 record.
+func encodeCEF(event Event) string {
+	name := event.Message
+	if name == "" {
+		name = fmt.Sprintf("%s %s", event.Type, event.Status)
+	}
+
+	header := strings.Join([]string{
+		"CEF:0",
+		cefHeaderEscape(SIEMVendor),
+		cefHeaderEscape(SIEMProduct),
+		cefHeaderEscape(SIEMProductVersion),
+		cefHeaderEscape(string(event.Type)),
+		cefHeaderEscape(name),
+		fmt.Sprint(cefSeverity(event.Status)),
+	}, "|")
+
+	ext := []string{
+		"rt=" + fmt.Sprint(event.Timestamp.UnixMilli()),
+		"externalId=" + cefExtensionEscape(event.ID),
+		"cat=" + cefExtensionEscape(string(event.Type)),
+		"outcome=" + cefExtensionEscape(string(event.Status)),
+	}
+	if event.Site != "" {
+		ext = append(ext, "dhost="+cefExtensionEscape(event.Site))
+	}
+	if event.Username != "" {
+		ext = append(ext, "duser="+cefExtensionEscape(event.Username))
+	}
+	if event.Message != "" {
+		ext = append(ext, "msg="+cefExtensionEscape(event.Message))
+	}
+	if event.CredentialID != "" {
+		ext = append(ext, "cs1Label=credentialId", "cs1="+cefExtensionEscape(event.CredentialID))
+	}
+	if len(event.Signature) > 0 {
+		ext = append(ext, "cs2Label=signature", "cs2="+hex.EncodeToString(event.Signature))
+	}
+	if len(event.Metadata) > 0 {
+		ext = append(ext, "cs3Label=metadata", "cs3="+cefExtensionEscape(joinMetadata(event.Metadata)))
+	}
+
+	return header + "|" + strings.Join(ext, " ")
+}
+
+// cefSeverity maps an event status to the CEF 0-10 severity scale.
+func cefSeverity(status EventStatus) int {
+	switch status {
+	case StatusFailure:
+		return 7
+	case StatusPending:
+		return 4
+	case StatusSkipped:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// cefHeaderEscape escapes pipes and backslashes in CEF header fields.
+func cefHeaderEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// cefExtensionEscape escapes equals signs, backslashes and newlines in CEF
+// extension values.
+func cefExtensionEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r", `\r`, "\n", `\n`).Replace(s)
+}
+
+// joinMetadata renders metadata as sorted "key=value" pairs.
+func joinMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + metadata[k]
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// ocsfAccountChange is an OCSF Account Change (class 3001) event.
+type ocsfAccountChange struct {
+	ActivityID   int               `json:"activity_id"`
+	ActivityName string            `json:"activity_name"`
+	CategoryUID  int               `json:"category_uid"`
+	CategoryName string            `json:"category_name"`
+	ClassUID     int               `json:"class_uid"`
+	ClassName    string            `json:"class_name"`
+	TypeUID      int               `json:"type_uid"`
+	Time         int64             `json:"time"`
+	SeverityID   int               `json:"severity_id"`
+	Severity     string            `json:"severity"`
+	StatusID     int               `json:"status_id"`
+	Status       string            `json:"status"`
+	Message      string            `json:"message,omitempty"`
+	Metadata     ocsfMetadata      `json:"metadata"`
+	User         ocsfUser          `json:"user"`
+	DstEndpoint  *ocsfEndpoint     `json:"dst_endpoint,omitempty"`
+	Unmapped     map[string]string `json:"unmapped,omitempty"`
+}
+
+type ocsfMetadata struct {
+	Version string      `json:"version"`
+	UID     string      `json:"uid"`
+	Product ocsfProduct `json:"product"`
+	Labels  []string    `json:"labels,omitempty"`
+}
+
+type ocsfProduct struct {
+	Name       string `json:"name"`
+	VendorName string `json:"vendor_name"`
+	Version    string `json:"version"`
+}
+
+type ocsfUser struct {
+	Name string `json:"name,omitempty"`
+	UID  string `json:"uid,omitempty"`
+}
+
+type ocsfEndpoint struct {
+	Hostname string `json:"hostname"`
+}
+
+func newOCSFAccountChange(event Event) ocsfAccountChange {
+	activityID, activityName := ocsfActivityOther, "Other"
+	if event.Type == EventTypeRotation {
+		activityID, activityName = ocsfActivityPassword, "Password Change"
+	}
+
+	statusID, statusName := 99, "Other"
+	severityID, severityName := 1, "Informational"
+	switch event.Status {
+	case StatusSuccess:
+		statusID, statusName = 1, "Success"
+	case StatusFailure:
+		statusID, statusName = 2, "Failure"
+		severityID, severityName = 3, "Medium"
+	}
+
+	out := ocsfAccountChange{
+		ActivityID:   activityID,
+		ActivityName: activityName,
+		CategoryUID:  ocsfCategoryIAM,
+		CategoryName: "Identity & Access Management",
+		ClassUID:     ocsfClassAccountChange,
+		ClassName:    "Account Change",
+		TypeUID:      ocsfClassAccountChange*100 + activityID,
+		Time:         event.Timestamp.UnixMilli(),
+		SeverityID:   severityID,
+		Severity:     severityName,
+		StatusID:     statusID,
+		Status:       statusName,
+		Message:      event.Message,
+		Metadata: ocsfMetadata{
+			Version: ocsfVersion,
+			UID:     event.ID,
+			Product: ocsfProduct{
+				Name:       SIEMProduct,
+				VendorName: SIEMVendor,
+				Version:    SIEMProductVersion,
+			},
+			Labels: []string{string(event.Type)},
+		},
+		User: ocsfUser{
+			Name: event.Username,
+			UID:  event.CredentialID,
+		},
+	}
+	if event.Site != "" {
+		out.DstEndpoint = &ocsfEndpoint{Hostname: event.Site}
+	}
+
+	if len(event.Metadata) > 0 || len(event.Signature) > 0 || statusID == 99 {
+		out.Unmapped = make(map[string]string, len(event.Metadata)+2)
+		for k, v := range event.Metadata {
+			out.Unmapped[k] = v
+		}
+		if len(event.Signature) > 0 {
+			out.Unmapped["signature"] = hex.EncodeToString(event.Signature)
+		}
+		if statusID == 99 {
+			out.Unmapped["acm_status"] = string(event.Status)
+		}
+	}
+
+	return out
+}
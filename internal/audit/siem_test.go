@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func siemTestEvent() Event {
+	return Event{
+		ID:           "evt-1",
+		Timestamp:    time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC),
+		Type:         EventTypeRotation,
+		Status:       StatusFailure,
+		CredentialID: "cred-a",
+		Site:         "git|hub.com",
+		Username:     "user@example.com",
+		Message:      "rotation failed: a=b\nretry",
+		Metadata:     map[string]string{"duration": "2s"},
+		Signature:    []byte{0xde, 0xad},
+	}
+}
+
+// TestEncodeEventNDJSON tests the NDJSON record schema
+func TestEncodeEventNDJSON(t *testing.T) {
+	data, err := EncodeEvent(siemTestEvent(), ReportFormatNDJSON)
+	if err != nil {
+		t.Fatalf("Failed to encode event: %v", err)
+	}
+	if bytes.Contains(data, []byte("\n")) {
+		t.Error("Expected a single-line record")
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("Failed to parse record: %v", err)
+	}
+	if record["id"] != "evt-1" || record["site"] != "git|hub.com" || record["signature"] != "dead" {
+		t.Errorf("Unexpected record: %s", data)
+	}
+	if record["timestamp"] != "2025-03-10T09:00:00Z" {
+		t.Errorf("Expected RFC 3339 timestamp, got %v", record["timestamp"])
+	}
+}
+
+// TestEncodeEventCEF tests CEF header and extension escaping
+func TestEncodeEventCEF(t *testing.T) {
+	data, err := EncodeEvent(siemTestEvent(), ReportFormatCEF)
+	if err != nil {
+		t.Fatalf("Failed to encode event: %v", err)
+	}
+	line := string(data)
+
+	if !strings.HasPrefix(line, "CEF:0|ACM|Automated Compromise Mitigation|") {
+		t.Errorf("Unexpected CEF header: %s", line)
+	}
+	if strings.Contains(line, "\n") {
+		t.Error("Expected newlines to be escaped")
+	}
+	for _, want := range []string{
+		"|rotation|rotation failed: a=b retry|7|",
+		"dhost=git|hub.com",
+		`msg=rotation failed: a\=b\nretry`,
+		"cs1Label=credentialId cs1=cred-a",
+		"rt=1741597200000",
+		"cs3=duration\\=2s",
+	} {
+		if !strings.Contains(line, want) {
+			t.Errorf("Expected CEF record to contain %q, got %s", want, line)
+		}
+	}
+}
+
+// TestEncodeEventOCSF tests mapping to an OCSF Account Change event
+func TestEncodeEventOCSF(t *testing.T) {
+	data, err := EncodeEvent(siemTestEvent(), ReportFormatOCSF)
+	if err != nil {
+		t.Fatalf("Failed to encode event: %v", err)
+	}
+
+	var record ocsfAccountChange
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("Failed to parse record: %v", err)
+	}
+	if record.ClassUID != 3001 || record.CategoryUID != 3 {
+		t.Errorf("Expected Account Change class, got class %d category %d", record.ClassUID, record.CategoryUID)
+	}
+	if record.ActivityID != 3 || record.TypeUID != 300103 {
+		t.Errorf("Expected Password Change activity, got %d (type %d)", record.ActivityID, record.TypeUID)
+	}
+	if record.StatusID != 2 {
+		t.Errorf("Expected failure status, got %d", record.StatusID)
+	}
+	if record.Metadata.UID != "evt-1" || record.User.UID != "cred-a" {
+		t.Errorf("Unexpected identifiers: %+v", record)
+	}
+	if record.DstEndpoint == nil || record.DstEndpoint.Hostname != "git|hub.com" {
+		t.Errorf("Expected destination endpoint, got %+v", record.DstEndpoint)
+	}
+	if record.Unmapped["duration"] != "2s" {
+		t.Errorf("Expected metadata in unmapped, got %v", record.Unmapped)
+	}
+}
+
+// TestExportStreamFormats tests that SIEM exports write one record per event
+func TestExportStreamFormats(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := logger.LogEvent(context.Background(), Event{Type: EventTypeRotation, Status: StatusSuccess}); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	for _, format := range []ReportFormat{ReportFormatNDJSON, ReportFormatCEF, ReportFormatOCSF} {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := logger.ExportReport(context.Background(), Filter{}, format)
+			if err != nil {
+				t.Fatalf("Failed to export report: %v", err)
+			}
+			lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+			if len(lines) != 3 {
+				t.Errorf("Expected 3 records, got %d", len(lines))
+			}
+		})
+	}
+}
+
+// TestExportCSVEscaping tests that CSV fields containing delimiters are quoted
+func TestExportCSVEscaping(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	event := Event{Type: EventTypeRotation, Status: StatusSuccess, Site: "a.com, b.com", Username: `say "hi"`, Message: "line1\nline2"}
+	if err := logger.LogEvent(context.Background(), event); err != nil {
+		t.Fatalf("Failed to log event: %v", err)
+	}
+
+	data, err := logger.ExportReport(context.Background(), Filter{}, ReportFormatCSV)
+	if err != nil {
+		t.Fatalf("Failed to export report: %v", err)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(records) != 2 || len(records[1]) != 8 {
+		t.Fatalf("Expected header and one 8-column row, got %v", records)
+	}
+	if records[1][5] != event.Site || records[1][6] != event.Username || records[1][7] != event.Message {
+		t.Errorf("CSV fields did not round-trip: %v", records[1])
+	}
+}
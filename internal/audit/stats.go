@@ -0,0 +1,478 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TimePeriod specifies the bucket width used for time-series statistics.
+type TimePeriod string
+
+const (
+	// PeriodNone disables time-series output.
+	PeriodNone TimePeriod = ""
+
+	// PeriodHour groups events into hourly buckets.
+	PeriodHour TimePeriod = "hour"
+
+	// PeriodDay groups events into daily buckets (UTC midnight).
+	PeriodDay TimePeriod = "day"
+
+	// PeriodWeek groups events into weekly buckets starting Monday 00:00 UTC.
+	PeriodWeek TimePeriod = "week"
+
+	// PeriodMonth groups events into calendar-month buckets (UTC).
+	PeriodMonth TimePeriod = "month"
+)
+
+// rollupPeriods lists every period the Aggregator maintains rollups for.
+var rollupPeriods = []TimePeriod{PeriodHour, PeriodDay, PeriodWeek, PeriodMonth}
+
+// Statistics summarizes audit events over a time range.
+type Statistics struct {
+	// TotalEvents is the number of events in the range.
+	TotalEvents int64
+
+	// EventsByType breaks the total down by event type.
+	EventsByType map[EventType]int64
+
+	// EventsByStatus breaks the total down by event status.
+	EventsByStatus map[EventStatus]int64
+
+	// SuccessfulRotations counts rotation events with StatusSuccess.
+	SuccessfulRotations int64
+
+	// FailedRotations counts rotation events with StatusFailure.
+	FailedRotations int64
+
+	// HIMInterventions counts HIM events.
+	HIMInterventions int64
+
+	// ComplianceChecks counts ACVS compliance events.
+	ComplianceChecks int64
+
+	// AvgRotationDuration is the mean duration of rotations that recorded one.
+	AvgRotationDuration time.Duration
+
+	// TimeSeries holds one point per period when a grouping was requested.
+	TimeSeries []TimeSeriesPoint
+}
+
+// TimeSeriesPoint holds the statistics for a single time bucket.
+type TimeSeriesPoint struct {
+	// Timestamp is the start of the bucket.
+	Timestamp time.Time
+
+	// EventCount is the number of events in the bucket.
+	EventCount int64
+
+	// EventsByType breaks the bucket down by event type.
+	EventsByType map[EventType]int64
+
+	// SuccessCount is the number of successful events in the bucket.
+	SuccessCount int64
+
+	// FailureCount is the number of failed events in the bucket.
+	FailureCount int64
+}
+
+// rollup accumulates counters for one bucket.
+type rollup struct {
+	total               int64
+	byType              map[EventType]int64
+	byStatus            map[EventStatus]int64
+	rotationSuccess     int64
+	rotationFailure     int64
+	him                 int64
+	compliance          int64
+	rotationDurationSum time.Duration
+	rotationDurationN   int64
+}
+
+func newRollup() *rollup {
+	return &rollup{
+		byType:   make(map[EventType]int64),
+		byStatus: make(map[EventStatus]int64),
+	}
+}
+
+// observe adds a single event to the rollup.
+func (r *rollup) observe(event Event) {
+	r.total++
+	r.byType[event.Type]++
+	r.byStatus[event.Status]++
+
+	switch event.Type {
+	case EventTypeRotation:
+		switch event.Status {
+		case StatusSuccess:
+			r.rotationSuccess++
+		case StatusFailure:
+			r.rotationFailure++
+		}
+		if d, ok := eventDuration(event); ok {
+			r.rotationDurationSum += d
+			r.rotationDurationN++
+		}
+	case EventTypeHIM:
+		r.him++
+	case EventTypeCompliance:
+		r.compliance++
+	}
+}
+
+// point returns the rollup as the time-series point of the bucket starting
+// at bucketStart.
+func (r *rollup) point(bucketStart time.Time) TimeSeriesPoint {
+	byType := make(map[EventType]int64, len(r.byType))
+	for k, v := range r.byType {
+		byType[k] = v
+	}
+
+	return TimeSeriesPoint{
+		Timestamp:    bucketStart,
+		EventCount:   r.total,
+		EventsByType: byType,
+		SuccessCount: r.byStatus[StatusSuccess],
+		FailureCount: r.byStatus[StatusFailure],
+	}
+}
+
+// merge adds the counters of other into r.
+func (r *rollup) merge(other *rollup) {
+	r.total += other.total
+	for k, v := range other.byType {
+		r.byType[k] += v
+	}
+	for k, v := range other.byStatus {
+		r.byStatus[k] += v
+	}
+	r.rotationSuccess += other.rotationSuccess
+	r.rotationFailure += other.rotationFailure
+	r.him += other.him
+	r.compliance += other.compliance
+	r.rotationDurationSum += other.rotationDurationSum
+	r.rotationDurationN += other.rotationDurationN
+}
+
+// Aggregator computes statistics over an audit Logger.
+//
+// Rollups for every TimePeriod are cached and updated incrementally: each
+// call to Statistics only reads events logged since the previous call, so a
+// large log is scanned once. Edge buckets that are only partly covered by
+// the requested range are re-read from the store so totals and time series
+// stay exact.
+//
+// New events are found by their position in logging order, not by
+// timestamp, so an event logged with an older timestamp is still counted.
+// If the logger can't report positions, or more events were logged since
+// the last call than it keeps track of, the rollups are rebuilt from a full
+// scan.
+type Aggregator struct {
+	logger Logger
+
+	mu       sync.Mutex
+	rollups  map[TimePeriod]map[int64]*rollup
+	built    bool
+	position int64               // log position of the next event to fold in
+	overlap  map[string]struct{} // IDs from the last full scan the next read may repeat
+}
+
+// positionReader is implemented by loggers that can list events in the
+// order they were logged, such as MemoryLogger. Positions count events
+// logged by this process.
+type positionReader interface {
+	// logPosition returns the position of the next event to be logged.
+	logPosition() int64
+
+	// eventsSince returns the events logged from position on and the
+	// position after them. ok is false if they are no longer all known.
+	eventsSince(position int64) (events []Event, next int64, ok bool)
+}
+
+// NewAggregator creates an aggregator that reads events from logger.
+func NewAggregator(logger Logger) *Aggregator {
+	return &Aggregator{
+		logger:  logger,
+		rollups: newRollups(),
+	}
+}
+
+// newRollups returns empty rollups for every period.
+func newRollups() map[TimePeriod]map[int64]*rollup {
+	rollups := make(map[TimePeriod]map[int64]*rollup, len(rollupPeriods))
+	for _, p := range rollupPeriods {
+		rollups[p] = make(map[int64]*rollup)
+	}
+	return rollups
+}
+
+// Refresh folds any events logged since the last refresh into the rollups.
+func (a *Aggregator) Refresh(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.refreshLocked(ctx)
+}
+
+func (a *Aggregator) refreshLocked(ctx context.Context) error {
+	reader, ok := a.logger.(positionReader)
+	if !ok {
+		return a.rebuildLocked(ctx, nil)
+	}
+	if !a.built {
+		return a.rebuildLocked(ctx, reader)
+	}
+
+	events, next, ok := reader.eventsSince(a.position)
+	if !ok {
+		return a.rebuildLocked(ctx, reader)
+	}
+	for _, event := range events {
+		if _, seen := a.overlap[event.ID]; seen {
+			continue
+		}
+		a.observeLocked(event)
+	}
+	a.position = next
+	a.overlap = nil
+
+	return nil
+}
+
+// rebuildLocked recomputes the rollups from every logged event, archived
+// ones included. With a reader, the log position is taken before the scan;
+// events logged while it runs may be both scanned and read from that
+// position, so the scanned IDs are kept to skip them once.
+func (a *Aggregator) rebuildLocked(ctx context.Context, reader positionReader) error {
+	var position int64
+	if reader != nil {
+		position = reader.logPosition()
+	}
+
+	events, err := a.logger.QueryEvents(ctx, Filter{IncludeArchive: true})
+	if err != nil {
+		return fmt.Errorf("failed to read audit events: %w", err)
+	}
+
+	a.rollups = newRollups()
+	overlap := make(map[string]struct{}, len(events))
+	for _, event := range events {
+		a.observeLocked(event)
+		if reader != nil {
+			overlap[event.ID] = struct{}{}
+		}
+	}
+
+	if reader != nil {
+		a.built = true
+		a.position = position
+		a.overlap = overlap
+	}
+	return nil
+}
+
+// observeLocked adds event to the rollup of its bucket in every period.
+func (a *Aggregator) observeLocked(event Event) {
+	for _, p := range rollupPeriods {
+		key := truncateToPeriod(event.Timestamp, p).Unix()
+		r, ok := a.rollups[p][key]
+		if !ok {
+			r = newRollup()
+			a.rollups[p][key] = r
+		}
+		r.observe(event)
+	}
+}
+
+// Statistics returns aggregate statistics for events between start and end
+// (inclusive). A zero start or end leaves that side of the range open.
+// When groupBy is not PeriodNone, TimeSeries contains one point per period
+// that overlaps the range; the first and last points count only the events
+// inside the range.
+func (a *Aggregator) Statistics(ctx context.Context, start, end time.Time, groupBy TimePeriod) (*Statistics, error) {
+	if groupBy != PeriodNone && !isValidPeriod(groupBy) {
+		return nil, fmt.Errorf("unsupported time period: %s", groupBy)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err := a.refreshLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	total := newRollup()
+	for key, r := range a.rollups[PeriodHour] {
+		bucketStart := time.Unix(key, 0).UTC()
+		bucketEnd := bucketStart.Add(time.Hour)
+
+		if (!end.IsZero() && bucketStart.After(end)) || (!start.IsZero() && !bucketEnd.After(start)) {
+			continue
+		}
+
+		if (start.IsZero() || !bucketStart.Before(start)) && (end.IsZero() || !bucketEnd.After(end)) {
+			total.merge(r)
+			continue
+		}
+
+		// Partially covered bucket: count only the events inside the range.
+		edge, err := a.scanRange(ctx, maxTime(start, bucketStart), minTime(end, bucketEnd.Add(-time.Nanosecond)))
+		if err != nil {
+			return nil, err
+		}
+		total.merge(edge)
+	}
+
+	stats := &Statistics{
+		TotalEvents:         total.total,
+		EventsByType:        total.byType,
+		EventsByStatus:      total.byStatus,
+		SuccessfulRotations: total.rotationSuccess,
+		FailedRotations:     total.rotationFailure,
+		HIMInterventions:    total.him,
+		ComplianceChecks:    total.compliance,
+	}
+	if total.rotationDurationN > 0 {
+		stats.AvgRotationDuration = total.rotationDurationSum / time.Duration(total.rotationDurationN)
+	}
+
+	if groupBy != PeriodNone {
+		if stats.TimeSeries, err = a.timeSeries(ctx, start, end, groupBy); err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+// timeSeries returns the buckets for period that overlap the range. Buckets
+// only partly inside the range are re-read from the store.
+func (a *Aggregator) timeSeries(ctx context.Context, start, end time.Time, period TimePeriod) ([]TimeSeriesPoint, error) {
+	points := make([]TimeSeriesPoint, 0, len(a.rollups[period]))
+	for key, r := range a.rollups[period] {
+		bucketStart := time.Unix(key, 0).UTC()
+		bucketEnd := nextPeriod(bucketStart, period)
+		if (!end.IsZero() && bucketStart.After(end)) || (!start.IsZero() && !bucketEnd.After(start)) {
+			continue
+		}
+
+		if (!start.IsZero() && bucketStart.Before(start)) || (!end.IsZero() && bucketEnd.After(end)) {
+			edge, err := a.scanRange(ctx, maxTime(start, bucketStart), minTime(end, bucketEnd.Add(-time.Nanosecond)))
+			if err != nil {
+				return nil, err
+			}
+			if edge.total == 0 {
+				continue
+			}
+			r = edge
+		}
+
+		points = append(points, r.point(bucketStart))
+	}
+
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Timestamp.Before(points[j].Timestamp)
+	})
+
+	return points, nil
+}
+
+// scanRange reads events directly from the store and rolls them up.
+func (a *Aggregator) scanRange(ctx context.Context, start, end time.Time) (*rollup, error) {
+	events, err := a.logger.QueryEvents(ctx, Filter{StartTime: start, EndTime: end, IncludeArchive: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit events: %w", err)
+	}
+
+	r := newRollup()
+	for _, event := range events {
+		r.observe(event)
+	}
+
+	return r, nil
+}
+
+// truncateToPeriod returns the start of the bucket containing t.
+func truncateToPeriod(t time.Time, period TimePeriod) time.Time {
+	t = t.UTC()
+	switch period {
+	case PeriodHour:
+		return t.Truncate(time.Hour)
+	case PeriodDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case PeriodWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		offset := (int(day.Weekday()) + 6) % 7 // days since Monday
+		return day.AddDate(0, 0, -offset)
+	case PeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return t
+	}
+}
+
+// nextPeriod returns the start of the bucket after the one starting at
+// bucketStart.
+func nextPeriod(bucketStart time.Time, period TimePeriod) time.Time {
+	switch period {
+	case PeriodHour:
+		return bucketStart.Add(time.Hour)
+	case PeriodDay:
+		return bucketStart.AddDate(0, 0, 1)
+	case PeriodWeek:
+		return bucketStart.AddDate(0, 0, 7)
+	default:
+		return bucketStart.AddDate(0, 1, 0)
+	}
+}
+
+func isValidPeriod(p TimePeriod) bool {
+	for _, known := range rollupPeriods {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
+// eventDuration extracts the operation duration recorded in event metadata.
+// Both "duration" (Go duration string) and "duration_ms" are accepted.
+func eventDuration(event Event) (time.Duration, bool) {
+	if s, ok := event.Metadata["duration"]; ok {
+		if d, err := time.ParseDuration(s); err == nil {
+			return d, true
+		}
+	}
+	if s, ok := event.Metadata["duration_ms"]; ok {
+		var ms int64
+		if _, err := fmt.Sscanf(s, "%d", &ms); err == nil {
+			return time.Duration(ms) * time.Millisecond, true
+		}
+	}
+	return 0, false
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.IsZero() {
+		return b
+	}
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.IsZero() {
+		return b
+	}
+	if b.After(a) {
+		return b
+	}
+	return a
+}
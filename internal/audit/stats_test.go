@@ -0,0 +1,269 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestAggregatorStatistics tests totals and breakdowns
+func TestAggregatorStatistics(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	base := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC) // a Monday
+	events := []Event{
+		{Type: EventTypeRotation, Status: StatusSuccess, Timestamp: base, Metadata: map[string]string{"duration": "2s"}},
+		{Type: EventTypeRotation, Status: StatusSuccess, Timestamp: base.Add(10 * time.Minute), Metadata: map[string]string{"duration_ms": "4000"}},
+		{Type: EventTypeRotation, Status: StatusFailure, Timestamp: base.Add(2 * time.Hour)},
+		{Type: EventTypeHIM, Status: StatusPending, Timestamp: base.Add(26 * time.Hour)},
+		{Type: EventTypeCompliance, Status: StatusSuccess, Timestamp: base.Add(8 * 24 * time.Hour)},
+	}
+	for _, event := range events {
+		if err := logger.LogEvent(context.Background(), event); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	agg := NewAggregator(logger)
+	stats, err := agg.Statistics(context.Background(), time.Time{}, time.Time{}, PeriodNone)
+	if err != nil {
+		t.Fatalf("Failed to compute statistics: %v", err)
+	}
+
+	if stats.TotalEvents != 5 {
+		t.Errorf("Expected 5 events, got %d", stats.TotalEvents)
+	}
+	if stats.EventsByType[EventTypeRotation] != 3 {
+		t.Errorf("Expected 3 rotation events, got %d", stats.EventsByType[EventTypeRotation])
+	}
+	if stats.EventsByStatus[StatusSuccess] != 3 {
+		t.Errorf("Expected 3 successful events, got %d", stats.EventsByStatus[StatusSuccess])
+	}
+	if stats.SuccessfulRotations != 2 || stats.FailedRotations != 1 {
+		t.Errorf("Expected 2/1 rotations, got %d/%d", stats.SuccessfulRotations, stats.FailedRotations)
+	}
+	if stats.HIMInterventions != 1 {
+		t.Errorf("Expected 1 HIM intervention, got %d", stats.HIMInterventions)
+	}
+	if stats.ComplianceChecks != 1 {
+		t.Errorf("Expected 1 compliance check, got %d", stats.ComplianceChecks)
+	}
+	if stats.AvgRotationDuration != 3*time.Second {
+		t.Errorf("Expected 3s average duration, got %v", stats.AvgRotationDuration)
+	}
+}
+
+// TestAggregatorPartialBuckets tests that ranges not aligned to hours are exact
+func TestAggregatorPartialBuckets(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	base := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		event := Event{
+			Type:      EventTypeRotation,
+			Status:    StatusSuccess,
+			Timestamp: base.Add(time.Duration(i) * 20 * time.Minute),
+		}
+		if err := logger.LogEvent(context.Background(), event); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	agg := NewAggregator(logger)
+
+	// 09:30 - 10:30 covers the events at 09:40, 10:00 and 10:20
+	stats, err := agg.Statistics(context.Background(), base.Add(30*time.Minute), base.Add(90*time.Minute), PeriodNone)
+	if err != nil {
+		t.Fatalf("Failed to compute statistics: %v", err)
+	}
+
+	if stats.TotalEvents != 3 {
+		t.Errorf("Expected 3 events, got %d", stats.TotalEvents)
+	}
+}
+
+// TestAggregatorTimeSeriesClipped tests that edge buckets of a time series
+// count only the events inside the range, like the totals
+func TestAggregatorTimeSeriesClipped(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	base := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		event := Event{Type: EventTypeRotation, Status: StatusSuccess, Timestamp: base.Add(time.Duration(i) * 20 * time.Minute)}
+		if err := logger.LogEvent(context.Background(), event); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	// 09:30 - 10:30: one event in the 09:00 bucket, two in the 10:00 bucket
+	stats, err := NewAggregator(logger).Statistics(context.Background(), base.Add(30*time.Minute), base.Add(90*time.Minute), PeriodHour)
+	if err != nil {
+		t.Fatalf("Failed to compute statistics: %v", err)
+	}
+	if len(stats.TimeSeries) != 2 || stats.TimeSeries[0].EventCount != 1 || stats.TimeSeries[1].EventCount != 2 {
+		t.Fatalf("Expected buckets of 1 and 2 events, got %+v", stats.TimeSeries)
+	}
+	if !stats.TimeSeries[0].Timestamp.Equal(base) {
+		t.Errorf("Expected the first bucket to start at %v, got %v", base, stats.TimeSeries[0].Timestamp)
+	}
+}
+
+// TestAggregatorBackdatedEvents tests that events logged with an older
+// timestamp than ones already counted are still picked up, including after
+// more events than the logger keeps in memory were logged
+func TestAggregatorBackdatedEvents(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	logger.broker = NewBroker(logger, 4)
+
+	ts := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	agg := NewAggregator(logger)
+	logAt := func(offsets ...time.Duration) {
+		for _, offset := range offsets {
+			if err := logger.LogEvent(context.Background(), Event{Type: EventTypeSystem, Status: StatusSuccess, Timestamp: ts.Add(offset)}); err != nil {
+				t.Fatalf("Failed to log event: %v", err)
+			}
+		}
+	}
+	total := func() int64 {
+		stats, err := agg.Statistics(context.Background(), time.Time{}, time.Time{}, PeriodNone)
+		if err != nil {
+			t.Fatalf("Failed to compute statistics: %v", err)
+		}
+		return stats.TotalEvents
+	}
+
+	logAt(time.Hour)
+	if n := total(); n != 1 {
+		t.Fatalf("Expected 1 event, got %d", n)
+	}
+
+	logAt(-time.Hour, 0)
+	if n := total(); n != 3 {
+		t.Errorf("Expected back-dated events to be counted, got %d", n)
+	}
+
+	// More than the broker retains: the aggregator rebuilds instead
+	logAt(-2*time.Hour, -3*time.Hour, -4*time.Hour, -5*time.Hour, -6*time.Hour)
+	if n := total(); n != 8 {
+		t.Errorf("Expected 8 events after a rebuild, got %d", n)
+	}
+}
+
+// TestAggregatorIncremental tests that new events are picked up on refresh
+func TestAggregatorIncremental(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	ts := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	agg := NewAggregator(logger)
+
+	for i := 1; i <= 3; i++ {
+		// Same timestamp on purpose: events at the watermark must not be lost or double-counted
+		if err := logger.LogEvent(context.Background(), Event{Type: EventTypeSystem, Status: StatusSuccess, Timestamp: ts}); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+
+		stats, err := agg.Statistics(context.Background(), time.Time{}, time.Time{}, PeriodNone)
+		if err != nil {
+			t.Fatalf("Failed to compute statistics: %v", err)
+		}
+		if stats.TotalEvents != int64(i) {
+			t.Errorf("Expected %d events after refresh, got %d", i, stats.TotalEvents)
+		}
+	}
+}
+
+// TestAggregatorTimeSeries tests hourly, daily and weekly grouping
+func TestAggregatorTimeSeries(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	base := time.Date(2025, 3, 12, 9, 15, 0, 0, time.UTC) // a Wednesday
+	events := []Event{
+		{Type: EventTypeRotation, Status: StatusFailure, Timestamp: base},
+		{Type: EventTypeRotation, Status: StatusSuccess, Timestamp: base},
+		{Type: EventTypeRotation, Status: StatusSuccess, Timestamp: base.Add(30 * time.Minute)},
+		{Type: EventTypeRotation, Status: StatusSuccess, Timestamp: base.Add(2 * time.Hour)},
+		{Type: EventTypeRotation, Status: StatusSuccess, Timestamp: base.Add(24 * time.Hour)},
+		{Type: EventTypeRotation, Status: StatusSuccess, Timestamp: base.Add(7 * 24 * time.Hour)},
+	}
+	for _, event := range events {
+		if err := logger.LogEvent(context.Background(), event); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	agg := NewAggregator(logger)
+
+	tests := []struct {
+		name      string
+		period    TimePeriod
+		buckets   int
+		firstTime time.Time
+		firstN    int64
+	}{
+		{"hourly", PeriodHour, 4, time.Date(2025, 3, 12, 9, 0, 0, 0, time.UTC), 3},
+		{"daily", PeriodDay, 3, time.Date(2025, 3, 12, 0, 0, 0, 0, time.UTC), 4},
+		{"weekly", PeriodWeek, 2, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := agg.Statistics(context.Background(), time.Time{}, time.Time{}, tt.period)
+			if err != nil {
+				t.Fatalf("Failed to compute statistics: %v", err)
+			}
+
+			if len(stats.TimeSeries) != tt.buckets {
+				t.Fatalf("Expected %d buckets, got %d", tt.buckets, len(stats.TimeSeries))
+			}
+
+			first := stats.TimeSeries[0]
+			if !first.Timestamp.Equal(tt.firstTime) {
+				t.Errorf("Expected first bucket at %v, got %v", tt.firstTime, first.Timestamp)
+			}
+			if first.EventCount != tt.firstN {
+				t.Errorf("Expected %d events in first bucket, got %d", tt.firstN, first.EventCount)
+			}
+			if first.FailureCount != 1 {
+				t.Errorf("Expected 1 failure in first bucket, got %d", first.FailureCount)
+			}
+		})
+	}
+}
+
+// TestAggregatorInvalidPeriod tests that unknown periods are rejected
+func TestAggregatorInvalidPeriod(t *testing.T) {
+	logger, err := NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	agg := NewAggregator(logger)
+	if _, err := agg.Statistics(context.Background(), time.Time{}, time.Time{}, TimePeriod("fortnight")); err == nil {
+		t.Error("Expected error for unsupported period")
+	}
+}
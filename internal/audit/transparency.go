@@ -0,0 +1,580 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Errors returned by transparency log operations.
+var (
+	ErrInvalidTreeSize = errors.New("invalid tree size")
+	ErrProofMismatch   = errors.New("proof does not match tree head")
+	ErrBadTreeHeadSig  = errors.New("invalid tree head signature")
+	ErrLeafMismatch    = errors.New("leaf does not match event")
+)
+
+// SignedTreeHead is a signed commitment to the first TreeSize leaves of the
+// transparency log.
+type SignedTreeHead struct {
+	TreeSize  int64     `json:"tree_size"`
+	Timestamp time.Time `json:"timestamp"`
+	RootHash  []byte    `json:"root_hash"`
+	Signature []byte    `json:"signature"`
+}
+
+// InclusionProof proves that an event is leaf LeafIndex of a signed tree.
+type InclusionProof struct {
+	EventID   string         `json:"event_id"`
+	LeafIndex int64          `json:"leaf_index"`
+	LeafData  []byte         `json:"leaf_data"`
+	AuditPath [][]byte       `json:"audit_path"`
+	TreeHead  SignedTreeHead `json:"tree_head"`
+}
+
+// ConsistencyProof proves that the first tree is a prefix of the second.
+type ConsistencyProof struct {
+	FirstTreeHead  SignedTreeHead `json:"first_tree_head"`
+	SecondTreeHead SignedTreeHead `json:"second_tree_head"`
+	Proof          [][]byte       `json:"proof"`
+}
+
+// ProofBundle is the self-contained file format checked by the offline
+// verifier. Exactly one of Inclusion or Consistency is set.
+type ProofBundle struct {
+	Type        string            `json:"type"`
+	Inclusion   *InclusionProof   `json:"inclusion,omitempty"`
+	Consistency *ConsistencyProof `json:"consistency,omitempty"`
+}
+
+// Proof bundle types.
+const (
+	ProofTypeInclusion   = "inclusion"
+	ProofTypeConsistency = "consistency"
+)
+
+// transparencyLeavesFile is the file, next to the archive segments, that
+// persists the transparency log's leaves.
+const transparencyLeavesFile = "transparency.leaves"
+
+// TransparencyLog is an append-only RFC 6962 Merkle tree over audit events.
+// Leaves are the canonical JSON encoding of each event in the order it was
+// logged; archiving an event does not remove its leaf.
+//
+// The hash of every complete subtree is cached as leaves are appended, so
+// roots and proofs need O(log n) cached hashes rather than a pass over
+// every leaf. Once Persist is called the leaf hashes are also written to
+// disk, and the tree continues across restarts: tree heads published by an
+// earlier run can be proven consistent with later ones.
+type TransparencyLog struct {
+	mu sync.RWMutex
+
+	// nodes[level][i] is the root of the i-th complete subtree of 2^level
+	// leaves; nodes[0] holds the leaf hashes.
+	nodes      [][][]byte
+	index      map[string]int64
+	signingKey ed25519.PrivateKey
+	heads      []SignedTreeHead
+
+	file     *os.File // persisted leaves, if Persist was called
+	fileSize int64
+}
+
+// persistedLeaf is one line of the persisted leaves file.
+type persistedLeaf struct {
+	EventID  string `json:"event_id"`
+	LeafHash []byte `json:"leaf_hash"`
+}
+
+// NewTransparencyLog creates an empty log that signs tree heads with signingKey.
+func NewTransparencyLog(signingKey ed25519.PrivateKey) *TransparencyLog {
+	return &TransparencyLog{
+		index:      make(map[string]int64),
+		signingKey: signingKey,
+	}
+}
+
+// Persist loads the leaves stored at path, if any, and appends every new
+// leaf to it from now on. It must be called before any leaf is appended. A
+// leaf cut short by a crash is discarded.
+func (t *TransparencyLog) Persist(path string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.file != nil {
+		return fmt.Errorf("transparency log is already persisted")
+	}
+	if n := t.size(); n > 0 {
+		return fmt.Errorf("transparency log already has %d unpersisted leaves", n)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read transparency log: %w", err)
+	}
+
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	for i, line := range bytes.Split(data[:complete], []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		var leaf persistedLeaf
+		if err := json.Unmarshal(line, &leaf); err != nil || len(leaf.LeafHash) != sha256.Size {
+			return fmt.Errorf("transparency log %s is corrupt at leaf %d", filepath.Base(path), i)
+		}
+		t.index[leaf.EventID] = t.size()
+		t.appendLeaf(leaf.LeafHash)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open transparency log: %w", err)
+	}
+	if complete < len(data) {
+		if err := file.Truncate(int64(complete)); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to discard partial transparency log leaf: %w", err)
+		}
+	}
+	t.file = file
+	t.fileSize = int64(complete)
+	return nil
+}
+
+// Close closes the persisted leaves file, if any.
+func (t *TransparencyLog) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+// Append adds an event as the next leaf.
+func (t *TransparencyLog) Append(event Event) error {
+	data, err := eventLeafData(event)
+	if err != nil {
+		return err
+	}
+	hash := MerkleLeafHash(data)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.file != nil {
+		line, err := json.Marshal(persistedLeaf{EventID: event.ID, LeafHash: hash})
+		if err != nil {
+			return fmt.Errorf("failed to encode transparency log leaf: %w", err)
+		}
+		line = append(line, '\n')
+		if _, err := t.file.Write(line); err != nil {
+			t.file.Truncate(t.fileSize)
+			return fmt.Errorf("failed to persist transparency log leaf: %w", err)
+		}
+		t.fileSize += int64(len(line))
+	}
+
+	t.index[event.ID] = t.size()
+	t.appendLeaf(hash)
+	return nil
+}
+
+// Size returns the number of leaves in the log.
+func (t *TransparencyLog) Size() int64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.size()
+}
+
+// LeafIndex returns the position of an event in the log.
+func (t *TransparencyLog) LeafIndex(eventID string) (int64, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	idx, ok := t.index[eventID]
+	return idx, ok
+}
+
+// SignTreeHead signs the root of the first treeSize leaves. A treeSize of
+// zero or less signs the current tree.
+func (t *TransparencyLog) SignTreeHead(treeSize int64) (*SignedTreeHead, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.signTreeHead(treeSize)
+}
+
+// PublishTreeHead signs the current tree and records it as the latest
+// published head. Publishing is skipped if the tree has not grown.
+func (t *TransparencyLog) PublishTreeHead() (*SignedTreeHead, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if n := len(t.heads); n > 0 && t.heads[n-1].TreeSize == t.size() {
+		head := t.heads[n-1]
+		return &head, nil
+	}
+
+	head, err := t.signTreeHead(0)
+	if err != nil {
+		return nil, err
+	}
+	t.heads = append(t.heads, *head)
+	return head, nil
+}
+
+// LatestTreeHead returns the most recently published tree head, publishing
+// one if none exists yet.
+func (t *TransparencyLog) LatestTreeHead() (*SignedTreeHead, error) {
+	t.mu.RLock()
+	if n := len(t.heads); n > 0 {
+		head := t.heads[n-1]
+		t.mu.RUnlock()
+		return &head, nil
+	}
+	t.mu.RUnlock()
+
+	return t.PublishTreeHead()
+}
+
+// InclusionProof returns the audit path of leafIndex in the tree of
+// treeSize leaves (zero means the current size) and a signed head for it.
+func (t *TransparencyLog) InclusionProof(leafIndex, treeSize int64) ([][]byte, *SignedTreeHead, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if treeSize <= 0 {
+		treeSize = t.size()
+	}
+	if treeSize > t.size() || leafIndex < 0 || leafIndex >= treeSize {
+		return nil, nil, fmt.Errorf("%w: leaf %d not in tree of size %d", ErrInvalidTreeSize, leafIndex, treeSize)
+	}
+
+	head, err := t.signTreeHead(treeSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t.path(leafIndex, 0, treeSize), head, nil
+}
+
+// ConsistencyProof returns a proof that the tree of first leaves is a prefix
+// of the tree of second leaves (zero means the current size).
+func (t *TransparencyLog) ConsistencyProof(first, second int64) (*ConsistencyProof, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if second <= 0 {
+		second = t.size()
+	}
+	if first <= 0 || first > second || second > t.size() {
+		return nil, fmt.Errorf("%w: cannot prove %d against %d (log size %d)", ErrInvalidTreeSize, first, second, t.size())
+	}
+
+	firstHead, err := t.signTreeHead(first)
+	if err != nil {
+		return nil, err
+	}
+	secondHead, err := t.signTreeHead(second)
+	if err != nil {
+		return nil, err
+	}
+
+	var proof [][]byte
+	if first < second {
+		proof = t.subproof(first, 0, second, true)
+	}
+
+	return &ConsistencyProof{
+		FirstTreeHead:  *firstHead,
+		SecondTreeHead: *secondHead,
+		Proof:          proof,
+	}, nil
+}
+
+// signTreeHead signs the tree of treeSize leaves. Persisted leaves are
+// synced first, so a signed head never covers leaves a crash could lose.
+// Caller must hold t.mu.
+func (t *TransparencyLog) signTreeHead(treeSize int64) (*SignedTreeHead, error) {
+	if treeSize <= 0 {
+		treeSize = t.size()
+	}
+	if treeSize > t.size() {
+		return nil, fmt.Errorf("%w: %d exceeds log size %d", ErrInvalidTreeSize, treeSize, t.size())
+	}
+	if t.file != nil {
+		if err := t.file.Sync(); err != nil {
+			return nil, fmt.Errorf("failed to sync transparency log: %w", err)
+		}
+	}
+
+	head := SignedTreeHead{
+		TreeSize:  treeSize,
+		Timestamp: time.Now().UTC().Truncate(time.Millisecond),
+		RootHash:  t.subtreeHash(0, treeSize),
+	}
+	head.Signature = ed25519.Sign(t.signingKey, treeHeadSigningMessage(head))
+	return &head, nil
+}
+
+// VerifyTreeHead checks the signature on a tree head.
+func VerifyTreeHead(publicKey ed25519.PublicKey, head SignedTreeHead) error {
+	if len(publicKey) != ed25519.PublicKeySize || !ed25519.Verify(publicKey, treeHeadSigningMessage(head), head.Signature) {
+		return ErrBadTreeHeadSig
+	}
+	return nil
+}
+
+// Verify checks the tree head signature, that LeafData is included in it
+// and that LeafData is the event named by EventID. Use VerifyEvent to also
+// check the leaf against a copy of the event.
+func (p *InclusionProof) Verify(publicKey ed25519.PublicKey) error {
+	if err := VerifyTreeHead(publicKey, p.TreeHead); err != nil {
+		return err
+	}
+	if err := VerifyInclusion(MerkleLeafHash(p.LeafData), p.LeafIndex, p.TreeHead.TreeSize, p.AuditPath, p.TreeHead.RootHash); err != nil {
+		return err
+	}
+
+	leaf, err := p.LeafEvent()
+	if err != nil {
+		return err
+	}
+	if leaf.ID != p.EventID {
+		return fmt.Errorf("%w: leaf is event %q, not %q", ErrLeafMismatch, leaf.ID, p.EventID)
+	}
+	return nil
+}
+
+// VerifyEvent checks the proof as Verify does and that the proven leaf is
+// exactly event, as stored in the audit log.
+func (p *InclusionProof) VerifyEvent(publicKey ed25519.PublicKey, event Event) error {
+	if err := p.Verify(publicKey); err != nil {
+		return err
+	}
+
+	// Leaves are encoded with empty metadata normalized to nil (see LogEvent)
+	if len(event.Metadata) == 0 {
+		event.Metadata = nil
+	}
+	data, err := eventLeafData(event)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(data, p.LeafData) {
+		return fmt.Errorf("%w: event %s differs from the proven leaf", ErrLeafMismatch, event.ID)
+	}
+	return nil
+}
+
+// LeafEvent decodes LeafData. The result is only authentic once Verify has
+// succeeded.
+func (p *InclusionProof) LeafEvent() (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(p.LeafData, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLeafMismatch, err)
+	}
+	return &event, nil
+}
+
+// Verify checks both tree head signatures and the consistency proof.
+func (p *ConsistencyProof) Verify(publicKey ed25519.PublicKey) error {
+	if err := VerifyTreeHead(publicKey, p.FirstTreeHead); err != nil {
+		return fmt.Errorf("first tree head: %w", err)
+	}
+	if err := VerifyTreeHead(publicKey, p.SecondTreeHead); err != nil {
+		return fmt.Errorf("second tree head: %w", err)
+	}
+	return VerifyConsistency(p.FirstTreeHead.TreeSize, p.SecondTreeHead.TreeSize,
+		p.FirstTreeHead.RootHash, p.SecondTreeHead.RootHash, p.Proof)
+}
+
+// Verify checks whichever proof the bundle contains.
+func (b *ProofBundle) Verify(publicKey ed25519.PublicKey) error {
+	switch {
+	case b.Type == ProofTypeInclusion && b.Inclusion != nil:
+		return b.Inclusion.Verify(publicKey)
+	case b.Type == ProofTypeConsistency && b.Consistency != nil:
+		return b.Consistency.Verify(publicKey)
+	default:
+		return fmt.Errorf("unknown or empty proof bundle type %q", b.Type)
+	}
+}
+
+// VerifyInclusion checks an RFC 6962 audit path (RFC 9162 section 2.1.3.2).
+func VerifyInclusion(leafHash []byte, leafIndex, treeSize int64, path [][]byte, root []byte) error {
+	if leafIndex < 0 || leafIndex >= treeSize {
+		return fmt.Errorf("%w: leaf %d not in tree of size %d", ErrInvalidTreeSize, leafIndex, treeSize)
+	}
+
+	fn, sn := leafIndex, treeSize-1
+	r := leafHash
+	for _, p := range path {
+		if sn == 0 {
+			return ErrProofMismatch
+		}
+		if fn&1 == 1 || fn == sn {
+			r = merkleNodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(r, root) {
+		return ErrProofMismatch
+	}
+	return nil
+}
+
+// VerifyConsistency checks an RFC 6962 consistency proof (RFC 9162 section 2.1.4.2).
+func VerifyConsistency(first, second int64, firstRoot, secondRoot []byte, proof [][]byte) error {
+	switch {
+	case first <= 0 || first > second:
+		return fmt.Errorf("%w: cannot prove %d against %d", ErrInvalidTreeSize, first, second)
+	case first == second:
+		if len(proof) != 0 || !bytes.Equal(firstRoot, secondRoot) {
+			return ErrProofMismatch
+		}
+		return nil
+	case len(proof) == 0:
+		return ErrProofMismatch
+	}
+
+	if first&(first-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrProofMismatch
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = merkleNodeHash(c, fr)
+			sr = merkleNodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = merkleNodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(fr, firstRoot) || !bytes.Equal(sr, secondRoot) {
+		return ErrProofMismatch
+	}
+	return nil
+}
+
+// size returns the number of leaves. Caller must hold t.mu.
+func (t *TransparencyLog) size() int64 {
+	if len(t.nodes) == 0 {
+		return 0
+	}
+	return int64(len(t.nodes[0]))
+}
+
+// appendLeaf adds a leaf hash and the hashes of the subtrees it completes.
+// Caller must hold t.mu for writing.
+func (t *TransparencyLog) appendLeaf(hash []byte) {
+	if len(t.nodes) == 0 {
+		t.nodes = append(t.nodes, nil)
+	}
+	t.nodes[0] = append(t.nodes[0], hash)
+
+	for level, i := 0, len(t.nodes[0])-1; i&1 == 1; level, i = level+1, i>>1 {
+		parent := merkleNodeHash(t.nodes[level][i-1], t.nodes[level][i])
+		if len(t.nodes) == level+1 {
+			t.nodes = append(t.nodes, nil)
+		}
+		t.nodes[level+1] = append(t.nodes[level+1], parent)
+	}
+}
+
+// subtreeHash returns MTH(D[start:end]). Complete subtrees aligned to their
+// size are read from the cache; RFC 6962 splits any other range into such
+// subtrees. Caller must hold t.mu.
+func (t *TransparencyLog) subtreeHash(start, end int64) []byte {
+	n := end - start
+	if n == 0 {
+		return MerkleTreeHash(nil)
+	}
+	if n&(n-1) == 0 && start%n == 0 {
+		level := bits.TrailingZeros64(uint64(n))
+		return t.nodes[level][start>>level]
+	}
+
+	k := int64(largestPowerOfTwoBelow(int(n)))
+	return merkleNodeHash(t.subtreeHash(start, start+k), t.subtreeHash(start+k, end))
+}
+
+// path computes PATH(m, D[start:end]) from RFC 6962 section 2.1.1, with m
+// relative to start. Caller must hold t.mu.
+func (t *TransparencyLog) path(m, start, end int64) [][]byte {
+	n := end - start
+	if n <= 1 {
+		return nil
+	}
+
+	k := int64(largestPowerOfTwoBelow(int(n)))
+	if m < k {
+		return append(t.path(m, start, start+k), t.subtreeHash(start+k, end))
+	}
+	return append(t.path(m-k, start+k, end), t.subtreeHash(start, start+k))
+}
+
+// subproof computes SUBPROOF(m, D[start:end], b) from RFC 6962 section
+// 2.1.2, with m relative to start. Caller must hold t.mu.
+func (t *TransparencyLog) subproof(m, start, end int64, b bool) [][]byte {
+	n := end - start
+	if m == n {
+		if b {
+			return nil
+		}
+		return [][]byte{t.subtreeHash(start, end)}
+	}
+
+	k := int64(largestPowerOfTwoBelow(int(n)))
+	if m <= k {
+		return append(t.subproof(m, start, start+k, b), t.subtreeHash(start+k, end))
+	}
+	return append(t.subproof(m-k, start+k, end, false), t.subtreeHash(start, start+k))
+}
+
+// treeHeadSigningMessage returns the bytes covered by a tree head signature.
+func treeHeadSigningMessage(head SignedTreeHead) []byte {
+	return []byte(fmt.Sprintf("acm-sth-v1|%d|%d|%x", head.TreeSize, head.Timestamp.UnixMilli(), head.RootHash))
+}
+
+// eventLeafData returns the canonical encoding of an event used as a Merkle leaf.
+func eventLeafData(event Event) ([]byte, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,255 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestTransparencyLog(t *testing.T, n int) (*TransparencyLog, ed25519.PublicKey) {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	tlog := NewTransparencyLog(privateKey)
+	for i := 0; i < n; i++ {
+		if err := tlog.Append(Event{ID: fmt.Sprintf("evt-%d", i), Type: EventTypeRotation, Status: StatusSuccess}); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+	}
+	return tlog, publicKey
+}
+
+// TestInclusionProofs tests every leaf against every tree size
+func TestInclusionProofs(t *testing.T) {
+	tlog, publicKey := newTestTransparencyLog(t, 17)
+
+	for size := int64(1); size <= 17; size++ {
+		for index := int64(0); index < size; index++ {
+			path, head, err := tlog.InclusionProof(index, size)
+			if err != nil {
+				t.Fatalf("Failed to build proof for %d/%d: %v", index, size, err)
+			}
+			if err := VerifyTreeHead(publicKey, *head); err != nil {
+				t.Fatalf("Tree head %d failed verification: %v", size, err)
+			}
+
+			tlog.mu.RLock()
+			leaf := tlog.nodes[0][index]
+			root := MerkleTreeHash(tlog.nodes[0][:size])
+			tlog.mu.RUnlock()
+
+			if !bytes.Equal(head.RootHash, root) {
+				t.Fatalf("Cached root of tree %d differs from the recomputed root", size)
+			}
+
+			if err := VerifyInclusion(leaf, index, size, path, head.RootHash); err != nil {
+				t.Errorf("Proof for leaf %d in tree %d failed: %v", index, size, err)
+			}
+
+			// A proof must not verify for a different leaf
+			other := MerkleLeafHash([]byte("forged"))
+			if err := VerifyInclusion(other, index, size, path, head.RootHash); err == nil {
+				t.Errorf("Forged leaf %d in tree %d verified", index, size)
+			}
+		}
+	}
+}
+
+// TestConsistencyProofs tests every pair of tree sizes
+func TestConsistencyProofs(t *testing.T) {
+	tlog, publicKey := newTestTransparencyLog(t, 17)
+
+	for first := int64(1); first <= 17; first++ {
+		for second := first; second <= 17; second++ {
+			proof, err := tlog.ConsistencyProof(first, second)
+			if err != nil {
+				t.Fatalf("Failed to build proof %d->%d: %v", first, second, err)
+			}
+			if err := proof.Verify(publicKey); err != nil {
+				t.Errorf("Consistency %d->%d failed: %v", first, second, err)
+			}
+
+			// Swapping in a different old root must fail
+			if first < second {
+				forged := append([]byte(nil), proof.FirstTreeHead.RootHash...)
+				forged[0] ^= 0xff
+				err := VerifyConsistency(first, second, forged, proof.SecondTreeHead.RootHash, proof.Proof)
+				if !errors.Is(err, ErrProofMismatch) {
+					t.Errorf("Forged root %d->%d verified", first, second)
+				}
+			}
+		}
+	}
+
+	if _, err := tlog.ConsistencyProof(5, 18); !errors.Is(err, ErrInvalidTreeSize) {
+		t.Errorf("Expected ErrInvalidTreeSize, got %v", err)
+	}
+}
+
+// TestTreeHeadSignature tests that altered tree heads are rejected
+func TestTreeHeadSignature(t *testing.T) {
+	tlog, publicKey := newTestTransparencyLog(t, 3)
+
+	head, err := tlog.PublishTreeHead()
+	if err != nil {
+		t.Fatalf("Failed to publish tree head: %v", err)
+	}
+	if err := VerifyTreeHead(publicKey, *head); err != nil {
+		t.Fatalf("Failed to verify tree head: %v", err)
+	}
+
+	tampered := *head
+	tampered.TreeSize = 2
+	if err := VerifyTreeHead(publicKey, tampered); !errors.Is(err, ErrBadTreeHeadSig) {
+		t.Errorf("Expected ErrBadTreeHeadSig, got %v", err)
+	}
+
+	otherKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	if err := VerifyTreeHead(otherKey, *head); err == nil {
+		t.Error("Expected verification with the wrong key to fail")
+	}
+
+	// Publishing again without growth returns the same head
+	again, _ := tlog.PublishTreeHead()
+	if again.TreeSize != head.TreeSize || !again.Timestamp.Equal(head.Timestamp) {
+		t.Error("Expected unchanged tree head when the log has not grown")
+	}
+}
+
+// TestEventInclusionProofBundle tests an end-to-end proof through a JSON bundle
+func TestEventInclusionProofBundle(t *testing.T) {
+	logger := newArchiveTestLogger(t, 6, time.Now().Add(-24*time.Hour))
+	defer logger.Close()
+
+	events, _ := logger.QueryEvents(context.Background(), Filter{})
+	target := events[1]
+
+	// Archive the event; its leaf must remain provable
+	if _, err := logger.ApplyRetention(context.Background(), RetentionPolicy{MaxEvents: 2}); err != nil {
+		t.Fatalf("Failed to apply retention: %v", err)
+	}
+
+	proof, err := logger.EventInclusionProof(context.Background(), target.ID, 0)
+	if err != nil {
+		t.Fatalf("Failed to build inclusion proof: %v", err)
+	}
+	if proof.LeafIndex != 1 {
+		t.Errorf("Expected leaf index 1, got %d", proof.LeafIndex)
+	}
+
+	data, err := json.Marshal(ProofBundle{Type: ProofTypeInclusion, Inclusion: proof})
+	if err != nil {
+		t.Fatalf("Failed to encode bundle: %v", err)
+	}
+
+	var bundle ProofBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatalf("Failed to decode bundle: %v", err)
+	}
+	if err := bundle.Verify(logger.PublicKey()); err != nil {
+		t.Fatalf("Failed to verify bundle: %v", err)
+	}
+
+	// The leaf must be the stored event, as exported to JSON
+	var exported Event
+	if data, err := json.Marshal(target); err != nil || json.Unmarshal(data, &exported) != nil {
+		t.Fatalf("Failed to round-trip event: %v", err)
+	}
+	if err := bundle.Inclusion.VerifyEvent(logger.PublicKey(), exported); err != nil {
+		t.Errorf("Failed to verify proof against the stored event: %v", err)
+	}
+	if err := bundle.Inclusion.VerifyEvent(logger.PublicKey(), events[2]); !errors.Is(err, ErrLeafMismatch) {
+		t.Errorf("Expected ErrLeafMismatch for another event, got %v", err)
+	}
+
+	// A valid proof relabelled with another event ID proves nothing
+	relabelled := *bundle.Inclusion
+	relabelled.EventID = events[2].ID
+	if err := relabelled.Verify(logger.PublicKey()); !errors.Is(err, ErrLeafMismatch) {
+		t.Errorf("Expected ErrLeafMismatch, got %v", err)
+	}
+
+	// Altering the event data must break the proof
+	bundle.Inclusion.LeafData = []byte(`{"ID":"forged"}`)
+	if err := bundle.Verify(logger.PublicKey()); !errors.Is(err, ErrProofMismatch) {
+		t.Errorf("Expected ErrProofMismatch, got %v", err)
+	}
+}
+
+// TestTransparencyLogPersists tests that a persisted log continues after a
+// restart and proves consistency with heads published before it
+func TestTransparencyLogPersists(t *testing.T) {
+	dir := t.TempDir()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	open := func() *MemoryLogger {
+		logger, err := NewMemoryLoggerWithKey(key)
+		if err != nil {
+			t.Fatalf("Failed to create logger: %v", err)
+		}
+		if err := logger.EnableArchive(dir); err != nil {
+			t.Fatalf("Failed to enable archive: %v", err)
+		}
+		return logger
+	}
+	logEvents := func(logger *MemoryLogger, n int) {
+		for i := 0; i < n; i++ {
+			if err := logger.LogEvent(context.Background(), Event{Type: EventTypeRotation, Status: StatusSuccess}); err != nil {
+				t.Fatalf("Failed to log event: %v", err)
+			}
+		}
+	}
+
+	first := open()
+	logEvents(first, 5)
+	oldHead, err := first.TransparencyLog().PublishTreeHead()
+	if err != nil {
+		t.Fatalf("Failed to publish tree head: %v", err)
+	}
+	firstEvents, _ := first.QueryEvents(context.Background(), Filter{})
+	first.Close()
+
+	// A leaf cut short by a crash is dropped on the next start
+	file, err := os.OpenFile(filepath.Join(dir, transparencyLeavesFile), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("Failed to open leaves file: %v", err)
+	}
+	file.WriteString(`{"event_id":"torn`)
+	file.Close()
+
+	restarted := open()
+	defer restarted.Close()
+	if size := restarted.TransparencyLog().Size(); size != 5 {
+		t.Fatalf("Expected 5 leaves after restart, got %d", size)
+	}
+	if index, ok := restarted.TransparencyLog().LeafIndex(firstEvents[4].ID); !ok || index != 4 {
+		t.Errorf("Expected event from the first run at leaf 4, got %d (%v)", index, ok)
+	}
+
+	logEvents(restarted, 3)
+	proof, err := restarted.TransparencyLog().ConsistencyProof(oldHead.TreeSize, 0)
+	if err != nil {
+		t.Fatalf("Failed to build consistency proof: %v", err)
+	}
+	if proof.SecondTreeHead.TreeSize != 8 || !bytes.Equal(proof.FirstTreeHead.RootHash, oldHead.RootHash) {
+		t.Fatalf("Expected a proof from the old head to 8 leaves, got %d", proof.SecondTreeHead.TreeSize)
+	}
+	if err := proof.Verify(key.Public().(ed25519.PublicKey)); err != nil {
+		t.Errorf("Consistency proof across the restart failed: %v", err)
+	}
+}
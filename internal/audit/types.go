@@ -86,15 +86,47 @@ type Filter struct {
 	// CredentialID filters by credential ID.
 	CredentialID string
 
-	// Site filters by site name.
+	// EventTypes, Statuses and CredentialIDs, when not empty, restrict
+	// results to events matching any of their values. They apply in
+	// addition to EventType, Status and CredentialID.
+	EventTypes    []EventType
+	Statuses      []EventStatus
+	CredentialIDs []string
+
+	// Site filters by site name. Sites are compared case-insensitively,
+	// ignoring any URL scheme, port or path.
 	Site string
 
+	// SiteMatch selects exact or registrable-domain (eTLD+1) site matching.
+	SiteMatch SiteMatch
+
+	// Metadata requires every predicate to hold for the event metadata.
+	Metadata []MetadataPredicate
+
+	// MessageContains filters by a case-insensitive substring of Message.
+	MessageContains string
+
+	// UsernameHash filters by the hex SHA-256 of the username (see HashUsername).
+	UsernameHash string
+
 	// StartTime filters events after this time.
 	StartTime time.Time
 
 	// EndTime filters events before this time.
 	EndTime time.Time
 
+	// IncludeArchive reads sealed archive segments even when the filter
+	// has no time range. Bounded filters read the archive whenever their
+	// range overlaps it.
+	IncludeArchive bool
+
+	// Order sorts results by timestamp (default oldest first).
+	Order SortOrder
+
+	// Cursor resumes a query after the last event of a previous page.
+	// Cursors are opaque and only valid with the same sort order.
+	Cursor string
+
 	// Limit restricts the number of results returned.
 	Limit int
 }
@@ -114,4 +146,13 @@ const (
 
 	// ReportFormatHTML exports as HTML.
 	ReportFormatHTML ReportFormat = "html"
+
+	// ReportFormatNDJSON exports one JSON object per line.
+	ReportFormatNDJSON ReportFormat = "ndjson"
+
+	// ReportFormatCEF exports ArcSight Common Event Format records.
+	ReportFormatCEF ReportFormat = "cef"
+
+	// ReportFormatOCSF exports OCSF Account Change events, one per line.
+	ReportFormatOCSF ReportFormat = "ocsf"
 )
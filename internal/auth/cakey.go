@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// CAPassphraseEnv names the environment variable holding the passphrase
+// that encrypts the CA key. Without it the CA key is not kept, and no
+// further client certificates can be issued.
+const CAPassphraseEnv = "ACM_CA_PASSPHRASE"
+
+// Argon2id parameters for deriving the CA key encryption key.
+const (
+	caKDFTime    = 3
+	caKDFMemory  = 64 * 1024
+	caKDFThreads = 4
+)
+
+// caKeyAD binds the ciphertext to its purpose.
+var caKeyAD = []byte("acm-ca-key-v1")
+
+// encryptedCAKey is the on-disk form of the passphrase-encrypted CA key.
+type encryptedCAKey struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Key     []byte `json:"key"`
+}
+
+// saveEncryptedCAKey writes key to path, encrypted with a key derived from
+// passphrase (Argon2id, XChaCha20-Poly1305), with 0600 permissions.
+func saveEncryptedCAKey(path string, key *rsa.PrivateKey, passphrase []byte) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	aead, err := chacha20poly1305.NewX(caKeyEncryptionKey(passphrase, salt))
+	if err != nil {
+		return fmt.Errorf("failed to create CA key cipher: %w", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	data, err := json.MarshalIndent(encryptedCAKey{
+		Version: 1,
+		KDF:     "argon2id",
+		Salt:    salt,
+		Key:     aead.Seal(nonce, nonce, x509.MarshalPKCS1PrivateKey(key), caKeyAD),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode CA key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create CA key directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write CA key: %w", err)
+	}
+	return nil
+}
+
+// loadEncryptedCAKey reads the CA key written by saveEncryptedCAKey.
+func loadEncryptedCAKey(path string, passphrase []byte) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("CA key was not kept: certificates created without %s cannot issue more; remove the certificate directory to regenerate them", CAPassphraseEnv)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key: %w", err)
+	}
+
+	var encrypted encryptedCAKey
+	if err := json.Unmarshal(data, &encrypted); err != nil {
+		return nil, fmt.Errorf("failed to parse CA key file: %w", err)
+	}
+	if encrypted.Version != 1 || encrypted.KDF != "argon2id" {
+		return nil, fmt.Errorf("unsupported CA key file version %d (%s)", encrypted.Version, encrypted.KDF)
+	}
+
+	aead, err := chacha20poly1305.NewX(caKeyEncryptionKey(passphrase, encrypted.Salt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA key cipher: %w", err)
+	}
+	if len(encrypted.Key) < aead.NonceSize() {
+		return nil, fmt.Errorf("CA key file is corrupt")
+	}
+	nonce, ciphertext := encrypted.Key[:aead.NonceSize()], encrypted.Key[aead.NonceSize():]
+	der, err := aead.Open(nil, nonce, ciphertext, caKeyAD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt CA key (wrong passphrase?)")
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA key: %w", err)
+	}
+	return key, nil
+}
+
+func caKeyEncryptionKey(passphrase, salt []byte) []byte {
+	return argon2.IDKey(passphrase, salt, caKDFTime, caKDFMemory, caKDFThreads, chacha20poly1305.KeySize)
+}
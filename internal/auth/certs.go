@@ -15,12 +15,15 @@ import (
 	"math/big"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 // CertManager handles certificate generation and loading for mTLS.
 type CertManager struct {
-	certDir string
+	certDir      string
+	caKeyPath    string
+	caPassphrase []byte
 }
 
 // NewCertManager creates a new certificate manager.
@@ -32,9 +35,20 @@ func NewCertManager(certDir string) *CertManager {
 	}
 	return &CertManager{
 		certDir: certDir,
+		// The CA key lives outside the certificate directory, so anyone
+		// given that directory can't issue certificates of their own
+		caKeyPath: filepath.Join(filepath.Dir(certDir), "ca", "ca-key.json"),
 	}
 }
 
+// SetCAPassphrase sets the passphrase that encrypts the CA key. With a
+// passphrase the CA key is kept, encrypted, so further client certificates
+// can be issued; without one it is discarded once the initial certificates
+// are created.
+func (cm *CertManager) SetCAPassphrase(passphrase []byte) {
+	cm.caPassphrase = passphrase
+}
+
 // EnsureCertificates generates certificates if they don't exist.
 func (cm *CertManager) EnsureCertificates() error {
 	// Create directory if it doesn't exist
@@ -51,7 +65,7 @@ func (cm *CertManager) EnsureCertificates() error {
 	// Check if certificates exist
 	if fileExists(serverCertPath) && fileExists(serverKeyPath) &&
 		fileExists(clientCertPath) && fileExists(clientKeyPath) && fileExists(caPath) {
-		return nil // Certificates already exist
+		return cm.migrateCAKey() // Certificates already exist
 	}
 
 	// Generate CA certificate
@@ -65,6 +79,14 @@ func (cm *CertManager) EnsureCertificates() error {
 		return err
 	}
 
+	// Keep the CA key, encrypted, only if further client certificates (one
+	// per approver) are to be issued
+	if len(cm.caPassphrase) > 0 {
+		if err := saveEncryptedCAKey(cm.caKeyPath, caKey, cm.caPassphrase); err != nil {
+			return err
+		}
+	}
+
 	// Generate server certificate
 	serverCert, serverKey, err := generateCertificate(caCert, caKey, "localhost", true)
 	if err != nil {
@@ -122,6 +144,24 @@ func (cm *CertManager) GetServerTLSConfig() (*tls.Config, error) {
 	}, nil
 }
 
+// GetWebTLSConfig returns the TLS config for the local browser prompt page.
+// Browsers don't present client certificates, so unlike the gRPC server it
+// doesn't ask for one; the page authenticates browsers itself.
+func (cm *CertManager) GetWebTLSConfig() (*tls.Config, error) {
+	serverCert, err := tls.LoadX509KeyPair(
+		filepath.Join(cm.certDir, "server-cert.pem"),
+		filepath.Join(cm.certDir, "server-key.pem"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
 // GetClientTLSConfig returns the TLS config for gRPC clients.
 func (cm *CertManager) GetClientTLSConfig() (*tls.Config, error) {
 	clientCert, err := tls.LoadX509KeyPair(
@@ -150,6 +190,105 @@ func (cm *CertManager) GetClientTLSConfig() (*tls.Config, error) {
 	}, nil
 }
 
+// IssueClientCertificate issues a client certificate for commonName, signed
+// by the local CA, and returns the paths of the certificate and key. Each
+// person who approves HIM requests needs their own certificate, since the
+// common name identifies them.
+func (cm *CertManager) IssueClientCertificate(commonName string) (certPath, keyPath string, err error) {
+	if commonName == "" || strings.ContainsAny(commonName, `/\`) || strings.HasPrefix(commonName, ".") {
+		return "", "", fmt.Errorf("invalid common name %q", commonName)
+	}
+
+	caCert, caKey, err := cm.loadCA()
+	if err != nil {
+		return "", "", err
+	}
+
+	cert, key, err := generateCertificate(caCert, caKey, commonName, false)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate client certificate: %w", err)
+	}
+
+	clientDir := filepath.Join(cm.certDir, "clients")
+	if err := os.MkdirAll(clientDir, 0700); err != nil {
+		return "", "", fmt.Errorf("failed to create client cert directory: %w", err)
+	}
+	certPath = filepath.Join(clientDir, commonName+"-cert.pem")
+	keyPath = filepath.Join(clientDir, commonName+"-key.pem")
+	if fileExists(certPath) {
+		return "", "", fmt.Errorf("a certificate for %s already exists", commonName)
+	}
+	if err := saveCertificate(certPath, cert); err != nil {
+		return "", "", err
+	}
+	if err := savePrivateKey(keyPath, key); err != nil {
+		return "", "", err
+	}
+	return certPath, keyPath, nil
+}
+
+// loadCA loads the CA certificate and decrypts the CA key.
+func (cm *CertManager) loadCA() (*x509.Certificate, *rsa.PrivateKey, error) {
+	if len(cm.caPassphrase) == 0 {
+		return nil, nil, fmt.Errorf("issuing certificates needs the CA passphrase in %s", CAPassphraseEnv)
+	}
+
+	certPEM, err := os.ReadFile(filepath.Join(cm.certDir, "ca-cert.pem"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, nil, fmt.Errorf("failed to decode CA PEM")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	key, err := loadEncryptedCAKey(cm.caKeyPath, cm.caPassphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		return nil, nil, fmt.Errorf("CA key does not match the CA certificate")
+	}
+	return cert, key, nil
+}
+
+// migrateCAKey moves a CA key left unencrypted in the certificate directory
+// by earlier versions: it is encrypted to the CA key path if a passphrase
+// is set, and deleted either way.
+func (cm *CertManager) migrateCAKey() error {
+	legacyPath := filepath.Join(cm.certDir, "ca-key.pem")
+	if !fileExists(legacyPath) {
+		return nil
+	}
+
+	if len(cm.caPassphrase) > 0 && !fileExists(cm.caKeyPath) {
+		keyPEM, err := os.ReadFile(legacyPath)
+		if err != nil {
+			return fmt.Errorf("failed to read CA key: %w", err)
+		}
+		block, _ := pem.Decode(keyPEM)
+		if block == nil {
+			return fmt.Errorf("failed to decode CA key PEM")
+		}
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse CA key: %w", err)
+		}
+		if err := saveEncryptedCAKey(cm.caKeyPath, key, cm.caPassphrase); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(legacyPath); err != nil {
+		return fmt.Errorf("failed to remove unencrypted CA key: %w", err)
+	}
+	return nil
+}
+
 // Helper functions
 
 func generateCA() (*x509.Certificate, *rsa.PrivateKey, error) {
@@ -25,6 +25,13 @@
 //	└── Tauri GUI Client Certificate (client cert)
 //	    └── CN: acm-gui-<device-id>
 //
+// The CA key is never written to the certificate directory. If
+// ACM_CA_PASSPHRASE is set when the CA is created it is kept in
+// ~/.acm/ca, encrypted with a key derived from the passphrase, and
+// "acm-cli issue-client-cert" needs the same passphrase to issue approver
+// certificates. Otherwise it is discarded once the initial certificates
+// exist.
+//
 // # TLS Configuration
 //
 //   - TLS 1.3 required (no fallback to older versions)
@@ -0,0 +1,185 @@
+package crs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/him"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/pwmanager"
+)
+
+// requireApproval asks the HIM policy whether rotating cred needs a human
+// before the vault is written. handled lists the HIM types the caller deals
+// with itself, such as the manual rotation a site-first rotation is.
+//
+// When the policy requires approval, as it does for shared credentials when
+// an approval policy is configured, requireApproval opens a HIMApproval
+// session and returns a result with Status RotationHIMRequired and the
+// session in HIMSessionID. Once the session is approved the policy is asked
+// again, and rotate runs only if nothing else the caller can't handle is
+// required; it never runs if the session is cancelled or expires. Any other
+// HIM type the caller doesn't handle is refused with RotationHIMRequired. A
+// nil result means rotation may go ahead now.
+//
+// The pending rotation, with its new password, is held in memory only: if
+// ACM restarts before the approval completes, the rotation must be
+// requested again.
+func (s *Service) requireApproval(ctx context.Context, cred pwmanager.CompromisedCredential, method RotationMethod, handled []him.HIMType, rotate func(ctx context.Context) error) (*RotationResult, error) {
+	if s.himManager == nil || s.pwManager == nil {
+		return nil, nil
+	}
+
+	startTime := time.Now()
+	result := &RotationResult{
+		CredentialID: hashCredentialID(cred.ID),
+		Status:       RotationHIMRequired,
+		StartTime:    startTime,
+	}
+	fail := func(rerr *RotationError) (*RotationResult, error) {
+		result.Status = RotationFailure
+		result.Error = rerr
+		result.EndTime = time.Now()
+		result.Duration = result.EndTime.Sub(startTime)
+		return result, rerr
+	}
+	needsHIM := func(himType him.HIMType, message string) (*RotationResult, error) {
+		result.Error = &RotationError{
+			Code:    ErrHIMRequired,
+			Message: message,
+			HIMType: rotationHIMType(himType),
+		}
+		result.EndTime = time.Now()
+		result.Duration = result.EndTime.Sub(startTime)
+		return result, result.Error
+	}
+
+	// Without the vault item it is unknown whether the credential is
+	// shared, so don't rotate
+	meta, err := s.pwManager.GetCredential(ctx, cred.ID)
+	if err != nil {
+		rerr := &RotationError{
+			Code:    ErrUpdateFailed,
+			Message: fmt.Sprintf("Failed to read credential before rotation: %v", err),
+			Cause:   err,
+		}
+		if pmErr, ok := err.(*pwmanager.PasswordManagerError); ok {
+			rerr.Retryable = pmErr.Retryable
+			if pmErr.Code == pwmanager.ErrVaultLocked {
+				rerr.Code = ErrVaultLocked
+			}
+		}
+		return fail(rerr)
+	}
+	site := cred.Site
+	if site == "" {
+		site = meta.Site
+	}
+
+	action := him.RotationAction{
+		CredentialID: cred.ID,
+		Site:         site,
+		ActionType:   him.ActionPasswordChange,
+		Method:       string(method),
+		Credential:   credentialMetadata(meta),
+		Timestamp:    startTime,
+	}
+	required, himType, err := s.himManager.RequiresHIM(ctx, action)
+	if err != nil {
+		return fail(&RotationError{
+			Code:    ErrComplianceViolation,
+			Message: fmt.Sprintf("Rotation not allowed: %v", err),
+			Cause:   err,
+		})
+	}
+	if !required || handlesHIM(handled, himType) {
+		return nil, nil
+	}
+	if himType != him.HIMApproval {
+		return needsHIM(himType, fmt.Sprintf("Rotating the credential for %s needs %s, which %s rotation can't provide", site, himType, method))
+	}
+
+	credentialID := result.CredentialID
+	sessionID, err := s.himManager.Pause(ctx, action, him.HIMPrompt{Type: him.HIMApproval, Site: site},
+		func(ctx context.Context, response *him.HIMResponse) error {
+			if response.CancelRequested || !response.Confirmed {
+				s.logApproval(ctx, credentialID, site, audit.StatusFailure, "Rotation of shared credential not approved", response.SessionID)
+				return nil
+			}
+
+			// Approval doesn't waive what else the policy requires
+			action.ApprovalSessionID = response.SessionID
+			required, himType, err := s.himManager.RequiresHIM(ctx, action)
+			if err == nil && required && !handlesHIM(handled, himType) {
+				err = fmt.Errorf("rotation also needs %s", himType)
+			}
+			if err != nil {
+				s.logApproval(ctx, credentialID, site, audit.StatusFailure, fmt.Sprintf("Rotation of shared credential approved but not allowed: %v", err), response.SessionID)
+				return err
+			}
+
+			s.logApproval(ctx, credentialID, site, audit.StatusSuccess, "Rotation of shared credential approved", response.SessionID)
+			return rotate(ctx)
+		})
+	if err != nil {
+		return fail(&RotationError{
+			Code:    ErrHIMRequired,
+			Message: fmt.Sprintf("Failed to request approval: %v", err),
+			Cause:   err,
+			HIMType: HIMApproval,
+		})
+	}
+	s.logApproval(ctx, credentialID, site, audit.StatusPending, "Rotation of shared credential waiting for approval", sessionID)
+
+	result.HIMSessionID = sessionID
+	return needsHIM(him.HIMApproval, fmt.Sprintf("Rotating the shared credential for %s needs approval; it will start once approval session %s is approved", site, sessionID))
+}
+
+// handlesHIM reports whether himType is one of handled.
+func handlesHIM(handled []him.HIMType, himType him.HIMType) bool {
+	for _, h := range handled {
+		if h == himType {
+			return true
+		}
+	}
+	return false
+}
+
+// rotationHIMType maps a HIM session type to the HIMType of a rotation
+// error. Site challenges other than a CAPTCHA are reported as MFA.
+func rotationHIMType(himType him.HIMType) HIMType {
+	switch himType {
+	case him.HIMApproval:
+		return HIMApproval
+	case him.HIMManualRotation:
+		return HIMManualRotation
+	case him.HIMToSReview:
+		return HIMToSReview
+	case him.HIMCAPTCHA:
+		return HIMCAPTCHA
+	default:
+		return HIMMFA
+	}
+}
+
+// logApproval records a step of an approval gate in the audit log.
+func (s *Service) logApproval(ctx context.Context, credentialID, site string, status audit.EventStatus, message, sessionID string) {
+	if s.auditLogger == nil {
+		return
+	}
+	_ = s.auditLogger.LogEvent(ctx, audit.Event{
+		Type:         audit.EventTypeRotation,
+		Status:       status,
+		CredentialID: credentialID,
+		Site:         site,
+		Message:      message,
+		Timestamp:    time.Now(),
+		Metadata:     map[string]string{"him_session_id": sessionID, "him_type": string(HIMApproval)},
+	})
+}
+
+// credentialMetadata describes a vault item as far as HIM policy needs.
+func credentialMetadata(meta *pwmanager.Credential) him.CredentialMetadata {
+	return him.CredentialMetadata{HasTOTP: meta.HasTOTP, Shared: meta.Shared}
+}
@@ -0,0 +1,238 @@
+package crs
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	acmv1 "github.com/ferg-cod3s/automated-compromise-mitigation/api/proto/acm/v1"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/acvs/evidence"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/him"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/pwmanager"
+)
+
+func newApprovalGateService(t *testing.T, shared bool) (*Service, *fakeVault, *him.Service) {
+	t.Helper()
+	return newPolicyGateService(t, shared, nil, nil)
+}
+
+// newPolicyGateService is newApprovalGateService with site overrides and an
+// ACVS verdict for every action.
+func newPolicyGateService(t *testing.T, shared bool, overrides []him.Override, verdict *him.ComplianceVerdict) (*Service, *fakeVault, *him.Service) {
+	t.Helper()
+	auditLogger, err := audit.NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	chain, err := evidence.NewChainGenerator()
+	if err != nil {
+		t.Fatalf("Failed to create evidence chain: %v", err)
+	}
+	himService := him.NewService(time.Minute)
+	t.Cleanup(himService.Close)
+	himService.SetEvidenceRecorder(chain)
+
+	policy := him.DefaultPolicy()
+	policy.Approval = &him.ApprovalPolicy{Required: 1}
+	policy.Overrides = overrides
+	var compliance him.ComplianceChecker
+	if verdict != nil {
+		compliance = him.ComplianceFunc(func(ctx context.Context, action him.RotationAction) (*him.ComplianceVerdict, error) {
+			return verdict, nil
+		})
+	}
+	vault := &fakeVault{password: "old-password", shared: shared}
+	service := NewService(vault, auditLogger)
+	service.SetHIMManager(him.NewManager(himService, policy, compliance))
+	return service, vault, himService
+}
+
+// approveSession approves a session with a new client certificate.
+func approveSession(t *testing.T, himService *him.Service, sessionID string) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "alice"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+
+	session, err := himService.GetSession(context.Background(), sessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	signedAt := time.Now()
+	signature, err := him.SignApproval(key, him.ApprovalMessage(session.ApprovalPayload(), signedAt))
+	if err != nil {
+		t.Fatalf("Failed to sign approval: %v", err)
+	}
+	if _, err := himService.Approve(context.Background(), sessionID, cert, signedAt, signature); err != nil {
+		t.Fatalf("Failed to approve: %v", err)
+	}
+}
+
+// TestRotateSharedCredentialNeedsApproval tests that a shared credential is
+// rotated only once its approval session is approved
+func TestRotateSharedCredentialNeedsApproval(t *testing.T) {
+	service, vault, himService := newApprovalGateService(t, true)
+	ctx := context.Background()
+	cred := pwmanager.CompromisedCredential{ID: "item-1", Site: "github.com"}
+
+	result, err := service.RotateCredential(ctx, cred, "n3w-p4ssw0rd")
+	if err == nil || result.Status != RotationHIMRequired || result.Error.HIMType != HIMApproval {
+		t.Fatalf("Expected rotation to wait for approval, got %+v (%v)", result, err)
+	}
+	session, err := himService.GetSession(ctx, result.HIMSessionID)
+	if err != nil {
+		t.Fatalf("Failed to get approval session: %v", err)
+	}
+	if session.Type != him.HIMApproval {
+		t.Fatalf("Expected an approval session, got %s", session.Type)
+	}
+	if password, _ := vault.state(); password != "old-password" {
+		t.Fatalf("Expected no rotation before approval, got %q", password)
+	}
+
+	approveSession(t, himService, session.ID)
+	waitForVault(t, vault, "n3w-p4ssw0rd", "")
+}
+
+// TestRotateSharedCredentialDenied tests that a cancelled approval never rotates
+func TestRotateSharedCredentialDenied(t *testing.T) {
+	service, vault, himService := newApprovalGateService(t, true)
+	ctx := context.Background()
+
+	result, _ := service.StartManualRotation(ctx, pwmanager.CompromisedCredential{ID: "item-1", Site: "github.com"}, "n3w-p4ssw0rd")
+	if result.Status != RotationHIMRequired || result.Error == nil || result.Error.HIMType != HIMApproval {
+		t.Fatalf("Expected manual rotation to wait for approval, got %+v", result)
+	}
+	if err := himService.CancelSession(ctx, result.HIMSessionID); err != nil {
+		t.Fatalf("Failed to cancel approval: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		events, err := service.auditLogger.QueryEvents(ctx, audit.Filter{Status: audit.StatusFailure})
+		if err != nil {
+			t.Fatalf("Failed to query audit log: %v", err)
+		}
+		if len(events) == 1 && events[0].Metadata["him_session_id"] == result.HIMSessionID {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the denied approval to be audited, got %+v", events)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if password, staged := vault.state(); password != "old-password" || staged != "" {
+		t.Errorf("Expected nothing rotated or staged, got %q and %q", password, staged)
+	}
+}
+
+// TestRotatePersonalCredentialSkipsApproval tests that credentials that
+// aren't shared rotate without approval
+func TestRotatePersonalCredentialSkipsApproval(t *testing.T) {
+	service, vault, _ := newApprovalGateService(t, false)
+
+	result, err := service.RotateCredential(context.Background(), pwmanager.CompromisedCredential{ID: "item-1", Site: "github.com"}, "n3w-p4ssw0rd")
+	if err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	if result.Status != RotationSuccess {
+		t.Errorf("Expected success, got %s", result.Status)
+	}
+	if password, _ := vault.state(); password != "n3w-p4ssw0rd" {
+		t.Errorf("Expected the password rotated, got %q", password)
+	}
+}
+
+// waitForAuditStatus waits for an audited approval step with status for sessionID.
+func waitForAuditStatus(t *testing.T, service *Service, status audit.EventStatus, sessionID string) audit.Event {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		events, err := service.auditLogger.QueryEvents(context.Background(), audit.Filter{Status: status})
+		if err != nil {
+			t.Fatalf("Failed to query audit log: %v", err)
+		}
+		for _, event := range events {
+			if event.Metadata["him_session_id"] == sessionID {
+				return event
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a %s approval event for %s, got %+v", status, sessionID, events)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRotateSharedCredentialBlockedByToS tests that approval doesn't waive
+// the ToS review ACVS requires, for shared and personal credentials
+func TestRotateSharedCredentialBlockedByToS(t *testing.T) {
+	blocked := &him.ComplianceVerdict{Result: acmv1.ValidationResult_VALIDATION_RESULT_BLOCKED}
+	ctx := context.Background()
+	cred := pwmanager.CompromisedCredential{ID: "item-1", Site: "github.com"}
+
+	service, vault, himService := newPolicyGateService(t, true, nil, blocked)
+	result, err := service.RotateCredential(ctx, cred, "n3w-p4ssw0rd")
+	if err == nil || result.Status != RotationHIMRequired || result.Error.HIMType != HIMApproval {
+		t.Fatalf("Expected rotation to wait for approval, got %+v (%v)", result, err)
+	}
+	approveSession(t, himService, result.HIMSessionID)
+	event := waitForAuditStatus(t, service, audit.StatusFailure, result.HIMSessionID)
+	if !strings.Contains(event.Message, string(him.HIMToSReview)) {
+		t.Errorf("Expected the ToS review to be reported, got %q", event.Message)
+	}
+	if password, _ := vault.state(); password != "old-password" {
+		t.Errorf("Expected no rotation of a ToS-blocked credential, got %q", password)
+	}
+
+	service, vault, _ = newPolicyGateService(t, false, nil, blocked)
+	result, err = service.RotateCredential(ctx, cred, "n3w-p4ssw0rd")
+	if err == nil || result.Status != RotationHIMRequired || result.Error.HIMType != HIMToSReview || result.HIMSessionID != "" {
+		t.Fatalf("Expected rotation refused for ToS review, got %+v (%v)", result, err)
+	}
+	if password, _ := vault.state(); password != "old-password" {
+		t.Errorf("Expected no rotation of a ToS-blocked credential, got %q", password)
+	}
+}
+
+// TestRotateSharedCredentialOverrideKeepsApproval tests that a site override
+// doesn't waive approval of a shared credential
+func TestRotateSharedCredentialOverrideKeepsApproval(t *testing.T) {
+	overrides := []him.Override{{Site: "github.com", Automate: true}}
+	service, vault, himService := newPolicyGateService(t, true, overrides, nil)
+	ctx := context.Background()
+
+	result, err := service.RotateCredential(ctx, pwmanager.CompromisedCredential{ID: "item-1", Site: "github.com"}, "n3w-p4ssw0rd")
+	if err == nil || result.Status != RotationHIMRequired || result.Error.HIMType != HIMApproval {
+		t.Fatalf("Expected rotation to wait for approval, got %+v (%v)", result, err)
+	}
+	if password, _ := vault.state(); password != "old-password" {
+		t.Fatalf("Expected no rotation before approval, got %q", password)
+	}
+
+	approveSession(t, himService, result.HIMSessionID)
+	waitForVault(t, vault, "n3w-p4ssw0rd", "")
+}
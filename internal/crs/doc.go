@@ -47,6 +47,52 @@
 //	    log.Printf("Rotated %s successfully", cred.Site)
 //	}
 //
+// # Guided Manual Rotation
+//
+// RotateCredential only updates the vault. When the password has to be
+// changed on the site by hand, StartManualRotation changes it site-first:
+// the new password is staged in the vault (see pwmanager.PasswordStager),
+// a HIMManualRotation session shows the change-password URL and the new
+// password once, and the password is committed to the vault only after the
+// user confirms the site accepted it. Aborting discards the staged password.
+// It needs a HIM manager, set with SetHIMManager. Callers choose it per
+// rotation; CredentialService uses it only for ROTATION_MODE_GUIDED.
+//
+// # Approval of Shared Credentials
+//
+// With a HIM manager set, RotateCredential and StartManualRotation first ask
+// its policy (RequiresHIM) whether the credential needs sign-off. A shared
+// vault item (pwmanager.Credential.Shared) does when the policy configures
+// approval: the call returns RotationHIMRequired with a HIMApproval session,
+// and the rotation starts only once enough approvers have approved it.
+// Approval is decided before site overrides and ACVS, so neither waives it,
+// and the policy is asked again once approval is given: a rotation that
+// also needs, say, a ToS review is then refused. Any HIM type a call can't
+// handle itself is refused the same way, with RotationHIMRequired.
+//
+// # Rotation Journal
+//
+// With a rotation.Journal set (SetJournal), every step of a rotation is
+// written ahead to SQLite before the next one starts. On startup the
+// journal's recovery pass hands each unfinished rotation to Recover, which
+// checks the vault for the write: a rotation that reached the vault is
+// completed, one that didn't is rolled back, and a manual rotation with a
+// staged password asks the user again whether the site took it.
+//
+// Once the user has confirmed the site change, the staged password is never
+// discarded. If committing it fails, it is retried, then the user is asked
+// to retry on a new session, and recovery commits it on the next start
+// without asking again.
+//
+// # Rotation Locks
+//
+// With a rotation.LockManager set (SetLockManager), a rotation first takes
+// a lease on its credential in SQLite. A second rotation of the credential,
+// from this process or another sharing the database, fails with
+// ErrRotationInProgress naming the holder and when it started. Leases
+// expire, so a crashed rotation frees its credential; manual rotations
+// hold theirs until the user answers.
+//
 // # Phase I Implementation
 //
 // Phase I focuses on:
@@ -64,6 +64,9 @@ type RotationResult struct {
 	// AuditEventID is the ID of the audit log entry for this rotation.
 	AuditEventID string
 
+	// HIMSessionID is the HIM session a manual rotation is waiting on.
+	HIMSessionID string
+
 	// ComplianceValidation contains ACVS validation results (if enabled).
 	ComplianceValidation *ComplianceValidation
 }
@@ -147,6 +150,22 @@ const (
 
 	// ErrVerificationFailed indicates post-rotation verification failed.
 	ErrVerificationFailed RotationErrorCode = "VERIFICATION_FAILED"
+
+	// ErrStagingUnsupported indicates the password manager cannot stage a
+	// password for manual rotation.
+	ErrStagingUnsupported RotationErrorCode = "STAGING_UNSUPPORTED"
+
+	// ErrRotationAborted indicates the user aborted a manual rotation.
+	ErrRotationAborted RotationErrorCode = "ROTATION_ABORTED"
+
+	// ErrJournalFailed indicates the rotation intent could not be recorded
+	// in the rotation journal, so nothing was changed.
+	ErrJournalFailed RotationErrorCode = "JOURNAL_FAILED"
+
+	// ErrRotationInProgress indicates another rotation holds the
+	// credential's lease. The cause is a *rotation.LockHeldError naming the
+	// holder and when it started.
+	ErrRotationInProgress RotationErrorCode = "ROTATION_IN_PROGRESS"
 )
 
 // HIMType indicates the type of Human-in-the-Middle intervention required.
@@ -164,6 +183,10 @@ const (
 
 	// HIMToSReview indicates Terms of Service review is required.
 	HIMToSReview HIMType = "tos_review"
+
+	// HIMApproval indicates sign-off from several approvers is required
+	// before a shared credential is rotated.
+	HIMApproval HIMType = "approval"
 )
 
 // RotationEvent represents a single rotation event in the history.
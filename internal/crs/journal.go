@@ -0,0 +1,205 @@
+package crs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/him"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/pwmanager"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation"
+)
+
+// JournalProvider is the provider name of vault rotations in the rotation
+// journal.
+const JournalProvider = "vault"
+
+// SetJournal records every rotation in journal so that rotations cut short
+// by a crash can be recovered on startup (see Recover).
+func (s *Service) SetJournal(journal *rotation.Journal) {
+	s.journal = journal
+}
+
+// beginJournal records the intent to rotate cred under rotationID and
+// returns the journal ID, or "" if no journal is set.
+func (s *Service) beginJournal(ctx context.Context, rotationID string, cred pwmanager.CompromisedCredential, site string, method RotationMethod) (string, error) {
+	if s.journal == nil {
+		return "", nil
+	}
+	entry, err := s.journal.Begin(ctx, rotation.JournalEntry{
+		ID:           rotationID,
+		CredentialID: cred.ID,
+		Provider:     JournalProvider,
+		Site:         site,
+		Metadata:     map[string]string{"method": string(method)},
+	})
+	if err != nil {
+		return "", err
+	}
+	return entry.ID, nil
+}
+
+// recordJournal records a step of the rotation journalID. A failed write is
+// logged but not fatal: recovery re-checks the vault rather than trusting
+// the last step.
+func (s *Service) recordJournal(ctx context.Context, journalID string, step rotation.JournalStep, detail string, metadata map[string]string) {
+	if s.journal == nil || journalID == "" {
+		return
+	}
+	if err := s.journal.Record(ctx, journalID, step, detail, metadata); err != nil {
+		s.logger.Error("Failed to record rotation journal step",
+			"journal_id", journalID, "step", string(step), "error", err)
+	}
+}
+
+// Recover implements rotation.Recoverer for vault rotations. The vault is
+// checked for a write since the rotation started: if there was one the
+// rotation is completed, otherwise it is rolled back. Manual rotations
+// waiting on the user are resumed with a new HIM session if theirs has
+// ended, since only the user knows whether the site took the new password.
+func (s *Service) Recover(ctx context.Context, entry rotation.JournalEntry) (rotation.RecoveryOutcome, error) {
+	outcome, err := s.recoverRotation(ctx, entry)
+	if outcome != rotation.RecoveryResumed {
+		s.releaseLease(ctx, rotation.Lease{ID: entry.ID, CredentialID: entry.CredentialID})
+	}
+	return outcome, err
+}
+
+// recoverRotation finishes or rolls back the rotation recorded in entry.
+func (s *Service) recoverRotation(ctx context.Context, entry rotation.JournalEntry) (rotation.RecoveryOutcome, error) {
+	if s.pwManager == nil {
+		return rotation.RecoveryFailed, fmt.Errorf("no password manager configured")
+	}
+	manual := entry.Metadata["method"] == string(MethodManual)
+
+	switch entry.Step {
+	case rotation.JournalIntent, rotation.JournalStaged:
+		if manual {
+			return s.recoverManualRotation(ctx, entry)
+		}
+		written, err := s.pwManager.VerifyUpdate(ctx, entry.CredentialID, entry.StartedAt)
+		if err != nil {
+			return rotation.RecoveryFailed, fmt.Errorf("failed to check vault: %w", err)
+		}
+		if written {
+			return rotation.RecoveryCompleted, nil
+		}
+		return rotation.RecoveryRolledBack, nil
+
+	case rotation.JournalVaultWritten:
+		written, err := s.pwManager.VerifyUpdate(ctx, entry.CredentialID, entry.StartedAt)
+		if err != nil {
+			return rotation.RecoveryFailed, fmt.Errorf("failed to check vault: %w", err)
+		}
+		if !written {
+			return rotation.RecoveryFailed, fmt.Errorf("vault write was not found")
+		}
+		return rotation.RecoveryCompleted, nil
+
+	case rotation.JournalVerified:
+		return rotation.RecoveryCompleted, nil
+	}
+
+	return rotation.RecoveryFailed, fmt.Errorf("%w: %s", rotation.ErrInvalidJournalStep, entry.Step)
+}
+
+// recoverManualRotation recovers a manual rotation that had not committed
+// the staged password. Before staging, the password is discarded. After,
+// the user may already have changed it on the site, so the rotation waits
+// on the user again: on its HIM session if still open, or on a new one.
+// Once the user has confirmed the site change, the staged password is
+// committed without asking again.
+func (s *Service) recoverManualRotation(ctx context.Context, entry rotation.JournalEntry) (rotation.RecoveryOutcome, error) {
+	stager, ok := s.pwManager.(pwmanager.PasswordStager)
+	if !ok {
+		return rotation.RecoveryFailed, fmt.Errorf("%s cannot stage passwords", s.pwManager.Type())
+	}
+
+	if entry.Step == rotation.JournalIntent {
+		if err := stager.DiscardStagedPassword(ctx, entry.CredentialID); err != nil {
+			return rotation.RecoveryFailed, fmt.Errorf("failed to discard staged password: %w", err)
+		}
+		return rotation.RecoveryRolledBack, nil
+	}
+
+	if s.himManager == nil {
+		return rotation.RecoveryFailed, fmt.Errorf("manual rotation cannot resume without the HIM manager; the new password is still staged in the vault")
+	}
+
+	lease, err := s.resumeLease(ctx, entry, manualLeaseTTL)
+	if err != nil {
+		return rotation.RecoveryFailed, fmt.Errorf("failed to lease credential: %w", err)
+	}
+	rot := manualRotation{
+		cred:        pwmanager.CompromisedCredential{ID: entry.CredentialID, Site: entry.Site},
+		site:        entry.Site,
+		startTime:   entry.StartedAt,
+		journalID:   entry.ID,
+		lease:       lease,
+		siteChanged: entry.Metadata["site_changed"] == "true",
+	}
+
+	if sessionID := entry.Metadata["him_session_id"]; sessionID != "" {
+		if err := s.himManager.RegisterContinuation(sessionID, rot.continuation(s)); err == nil {
+			if !rot.siteChanged {
+				s.reattachPassword(ctx, stager, entry.CredentialID, sessionID)
+			}
+			return rotation.RecoveryResumed, nil
+		}
+	}
+
+	if rot.siteChanged {
+		if err := commitStaged(ctx, stager, entry.CredentialID); err != nil {
+			if _, retryErr := s.retryCommit(ctx, rot, err); retryErr != nil {
+				return rotation.RecoveryFailed, fmt.Errorf("failed to commit staged password (%v) and to ask for a retry: %w", err, retryErr)
+			}
+			return rotation.RecoveryResumed, nil
+		}
+		s.recordJournal(ctx, entry.ID, rotation.JournalVaultWritten, "", nil)
+		if verified, err := s.VerifyRotation(ctx, entry.CredentialID); err != nil || !verified {
+			return rotation.RecoveryFailed, fmt.Errorf("staged password committed but not verified: %v", err)
+		}
+		return rotation.RecoveryCompleted, nil
+	}
+
+	action := him.RotationAction{
+		CredentialID: entry.CredentialID,
+		Site:         entry.Site,
+		ActionType:   him.ActionPasswordChange,
+		Method:       string(MethodManual),
+		Timestamp:    entry.StartedAt,
+	}
+	if meta, err := s.pwManager.GetCredential(ctx, entry.CredentialID); err == nil {
+		action.Credential = credentialMetadata(meta)
+	}
+	prompt := him.HIMPrompt{
+		Type:      him.HIMManualRotation,
+		Site:      entry.Site,
+		Message:   fmt.Sprintf("ACM stopped while you were changing your %s password. Confirm only if the site accepted the new password; otherwise the vault keeps the current one.", entry.Site),
+		ActionURL: changePasswordURL("", entry.Site),
+		InputType: him.InputConfirmation,
+		Timeout:   manualRotationTimeout,
+	}
+	sessionID, err := s.himManager.Pause(ctx, action, prompt, rot.continuation(s))
+	if err != nil {
+		return rotation.RecoveryFailed, fmt.Errorf("failed to open manual rotation session: %w", err)
+	}
+	s.recordJournal(ctx, entry.ID, rotation.JournalStaged, "", map[string]string{"him_session_id": sessionID})
+	s.reattachPassword(ctx, stager, entry.CredentialID, sessionID)
+
+	return rotation.RecoveryResumed, nil
+}
+
+// reattachPassword attaches the staged password to a resumed rotation's
+// session. Attached passwords are kept in memory only, so the one attached
+// before the restart is gone. Without it the user can still read the
+// password from the vault's staged field, so a failure is only logged.
+func (s *Service) reattachPassword(ctx context.Context, stager pwmanager.PasswordStager, credentialID, sessionID string) {
+	password, err := stager.StagedPassword(ctx, credentialID)
+	if err == nil {
+		err = s.himManager.AttachPassword(ctx, sessionID, password)
+	}
+	if err != nil {
+		s.logger.Warn("Failed to attach staged password to resumed rotation",
+			"session_id", sessionID, "error", err)
+	}
+}
@@ -0,0 +1,240 @@
+package crs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/him"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/pwmanager"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation"
+)
+
+func openTestJournal(t *testing.T) (*rotation.Journal, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	journal, err := rotation.NewJournal(db)
+	if err != nil {
+		t.Fatalf("Failed to create journal: %v", err)
+	}
+	return journal, db
+}
+
+// waitForStep waits for the rotation to reach step in the journal.
+func waitForStep(t *testing.T, journal *rotation.Journal, id string, step rotation.JournalStep) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		entry, err := journal.Get(context.Background(), id)
+		if err == nil && entry.Step == step {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected rotation at %s, got %s (%v)", step, entry.Step, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRotateCredentialJournal tests that every step of a rotation is journaled
+func TestRotateCredentialJournal(t *testing.T) {
+	ctx := context.Background()
+	service, _, _ := newManualRotationService(t)
+	journal, db := openTestJournal(t)
+	service.SetJournal(journal)
+
+	if _, err := service.RotateCredential(ctx, pwmanager.CompromisedCredential{ID: "item-1", Site: "github.com"}, "n3w-p4ssw0rd"); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+
+	incomplete, _ := journal.Incomplete(ctx)
+	if len(incomplete) != 0 {
+		t.Fatalf("Expected no incomplete rotations, got %+v", incomplete)
+	}
+	var id string
+	if err := db.QueryRow("SELECT id FROM rotation_journal WHERE step = ?", string(rotation.JournalAudited)).Scan(&id); err != nil {
+		t.Fatalf("Expected an audited rotation: %v", err)
+	}
+	history, _ := journal.History(ctx, id)
+	want := []rotation.JournalStep{rotation.JournalIntent, rotation.JournalVaultWritten, rotation.JournalVerified, rotation.JournalAudited}
+	if len(history) != len(want) {
+		t.Fatalf("Expected %d steps, got %+v", len(want), history)
+	}
+	for i, step := range want {
+		if history[i].Step != step {
+			t.Errorf("Step %d: expected %s, got %s", i, step, history[i].Step)
+		}
+	}
+}
+
+// TestRecoverInterruptedRotation tests recovering a rotation cut short around the vault write
+func TestRecoverInterruptedRotation(t *testing.T) {
+	tests := []struct {
+		name         string
+		vaultWritten bool
+		want         rotation.JournalStep
+		wantStatus   audit.EventStatus
+	}{
+		{"crash after vault write", true, rotation.JournalAudited, audit.StatusSuccess},
+		{"crash before vault write", false, rotation.JournalRolledBack, audit.StatusFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			service, vault, _ := newManualRotationService(t)
+			journal, _ := openTestJournal(t)
+
+			entry, err := journal.Begin(ctx, rotation.JournalEntry{
+				CredentialID: "item-1",
+				Provider:     JournalProvider,
+				Site:         "github.com",
+				Metadata:     map[string]string{"method": string(MethodAuto)},
+			})
+			if err != nil {
+				t.Fatalf("Failed to begin: %v", err)
+			}
+			if tt.vaultWritten {
+				time.Sleep(2 * time.Millisecond)
+				_ = vault.UpdatePassword(ctx, "item-1", "n3w-p4ssw0rd")
+			}
+
+			auditLogger, _ := audit.NewMemoryLogger()
+			if _, err := journal.Recover(ctx, map[string]rotation.Recoverer{JournalProvider: service}, auditLogger); err != nil {
+				t.Fatalf("Failed to recover: %v", err)
+			}
+
+			got, _ := journal.Get(ctx, entry.ID)
+			if got.Step != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got.Step)
+			}
+			events, _ := auditLogger.QueryEvents(ctx, audit.Filter{EventType: audit.EventTypeRotation})
+			if len(events) != 1 || events[0].Status != tt.wantStatus {
+				t.Errorf("Expected one %s recovery event, got %+v", tt.wantStatus, events)
+			}
+		})
+	}
+}
+
+// TestRecoverManualRotation tests resuming a staged manual rotation after a restart
+func TestRecoverManualRotation(t *testing.T) {
+	ctx := context.Background()
+	journal, _ := openTestJournal(t)
+
+	// First run: the password is staged, then the service stops
+	before, vault, _ := newManualRotationService(t)
+	before.SetJournal(journal)
+	result, err := before.StartManualRotation(ctx, pwmanager.CompromisedCredential{ID: "item-1", Site: "github.com"}, "n3w-p4ssw0rd")
+	if err != nil {
+		t.Fatalf("Failed to start manual rotation: %v", err)
+	}
+	incomplete, _ := journal.Incomplete(ctx)
+	if len(incomplete) != 1 || incomplete[0].Step != rotation.JournalStaged || incomplete[0].Metadata["him_session_id"] != result.HIMSessionID {
+		t.Fatalf("Expected a staged rotation, got %+v", incomplete)
+	}
+
+	// Second run: the old session is gone, so a new one is opened
+	auditLogger, _ := audit.NewMemoryLogger()
+	himService := him.NewService(time.Minute)
+	defer himService.Close()
+	after := NewService(vault, auditLogger)
+	after.SetHIMManager(him.NewManager(himService, him.DefaultPolicy(), nil))
+	after.SetJournal(journal)
+
+	report, err := journal.Recover(ctx, map[string]rotation.Recoverer{JournalProvider: after}, auditLogger)
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	if report.Resumed != 1 {
+		t.Fatalf("Expected the rotation to resume, got %+v", report)
+	}
+	if _, staged := vault.state(); staged != "n3w-p4ssw0rd" {
+		t.Fatalf("Expected the new password to stay staged, got %q", staged)
+	}
+
+	entry, _ := journal.Get(ctx, incomplete[0].ID)
+	sessionID := entry.Metadata["him_session_id"]
+	if sessionID == result.HIMSessionID {
+		t.Fatal("Expected a new HIM session")
+	}
+	session, err := himService.GetSession(ctx, sessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if password, err := himService.RevealPassword(ctx, session.ID, session.SecurityToken); err != nil || password != "n3w-p4ssw0rd" {
+		t.Errorf("Expected the staged password on the new session, got %q (%v)", password, err)
+	}
+	err = himService.SubmitResponse(ctx, session.ID, him.Response{
+		SessionID:     session.ID,
+		SecurityToken: session.SecurityToken,
+		Data:          him.ResponseData{TextInput: "yes"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to confirm: %v", err)
+	}
+	waitForVault(t, vault, "n3w-p4ssw0rd", "")
+	waitForStep(t, journal, entry.ID, rotation.JournalAudited)
+}
+
+// TestRecoverManualRotationCommit tests that a rotation the user confirmed
+// but that couldn't be committed is committed after a restart without
+// asking again
+func TestRecoverManualRotationCommit(t *testing.T) {
+	delay := commitRetryDelay
+	commitRetryDelay = time.Millisecond
+	t.Cleanup(func() { commitRetryDelay = delay })
+
+	ctx := context.Background()
+	journal, _ := openTestJournal(t)
+
+	// First run: the user confirms, the commit fails, then the service stops
+	before, vault, beforeHIM := newManualRotationService(t)
+	before.SetJournal(journal)
+	result, err := before.StartManualRotation(ctx, pwmanager.CompromisedCredential{ID: "item-1", Site: "github.com"}, "n3w-p4ssw0rd")
+	if err != nil {
+		t.Fatalf("Failed to start manual rotation: %v", err)
+	}
+	incomplete, _ := journal.Incomplete(ctx)
+	if len(incomplete) != 1 {
+		t.Fatalf("Expected one rotation in the journal, got %d", len(incomplete))
+	}
+	vault.failCommit(errors.New("vault unreachable"))
+	confirmSession(t, beforeHIM, result.HIMSessionID)
+	waitForRetrySession(t, journal, incomplete[0].ID, result.HIMSessionID)
+
+	// Second run: the retry session is gone, and the vault works again
+	vault.failCommit(nil)
+	auditLogger, _ := audit.NewMemoryLogger()
+	himService := him.NewService(time.Minute)
+	defer himService.Close()
+	after := NewService(vault, auditLogger)
+	after.SetHIMManager(him.NewManager(himService, him.DefaultPolicy(), nil))
+	after.SetJournal(journal)
+
+	report, err := journal.Recover(ctx, map[string]rotation.Recoverer{JournalProvider: after}, auditLogger)
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	if report.Completed != 1 {
+		t.Fatalf("Expected the rotation to complete, got %+v", report)
+	}
+	if password, staged := vault.state(); password != "n3w-p4ssw0rd" || staged != "" {
+		t.Errorf("Expected the staged password committed, got %q and %q", password, staged)
+	}
+	if sessions, _ := himService.ListActiveSessions(ctx); len(sessions) != 0 {
+		t.Errorf("Expected no new prompt, got %d sessions", len(sessions))
+	}
+	if entry, _ := journal.Get(ctx, incomplete[0].ID); entry.Step != rotation.JournalAudited {
+		t.Errorf("Expected the rotation audited, got %s", entry.Step)
+	}
+}
@@ -0,0 +1,73 @@
+package crs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation"
+)
+
+// manualLeaseTTL covers the manual rotation session, with time to spare
+// for committing once the user confirms.
+const manualLeaseTTL = manualRotationTimeout + 5*time.Minute
+
+// SetLockManager makes every rotation lease its credential first, so a
+// second rotation of the same credential fails with ErrRotationInProgress
+// instead of racing the first.
+func (s *Service) SetLockManager(locks *rotation.LockManager) {
+	s.locks = locks
+}
+
+// acquireLease leases credentialID for ttl under rotationID. Without a
+// lock manager the lease is not stored.
+func (s *Service) acquireLease(ctx context.Context, credentialID, rotationID string, ttl time.Duration) (rotation.Lease, *RotationError) {
+	lease := rotation.Lease{ID: rotationID, CredentialID: credentialID}
+	if s.locks == nil {
+		return lease, nil
+	}
+
+	lease, err := s.locks.Acquire(ctx, lease, ttl)
+	if err != nil {
+		rerr := &RotationError{
+			Code:      ErrUpdateFailed,
+			Message:   "Failed to lease credential for rotation",
+			Cause:     err,
+			Retryable: true,
+		}
+		if errors.Is(err, rotation.ErrRotationInProgress) {
+			rerr.Code = ErrRotationInProgress
+			rerr.Message = "Credential is already being rotated"
+		}
+		return lease, rerr
+	}
+	return lease, nil
+}
+
+// resumeLease takes back the lease of a rotation recovered after a
+// restart, or leases the credential again if it has expired.
+func (s *Service) resumeLease(ctx context.Context, entry rotation.JournalEntry, ttl time.Duration) (rotation.Lease, error) {
+	return s.renewLease(ctx, rotation.Lease{ID: entry.ID, CredentialID: entry.CredentialID}, ttl)
+}
+
+// renewLease extends lease by ttl, or leases the credential again if it
+// has expired.
+func (s *Service) renewLease(ctx context.Context, lease rotation.Lease, ttl time.Duration) (rotation.Lease, error) {
+	if s.locks == nil {
+		return lease, nil
+	}
+
+	renewed, err := s.locks.Renew(ctx, lease, ttl)
+	if errors.Is(err, rotation.ErrLeaseLost) {
+		return s.locks.Acquire(ctx, lease, ttl)
+	}
+	return renewed, err
+}
+
+// releaseLease gives up lease. A lease that can't be released expires.
+func (s *Service) releaseLease(ctx context.Context, lease rotation.Lease) {
+	if s.locks == nil {
+		return
+	}
+	_ = s.locks.Release(ctx, lease)
+}
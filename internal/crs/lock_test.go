@@ -0,0 +1,95 @@
+package crs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/pwmanager"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation"
+)
+
+func openTestLocks(t *testing.T) *rotation.LockManager {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	locks, err := rotation.NewLockManager(db)
+	if err != nil {
+		t.Fatalf("Failed to create lock manager: %v", err)
+	}
+	return locks
+}
+
+// TestRotateCredentialInProgress tests that a credential being rotated can't be rotated again
+func TestRotateCredentialInProgress(t *testing.T) {
+	ctx := context.Background()
+	service, vault, _ := newManualRotationService(t)
+	locks := openTestLocks(t)
+	service.SetLockManager(locks)
+
+	held, err := locks.Acquire(ctx, rotation.Lease{CredentialID: "item-1", Holder: "scheduler"}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to acquire: %v", err)
+	}
+
+	_, err = service.RotateCredential(ctx, pwmanager.CompromisedCredential{ID: "item-1"}, "n3w-p4ssw0rd")
+	var rerr *RotationError
+	if !errors.As(err, &rerr) || rerr.Code != ErrRotationInProgress {
+		t.Fatalf("Expected ErrRotationInProgress, got %v", err)
+	}
+	var lockErr *rotation.LockHeldError
+	if !errors.As(err, &lockErr) || lockErr.Holder != "scheduler" {
+		t.Errorf("Expected the holder in the error, got %v", err)
+	}
+	if password, _ := vault.state(); password != "old-password" {
+		t.Errorf("Expected the vault to be untouched, got %q", password)
+	}
+
+	// Once released, the rotation goes ahead and gives the lease back
+	_ = locks.Release(ctx, held)
+	if _, err := service.RotateCredential(ctx, pwmanager.CompromisedCredential{ID: "item-1"}, "n3w-p4ssw0rd"); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	if _, ok, _ := locks.Held(ctx, "item-1"); ok {
+		t.Error("Expected the lease to be released")
+	}
+}
+
+// TestManualRotationHoldsLease tests that a manual rotation keeps the lease until the user answers
+func TestManualRotationHoldsLease(t *testing.T) {
+	ctx := context.Background()
+	service, vault, himService := newManualRotationService(t)
+	locks := openTestLocks(t)
+	service.SetLockManager(locks)
+
+	result, err := service.StartManualRotation(ctx, pwmanager.CompromisedCredential{ID: "item-1", Site: "github.com"}, "n3w-p4ssw0rd")
+	if err != nil {
+		t.Fatalf("Failed to start manual rotation: %v", err)
+	}
+	if _, err := service.RotateCredential(ctx, pwmanager.CompromisedCredential{ID: "item-1"}, "0th3r-p4ssw0rd"); !errors.Is(err, rotation.ErrRotationInProgress) {
+		t.Fatalf("Expected the manual rotation to hold the lease, got %v", err)
+	}
+
+	if err := himService.CancelSession(ctx, result.HIMSessionID); err != nil {
+		t.Fatalf("Failed to cancel: %v", err)
+	}
+	waitForVault(t, vault, "old-password", "")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok, _ := locks.Held(ctx, "item-1"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the lease to be released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,435 @@
+package crs
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/him"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/pwmanager"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation"
+)
+
+// manualRotationTimeout is how long the user has to change the password on
+// the site before the staged password is discarded.
+const manualRotationTimeout = 30 * time.Minute
+
+// SetHIMManager enables guided manual rotation (StartManualRotation).
+func (s *Service) SetHIMManager(manager *him.Manager) {
+	s.himManager = manager
+}
+
+// ManualRotationEnabled reports whether StartManualRotation can run: a HIM
+// manager is set and the password manager can stage passwords.
+func (s *Service) ManualRotationEnabled() bool {
+	_, ok := s.pwManager.(pwmanager.PasswordStager)
+	return ok && s.himManager != nil
+}
+
+// manualHandledHIM are the HIM types a site-first rotation deals with: the
+// user changes the password by hand and answers the site's challenges.
+var manualHandledHIM = []him.HIMType{
+	him.HIMManualRotation, him.HIMMFA, him.HIMTOTP, him.HIMSMS, him.HIMPush, him.HIMEmail, him.HIMCAPTCHA,
+	him.HIMBiometric, him.HIMSecurityKey, him.HIMBackupCode, him.HIMRecoveryCode,
+}
+
+// StartManualRotation starts a site-first rotation of cred:
+//
+//  1. The new password is staged in the vault next to the current one
+//  2. A HIMManualRotation session shows the change-password URL, and the
+//     new password can be shown, or filled in by the browser extension, once
+//  3. When the user confirms the site accepted it, the staged password is
+//     committed to the vault, verified and audited
+//
+// If the user aborts, or the session expires, the staged password is
+// discarded and the vault keeps the current password. The vault and the site
+// therefore only diverge while the user is changing the password.
+//
+// StartManualRotation returns once the session is open, with Status
+// RotationHIMRequired and the session in HIMSessionID. When the HIM policy
+// requires approval, as for shared credentials, it instead returns an error
+// with the approval session in HIMSessionID, and the manual rotation starts
+// once the session is approved. A ToS review it refuses without starting.
+func (s *Service) StartManualRotation(ctx context.Context, cred pwmanager.CompromisedCredential, newPassword string) (*RotationResult, error) {
+	if s.ManualRotationEnabled() && newPassword != "" {
+		start := func(ctx context.Context) error {
+			_, err := s.startManualRotation(ctx, cred, newPassword)
+			return err
+		}
+		if result, err := s.requireApproval(ctx, cred, MethodManual, manualHandledHIM, start); result != nil {
+			return result, err
+		}
+	}
+	return s.startManualRotation(ctx, cred, newPassword)
+}
+
+// startManualRotation starts a manual rotation without checking for approval.
+func (s *Service) startManualRotation(ctx context.Context, cred pwmanager.CompromisedCredential, newPassword string) (*RotationResult, error) {
+	startTime := time.Now()
+
+	result := &RotationResult{
+		CredentialID: hashCredentialID(cred.ID),
+		Status:       RotationPending,
+		StartTime:    startTime,
+	}
+	fail := func(rerr *RotationError) (*RotationResult, error) {
+		result.Status = RotationFailure
+		result.Error = rerr
+		result.EndTime = time.Now()
+		result.Duration = result.EndTime.Sub(startTime)
+		return result, rerr
+	}
+
+	if s.pwManager == nil {
+		return fail(&RotationError{
+			Code:    ErrPasswordManagerUnavailable,
+			Message: "No password manager configured. Please install and configure Bitwarden or 1Password CLI.",
+		})
+	}
+	stager, ok := s.pwManager.(pwmanager.PasswordStager)
+	if !ok {
+		return fail(&RotationError{
+			Code:    ErrStagingUnsupported,
+			Message: fmt.Sprintf("%s cannot stage passwords for manual rotation", s.pwManager.Type()),
+		})
+	}
+	if s.himManager == nil {
+		return fail(&RotationError{
+			Code:    ErrHIMRequired,
+			Message: "Manual rotation requires the HIM manager",
+			HIMType: HIMManualRotation,
+		})
+	}
+	if newPassword == "" {
+		return fail(&RotationError{
+			Code:    ErrPasswordGenerationFailed,
+			Message: "New password cannot be empty",
+		})
+	}
+
+	site := cred.Site
+	loginURL := ""
+	var credential him.CredentialMetadata
+	if meta, err := s.pwManager.GetCredential(ctx, cred.ID); err == nil {
+		if site == "" {
+			site = meta.Site
+		}
+		loginURL = meta.URL
+		credential = credentialMetadata(meta)
+	}
+	if site == "" {
+		site = loginURL
+	}
+
+	rotationID := rotation.GenerateStateID()
+	lease, rerr := s.acquireLease(ctx, cred.ID, rotationID, manualLeaseTTL)
+	if rerr != nil {
+		return fail(rerr)
+	}
+	// Once the session is open, finishing the rotation releases the lease
+	started := false
+	defer func() {
+		if !started {
+			s.releaseLease(ctx, lease)
+		}
+	}()
+
+	journalID, err := s.beginJournal(ctx, rotationID, cred, site, MethodManual)
+	if err != nil {
+		return fail(&RotationError{
+			Code:      ErrJournalFailed,
+			Message:   "Failed to record rotation intent",
+			Cause:     err,
+			Retryable: true,
+		})
+	}
+	rot := manualRotation{cred: cred, site: site, startTime: startTime, journalID: journalID, lease: lease}
+
+	// Step 1: Stage the new password without touching the current one
+	if err := stager.StagePassword(ctx, cred.ID, newPassword); err != nil {
+		rerr := &RotationError{
+			Code:    ErrUpdateFailed,
+			Message: fmt.Sprintf("Failed to stage password in vault: %v", err),
+			Cause:   err,
+		}
+		if pmErr, ok := err.(*pwmanager.PasswordManagerError); ok {
+			rerr.Retryable = pmErr.Retryable
+			if pmErr.Code == pwmanager.ErrVaultLocked {
+				rerr.Code = ErrVaultLocked
+			}
+		}
+		s.logManualRotation(ctx, result.CredentialID, site, audit.StatusFailure, rerr.Message, string(rerr.Code))
+		s.recordJournal(ctx, journalID, rotation.JournalFailed, rerr.Message, nil)
+		return fail(rerr)
+	}
+	s.recordJournal(ctx, journalID, rotation.JournalStaged, "", nil)
+
+	// Step 2: Ask the user to change the password on the site
+	changeURL := changePasswordURL(loginURL, site)
+	action := him.RotationAction{
+		CredentialID: cred.ID,
+		Site:         site,
+		ActionType:   him.ActionPasswordChange,
+		Method:       string(MethodManual),
+		Credential:   credential,
+		Timestamp:    startTime,
+	}
+	prompt := him.HIMPrompt{
+		Type:      him.HIMManualRotation,
+		Site:      site,
+		Message:   fmt.Sprintf("Change your %s password to the new one ACM generated, then confirm once the site has accepted it. The new password is shown once.", site),
+		ActionURL: changeURL,
+		InputType: him.InputConfirmation,
+		Timeout:   manualRotationTimeout,
+	}
+
+	sessionID, err := s.himManager.Pause(ctx, action, prompt, rot.continuation(s))
+	if err != nil {
+		s.discardStaged(ctx, stager, cred.ID)
+		s.recordJournal(ctx, journalID, rotation.JournalRolledBack, "failed to open HIM session", nil)
+		rerr := &RotationError{
+			Code:    ErrHIMRequired,
+			Message: fmt.Sprintf("Failed to open manual rotation session: %v", err),
+			Cause:   err,
+			HIMType: HIMManualRotation,
+		}
+		s.logManualRotation(ctx, result.CredentialID, site, audit.StatusFailure, rerr.Message, string(rerr.Code))
+		return fail(rerr)
+	}
+	started = true
+
+	if err := s.himManager.AttachPassword(ctx, sessionID, newPassword); err != nil {
+		// Cancelling resumes the continuation, which discards the staged password
+		_ = s.himManager.CancelSession(ctx, sessionID)
+		return fail(&RotationError{
+			Code:    ErrHIMRequired,
+			Message: fmt.Sprintf("Failed to attach password to manual rotation session: %v", err),
+			Cause:   err,
+			HIMType: HIMManualRotation,
+		})
+	}
+
+	s.recordJournal(ctx, journalID, rotation.JournalStaged, "", map[string]string{"him_session_id": sessionID})
+	s.logManualRotation(ctx, result.CredentialID, site, audit.StatusPending, "Manual rotation started; waiting for the site change", "")
+
+	result.Status = RotationHIMRequired
+	result.HIMSessionID = sessionID
+	return result, nil
+}
+
+// manualRotation is a manual rotation waiting on the user.
+type manualRotation struct {
+	cred      pwmanager.CompromisedCredential
+	site      string
+	startTime time.Time
+	journalID string
+	lease     rotation.Lease
+
+	// siteChanged is set once the user confirmed the site accepted the new
+	// password. From then on the staged password is never discarded.
+	siteChanged bool
+}
+
+// commitAttempts is how many times a staged password is committed before
+// the user is asked to retry.
+const commitAttempts = 3
+
+// commitRetryDelay is the pause between commit attempts.
+var commitRetryDelay = 2 * time.Second
+
+// continuation finishes the rotation when its HIM session ends.
+func (rot manualRotation) continuation(s *Service) him.Continuation {
+	return func(ctx context.Context, response *him.HIMResponse) error {
+		return s.finishManualRotation(ctx, rot, response)
+	}
+}
+
+// finishManualRotation commits or discards the staged password once the
+// user has answered the manual rotation session.
+func (s *Service) finishManualRotation(ctx context.Context, rot manualRotation, response *him.HIMResponse) error {
+	stager := s.pwManager.(pwmanager.PasswordStager)
+	cred, site := rot.cred, rot.site
+	credentialID := hashCredentialID(cred.ID)
+
+	if response.CancelRequested || !response.Confirmed {
+		defer s.releaseLease(ctx, rot.lease)
+		if rot.siteChanged {
+			// The site already has the new password, so keep it staged for
+			// recovery to commit
+			s.logManualRotation(ctx, credentialID, site, audit.StatusFailure, "Staged password not committed; the site has the new password, so it stays staged and is committed when ACM restarts", string(ErrUpdateFailed))
+			return nil
+		}
+		if err := stager.DiscardStagedPassword(ctx, cred.ID); err != nil {
+			s.logManualRotation(ctx, credentialID, site, audit.StatusFailure, fmt.Sprintf("Failed to discard staged password: %v", err), string(ErrUpdateFailed))
+			return fmt.Errorf("failed to discard staged password: %w", err)
+		}
+		s.logManualRotation(ctx, credentialID, site, audit.StatusFailure, "Manual rotation aborted; staged password discarded", string(ErrRotationAborted))
+		s.recordJournal(ctx, rot.journalID, rotation.JournalRolledBack, "aborted by user", nil)
+		return nil
+	}
+
+	if !rot.siteChanged {
+		rot.siteChanged = true
+		s.recordJournal(ctx, rot.journalID, rotation.JournalStaged, "", map[string]string{"site_changed": "true"})
+	}
+	return s.commitManualRotation(ctx, rot, response.SessionID)
+}
+
+// commitManualRotation commits the staged password of a rotation the user
+// has changed on the site, then verifies and audits it. If the commit keeps
+// failing, the journal stays at staged and the user is asked to retry on a
+// new HIM session, which keeps the lease; recovery commits it if ACM
+// restarts first.
+func (s *Service) commitManualRotation(ctx context.Context, rot manualRotation, sessionID string) error {
+	stager := s.pwManager.(pwmanager.PasswordStager)
+	cred, site := rot.cred, rot.site
+	credentialID := hashCredentialID(cred.ID)
+
+	// Step 3: The site accepted the password, so the vault can follow
+	if err := commitStaged(ctx, stager, cred.ID); err != nil {
+		s.logManualRotation(ctx, credentialID, site, audit.StatusFailure, fmt.Sprintf("Failed to commit staged password: %v", err), string(ErrUpdateFailed))
+		retryID, retryErr := s.retryCommit(ctx, rot, err)
+		if retryErr != nil {
+			s.releaseLease(ctx, rot.lease)
+			return fmt.Errorf("failed to commit staged password (%v) and to ask for a retry: %w", err, retryErr)
+		}
+		return fmt.Errorf("failed to commit staged password; retry waits on session %s: %w", retryID, err)
+	}
+	defer s.releaseLease(ctx, rot.lease)
+	s.recordJournal(ctx, rot.journalID, rotation.JournalVaultWritten, "", nil)
+
+	verified, err := s.VerifyRotation(ctx, cred.ID)
+	if err != nil || !verified {
+		s.logManualRotation(ctx, credentialID, site, audit.StatusFailure, "Verification failed", string(ErrVerificationFailed))
+		s.recordJournal(ctx, rot.journalID, rotation.JournalFailed, "verification failed", nil)
+		return &RotationError{Code: ErrVerificationFailed, Message: "Failed to verify password update", Cause: err}
+	}
+	s.recordJournal(ctx, rot.journalID, rotation.JournalVerified, "", nil)
+
+	if s.auditLogger != nil {
+		err := s.auditLogger.LogEvent(ctx, audit.Event{
+			Type:         audit.EventTypeRotation,
+			Status:       audit.StatusSuccess,
+			CredentialID: credentialID,
+			Site:         site,
+			Username:     cred.Username,
+			Message:      "Password rotated manually and committed to vault",
+			Timestamp:    time.Now(),
+			Metadata: map[string]string{
+				"password_manager": s.pwManager.Type(),
+				"breach_name":      cred.BreachName,
+				"method":           string(MethodManual),
+				"him_session_id":   sessionID,
+				"duration":         time.Since(rot.startTime).String(),
+			},
+		})
+		if err != nil {
+			// The password is rotated; the journal stays at verified so
+			// the missing audit record is visible
+			return fmt.Errorf("password rotated but the audit event could not be written: %w", err)
+		}
+	}
+	s.recordJournal(ctx, rot.journalID, rotation.JournalAudited, "", nil)
+	return nil
+}
+
+// commitStaged commits the staged password, trying commitAttempts times.
+func commitStaged(ctx context.Context, stager pwmanager.PasswordStager, id string) error {
+	var err error
+	for attempt := 0; attempt < commitAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(commitRetryDelay):
+			}
+		}
+		if err = stager.CommitStagedPassword(ctx, id); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// retryCommit asks the user to retry committing the staged password of a
+// rotation the site has already accepted, and returns the new session.
+func (s *Service) retryCommit(ctx context.Context, rot manualRotation, cause error) (string, error) {
+	lease, err := s.renewLease(ctx, rot.lease, manualLeaseTTL)
+	if err != nil {
+		return "", fmt.Errorf("failed to lease credential: %w", err)
+	}
+	rot.lease = lease
+
+	action := him.RotationAction{
+		CredentialID: rot.cred.ID,
+		Site:         rot.site,
+		ActionType:   him.ActionPasswordChange,
+		Method:       string(MethodManual),
+		Timestamp:    time.Now(),
+	}
+	prompt := him.HIMPrompt{
+		Type:      him.HIMManualRotation,
+		Site:      rot.site,
+		Message:   fmt.Sprintf("Your %s password was changed on the site, but ACM could not save it to the vault (%v). It stays staged in the vault; confirm to try saving it again.", rot.site, cause),
+		InputType: him.InputConfirmation,
+		Timeout:   manualRotationTimeout,
+	}
+	sessionID, err := s.himManager.Pause(ctx, action, prompt, rot.continuation(s))
+	if err != nil {
+		return "", err
+	}
+	s.recordJournal(ctx, rot.journalID, rotation.JournalStaged, "", map[string]string{"him_session_id": sessionID})
+	return sessionID, nil
+}
+
+// discardStaged discards a staged password after a failed start.
+func (s *Service) discardStaged(ctx context.Context, stager pwmanager.PasswordStager, id string) {
+	if err := stager.DiscardStagedPassword(ctx, id); err != nil {
+		s.logManualRotation(ctx, hashCredentialID(id), "", audit.StatusFailure, fmt.Sprintf("Failed to discard staged password: %v", err), string(ErrUpdateFailed))
+	}
+}
+
+// logManualRotation records a step of a manual rotation in the audit log.
+func (s *Service) logManualRotation(ctx context.Context, credentialID, site string, status audit.EventStatus, message, errorCode string) {
+	if s.auditLogger == nil {
+		return
+	}
+	metadata := map[string]string{"method": string(MethodManual)}
+	if errorCode != "" {
+		metadata["error_code"] = errorCode
+	}
+	_ = s.auditLogger.LogEvent(ctx, audit.Event{
+		Type:         audit.EventTypeRotation,
+		Status:       status,
+		CredentialID: credentialID,
+		Site:         site,
+		Message:      message,
+		Timestamp:    time.Now(),
+		Metadata:     metadata,
+	})
+}
+
+// changePasswordURL returns the page where the user changes the password:
+// the site's well-known change-password URL, which sites redirect to their
+// own form (https://w3c.github.io/webappsec-change-password-url/).
+func changePasswordURL(loginURL, site string) string {
+	host := ""
+	if u, err := url.Parse(loginURL); err == nil && u.Hostname() != "" {
+		host = u.Host
+	} else {
+		candidate := site
+		if !strings.Contains(candidate, "://") {
+			candidate = "https://" + candidate
+		}
+		if u, err := url.Parse(candidate); err == nil {
+			host = u.Host
+		}
+	}
+	if host == "" || strings.ContainsAny(host, " /") {
+		return ""
+	}
+	return "https://" + host + "/.well-known/change-password"
+}
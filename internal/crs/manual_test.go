@@ -0,0 +1,374 @@
+package crs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/him"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/pwmanager"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation"
+)
+
+// fakeVault is an in-memory password manager that can stage passwords.
+type fakeVault struct {
+	mu           sync.Mutex
+	password     string
+	staged       string
+	lastModified time.Time
+	shared       bool
+	commitErr    error
+}
+
+func (v *fakeVault) DetectCompromised(ctx context.Context) ([]pwmanager.CompromisedCredential, error) {
+	return nil, nil
+}
+
+func (v *fakeVault) GetCredential(ctx context.Context, id string) (*pwmanager.Credential, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return &pwmanager.Credential{ID: id, Site: "GitHub", URL: "https://github.com/login", LastModified: v.lastModified, Shared: v.shared}, nil
+}
+
+func (v *fakeVault) UpdatePassword(ctx context.Context, id string, newPassword string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.password = newPassword
+	v.lastModified = time.Now()
+	return nil
+}
+
+func (v *fakeVault) VerifyUpdate(ctx context.Context, id string, expectedModifiedAfter time.Time) (bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.lastModified.After(expectedModifiedAfter), nil
+}
+
+func (v *fakeVault) IsAvailable(ctx context.Context) (bool, error)   { return true, nil }
+func (v *fakeVault) IsVaultLocked(ctx context.Context) (bool, error) { return false, nil }
+func (v *fakeVault) Type() string                                    { return "fake" }
+
+func (v *fakeVault) StagePassword(ctx context.Context, id string, password string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.staged = password
+	return nil
+}
+
+func (v *fakeVault) CommitStagedPassword(ctx context.Context, id string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.commitErr != nil {
+		return v.commitErr
+	}
+	if v.staged == "" {
+		return &pwmanager.PasswordManagerError{Code: pwmanager.ErrNoStagedPassword, Message: "nothing staged"}
+	}
+	v.password, v.staged = v.staged, ""
+	v.lastModified = time.Now()
+	return nil
+}
+
+func (v *fakeVault) DiscardStagedPassword(ctx context.Context, id string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.staged = ""
+	return nil
+}
+
+func (v *fakeVault) StagedPassword(ctx context.Context, id string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.staged == "" {
+		return "", &pwmanager.PasswordManagerError{Code: pwmanager.ErrNoStagedPassword, Message: "nothing staged"}
+	}
+	return v.staged, nil
+}
+
+// failCommit makes CommitStagedPassword fail with err, or succeed if nil.
+func (v *fakeVault) failCommit(err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.commitErr = err
+}
+
+func (v *fakeVault) state() (password, staged string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.password, v.staged
+}
+
+// plainVault is a password manager that cannot stage passwords.
+type plainVault struct{ pwmanager.PasswordManager }
+
+func newManualRotationService(t *testing.T) (*Service, *fakeVault, *him.Service) {
+	t.Helper()
+	auditLogger, err := audit.NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	himService := him.NewService(time.Minute)
+	t.Cleanup(himService.Close)
+
+	vault := &fakeVault{password: "old-password"}
+	service := NewService(vault, auditLogger)
+	service.SetHIMManager(him.NewManager(himService, him.DefaultPolicy(), nil))
+	return service, vault, himService
+}
+
+// waitForVault waits for the continuation to leave the vault in the expected state.
+func waitForVault(t *testing.T, vault *fakeVault, password, staged string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		gotPassword, gotStaged := vault.state()
+		if gotPassword == password && gotStaged == staged {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected password %q and staged %q, got %q and %q", password, staged, gotPassword, gotStaged)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestManualRotationCommit tests that a confirmed manual rotation commits the staged password
+func TestManualRotationCommit(t *testing.T) {
+	service, vault, himService := newManualRotationService(t)
+	ctx := context.Background()
+
+	result, err := service.StartManualRotation(ctx, pwmanager.CompromisedCredential{ID: "item-1", Site: "github.com"}, "n3w-p4ssw0rd")
+	if err != nil {
+		t.Fatalf("Failed to start manual rotation: %v", err)
+	}
+	if result.Status != RotationHIMRequired || result.HIMSessionID == "" {
+		t.Fatalf("Expected a HIM session, got %+v", result)
+	}
+
+	// The current password is untouched until the user confirms
+	if password, staged := vault.state(); password != "old-password" || staged != "n3w-p4ssw0rd" {
+		t.Fatalf("Expected the new password to be staged only, got %q and %q", password, staged)
+	}
+
+	session, err := himService.GetSession(ctx, result.HIMSessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if session.Type != him.HIMManualRotation || session.ActionURL != "https://github.com/.well-known/change-password" || !session.PasswordPending {
+		t.Errorf("Unexpected session: type %s, URL %q, password pending %v", session.Type, session.ActionURL, session.PasswordPending)
+	}
+
+	password, err := himService.RevealPassword(ctx, session.ID, session.SecurityToken)
+	if err != nil || password != "n3w-p4ssw0rd" {
+		t.Fatalf("Expected the new password to be shown, got %q (%v)", password, err)
+	}
+	if _, err := himService.RevealPassword(ctx, session.ID, session.SecurityToken); err == nil {
+		t.Error("Expected the password to be shown only once")
+	}
+
+	err = himService.SubmitResponse(ctx, session.ID, him.Response{
+		SessionID:     session.ID,
+		SecurityToken: session.SecurityToken,
+		Data:          him.ResponseData{TextInput: "yes"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to confirm: %v", err)
+	}
+	waitForVault(t, vault, "n3w-p4ssw0rd", "")
+}
+
+// failingAuditLogger is an audit logger that can't write events.
+type failingAuditLogger struct{ audit.Logger }
+
+func (failingAuditLogger) LogEvent(ctx context.Context, event audit.Event) error {
+	return errors.New("audit log unavailable")
+}
+
+// TestManualRotationAuditFailure tests that a rotation whose success can't be audited reports it
+func TestManualRotationAuditFailure(t *testing.T) {
+	ctx := context.Background()
+	journal, _ := openTestJournal(t)
+	vault := &fakeVault{password: "old-password", staged: "n3w-p4ssw0rd"}
+	service := NewService(vault, failingAuditLogger{})
+	service.SetJournal(journal)
+
+	cred := pwmanager.CompromisedCredential{ID: "item-1", Site: "github.com"}
+	journalID, err := service.beginJournal(ctx, "rotation-1", cred, "github.com", MethodManual)
+	if err != nil {
+		t.Fatalf("Failed to begin journal: %v", err)
+	}
+
+	rot := manualRotation{cred: cred, site: "github.com", startTime: time.Now(), journalID: journalID}
+	if err := service.finishManualRotation(ctx, rot, &him.HIMResponse{Confirmed: true}); err == nil {
+		t.Error("Expected the audit failure to be returned")
+	}
+	if password, _ := vault.state(); password != "n3w-p4ssw0rd" {
+		t.Errorf("Expected the password to be committed, got %q", password)
+	}
+	if entry, _ := journal.Get(ctx, journalID); entry.Step != rotation.JournalVerified {
+		t.Errorf("Expected the journal to stop at verified, got %s", entry.Step)
+	}
+}
+
+// confirmSession answers a confirmation session with "yes".
+func confirmSession(t *testing.T, himService *him.Service, sessionID string) {
+	t.Helper()
+	ctx := context.Background()
+	session, err := himService.GetSession(ctx, sessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	err = himService.SubmitResponse(ctx, session.ID, him.Response{
+		SessionID:     session.ID,
+		SecurityToken: session.SecurityToken,
+		Data:          him.ResponseData{TextInput: "yes"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to confirm: %v", err)
+	}
+}
+
+// waitForRetrySession waits for a failed commit to open a new session and
+// returns it.
+func waitForRetrySession(t *testing.T, journal *rotation.Journal, id, previous string) string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		entry, err := journal.Get(context.Background(), id)
+		if err == nil && entry.Step == rotation.JournalStaged && entry.Metadata["site_changed"] == "true" &&
+			entry.Metadata["him_session_id"] != previous {
+			return entry.Metadata["him_session_id"]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a retry session for a staged rotation, got %+v (%v)", entry, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestManualRotationCommitFailure tests that a commit failing after the site
+// change keeps the staged password and asks the user to retry
+func TestManualRotationCommitFailure(t *testing.T) {
+	delay := commitRetryDelay
+	commitRetryDelay = time.Millisecond
+	t.Cleanup(func() { commitRetryDelay = delay })
+
+	ctx := context.Background()
+	journal, _ := openTestJournal(t)
+	service, vault, himService := newManualRotationService(t)
+	service.SetJournal(journal)
+
+	result, err := service.StartManualRotation(ctx, pwmanager.CompromisedCredential{ID: "item-1", Site: "github.com"}, "n3w-p4ssw0rd")
+	if err != nil {
+		t.Fatalf("Failed to start manual rotation: %v", err)
+	}
+	incomplete, _ := journal.Incomplete(ctx)
+	if len(incomplete) != 1 {
+		t.Fatalf("Expected one rotation in the journal, got %d", len(incomplete))
+	}
+	journalID := incomplete[0].ID
+
+	vault.failCommit(errors.New("vault unreachable"))
+	confirmSession(t, himService, result.HIMSessionID)
+	retryID := waitForRetrySession(t, journal, journalID, result.HIMSessionID)
+	if password, staged := vault.state(); password != "old-password" || staged != "n3w-p4ssw0rd" {
+		t.Fatalf("Expected the new password to stay staged, got %q and %q", password, staged)
+	}
+
+	// The retry asks again while the vault still fails
+	confirmSession(t, himService, retryID)
+	retryID = waitForRetrySession(t, journal, journalID, retryID)
+
+	vault.failCommit(nil)
+	confirmSession(t, himService, retryID)
+	waitForVault(t, vault, "n3w-p4ssw0rd", "")
+	waitForStep(t, journal, journalID, rotation.JournalAudited)
+}
+
+// TestManualRotationAbort tests that aborting or declining discards the staged password
+func TestManualRotationAbort(t *testing.T) {
+	tests := []struct {
+		name  string
+		abort func(ctx context.Context, service *him.Service, session *him.Session) error
+	}{
+		{
+			name: "cancelled",
+			abort: func(ctx context.Context, service *him.Service, session *him.Session) error {
+				return service.CancelSession(ctx, session.ID)
+			},
+		},
+		{
+			name: "declined",
+			abort: func(ctx context.Context, service *him.Service, session *him.Session) error {
+				return service.SubmitResponse(ctx, session.ID, him.Response{
+					SessionID:     session.ID,
+					SecurityToken: session.SecurityToken,
+					Data:          him.ResponseData{TextInput: "no"},
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, vault, himService := newManualRotationService(t)
+			ctx := context.Background()
+
+			result, err := service.StartManualRotation(ctx, pwmanager.CompromisedCredential{ID: "item-1", Site: "github.com"}, "n3w-p4ssw0rd")
+			if err != nil {
+				t.Fatalf("Failed to start manual rotation: %v", err)
+			}
+			session, _ := himService.GetSession(ctx, result.HIMSessionID)
+			if err := tt.abort(ctx, himService, session); err != nil {
+				t.Fatalf("Failed to abort: %v", err)
+			}
+			waitForVault(t, vault, "old-password", "")
+		})
+	}
+}
+
+// TestManualRotationRequiresStaging tests that vaults without staging are refused
+func TestManualRotationRequiresStaging(t *testing.T) {
+	auditLogger, _ := audit.NewMemoryLogger()
+	himService := him.NewService(time.Minute)
+	defer himService.Close()
+
+	var vault pwmanager.PasswordManager = plainVault{&fakeVault{password: "old-password"}}
+	service := NewService(vault, auditLogger)
+	service.SetHIMManager(him.NewManager(himService, him.DefaultPolicy(), nil))
+	if service.ManualRotationEnabled() {
+		t.Error("Expected manual rotation to be disabled")
+	}
+
+	_, err := service.StartManualRotation(context.Background(), pwmanager.CompromisedCredential{ID: "item-1"}, "n3w-p4ssw0rd")
+	var rerr *RotationError
+	if !errors.As(err, &rerr) || rerr.Code != ErrStagingUnsupported {
+		t.Fatalf("Expected ErrStagingUnsupported, got %v", err)
+	}
+}
+
+// TestChangePasswordURL tests finding the change-password page
+func TestChangePasswordURL(t *testing.T) {
+	tests := []struct {
+		loginURL string
+		site     string
+		want     string
+	}{
+		{"https://accounts.example.com/login", "Example", "https://accounts.example.com/.well-known/change-password"},
+		{"", "github.com", "https://github.com/.well-known/change-password"},
+		{"", "https://gitlab.com/users/sign_in", "https://gitlab.com/.well-known/change-password"},
+		{"", "My Bank", ""},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.loginURL+" "+tt.site, func(t *testing.T) {
+			if got := changePasswordURL(tt.loginURL, tt.site); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -11,7 +11,10 @@ import (
 	"time"
 
 	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/him"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/logging"
 	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/pwmanager"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation"
 )
 
 // Service implements the CredentialRemediationService interface.
@@ -19,6 +22,10 @@ type Service struct {
 	pwManager     pwmanager.PasswordManager
 	auditLogger   audit.Logger
 	defaultPolicy pwmanager.PasswordPolicy
+	himManager    *him.Manager
+	journal       *rotation.Journal
+	locks         *rotation.LockManager
+	logger        *logging.Logger
 }
 
 // NewService creates a new CRS instance with the specified password manager and audit logger.
@@ -27,6 +34,7 @@ func NewService(pm pwmanager.PasswordManager, auditer audit.Logger) *Service {
 		pwManager:     pm,
 		auditLogger:   auditer,
 		defaultPolicy: pwmanager.DefaultPasswordPolicy(),
+		logger:        logging.NewLogger("crs"),
 	}
 }
 
@@ -192,7 +200,26 @@ func (s *Service) GeneratePassword(ctx context.Context, policy pwmanager.Passwor
 }
 
 // RotateCredential performs the complete rotation workflow for a single credential.
+// When the HIM policy requires approval, as for shared credentials, it
+// returns RotationHIMRequired with the approval session in HIMSessionID,
+// and the rotation runs once the session is approved. When the policy
+// requires any other human intervention it returns RotationHIMRequired
+// without rotating.
 func (s *Service) RotateCredential(ctx context.Context, cred pwmanager.CompromisedCredential, newPassword string) (*RotationResult, error) {
+	if newPassword != "" {
+		rotate := func(ctx context.Context) error {
+			_, err := s.rotateCredential(ctx, cred, newPassword)
+			return err
+		}
+		if result, err := s.requireApproval(ctx, cred, MethodAuto, nil, rotate); result != nil {
+			return result, err
+		}
+	}
+	return s.rotateCredential(ctx, cred, newPassword)
+}
+
+// rotateCredential rotates cred without checking for approval.
+func (s *Service) rotateCredential(ctx context.Context, cred pwmanager.CompromisedCredential, newPassword string) (*RotationResult, error) {
 	startTime := time.Now()
 
 	result := &RotationResult{
@@ -226,6 +253,31 @@ func (s *Service) RotateCredential(ctx context.Context, cred pwmanager.Compromis
 		return result, result.Error
 	}
 
+	rotationID := rotation.GenerateStateID()
+	lease, rerr := s.acquireLease(ctx, cred.ID, rotationID, rotation.DefaultLeaseTTL)
+	if rerr != nil {
+		result.Status = RotationFailure
+		result.Error = rerr
+		result.EndTime = time.Now()
+		result.Duration = result.EndTime.Sub(startTime)
+		return result, result.Error
+	}
+	defer s.releaseLease(ctx, lease)
+
+	journalID, err := s.beginJournal(ctx, rotationID, cred, cred.Site, MethodAuto)
+	if err != nil {
+		result.Status = RotationFailure
+		result.Error = &RotationError{
+			Code:      ErrJournalFailed,
+			Message:   "Failed to record rotation intent",
+			Cause:     err,
+			Retryable: true,
+		}
+		result.EndTime = time.Now()
+		result.Duration = result.EndTime.Sub(startTime)
+		return result, result.Error
+	}
+
 	// Step 2: Update vault via password manager CLI
 	if err := s.pwManager.UpdatePassword(ctx, cred.ID, newPassword); err != nil {
 		result.Status = RotationFailure
@@ -246,6 +298,7 @@ func (s *Service) RotateCredential(ctx context.Context, cred pwmanager.Compromis
 
 		result.EndTime = time.Now()
 		result.Duration = result.EndTime.Sub(startTime)
+		s.recordJournal(ctx, journalID, rotation.JournalFailed, result.Error.Message, nil)
 
 		// Log failure
 		_ = s.auditLogger.LogEvent(ctx, audit.Event{
@@ -264,6 +317,7 @@ func (s *Service) RotateCredential(ctx context.Context, cred pwmanager.Compromis
 	}
 
 	result.NewPasswordSet = true
+	s.recordJournal(ctx, journalID, rotation.JournalVaultWritten, "", nil)
 
 	// Step 3: Verify update success
 	verified, err := s.VerifyRotation(ctx, cred.ID)
@@ -276,6 +330,7 @@ func (s *Service) RotateCredential(ctx context.Context, cred pwmanager.Compromis
 		}
 		result.EndTime = time.Now()
 		result.Duration = result.EndTime.Sub(startTime)
+		s.recordJournal(ctx, journalID, rotation.JournalFailed, "verification failed", nil)
 
 		// Log verification failure
 		_ = s.auditLogger.LogEvent(ctx, audit.Event{
@@ -290,6 +345,8 @@ func (s *Service) RotateCredential(ctx context.Context, cred pwmanager.Compromis
 		return result, result.Error
 	}
 
+	s.recordJournal(ctx, journalID, rotation.JournalVerified, "", nil)
+
 	// Step 4: Log rotation event to audit trail
 	auditEvent := audit.Event{
 		Type:         audit.EventTypeRotation,
@@ -302,6 +359,7 @@ func (s *Service) RotateCredential(ctx context.Context, cred pwmanager.Compromis
 		Metadata: map[string]string{
 			"password_manager": s.pwManager.Type(),
 			"breach_name":      cred.BreachName,
+			"duration":         time.Since(startTime).String(),
 		},
 	}
 
@@ -314,6 +372,7 @@ func (s *Service) RotateCredential(ctx context.Context, cred pwmanager.Compromis
 		return result, nil
 	}
 
+	s.recordJournal(ctx, journalID, rotation.JournalAudited, "", nil)
 	result.AuditEventID = auditEvent.ID
 	result.Status = RotationSuccess
 	result.EndTime = time.Now()
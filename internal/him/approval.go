@@ -0,0 +1,320 @@
+package him
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	acmv1 "github.com/ferg-cod3s/automated-compromise-mitigation/api/proto/acm/v1"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/acvs/evidence"
+)
+
+// approvalSignatureWindow bounds how far an approval's signing time may be
+// from the service's clock, so a captured signature can't be replayed later.
+const approvalSignatureWindow = 5 * time.Minute
+
+// ApprovalRequirement is the sign-off a HIMApproval session needs before
+// the rotation may proceed.
+type ApprovalRequirement struct {
+	// Required is the number of distinct approvers needed.
+	Required int `json:"required"`
+
+	// Approvers lists the client certificate common names allowed to
+	// approve. Empty allows any certificate issued by the ACM CA.
+	Approvers []string `json:"approvers,omitempty"`
+
+	// EscalateAfter is how long to wait for the required approvals before
+	// escalating. Zero disables escalation.
+	EscalateAfter time.Duration `json:"escalate_after,omitempty"`
+
+	// EscalationApprovers may also approve once the session has escalated.
+	EscalationApprovers []string `json:"escalation_approvers,omitempty"`
+}
+
+// Approver identifies a person by the mTLS client certificate they used.
+type Approver struct {
+	// CommonName is the certificate subject's common name.
+	CommonName string
+
+	// Fingerprint is the hex SHA-256 of the DER-encoded certificate.
+	Fingerprint string
+}
+
+// ApproverFromCertificate identifies the holder of cert.
+func ApproverFromCertificate(cert *x509.Certificate) Approver {
+	sum := sha256.Sum256(cert.Raw)
+	return Approver{CommonName: cert.Subject.CommonName, Fingerprint: hex.EncodeToString(sum[:])}
+}
+
+// Approval is one signed approval of a HIMApproval session.
+type Approval struct {
+	// Approver is who approved.
+	Approver Approver
+
+	// Signature is the approver's signature over ApprovalMessage, made with
+	// the private key of their client certificate.
+	Signature []byte
+
+	// SignedAt is the signing time included in the signed message.
+	SignedAt time.Time
+
+	// EvidenceID is the evidence chain entry recording the approval.
+	EvidenceID string
+}
+
+// EvidenceRecorder appends entries to the evidence chain.
+// *evidence.ChainGenerator implements it.
+type EvidenceRecorder interface {
+	AddEntry(ctx context.Context, entry *evidence.Entry) (string, error)
+}
+
+// ApprovalPayload describes what approving session means: the session and
+// the operation and credential it gates. Clients show it to the approver.
+func (s *Session) ApprovalPayload() string {
+	return fmt.Sprintf("acm-him-approval/v1\nsession=%s\noperation=%s\nsite=%s\ncredential=%s\n",
+		s.ID, s.OperationID, s.Site, hashToken(s.CredentialID))
+}
+
+// ApprovalMessage is what an approver signs: the approval payload and the
+// signing time.
+func ApprovalMessage(payload string, signedAt time.Time) []byte {
+	return []byte(fmt.Sprintf("%ssigned_at=%d\n", payload, signedAt.Unix()))
+}
+
+// SignApproval signs message with the private key of a client certificate.
+// RSA keys use PKCS #1 v1.5 with SHA-256, ECDSA keys ASN.1 with SHA-256.
+func SignApproval(signer crypto.Signer, message []byte) ([]byte, error) {
+	switch signer.Public().(type) {
+	case ed25519.PublicKey:
+		return signer.Sign(rand.Reader, message, crypto.Hash(0))
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", signer.Public())
+	}
+}
+
+// verifyApproval checks signature against the certificate's public key.
+func verifyApproval(cert *x509.Certificate, message, signature []byte) error {
+	var algorithm x509.SignatureAlgorithm
+	switch cert.PublicKeyAlgorithm {
+	case x509.RSA:
+		algorithm = x509.SHA256WithRSA
+	case x509.ECDSA:
+		algorithm = x509.ECDSAWithSHA256
+	case x509.Ed25519:
+		algorithm = x509.PureEd25519
+	default:
+		return fmt.Errorf("unsupported key algorithm %s", cert.PublicKeyAlgorithm)
+	}
+	return cert.CheckSignature(algorithm, message, signature)
+}
+
+// SetEvidenceRecorder sets where approvals are recorded. Approve fails
+// until one is set.
+func (s *Service) SetEvidenceRecorder(recorder EvidenceRecorder) {
+	s.evidenceMu.Lock()
+	defer s.evidenceMu.Unlock()
+	s.evidence = recorder
+}
+
+// OnEscalation registers fn to be called, in its own goroutine, with a copy
+// of an approval session when it escalates.
+func (s *Service) OnEscalation(fn func(Session)) {
+	s.listenersMu.Lock()
+	defer s.listenersMu.Unlock()
+	s.escalationListeners = append(s.escalationListeners, fn)
+}
+
+// Approve records an approval of a HIMApproval session by the holder of
+// cert, who signed ApprovalMessage(session.ApprovalPayload(), signedAt). The approval is
+// written to the evidence chain before it counts. Once the required number
+// of distinct approvers have approved, the session completes with
+// BooleanInput set.
+func (s *Service) Approve(ctx context.Context, sessionID string, cert *x509.Certificate, signedAt time.Time, signature []byte) (*Session, error) {
+	entry, err := s.entry(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	session := &entry.session
+
+	if session.Type != HIMApproval || session.Approval == nil {
+		return nil, &HIMError{Code: ErrNotAuthorized, Message: "session is not an approval request", SessionID: sessionID}
+	}
+	if !session.IsActive() {
+		return nil, closedError(session)
+	}
+	if !time.Now().Before(session.ExpiresAt) {
+		entry.transition(StateTimeout)
+		return nil, closedError(session)
+	}
+
+	if d := time.Since(signedAt); d > approvalSignatureWindow || d < -approvalSignatureWindow {
+		return nil, &HIMError{Code: ErrInvalidSignature, Message: "approval signing time is too far from now", SessionID: sessionID}
+	}
+	if err := verifyApproval(cert, ApprovalMessage(session.ApprovalPayload(), signedAt), signature); err != nil {
+		return nil, &HIMError{Code: ErrInvalidSignature, Message: "approval signature does not verify", Cause: err, SessionID: sessionID}
+	}
+
+	approver := ApproverFromCertificate(cert)
+	if !canApprove(session, approver) {
+		return nil, &HIMError{Code: ErrNotAuthorized, Message: fmt.Sprintf("%s may not approve this request", approver.CommonName), SessionID: sessionID}
+	}
+	if hasApproved(session, approver) {
+		return nil, &HIMError{Code: ErrDuplicateApproval, Message: fmt.Sprintf("%s has already approved", approver.CommonName), SessionID: sessionID}
+	}
+
+	approval := Approval{Approver: approver, Signature: signature, SignedAt: signedAt}
+	approval.EvidenceID, err = s.recordApproval(ctx, session, approval)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clip so a snapshot taken earlier never shares the appended element
+	session.Approvals = append(slices.Clip(session.Approvals), approval)
+	session.LastUpdated = time.Now()
+	s.logger.Info("HIM approval recorded",
+		"session_id", sessionID,
+		"approver", approver.CommonName,
+		"approvals", len(session.Approvals),
+		"required", session.Approval.Required,
+	)
+
+	if len(session.Approvals) < session.Approval.Required {
+		s.saveSession(*session)
+		snapshot := *session
+		return &snapshot, nil
+	}
+
+	if err := entry.transition(StateProcessing); err != nil {
+		return nil, err
+	}
+	entry.response = Response{SessionID: sessionID, Data: ResponseData{BooleanInput: true, BooleanSet: true}, Timestamp: time.Now()}
+	if err := entry.transition(StateCompleted); err != nil {
+		return nil, err
+	}
+	snapshot := *session
+	return &snapshot, nil
+}
+
+// CanApprove reports whether approver may still approve session.
+func CanApprove(session *Session, approver Approver) bool {
+	return session.Type == HIMApproval &&
+		session.Approval != nil &&
+		session.IsActive() &&
+		canApprove(session, approver) &&
+		!hasApproved(session, approver)
+}
+
+// canApprove reports whether approver is eligible for session at all.
+func canApprove(session *Session, approver Approver) bool {
+	req := session.Approval
+	if len(req.Approvers) == 0 || containsFold(req.Approvers, approver.CommonName) {
+		return true
+	}
+	return session.Escalated && containsFold(req.EscalationApprovers, approver.CommonName)
+}
+
+// hasApproved reports whether approver, by certificate or by name, has
+// already approved session. Distinct approvers means distinct people, so a
+// second certificate with the same name doesn't count twice.
+func hasApproved(session *Session, approver Approver) bool {
+	for _, a := range session.Approvals {
+		if a.Approver.Fingerprint == approver.Fingerprint || strings.EqualFold(a.Approver.CommonName, approver.CommonName) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordApproval writes approval to the evidence chain. The caller must
+// hold the session's entry lock.
+func (s *Service) recordApproval(ctx context.Context, session *Session, approval Approval) (string, error) {
+	s.evidenceMu.RLock()
+	recorder := s.evidence
+	s.evidenceMu.RUnlock()
+	if recorder == nil {
+		return "", fmt.Errorf("no evidence chain configured for approvals")
+	}
+
+	id, err := recorder.AddEntry(ctx, &evidence.Entry{
+		EventType:        acmv1.EvidenceEventType_EVIDENCE_EVENT_TYPE_HIM_PROMPT,
+		Site:             session.Site,
+		CredentialIDHash: hashToken(session.CredentialID),
+		EvidenceData: map[string]interface{}{
+			"him_type":             string(HIMApproval),
+			"session_id":           session.ID,
+			"operation_id":         session.OperationID,
+			"approver":             approval.Approver.CommonName,
+			"approver_fingerprint": approval.Approver.Fingerprint,
+			"signature":            base64.StdEncoding.EncodeToString(approval.Signature),
+			"signed_message":       string(ApprovalMessage(session.ApprovalPayload(), approval.SignedAt)),
+			"approval_number":      len(session.Approvals) + 1,
+			"required":             session.Approval.Required,
+			"escalated":            session.Escalated,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to record approval in evidence chain: %w", err)
+	}
+	return id, nil
+}
+
+// escalate marks an approval session escalated if it is still waiting.
+func (e *sessionEntry) escalate() (Session, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.session.IsActive() || e.session.Escalated {
+		return Session{}, false
+	}
+	e.session.Escalated = true
+	e.session.LastUpdated = time.Now()
+	if e.save != nil {
+		e.save(e.session)
+	}
+	return e.session, true
+}
+
+// escalateSession escalates an approval session and notifies listeners.
+func (s *Service) escalateSession(entry *sessionEntry) {
+	session, ok := entry.escalate()
+	if !ok {
+		return
+	}
+	s.logger.Warn("HIM approval escalated",
+		"session_id", session.ID,
+		"approvals", len(session.Approvals),
+		"required", session.Approval.Required,
+	)
+
+	s.listenersMu.RLock()
+	for _, listener := range s.escalationListeners {
+		go listener(session)
+	}
+	s.listenersMu.RUnlock()
+}
+
+func containsFold(values []string, v string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,299 @@
+package him
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/acvs/evidence"
+)
+
+// testApprover is a client certificate and its key.
+type testApprover struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestApprover(t *testing.T, commonName string) testApprover {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return testApprover{cert: cert, key: key}
+}
+
+// approve signs and submits an approval as a.
+func (a testApprover) approve(t *testing.T, service *Service, session *Session) (*Session, error) {
+	t.Helper()
+	signedAt := time.Now()
+	signature, err := SignApproval(a.key, ApprovalMessage(session.ApprovalPayload(), signedAt))
+	if err != nil {
+		t.Fatalf("Failed to sign approval: %v", err)
+	}
+	return service.Approve(context.Background(), session.ID, a.cert, signedAt, signature)
+}
+
+func newApprovalService(t *testing.T) (*Service, *evidence.ChainGenerator) {
+	t.Helper()
+	chain, err := evidence.NewChainGenerator()
+	if err != nil {
+		t.Fatalf("Failed to create evidence chain: %v", err)
+	}
+	service := NewService(time.Minute)
+	t.Cleanup(service.Close)
+	service.SetEvidenceRecorder(chain)
+	return service, chain
+}
+
+func createApproval(t *testing.T, service *Service, requirement ApprovalRequirement) *Session {
+	t.Helper()
+	session, err := service.CreateSession(context.Background(), SessionRequest{
+		Type:         HIMApproval,
+		CredentialID: "cred-1",
+		Site:         "shared.example.com",
+		OperationID:  "op-1",
+		Prompt:       "Approve rotation",
+		Approval:     &requirement,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create approval session: %v", err)
+	}
+	return session
+}
+
+func assertHIMError(t *testing.T, err error, code HIMErrorCode) {
+	t.Helper()
+	var herr *HIMError
+	if !errors.As(err, &herr) || herr.Code != code {
+		t.Fatalf("Expected %s, got %v", code, err)
+	}
+}
+
+// TestApprovalQuorum tests that distinct signed approvals complete the session
+func TestApprovalQuorum(t *testing.T) {
+	service, chain := newApprovalService(t)
+	session := createApproval(t, service, ApprovalRequirement{Required: 2, Approvers: []string{"alice", "bob", "carol"}})
+
+	alice, bob := newTestApprover(t, "alice"), newTestApprover(t, "bob")
+
+	after, err := alice.approve(t, service, session)
+	if err != nil {
+		t.Fatalf("Failed to approve: %v", err)
+	}
+	if !after.IsActive() || len(after.Approvals) != 1 || after.Approvals[0].EvidenceID == "" {
+		t.Fatalf("Expected one recorded approval on an active session, got %+v", after)
+	}
+
+	// The same person again, even with a new certificate, doesn't count
+	_, err = newTestApprover(t, "alice").approve(t, service, session)
+	assertHIMError(t, err, ErrDuplicateApproval)
+
+	after, err = bob.approve(t, service, session)
+	if err != nil {
+		t.Fatalf("Failed to approve: %v", err)
+	}
+	if after.State != StateCompleted {
+		t.Fatalf("Expected completed session, got %s", after.State)
+	}
+
+	response, err := service.WaitForResponse(context.Background(), session.ID)
+	if err != nil || !response.Data.BooleanInput {
+		t.Errorf("Expected an approving response, got %+v (%v)", response, err)
+	}
+
+	if chain.GetChainLength() != 2 {
+		t.Fatalf("Expected 2 evidence entries, got %d", chain.GetChainLength())
+	}
+	for _, approval := range after.Approvals {
+		if _, err := chain.GetEntry(context.Background(), approval.EvidenceID); err != nil {
+			t.Errorf("Evidence entry %s not found: %v", approval.EvidenceID, err)
+		}
+	}
+}
+
+// TestApprovalRejected tests approvals that must not count
+func TestApprovalRejected(t *testing.T) {
+	service, chain := newApprovalService(t)
+	session := createApproval(t, service, ApprovalRequirement{Required: 1, Approvers: []string{"alice"}})
+	alice := newTestApprover(t, "alice")
+
+	// Signed by a different key than the certificate's
+	signedAt := time.Now()
+	forged, _ := SignApproval(newTestApprover(t, "mallory").key, ApprovalMessage(session.ApprovalPayload(), signedAt))
+	_, err := service.Approve(context.Background(), session.ID, alice.cert, signedAt, forged)
+	assertHIMError(t, err, ErrInvalidSignature)
+
+	// A stale signature can't be replayed
+	old := time.Now().Add(-time.Hour)
+	stale, _ := SignApproval(alice.key, ApprovalMessage(session.ApprovalPayload(), old))
+	_, err = service.Approve(context.Background(), session.ID, alice.cert, old, stale)
+	assertHIMError(t, err, ErrInvalidSignature)
+
+	// Not a listed approver
+	_, err = newTestApprover(t, "mallory").approve(t, service, session)
+	assertHIMError(t, err, ErrNotAuthorized)
+
+	// The security token can't stand in for approvals
+	err = service.SubmitResponse(context.Background(), session.ID, Response{SecurityToken: session.SecurityToken, Data: ResponseData{BooleanInput: true, BooleanSet: true}})
+	assertHIMError(t, err, ErrNotAuthorized)
+
+	if chain.GetChainLength() != 0 {
+		t.Errorf("Expected no evidence entries, got %d", chain.GetChainLength())
+	}
+	current, _ := service.GetSession(context.Background(), session.ID)
+	if !current.IsActive() || len(current.Approvals) != 0 {
+		t.Errorf("Expected untouched session, got %+v", current)
+	}
+}
+
+// TestApprovalRequiresEvidence tests that approvals fail without an evidence chain
+func TestApprovalRequiresEvidence(t *testing.T) {
+	service := NewService(time.Minute)
+	defer service.Close()
+	session := createApproval(t, service, ApprovalRequirement{Required: 1})
+
+	if _, err := newTestApprover(t, "alice").approve(t, service, session); err == nil {
+		t.Fatal("Expected approval to fail without an evidence chain")
+	}
+	current, _ := service.GetSession(context.Background(), session.ID)
+	if len(current.Approvals) != 0 {
+		t.Errorf("Expected no approvals, got %d", len(current.Approvals))
+	}
+}
+
+// TestApprovalEscalation tests that escalation notifies and admits escalation approvers
+func TestApprovalEscalation(t *testing.T) {
+	service, _ := newApprovalService(t)
+	escalated := make(chan Session, 1)
+	service.OnEscalation(func(session Session) { escalated <- session })
+
+	session := createApproval(t, service, ApprovalRequirement{
+		Required:            1,
+		Approvers:           []string{"alice"},
+		EscalateAfter:       200 * time.Millisecond,
+		EscalationApprovers: []string{"oncall"},
+	})
+	oncall := newTestApprover(t, "oncall")
+
+	if _, err := oncall.approve(t, service, session); err == nil {
+		t.Fatal("Expected escalation approver to be rejected before escalation")
+	}
+
+	select {
+	case got := <-escalated:
+		if got.ID != session.ID || !got.Escalated {
+			t.Fatalf("Unexpected escalation: %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Session did not escalate")
+	}
+
+	after, err := oncall.approve(t, service, session)
+	if err != nil {
+		t.Fatalf("Failed to approve after escalation: %v", err)
+	}
+	if after.State != StateCompleted {
+		t.Errorf("Expected completed session, got %s", after.State)
+	}
+}
+
+// TestSignApprovalKeyTypes tests signing and verifying with each key type
+func TestSignApprovalKeyTypes(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ed"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, edKey.Public(), edKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	edCert, _ := x509.ParseCertificate(der)
+
+	ec := newTestApprover(t, "ec")
+	for name, a := range map[string]testApprover{"ecdsa": ec, "ed25519": {cert: edCert, key: edKey}} {
+		t.Run(name, func(t *testing.T) {
+			message := ApprovalMessage("payload\n", time.Now())
+			signature, err := SignApproval(a.key, message)
+			if err != nil {
+				t.Fatalf("Failed to sign: %v", err)
+			}
+			if err := verifyApproval(a.cert, message, signature); err != nil {
+				t.Errorf("Failed to verify: %v", err)
+			}
+			if err := verifyApproval(a.cert, append(message, 'x'), signature); err == nil {
+				t.Error("Expected a modified message to fail verification")
+			}
+		})
+	}
+}
+
+// TestApprovalPersistence tests that approvals and escalation survive a restart
+func TestApprovalPersistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	before, _ := newApprovalService(t)
+	if _, _, err := before.Restore(ctx, openTestStore(t, path), nil); err != nil {
+		t.Fatalf("Failed to attach store: %v", err)
+	}
+	session := createApproval(t, before, ApprovalRequirement{Required: 2, Approvers: []string{"alice", "bob"}, EscalationApprovers: []string{"oncall"}})
+	if _, err := newTestApprover(t, "alice").approve(t, before, session); err != nil {
+		t.Fatalf("Failed to approve: %v", err)
+	}
+	before.Close()
+
+	after, _ := newApprovalService(t)
+	if _, _, err := after.Restore(ctx, openTestStore(t, path), nil); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	restored, err := after.GetSession(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get restored session: %v", err)
+	}
+	if restored.Approval == nil || restored.Approval.Required != 2 || len(restored.Approval.EscalationApprovers) != 1 {
+		t.Fatalf("Approval requirement not restored: %+v", restored.Approval)
+	}
+	if len(restored.Approvals) != 1 || restored.Approvals[0].Approver.CommonName != "alice" || len(restored.Approvals[0].Signature) == 0 {
+		t.Fatalf("Approvals not restored: %+v", restored.Approvals)
+	}
+
+	// The restored approval still counts towards the quorum
+	_, err = newTestApprover(t, "alice").approve(t, after, restored)
+	assertHIMError(t, err, ErrDuplicateApproval)
+	done, err := newTestApprover(t, "bob").approve(t, after, restored)
+	if err != nil || done.State != StateCompleted {
+		t.Fatalf("Expected restored session to complete, got %+v (%v)", done, err)
+	}
+}
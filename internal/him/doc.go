@@ -17,6 +17,79 @@
 //   - CANCELLED: User cancelled the session
 //   - EXPIRED: Session timed out waiting for response
 //
+// Service enforces the legal transitions under a per-session lock and
+// returns copies of sessions, so callers never observe a session mid-update.
+// Expiry runs from a single timer over a heap of deadlines, and
+// cancellation is idempotent.
+//
+// # Persistence
+//
+// Service.Restore attaches a SessionStore (SQLiteSessionStore in the
+// daemon) and rehydrates the sessions saved in it. Prompts that expired
+// while the daemon was down are timed out and audited; live prompts get a
+// new security token and are re-sent to clients as they reconnect. Only
+// the SHA-256 of a security token is ever stored.
+//
+// # TOTP Auto-Fill
+//
+// When the policy sets AutoFillTOTP and a pwmanager.TOTPGenerator is
+// attached with Manager.SetTOTPSource, a TOTP prompt opened with Pause or
+// PromptAction for a credential whose vault item has a TOTP seed
+// (RotationAction.Credential, filled from the vault by the caller) becomes
+// a yes/no confirmation. On yes, the manager reads the current code from the
+// password manager CLI and resumes the rotation with it
+// (HIMResponse.AutoFilled). The code is never stored, logged or audited;
+// only the fact that an auto-fill happened is. If the user says no or the
+// vault has no code, the user is asked for the code as usual.
+//
+// # Codes From Local Mail
+//
+// MaildirWatcher watches a Maildir synced by mbsync or offlineimap for
+// mail from the site behind an EMAIL_CODE session. The code is extracted
+// with a per-site regular expression from MaildirConfig.Templates, or a
+// heuristic that picks the code-like token closest to a word like "code",
+// and offered through Service.Suggest. The user still confirms it: clients
+// show the suggestion and submit it as the response.
+//
+// # Multi-Party Approval
+//
+// When the policy configures Approval, rotating a shared credential opens
+// a HIMApproval session that needs sign-off from a number of distinct
+// people. Approvers are identified by their mTLS client certificates and
+// sign the session's ApprovalPayload with the certificate's key; each
+// approval is verified and written to the evidence chain before it counts.
+// The security token cannot answer these sessions. If approvals are still
+// missing after EscalateAfter, the session escalates: escalation listeners
+// are notified and EscalationApprovers may approve as well.
+//
+// # Browser Prompts
+//
+// WebServer serves pending prompts as an HTTPS page on 127.0.0.1, for
+// people who would rather answer in a browser than a terminal. Browsers
+// sign in with a one-time login URL (acm him-web prints one), and every
+// response form carries the session's SecurityToken as its CSRF token, so
+// responses go through SubmitResponse exactly as they do over gRPC. The
+// page sends a strict Content-Security-Policy and refuses requests for
+// other host names.
+//
+// # Browser Extension Handoff
+//
+// The acm-native-host binary relays a browser extension's requests to the
+// service. SessionsForOrigin lists the prompts for the site in the current
+// tab, and a rotation can attach its new password to a session with
+// AttachPassword. ReleasePassword hands it out once, and only to an https
+// origin on the session's registrable domain; it is kept in memory only and
+// dropped when the session ends.
+//
+// # Input Validation
+//
+// Each session carries an InputType, and SubmitResponse runs the matching
+// Validator before accepting a response: TOTP and SMS codes must be digits,
+// confirmations must be an unambiguous yes or no, free text is bounded, and
+// so on. Malformed input is rejected with ErrInvalidInput and does not use
+// up an attempt, so a typo can simply be retried. Service.SetValidator
+// replaces or removes the validator for an input type.
+//
 // # HIM Trigger Conditions
 //
 // HIM workflows are triggered when:
@@ -35,10 +108,35 @@
 //   - Secure Input: All user input transmitted over mTLS, never logged plaintext
 //   - Context Preservation: State maintained across pause/resume cycles
 //
+// # Deciding When HIM Is Needed
+//
+// Manager.RequiresHIM applies a Policy in this order:
+//
+//   - Multi-party approval for shared credentials, when configured. Nothing
+//     later can waive it; once the action carries the approved session in
+//     ApprovalSessionID, the rest of the order applies
+//   - User overrides for the site (and optionally action type)
+//   - The ACVS verdict from the ComplianceChecker: blocked actions need a
+//     ToS review, and a manual recommendation needs a manual rotation
+//   - Manual rotation when the method is manual or the site category is
+//     one the user always changes by hand (financial, government and
+//     healthcare by default)
+//   - The challenge the site will raise: TOTP when the vault item has a
+//     TOTP secret, otherwise an email confirmation for account recovery and
+//     email changes
+//
+// Policies are loaded from JSON with LoadPolicy.
+//
+// # Pausing and Resuming Rotations
+//
+// Manager.Pause creates a session without blocking and registers a
+// Continuation for it. When the user responds, cancels, or the session
+// expires, the continuation is called once through ResumeAutomation.
+//
 // # Example Usage
 //
 //	ctx := context.Background()
-//	himMgr := him.NewManager()
+//	himMgr := him.NewManager(him.NewService(0), him.DefaultPolicy(), acvsChecker)
 //
 //	// Check if HIM is required for a rotation
 //	action := him.RotationAction{
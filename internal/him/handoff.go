@@ -0,0 +1,144 @@
+package him
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+)
+
+// AttachPassword attaches a newly generated password to an active session
+// so a browser extension on the site's change-password form can fill it in.
+// It can be released once, with ReleasePassword, and is dropped when the
+// session ends. Attaching again replaces an unreleased password.
+func (s *Service) AttachPassword(ctx context.Context, sessionID, password string) error {
+	entry, err := s.entry(sessionID)
+	if err != nil {
+		return err
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if !entry.session.IsActive() {
+		return closedError(&entry.session)
+	}
+	entry.password = password
+	entry.session.PasswordPending = password != ""
+	entry.session.LastUpdated = time.Now()
+	return nil
+}
+
+// ReleasePassword returns the password attached to a session, once, to a
+// browser on origin. The caller proves it received the prompt with the
+// session's security token, since origin is only what the caller claims.
+// origin must be an https origin on the session's site (the same
+// registrable domain), so a password for github.com is never handed to a
+// page on another site.
+func (s *Service) ReleasePassword(ctx context.Context, sessionID, origin, securityToken string) (string, error) {
+	entry, err := s.entry(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	session := &entry.session
+
+	if subtle.ConstantTimeCompare([]byte(securityToken), []byte(session.SecurityToken)) != 1 {
+		s.logger.Warn("Password release refused without a valid security token", "session_id", sessionID, "origin", origin)
+		return "", &HIMError{Code: ErrInvalidToken, Message: "invalid security token", SessionID: sessionID}
+	}
+	if !session.IsActive() {
+		return "", closedError(session)
+	}
+	if !OriginMatches(session.Site, origin) {
+		s.logger.Warn("Password release refused for foreign origin", "session_id", sessionID, "site", session.Site, "origin", origin)
+		return "", &HIMError{Code: ErrOriginMismatch, Message: "origin does not belong to the session's site", SessionID: sessionID}
+	}
+	password, err := entry.takePassword()
+	if err != nil {
+		return "", err
+	}
+	s.logger.Info("Password released to browser", "session_id", sessionID, "origin", origin)
+	return password, nil
+}
+
+// RevealPassword returns the password attached to a session, once, to a
+// client that shows it to the user, such as acm-cli. The caller proves it
+// received the prompt with the session's security token.
+func (s *Service) RevealPassword(ctx context.Context, sessionID, securityToken string) (string, error) {
+	entry, err := s.entry(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	session := &entry.session
+
+	if subtle.ConstantTimeCompare([]byte(securityToken), []byte(session.SecurityToken)) != 1 {
+		return "", &HIMError{Code: ErrInvalidToken, Message: "invalid security token", SessionID: sessionID}
+	}
+	if !session.IsActive() {
+		return "", closedError(session)
+	}
+
+	password, err := entry.takePassword()
+	if err != nil {
+		return "", err
+	}
+	s.logger.Info("Password revealed to user", "session_id", sessionID)
+	return password, nil
+}
+
+// takePassword removes and returns the attached password. The caller holds
+// e.mu and has checked the session is active.
+func (e *sessionEntry) takePassword() (string, error) {
+	if e.password == "" {
+		return "", &HIMError{Code: ErrPasswordReleased, Message: "no password to release", SessionID: e.session.ID}
+	}
+
+	password := e.password
+	e.password = ""
+	e.session.PasswordPending = false
+	e.session.LastUpdated = time.Now()
+	return password, nil
+}
+
+// SessionsForOrigin returns the active sessions for the site origin belongs
+// to, oldest first. Approval sessions are not included.
+func (s *Service) SessionsForOrigin(ctx context.Context, origin string) ([]*Session, error) {
+	active, err := s.ListActiveSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*Session
+	for _, session := range active {
+		if session.Type != HIMApproval && OriginMatches(session.Site, origin) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// OriginMatches reports whether a browser origin such as
+// "https://accounts.example.com" belongs to site. Only https origins match,
+// and they match by registrable domain.
+func OriginMatches(site, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || site == "" {
+		return false
+	}
+	if u.Path != "" && u.Path != "/" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return false
+	}
+	domain := audit.RegistrableDomain(site)
+	return domain != "" && audit.RegistrableDomain(u.Hostname()) == domain
+}
@@ -0,0 +1,138 @@
+package him
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestOriginMatches tests which browser origins belong to a site
+func TestOriginMatches(t *testing.T) {
+	tests := []struct {
+		site   string
+		origin string
+		want   bool
+	}{
+		{"github.com", "https://github.com", true},
+		{"github.com", "https://github.com/", true},
+		{"https://github.com/settings", "https://github.com:443", true},
+		{"example-bank.com", "https://secure.example-bank.com", true},
+		{"github.com", "http://github.com", false},
+		{"github.com", "https://github.com.evil.net", false},
+		{"github.com", "https://notgithub.com", false},
+		{"alice.github.io", "https://mallory.github.io", false},
+		{"github.com", "https://github.com/login", false},
+		{"github.com", "https://user@github.com", false},
+		{"github.com", "github.com", false},
+		{"", "https://github.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.site+" "+tt.origin, func(t *testing.T) {
+			if got := OriginMatches(tt.site, tt.origin); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestReleasePasswordOnce tests that a password is released once, to its own
+// site and only with the session's security token
+func TestReleasePasswordOnce(t *testing.T) {
+	service := NewService(time.Minute)
+	defer service.Close()
+	ctx := context.Background()
+
+	session, _ := service.CreateSession(ctx, SessionRequest{Type: HIMManualRotation, Site: "github.com", Prompt: "Change your password"})
+	if err := service.AttachPassword(ctx, session.ID, "n3w-p4ssw0rd"); err != nil {
+		t.Fatalf("Failed to attach password: %v", err)
+	}
+	if current, _ := service.GetSession(ctx, session.ID); !current.PasswordPending {
+		t.Error("Expected session to report a pending password")
+	}
+
+	var herr *HIMError
+	if _, err := service.ReleasePassword(ctx, session.ID, "https://github.com.evil.net", session.SecurityToken); !errors.As(err, &herr) || herr.Code != ErrOriginMismatch {
+		t.Fatalf("Expected ErrOriginMismatch, got %v", err)
+	}
+	for _, token := range []string{"", "wrong"} {
+		if _, err := service.ReleasePassword(ctx, session.ID, "https://github.com", token); !errors.As(err, &herr) || herr.Code != ErrInvalidToken {
+			t.Fatalf("Expected ErrInvalidToken for token %q, got %v", token, err)
+		}
+	}
+
+	password, err := service.ReleasePassword(ctx, session.ID, "https://github.com", session.SecurityToken)
+	if err != nil || password != "n3w-p4ssw0rd" {
+		t.Fatalf("Expected the password, got %q (%v)", password, err)
+	}
+	if _, err := service.ReleasePassword(ctx, session.ID, "https://github.com", session.SecurityToken); !errors.As(err, &herr) || herr.Code != ErrPasswordReleased {
+		t.Errorf("Expected ErrPasswordReleased on second release, got %v", err)
+	}
+	if current, _ := service.GetSession(ctx, session.ID); current.PasswordPending {
+		t.Error("Expected no pending password after release")
+	}
+}
+
+// TestPasswordDroppedWhenSessionEnds tests that an unreleased password does not outlive its session
+func TestPasswordDroppedWhenSessionEnds(t *testing.T) {
+	service := NewService(time.Minute)
+	defer service.Close()
+	ctx := context.Background()
+
+	session, _ := service.CreateSession(ctx, SessionRequest{Type: HIMManualRotation, Site: "github.com", Prompt: "Change your password"})
+	service.AttachPassword(ctx, session.ID, "n3w-p4ssw0rd")
+	if err := service.CancelSession(ctx, session.ID); err != nil {
+		t.Fatalf("Failed to cancel: %v", err)
+	}
+
+	if _, err := service.ReleasePassword(ctx, session.ID, "https://github.com", session.SecurityToken); err == nil {
+		t.Error("Expected release to fail after the session ended")
+	}
+	if err := service.AttachPassword(ctx, session.ID, "another"); err == nil {
+		t.Error("Expected attach to fail after the session ended")
+	}
+}
+
+// TestSessionsForOrigin tests listing the prompts for a tab's origin
+func TestSessionsForOrigin(t *testing.T) {
+	service := NewService(time.Minute)
+	defer service.Close()
+	ctx := context.Background()
+
+	first, _ := service.CreateSession(ctx, SessionRequest{Type: HIMTOTP, Site: "github.com"})
+	second, _ := service.CreateSession(ctx, SessionRequest{Type: HIMManualRotation, Site: "https://github.com/settings"})
+	service.CreateSession(ctx, SessionRequest{Type: HIMTOTP, Site: "gitlab.com"})
+	service.CreateSession(ctx, SessionRequest{Type: HIMApproval, Site: "github.com", Approval: &ApprovalRequirement{Required: 1}})
+
+	sessions, err := service.SessionsForOrigin(ctx, "https://github.com")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != first.ID || sessions[1].ID != second.ID {
+		t.Errorf("Expected the two github.com prompts in order, got %d sessions", len(sessions))
+	}
+}
+
+// TestRevealPassword tests showing a session's password once to a client holding its token
+func TestRevealPassword(t *testing.T) {
+	service := NewService(time.Minute)
+	defer service.Close()
+	ctx := context.Background()
+
+	session, _ := service.CreateSession(ctx, SessionRequest{Type: HIMManualRotation, Site: "github.com", Prompt: "Change your password"})
+	service.AttachPassword(ctx, session.ID, "n3w-p4ssw0rd")
+
+	var herr *HIMError
+	if _, err := service.RevealPassword(ctx, session.ID, "wrong"); !errors.As(err, &herr) || herr.Code != ErrInvalidToken {
+		t.Fatalf("Expected ErrInvalidToken, got %v", err)
+	}
+
+	password, err := service.RevealPassword(ctx, session.ID, session.SecurityToken)
+	if err != nil || password != "n3w-p4ssw0rd" {
+		t.Fatalf("Expected the password, got %q (%v)", password, err)
+	}
+	if _, err := service.ReleasePassword(ctx, session.ID, "https://github.com", session.SecurityToken); !errors.As(err, &herr) || herr.Code != ErrPasswordReleased {
+		t.Errorf("Expected ErrPasswordReleased after reveal, got %v", err)
+	}
+}
@@ -49,6 +49,14 @@ type RotationAction struct {
 	// Method is the intended rotation method (auto, API, manual).
 	Method string
 
+	// Credential describes the credential as far as HIM policy needs.
+	Credential CredentialMetadata
+
+	// ApprovalSessionID names the approved HIMApproval session for the
+	// action, once there is one. The policy then stops asking for approval
+	// and decides on the rest of the action.
+	ApprovalSessionID string
+
 	// Timestamp is when the action was initiated.
 	Timestamp time.Time
 }
@@ -81,6 +89,10 @@ type HIMPrompt struct {
 	// Message is the human-readable prompt message.
 	Message string
 
+	// ActionURL is a page the user should open, such as the site's
+	// change-password page.
+	ActionURL string
+
 	// InputType describes what kind of input is expected.
 	InputType InputType
 
@@ -110,6 +122,15 @@ const (
 	// InputConfirmation indicates yes/no confirmation is expected.
 	InputConfirmation InputType = "confirmation"
 
+	// InputEmailCode indicates a code sent by email is expected.
+	InputEmailCode InputType = "email_code"
+
+	// InputBackupCode indicates a single-use MFA backup code is expected.
+	InputBackupCode InputType = "backup_code"
+
+	// InputRecoveryCode indicates an account recovery code or key is expected.
+	InputRecoveryCode InputType = "recovery_code"
+
 	// InputText indicates arbitrary text input is expected.
 	InputText InputType = "text"
 )
@@ -128,6 +149,10 @@ type HIMResponse struct {
 	// CancelRequested indicates if the user wants to cancel the operation.
 	CancelRequested bool
 
+	// AutoFilled indicates Input is a TOTP code fetched from the vault after
+	// the user confirmed, rather than typed by the user.
+	AutoFilled bool
+
 	// RespondedAt is when the user responded.
 	RespondedAt time.Time
 }
@@ -209,4 +234,30 @@ const (
 
 	// ErrMaxAttemptsExceeded indicates the user exceeded the maximum number of attempts.
 	ErrMaxAttemptsExceeded HIMErrorCode = "MAX_ATTEMPTS_EXCEEDED"
+
+	// ErrInvalidToken indicates the response's security token did not match.
+	ErrInvalidToken HIMErrorCode = "INVALID_TOKEN"
+
+	// ErrSessionClosed indicates the session has already ended.
+	ErrSessionClosed HIMErrorCode = "SESSION_CLOSED"
+
+	// ErrInvalidTransition indicates a state change the state machine forbids.
+	ErrInvalidTransition HIMErrorCode = "INVALID_TRANSITION"
+
+	// ErrNotAuthorized indicates the caller may not act on the session.
+	ErrNotAuthorized HIMErrorCode = "NOT_AUTHORIZED"
+
+	// ErrDuplicateApproval indicates the approver has already approved.
+	ErrDuplicateApproval HIMErrorCode = "DUPLICATE_APPROVAL"
+
+	// ErrInvalidSignature indicates an approval signature did not verify.
+	ErrInvalidSignature HIMErrorCode = "INVALID_SIGNATURE"
+
+	// ErrOriginMismatch indicates a browser origin does not belong to the
+	// session's site.
+	ErrOriginMismatch HIMErrorCode = "ORIGIN_MISMATCH"
+
+	// ErrPasswordReleased indicates the session's password was already
+	// released, or none was attached.
+	ErrPasswordReleased HIMErrorCode = "PASSWORD_RELEASED"
 )
@@ -0,0 +1,381 @@
+package him
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/logging"
+)
+
+const (
+	// defaultMaildirPollInterval is how often the Maildir is rescanned.
+	defaultMaildirPollInterval = 5 * time.Second
+
+	// maildirLookback accepts mail sent shortly before the prompt opened,
+	// since the site usually sends the code as the prompt is raised.
+	maildirLookback = 2 * time.Minute
+
+	// maxMessageSize bounds how much of a message is read.
+	maxMessageSize = 1 << 20
+
+	// keywordDistance is how far, in bytes, a heuristic code may be from a
+	// word like "code" or "verification".
+	keywordDistance = 120
+)
+
+var (
+	codeKeywordPattern = regexp.MustCompile(`(?i)\b(code|verification|verify|one[- ]time|otp|passcode|security code|pin)\b`)
+	codeCandidate      = regexp.MustCompile(`\b(?:[0-9]{4,8}|[0-9]{3}[- ][0-9]{3}|[A-Z0-9]{6,8})\b`)
+	htmlTagPattern     = regexp.MustCompile(`(?s)<style.*?</style>|<script.*?</script>|<[^>]*>`)
+)
+
+// MaildirConfig configures reading verification codes from local mail.
+type MaildirConfig struct {
+	// Path is the Maildir to watch (the directory holding cur/ and new/).
+	Path string `json:"path"`
+
+	// PollInterval is how often to rescan, as a Go duration. Defaults to 5s.
+	PollInterval string `json:"poll_interval,omitempty"`
+
+	// Templates maps a site to a regular expression that extracts its code.
+	// The first capture group is the code; without one, the whole match is.
+	// Sites without a template use a generic heuristic.
+	Templates map[string]string `json:"templates,omitempty"`
+}
+
+// LoadMaildirConfig reads a Maildir configuration file.
+func LoadMaildirConfig(path string) (MaildirConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return MaildirConfig{}, fmt.Errorf("failed to read Maildir config: %w", err)
+	}
+
+	var config MaildirConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return MaildirConfig{}, fmt.Errorf("failed to parse Maildir config: %w", err)
+	}
+	return config, nil
+}
+
+// MaildirWatcher finds verification codes in a local Maildir (as synced by
+// mbsync or offlineimap) and offers them as suggestions on EMAIL_CODE
+// sessions. It only reads mail; nothing is moved, flagged or deleted.
+type MaildirWatcher struct {
+	dir       string
+	interval  time.Duration
+	templates map[string]*regexp.Regexp // registrable domain -> pattern
+	logger    *logging.Logger
+}
+
+// NewMaildirWatcher creates a watcher from config.
+func NewMaildirWatcher(config MaildirConfig) (*MaildirWatcher, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("Maildir path is required")
+	}
+	if info, err := os.Stat(filepath.Join(config.Path, "cur")); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a Maildir", config.Path)
+	}
+
+	interval := defaultMaildirPollInterval
+	if config.PollInterval != "" {
+		d, err := time.ParseDuration(config.PollInterval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid poll_interval %q", config.PollInterval)
+		}
+		interval = d
+	}
+
+	templates := make(map[string]*regexp.Regexp, len(config.Templates))
+	for site, pattern := range config.Templates {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for %s: %w", site, err)
+		}
+		templates[audit.RegistrableDomain(site)] = re
+	}
+
+	return &MaildirWatcher{
+		dir:       config.Path,
+		interval:  interval,
+		templates: templates,
+		logger:    logging.NewLogger("him-maildir"),
+	}, nil
+}
+
+// Attach watches the Maildir for every EMAIL_CODE session service creates,
+// until the session ends or ctx is done, and suggests the first code found.
+func (w *MaildirWatcher) Attach(ctx context.Context, service *Service) {
+	service.OnSessionCreated(func(session Session) {
+		if session.Type == HIMEmail {
+			w.watch(ctx, service, session)
+		}
+	})
+}
+
+// watch polls for a code for session and suggests it. Messages already
+// scanned without finding a code are not read again on later polls.
+func (w *MaildirWatcher) watch(ctx context.Context, service *Service, session Session) {
+	since := session.CreatedAt.Add(-maildirLookback)
+	scanned := make(map[string]bool)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		current, err := service.GetSession(ctx, session.ID)
+		if err != nil || !current.IsActive() {
+			return
+		}
+
+		code, found, err := w.findCode(session.Site, since, scanned)
+		if err != nil {
+			w.logger.Warn("Failed to scan Maildir", "dir", w.dir, "error", err)
+		} else if found {
+			if err := service.Suggest(ctx, session.ID, code); err != nil {
+				w.logger.Warn("Code found in mail was not accepted", "session_id", session.ID, "error", err)
+			} else {
+				w.logger.Info("Offered code from mail", "session_id", session.ID, "site", session.Site)
+			}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// FindCode returns the code in the newest message from site received at or
+// after since. found is false if no such message has a recognizable code.
+// Files last modified before since are not read.
+func (w *MaildirWatcher) FindCode(site string, since time.Time) (code string, found bool, err error) {
+	return w.findCode(site, since, nil)
+}
+
+// findCode implements FindCode. Files named in scanned are skipped, and
+// files that hold no code for site are added to it, if not nil. Maildir
+// messages are never rewritten in place (a flag change renames the file),
+// so a file without a code never gains one.
+func (w *MaildirWatcher) findCode(site string, since time.Time, scanned map[string]bool) (code string, found bool, err error) {
+	domain := audit.RegistrableDomain(site)
+	var newest time.Time
+
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(w.dir, sub))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", false, fmt.Errorf("failed to read Maildir: %w", err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			path := filepath.Join(w.dir, sub, entry.Name())
+			if scanned[path] {
+				continue
+			}
+			if c, received, ok := w.scanFile(path, entry, domain, since); ok {
+				if received.After(newest) {
+					code, found, newest = c, true, received
+				}
+			} else if scanned != nil {
+				scanned[path] = true
+			}
+		}
+	}
+
+	return code, found, nil
+}
+
+// scanFile returns the code in the message at path if it was sent from
+// domain at or after since.
+func (w *MaildirWatcher) scanFile(path string, entry os.DirEntry, domain string, since time.Time) (string, time.Time, bool) {
+	// Mail is delivered after it is sent, so an older file can't be newer mail
+	info, err := entry.Info()
+	if err != nil || info.ModTime().Before(since) {
+		return "", time.Time{}, false
+	}
+
+	msg, err := readMessage(path)
+	if err != nil {
+		return "", time.Time{}, false // Skip messages we can't parse
+	}
+	if msg.received.Before(since) || !sentFrom(msg.from, domain) {
+		return "", time.Time{}, false
+	}
+	code, ok := w.extractCode(domain, msg.subject+"\n"+msg.body)
+	return code, msg.received, ok
+}
+
+// extractCode applies the site's template, or the generic heuristic.
+func (w *MaildirWatcher) extractCode(domain, text string) (string, bool) {
+	if re, ok := w.templates[domain]; ok {
+		m := re.FindStringSubmatch(text)
+		switch {
+		case m == nil:
+			return "", false
+		case len(m) > 1:
+			return m[1], m[1] != ""
+		default:
+			return m[0], true
+		}
+	}
+	return heuristicCode(text)
+}
+
+// heuristicCode picks the code-like token closest to a word such as "code"
+// or "verification". Codes of only letters are ignored, as are tokens too
+// far from any keyword.
+func heuristicCode(text string) (string, bool) {
+	keywords := codeKeywordPattern.FindAllStringIndex(text, -1)
+	if len(keywords) == 0 {
+		return "", false
+	}
+
+	best, bestDistance := "", keywordDistance+1
+	for _, loc := range codeCandidate.FindAllStringIndex(text, -1) {
+		token := text[loc[0]:loc[1]]
+		if !strings.ContainsAny(token, "0123456789") {
+			continue
+		}
+		for _, kw := range keywords {
+			distance := loc[0] - kw[1]
+			if distance < 0 {
+				distance = kw[0] - loc[1]
+			}
+			if distance < 0 {
+				distance = 0
+			}
+			if distance < bestDistance {
+				best, bestDistance = token, distance
+			}
+		}
+	}
+	return best, best != ""
+}
+
+// sentFrom reports whether address belongs to the site's domain.
+func sentFrom(address, domain string) bool {
+	at := strings.LastIndex(address, "@")
+	if at < 0 || domain == "" {
+		return false
+	}
+	return audit.RegistrableDomain(address[at+1:]) == domain
+}
+
+// maildirMessage is the part of a message the watcher looks at.
+type maildirMessage struct {
+	from     string
+	subject  string
+	body     string
+	received time.Time
+}
+
+// readMessage parses a Maildir message file. The Date header is used as
+// the receive time, falling back to the file's modification time.
+func readMessage(path string) (*maildirMessage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	msg, err := mail.ReadMessage(io.LimitReader(f, maxMessageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &maildirMessage{}
+	if from, err := mail.ParseAddress(msg.Header.Get("From")); err == nil {
+		result.from = from.Address
+	}
+	decoder := new(mime.WordDecoder)
+	if subject, err := decoder.DecodeHeader(msg.Header.Get("Subject")); err == nil {
+		result.subject = subject
+	}
+	if date, err := msg.Header.Date(); err == nil {
+		result.received = date
+	} else if info, err := f.Stat(); err == nil {
+		result.received = info.ModTime()
+	}
+
+	body, err := messageText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	result.body = body
+	return result, nil
+}
+
+// messageText returns the readable text of a message body, preferring
+// text/plain parts and stripping tags from text/html ones.
+func messageText(contentType, encoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		var plain, htmlText string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := messageText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				continue
+			}
+			partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			switch {
+			case partType == "text/html" && htmlText == "":
+				htmlText = text
+			case (partType == "text/plain" || strings.HasPrefix(partType, "multipart/")) && plain == "":
+				plain = text
+			}
+		}
+		if plain != "" {
+			return plain, nil
+		}
+		return htmlText, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	text := string(data)
+	if mediaType == "text/html" {
+		text = html.UnescapeString(htmlTagPattern.ReplaceAllString(text, " "))
+	}
+	return text, nil
+}
@@ -0,0 +1,169 @@
+package him
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMaildirFindCode tests code extraction from the fixture Maildir
+func TestMaildirFindCode(t *testing.T) {
+	watcher, err := NewMaildirWatcher(MaildirConfig{
+		Path:      "testdata/maildir",
+		Templates: map[string]string{"custom.io": `Your token: ([A-Z]{3}-[0-9]{3})`},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+
+	since := time.Date(2026, 10, 12, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		site  string
+		since time.Time
+		want  string
+		found bool
+	}{
+		{"newest message with a code wins", "github.com", since, "482913", true},
+		{"older messages are ignored", "https://github.com/login", time.Date(2026, 10, 12, 10, 30, 0, 0, time.UTC), "", false},
+		{"subdomain sender and html part", "example-bank.com", since, "739 105", true},
+		{"site template", "custom.io", since, "ABC-123", true},
+		{"lookalike sender only matches its own domain", "account-check.net", since, "999999", true},
+		{"unknown site", "gitlab.com", since, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, found, err := watcher.FindCode(tt.site, tt.since)
+			if err != nil {
+				t.Fatalf("Failed to find code: %v", err)
+			}
+			if found != tt.found || code != tt.want {
+				t.Errorf("Expected %q (found=%v), got %q (found=%v)", tt.want, tt.found, code, found)
+			}
+		})
+	}
+}
+
+// TestMaildirSkipsOldAndScannedFiles tests that files modified before the
+// cutoff and files already scanned are not read
+func TestMaildirSkipsOldAndScannedFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0700); err != nil {
+			t.Fatalf("Failed to create Maildir: %v", err)
+		}
+	}
+	watcher, err := NewMaildirWatcher(MaildirConfig{Path: dir})
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+
+	since := time.Now().Add(-time.Minute)
+	write := func(name, body string) string {
+		path := filepath.Join(dir, "new", name)
+		message := fmt.Sprintf("From: noreply@github.com\r\nSubject: Sign-in\r\nDate: %s\r\n\r\n%s\r\n",
+			time.Now().Format(time.RFC1123Z), body)
+		if err := os.WriteFile(path, []byte(message), 0600); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+		return path
+	}
+
+	// A file last modified before the cutoff is skipped, whatever its Date says
+	old := write("1.M1.test", "Verification code: 111111")
+	if err := os.Chtimes(old, since.Add(-time.Hour), since.Add(-time.Hour)); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	if _, found, _ := watcher.FindCode("github.com", since); found {
+		t.Error("Expected a file modified before the cutoff to be skipped")
+	}
+
+	// A file scanned without a code is not read again
+	scanned := make(map[string]bool)
+	path := write("2.M2.test", "Welcome back")
+	if _, found, _ := watcher.findCode("github.com", since, scanned); found || !scanned[path] {
+		t.Fatalf("Expected the message to be scanned without a code, scanned=%v", scanned)
+	}
+	write("2.M2.test", "Verification code: 222222")
+	if _, found, _ := watcher.findCode("github.com", since, scanned); found {
+		t.Error("Expected a scanned file not to be read again")
+	}
+	if code, found, _ := watcher.FindCode("github.com", since); !found || code != "222222" {
+		t.Errorf("Expected a fresh scan to find 222222, got %q", code)
+	}
+}
+
+// TestHeuristicCode tests the generic code heuristic
+func TestHeuristicCode(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"digits after keyword", "Your verification code is 123456.", "123456"},
+		{"code before keyword", "847261 is your Acme code", "847261"},
+		{"closest candidate", "Order 99887766 placed.\n\n" + fmt.Sprintf("%80s", "") + "Your code: 4321", "4321"},
+		{"alphanumeric", "Enter security code X7K9Q2 to continue", "X7K9Q2"},
+		{"letters only", "Enter code ABCDEF to continue", ""},
+		{"no keyword", "Invoice 123456 attached", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := heuristicCode(tt.text); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestMaildirWatcherSuggests tests that a code arriving after the prompt is offered
+func TestMaildirWatcherSuggests(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0700); err != nil {
+			t.Fatalf("Failed to create Maildir: %v", err)
+		}
+	}
+
+	watcher, err := NewMaildirWatcher(MaildirConfig{Path: dir, PollInterval: "10ms"})
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+
+	service := NewService(time.Minute)
+	defer service.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	suggested := make(chan Session, 1)
+	service.OnSuggestion(func(session Session) { suggested <- session })
+	watcher.Attach(ctx, service)
+
+	session, _ := service.CreateSession(ctx, SessionRequest{Type: HIMEmail, Site: "github.com"})
+
+	message := fmt.Sprintf("From: noreply@github.com\r\nSubject: Your code\r\nDate: %s\r\n\r\nVerification code: 531-682\r\n",
+		time.Now().Format(time.RFC1123Z))
+	if err := os.WriteFile(filepath.Join(dir, "new", "1.M1.test"), []byte(message), 0600); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+
+	select {
+	case got := <-suggested:
+		if got.ID != session.ID || got.Suggestion != "531682" {
+			t.Errorf("Unexpected suggestion: %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No suggestion was offered")
+	}
+
+	// The suggestion is only offered; the session still waits for the user
+	current, _ := service.GetSession(ctx, session.ID)
+	if !current.IsActive() || current.AttemptCount != 0 {
+		t.Errorf("Expected session to stay active, got %+v", current)
+	}
+}
@@ -0,0 +1,399 @@
+package him
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/logging"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/pwmanager"
+)
+
+// Continuation resumes a paused rotation with the user's response. When the
+// session was cancelled or expired, the response has CancelRequested set.
+type Continuation func(ctx context.Context, response *HIMResponse) error
+
+// Manager implements HIMManager on top of Service. Decisions come from a
+// Policy combined with an optional ComplianceChecker, and paused rotations
+// are resumed through the Continuation registered for their session.
+type Manager struct {
+	service    *Service
+	policy     Policy
+	compliance ComplianceChecker
+	logger     *logging.Logger
+
+	mu            sync.Mutex
+	actions       map[string]RotationAction // sessionID -> action
+	continuations map[string]Continuation   // sessionID -> continuation
+	autoFill      map[string]bool           // sessionID -> asks to fill TOTP from the vault
+	totp          pwmanager.TOTPGenerator
+	auditLogger   audit.Logger
+}
+
+var _ HIMManager = (*Manager)(nil)
+
+// NewManager creates a HIM manager. compliance may be nil, in which case
+// decisions are made from the policy and action alone.
+func NewManager(service *Service, policy Policy, compliance ComplianceChecker) *Manager {
+	return &Manager{
+		service:       service,
+		policy:        policy,
+		compliance:    compliance,
+		logger:        logging.NewLogger("him"),
+		actions:       make(map[string]RotationAction),
+		continuations: make(map[string]Continuation),
+		autoFill:      make(map[string]bool),
+	}
+}
+
+// RequiresHIM decides whether action needs a human and which kind, from the
+// user's overrides, the ACVS verdict, the action and the credential metadata.
+func (m *Manager) RequiresHIM(ctx context.Context, action RotationAction) (bool, HIMType, error) {
+	var verdict *ComplianceVerdict
+	if m.compliance != nil {
+		v, err := m.compliance.CheckCompliance(ctx, action)
+		if err != nil {
+			return false, "", fmt.Errorf("compliance check failed for %s: %w", action.Site, err)
+		}
+		verdict = v
+	}
+	return m.policy.Decide(action, verdict)
+}
+
+// PromptUser shows prompt to the user and blocks until they respond, the
+// session expires or ctx is done. If prompt.SessionID names a session
+// created by Pause, that session is awaited instead of creating a new one.
+//
+// A prompt made through PromptUser carries no credential, so it is never
+// auto-filled; use PromptAction for that.
+func (m *Manager) PromptUser(ctx context.Context, prompt HIMPrompt) (*HIMResponse, error) {
+	return m.PromptAction(ctx, RotationAction{Site: prompt.Site}, prompt)
+}
+
+// PromptAction is PromptUser for a prompt raised while performing action.
+// When the policy lets the vault answer a TOTP prompt for action's
+// credential, the user is only asked to confirm, and the response carries
+// the vault's code with AutoFilled set; if the user declined or the vault
+// had no code, the user is asked for the code instead.
+func (m *Manager) PromptAction(ctx context.Context, action RotationAction, prompt HIMPrompt) (*HIMResponse, error) {
+	sessionID := prompt.SessionID
+	if _, err := m.service.GetSession(ctx, sessionID); sessionID == "" || err != nil {
+		session, err := m.createSession(ctx, action, prompt, true)
+		if err != nil {
+			return nil, err
+		}
+		sessionID = session.ID
+	}
+
+	response, err := m.service.WaitForResponse(ctx, sessionID)
+	session, getErr := m.service.GetSession(ctx, sessionID)
+	if getErr != nil {
+		return nil, &HIMError{Code: ErrSessionNotFound, Message: "session disappeared", Cause: getErr, SessionID: sessionID}
+	}
+	switch {
+	case session.State == StateCancelled:
+		return nil, &HIMError{Code: ErrCancelled, Message: "session cancelled", SessionID: sessionID}
+	case session.State == StateTimeout:
+		return nil, &HIMError{Code: ErrTimeout, Message: "no response before the session expired", Cause: err, SessionID: sessionID}
+	case err != nil:
+		return nil, &HIMError{Code: ErrCancelled, Message: "stopped waiting for response", Cause: err, SessionID: sessionID}
+	}
+
+	result := toHIMResponse(sessionID, response)
+	if m.takeAutoFill(sessionID) {
+		if filled, ok := m.fillFromVault(ctx, sessionID, result); ok {
+			return filled, nil
+		}
+		next, err := m.fallbackToManualTOTP(ctx, session)
+		if err != nil {
+			return nil, err
+		}
+		return m.PromptUser(ctx, HIMPrompt{SessionID: next.ID})
+	}
+	return result, nil
+}
+
+// Pause creates a session for action without blocking. When the session
+// ends, cont is called through ResumeAutomation with the user's response.
+// It returns the session ID.
+func (m *Manager) Pause(ctx context.Context, action RotationAction, prompt HIMPrompt, cont Continuation) (string, error) {
+	if cont == nil {
+		return "", fmt.Errorf("continuation is required")
+	}
+
+	session, err := m.createSession(ctx, action, prompt, true)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	m.continuations[session.ID] = cont
+	m.mu.Unlock()
+
+	go m.await(context.WithoutCancel(ctx), session.ID)
+
+	return session.ID, nil
+}
+
+// RegisterContinuation registers cont to resume the rotation paused on an
+// existing session, such as one restored after a restart. As with Pause,
+// cont is called when the session ends. Only one continuation may be
+// registered per session.
+func (m *Manager) RegisterContinuation(sessionID string, cont Continuation) error {
+	session, err := m.service.GetSession(context.Background(), sessionID)
+	if err != nil {
+		return &HIMError{Code: ErrSessionNotFound, Message: "cannot register continuation", Cause: err, SessionID: sessionID}
+	}
+	if !session.IsActive() {
+		return &HIMError{Code: ErrSessionExpired, Message: fmt.Sprintf("session is %s", session.State), SessionID: sessionID}
+	}
+
+	m.mu.Lock()
+	if _, exists := m.continuations[sessionID]; exists {
+		m.mu.Unlock()
+		return fmt.Errorf("continuation already registered for session %s", sessionID)
+	}
+	m.continuations[sessionID] = cont
+	m.mu.Unlock()
+
+	go m.await(context.Background(), sessionID)
+	return nil
+}
+
+// ResumeAutomation hands response to the continuation registered for the
+// session. Each continuation runs at most once.
+func (m *Manager) ResumeAutomation(ctx context.Context, sessionID string, response *HIMResponse) error {
+	m.mu.Lock()
+	cont, ok := m.continuations[sessionID]
+	delete(m.continuations, sessionID)
+	delete(m.actions, sessionID)
+	m.mu.Unlock()
+
+	if !ok {
+		return &HIMError{Code: ErrSessionNotFound, Message: "no paused rotation for session", SessionID: sessionID}
+	}
+	if response == nil {
+		response = &HIMResponse{SessionID: sessionID, CancelRequested: true, RespondedAt: time.Now()}
+	}
+	return cont(ctx, response)
+}
+
+// GetSessionState returns the state of a session.
+func (m *Manager) GetSessionState(ctx context.Context, sessionID string) (*HIMSessionState, error) {
+	session, err := m.service.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, &HIMError{Code: ErrSessionNotFound, Message: "session not found", Cause: err, SessionID: sessionID}
+	}
+	return m.sessionState(session), nil
+}
+
+// CancelSession cancels an active session. A rotation paused on it is
+// resumed with CancelRequested set. Cancelling twice is not an error.
+func (m *Manager) CancelSession(ctx context.Context, sessionID string) error {
+	return m.service.CancelSession(ctx, sessionID)
+}
+
+// AttachPassword attaches a newly generated password to a session so it
+// can be shown to the user, or filled in by the browser extension, once.
+func (m *Manager) AttachPassword(ctx context.Context, sessionID, password string) error {
+	return m.service.AttachPassword(ctx, sessionID, password)
+}
+
+// ListActiveSessions returns the state of every active session.
+func (m *Manager) ListActiveSessions(ctx context.Context) ([]*HIMSessionState, error) {
+	sessions, err := m.service.ListActiveSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]*HIMSessionState, 0, len(sessions))
+	for _, session := range sessions {
+		states = append(states, m.sessionState(session))
+	}
+	return states, nil
+}
+
+// createSession creates a service session for prompt and records action.
+// With allowAutoFill, a TOTP prompt the policy lets the vault answer is
+// turned into a confirmation.
+func (m *Manager) createSession(ctx context.Context, action RotationAction, prompt HIMPrompt, allowAutoFill bool) (*Session, error) {
+	himType := prompt.Type
+	if himType == "" {
+		himType = HIMManualRotation
+	}
+	site := action.Site
+	if site == "" {
+		site = prompt.Site
+	}
+	autoFill := allowAutoFill && m.autoFillApplies(himType, action)
+	if autoFill {
+		prompt = autoFillPrompt(prompt, site)
+	}
+	inputType := prompt.InputType
+	if inputType == "" {
+		inputType = inputTypeFor(himType)
+	}
+
+	req := SessionRequest{
+		Type:          himType,
+		CredentialID:  action.CredentialID,
+		Site:          site,
+		Prompt:        prompt.Message,
+		ActionURL:     prompt.ActionURL,
+		InputType:     inputType,
+		ExpectedInput: expectedInputFor(inputType),
+		Timeout:       prompt.Timeout,
+	}
+	if himType == HIMApproval {
+		if err := m.approvalRequest(&req); err != nil {
+			return nil, err
+		}
+	}
+
+	session, err := m.service.CreateSession(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HIM session: %w", err)
+	}
+
+	m.mu.Lock()
+	m.actions[session.ID] = action
+	if autoFill {
+		m.autoFill[session.ID] = true
+	}
+	m.mu.Unlock()
+
+	return session, nil
+}
+
+// approvalRequest fills in the approval requirement from the policy.
+func (m *Manager) approvalRequest(req *SessionRequest) error {
+	if m.policy.Approval == nil {
+		return fmt.Errorf("approval required for %s but no approval policy is configured", req.Site)
+	}
+	requirement, timeout, err := m.policy.Approval.requirement()
+	if err != nil {
+		return err
+	}
+	req.Approval = &requirement
+	if req.Timeout == 0 {
+		req.Timeout = timeout
+	}
+	if req.Prompt == "" {
+		req.Prompt = fmt.Sprintf("Approve rotating the shared credential for %s (%d approvals required)", req.Site, requirement.Required)
+	}
+	return nil
+}
+
+// fallbackToManualTOTP replaces a declined or failed auto-fill session with
+// a prompt for the code, carrying over its action.
+func (m *Manager) fallbackToManualTOTP(ctx context.Context, session *Session) (*Session, error) {
+	m.mu.Lock()
+	action, ok := m.actions[session.ID]
+	delete(m.actions, session.ID)
+	m.mu.Unlock()
+	if !ok {
+		action = RotationAction{CredentialID: session.CredentialID, Site: session.Site}
+	}
+
+	return m.createSession(ctx, action, manualTOTPPrompt(session.Site, session.ExpiresAt.Sub(session.CreatedAt)), false)
+}
+
+// await waits for a paused session to end and resumes its rotation.
+func (m *Manager) await(ctx context.Context, sessionID string) {
+	response, err := m.service.WaitForResponse(ctx, sessionID)
+
+	result := toHIMResponse(sessionID, response)
+	session, getErr := m.service.GetSession(ctx, sessionID)
+	if err != nil || getErr != nil || session.State == StateCancelled || session.State == StateTimeout {
+		m.takeAutoFill(sessionID)
+		result = &HIMResponse{SessionID: sessionID, CancelRequested: true, RespondedAt: time.Now()}
+	} else if m.takeAutoFill(sessionID) {
+		filled, ok := m.fillFromVault(ctx, sessionID, result)
+		if !ok {
+			m.awaitManualTOTP(ctx, session)
+			return
+		}
+		result = filled
+	}
+
+	if err := m.ResumeAutomation(ctx, sessionID, result); err != nil {
+		m.logger.Error("Paused rotation failed to resume", "session_id", sessionID, "error", err)
+	}
+}
+
+// awaitManualTOTP moves the rotation paused on an auto-fill session to a
+// prompt for the code.
+func (m *Manager) awaitManualTOTP(ctx context.Context, session *Session) {
+	next, err := m.fallbackToManualTOTP(ctx, session)
+
+	m.mu.Lock()
+	cont, ok := m.continuations[session.ID]
+	delete(m.continuations, session.ID)
+	if ok && err == nil {
+		m.continuations[next.ID] = cont
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	if err != nil {
+		m.logger.Error("Failed to ask for TOTP code", "session_id", session.ID, "error", err)
+		cont(ctx, &HIMResponse{SessionID: session.ID, CancelRequested: true, RespondedAt: time.Now()})
+		return
+	}
+	m.await(ctx, next.ID)
+}
+
+// sessionState converts a service session to HIMSessionState.
+func (m *Manager) sessionState(session *Session) *HIMSessionState {
+	m.mu.Lock()
+	action, ok := m.actions[session.ID]
+	m.mu.Unlock()
+	if !ok {
+		action = RotationAction{CredentialID: session.CredentialID, Site: session.Site}
+	}
+
+	state := &HIMSessionState{
+		SessionID:      session.ID,
+		State:          session.State,
+		RotationAction: action,
+		CreatedAt:      session.CreatedAt,
+		UpdatedAt:      session.LastUpdated,
+		ExpiresAt:      session.ExpiresAt,
+		AttemptCount:   session.AttemptCount,
+		MaxAttempts:    session.MaxAttempts,
+	}
+	if state.UpdatedAt.IsZero() {
+		state.UpdatedAt = session.CreatedAt
+	}
+	if session.IsActive() {
+		state.Prompt = &HIMPrompt{
+			SessionID: session.ID,
+			Type:      session.Type,
+			Site:      session.Site,
+			Message:   session.Prompt,
+			ActionURL: session.ActionURL,
+			InputType: session.InputType,
+			Timeout:   session.ExpiresAt.Sub(session.CreatedAt),
+			CreatedAt: session.CreatedAt,
+		}
+	}
+	return state
+}
+
+// toHIMResponse converts a service response to HIMResponse.
+func toHIMResponse(sessionID string, response Response) *HIMResponse {
+	respondedAt := response.Timestamp
+	if respondedAt.IsZero() {
+		respondedAt = time.Now()
+	}
+	return &HIMResponse{
+		SessionID:   sessionID,
+		Input:       response.Data.TextInput,
+		Confirmed:   response.Data.BooleanInput,
+		RespondedAt: respondedAt,
+	}
+}
@@ -0,0 +1,214 @@
+package him
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	acmv1 "github.com/ferg-cod3s/automated-compromise-mitigation/api/proto/acm/v1"
+)
+
+// TestPolicyDecide tests how overrides, ACVS verdicts and metadata combine
+func TestPolicyDecide(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Overrides = []Override{
+		{Site: "example.com", Automate: true},
+		{Site: "github.com", ActionType: ActionAccountRecovery, Type: HIMSecurityKey},
+	}
+	policy.Approval = &ApprovalPolicy{Required: 2}
+
+	blocked := &ComplianceVerdict{Result: acmv1.ValidationResult_VALIDATION_RESULT_BLOCKED}
+	manual := &ComplianceVerdict{
+		Result:            acmv1.ValidationResult_VALIDATION_RESULT_HIM_REQUIRED,
+		RecommendedMethod: acmv1.AutomationMethod_AUTOMATION_METHOD_MANUAL,
+	}
+	himRequired := &ComplianceVerdict{Result: acmv1.ValidationResult_VALIDATION_RESULT_HIM_REQUIRED}
+	allowed := &ComplianceVerdict{Result: acmv1.ValidationResult_VALIDATION_RESULT_ALLOWED}
+
+	tests := []struct {
+		name     string
+		action   RotationAction
+		verdict  *ComplianceVerdict
+		required bool
+		himType  HIMType
+	}{
+		{"override automates subdomain", RotationAction{Site: "https://login.example.com", Credential: CredentialMetadata{HasTOTP: true}}, blocked, false, ""},
+		{"override by action type", RotationAction{Site: "github.com", ActionType: ActionAccountRecovery}, nil, true, HIMSecurityKey},
+		{"override skipped for other action", RotationAction{Site: "github.com", ActionType: ActionPasswordChange}, allowed, false, ""},
+		{"acvs blocked", RotationAction{Site: "bank.com"}, blocked, true, HIMToSReview},
+		{"acvs manual method", RotationAction{Site: "shop.com", Credential: CredentialMetadata{HasTOTP: true}}, manual, true, HIMManualRotation},
+		{"manual category", RotationAction{Site: "bank.com", Credential: CredentialMetadata{Category: CategoryFinancial, HasTOTP: true}}, allowed, true, HIMManualRotation},
+		{"manual method", RotationAction{Site: "shop.com", Method: "manual"}, nil, true, HIMManualRotation},
+		{"totp present", RotationAction{Site: "gitlab.com", ActionType: ActionPasswordChange, Credential: CredentialMetadata{HasTOTP: true}}, allowed, true, HIMTOTP},
+		{"email change without totp", RotationAction{Site: "shop.com", ActionType: ActionEmailChange}, nil, true, HIMEmail},
+		{"acvs requires human", RotationAction{Site: "shop.com", ActionType: ActionPasswordChange}, himRequired, true, HIMManualRotation},
+		{"fully automatable", RotationAction{Site: "gitlab.com", ActionType: ActionPasswordChange, Credential: CredentialMetadata{Category: CategoryDeveloper}}, allowed, false, ""},
+		{"shared credential needs approval", RotationAction{Site: "bank.com", Credential: CredentialMetadata{Shared: true, Category: CategoryFinancial}}, allowed, true, HIMApproval},
+		{"approval before acvs", RotationAction{Site: "bank.com", Credential: CredentialMetadata{Shared: true}}, blocked, true, HIMApproval},
+		{"approval before override", RotationAction{Site: "example.com", Credential: CredentialMetadata{Shared: true}}, nil, true, HIMApproval},
+		{"acvs blocked after approval", RotationAction{Site: "bank.com", Credential: CredentialMetadata{Shared: true}, ApprovalSessionID: "him-1"}, blocked, true, HIMToSReview},
+		{"override after approval", RotationAction{Site: "example.com", Credential: CredentialMetadata{Shared: true}, ApprovalSessionID: "him-1"}, nil, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			required, himType, err := policy.Decide(tt.action, tt.verdict)
+			if err != nil {
+				t.Fatalf("Failed to decide: %v", err)
+			}
+			if required != tt.required || himType != tt.himType {
+				t.Errorf("Expected (%v, %q), got (%v, %q)", tt.required, tt.himType, required, himType)
+			}
+		})
+	}
+
+	rateLimited := &ComplianceVerdict{Result: acmv1.ValidationResult_VALIDATION_RESULT_RATE_LIMITED}
+	if _, _, err := policy.Decide(RotationAction{Site: "shop.com"}, rateLimited); err == nil {
+		t.Error("Expected error for rate limited action")
+	}
+}
+
+// TestLoadPolicy tests reading overrides while keeping defaults
+func TestLoadPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "him_policy.json")
+	config := `{"overrides": [{"site": "bank.com", "automate": true}]}`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("Failed to load policy: %v", err)
+	}
+	if len(policy.Overrides) != 1 || len(policy.ManualCategories) != len(DefaultPolicy().ManualCategories) {
+		t.Errorf("Unexpected policy: %+v", policy)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"overrides": [{"site": "bank.com"}]}`), 0600); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+	if _, err := LoadPolicy(path); err == nil {
+		t.Error("Expected error for override without decision")
+	}
+
+	for _, approval := range []string{
+		`{"required": 0}`,
+		`{"required": 3, "approvers": ["alice", "bob"]}`,
+		`{"required": 1, "timeout": "1h", "escalate_after": "2h"}`,
+	} {
+		if err := os.WriteFile(path, []byte(`{"approval": `+approval+`}`), 0600); err != nil {
+			t.Fatalf("Failed to write policy: %v", err)
+		}
+		if _, err := LoadPolicy(path); err == nil {
+			t.Errorf("Expected error for approval policy %s", approval)
+		}
+	}
+}
+
+// TestManagerRequiresHIMUsesCompliance tests that the ACVS verdict is consulted
+func TestManagerRequiresHIMUsesCompliance(t *testing.T) {
+	var checked RotationAction
+	compliance := ComplianceFunc(func(ctx context.Context, action RotationAction) (*ComplianceVerdict, error) {
+		checked = action
+		return &ComplianceVerdict{Result: acmv1.ValidationResult_VALIDATION_RESULT_BLOCKED}, nil
+	})
+	m := NewManager(NewService(time.Minute), DefaultPolicy(), compliance)
+
+	required, himType, err := m.RequiresHIM(context.Background(), RotationAction{Site: "github.com"})
+	if err != nil {
+		t.Fatalf("Failed to decide: %v", err)
+	}
+	if !required || himType != HIMToSReview || checked.Site != "github.com" {
+		t.Errorf("Unexpected decision (%v, %q) for %+v", required, himType, checked)
+	}
+
+	failing := ComplianceFunc(func(ctx context.Context, action RotationAction) (*ComplianceVerdict, error) {
+		return nil, errors.New("acvs unavailable")
+	})
+	m = NewManager(NewService(time.Minute), DefaultPolicy(), failing)
+	if _, _, err := m.RequiresHIM(context.Background(), RotationAction{Site: "github.com"}); err == nil {
+		t.Error("Expected compliance error to be returned")
+	}
+}
+
+// TestManagerPauseAndResume tests that a response resumes the registered continuation
+func TestManagerPauseAndResume(t *testing.T) {
+	service := NewService(time.Minute)
+	m := NewManager(service, DefaultPolicy(), nil)
+
+	resumed := make(chan *HIMResponse, 1)
+	action := RotationAction{CredentialID: "cred-1", Site: "github.com", ActionType: ActionPasswordChange}
+	sessionID, err := m.Pause(context.Background(), action, HIMPrompt{Type: HIMTOTP, Message: "Enter code"}, func(ctx context.Context, response *HIMResponse) error {
+		resumed <- response
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to pause: %v", err)
+	}
+
+	state, err := m.GetSessionState(context.Background(), sessionID)
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if state.RotationAction.CredentialID != "cred-1" || state.Prompt == nil || state.Prompt.InputType != InputTOTP {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+
+	session, _ := service.GetSession(context.Background(), sessionID)
+	err = service.SubmitResponse(context.Background(), sessionID, Response{
+		SecurityToken: session.SecurityToken,
+		Data:          ResponseData{TextInput: "123456"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to submit response: %v", err)
+	}
+
+	select {
+	case response := <-resumed:
+		if response.Input != "123456" || response.CancelRequested {
+			t.Errorf("Unexpected response: %+v", response)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Continuation was not called")
+	}
+
+	// The continuation runs once
+	var herr *HIMError
+	if err := m.ResumeAutomation(context.Background(), sessionID, &HIMResponse{}); !errors.As(err, &herr) || herr.Code != ErrSessionNotFound {
+		t.Errorf("Expected ErrSessionNotFound on second resume, got %v", err)
+	}
+}
+
+// TestManagerCancelResumesWithCancel tests that cancelling a paused session resumes it as cancelled
+func TestManagerCancelResumesWithCancel(t *testing.T) {
+	m := NewManager(NewService(time.Minute), DefaultPolicy(), nil)
+
+	resumed := make(chan *HIMResponse, 1)
+	sessionID, err := m.Pause(context.Background(), RotationAction{Site: "bank.com"}, HIMPrompt{Type: HIMManualRotation, Message: "Change it"}, func(ctx context.Context, response *HIMResponse) error {
+		resumed <- response
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to pause: %v", err)
+	}
+
+	if err := m.CancelSession(context.Background(), sessionID); err != nil {
+		t.Fatalf("Failed to cancel: %v", err)
+	}
+
+	select {
+	case response := <-resumed:
+		if !response.CancelRequested {
+			t.Errorf("Expected cancelled response, got %+v", response)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Continuation was not called")
+	}
+
+	if err := m.CancelSession(context.Background(), sessionID); err != nil {
+		t.Errorf("Expected repeated cancel to succeed, got %v", err)
+	}
+}
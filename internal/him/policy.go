@@ -0,0 +1,291 @@
+package him
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	acmv1 "github.com/ferg-cod3s/automated-compromise-mitigation/api/proto/acm/v1"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+)
+
+// SiteCategory classifies a site for HIM policy decisions.
+type SiteCategory string
+
+const (
+	// CategoryUnknown is used when the site has not been classified.
+	CategoryUnknown SiteCategory = ""
+
+	// CategoryFinancial covers banks, brokers and payment providers.
+	CategoryFinancial SiteCategory = "financial"
+
+	// CategoryGovernment covers government and tax services.
+	CategoryGovernment SiteCategory = "government"
+
+	// CategoryHealthcare covers health providers and insurers.
+	CategoryHealthcare SiteCategory = "healthcare"
+
+	// CategoryEmail covers email providers, which often gate account recovery.
+	CategoryEmail SiteCategory = "email"
+
+	// CategoryDeveloper covers developer platforms with rotation APIs.
+	CategoryDeveloper SiteCategory = "developer"
+
+	// CategorySocial covers social networks.
+	CategorySocial SiteCategory = "social"
+)
+
+// CredentialMetadata describes the credential being rotated, as far as it
+// affects whether a human is needed.
+type CredentialMetadata struct {
+	// HasTOTP indicates the vault item has a TOTP secret, so the site will
+	// ask for a one-time code.
+	HasTOTP bool
+
+	// Category is the site's classification.
+	Category SiteCategory
+
+	// Shared indicates a team credential, which needs multi-party approval
+	// when the policy configures one.
+	Shared bool
+}
+
+// ComplianceVerdict is the ACVS outcome for a rotation action.
+type ComplianceVerdict struct {
+	// Result is the ACVS validation result.
+	Result acmv1.ValidationResult
+
+	// RecommendedMethod is the automation method ACVS recommends.
+	RecommendedMethod acmv1.AutomationMethod
+
+	// Reasoning explains the verdict.
+	Reasoning string
+}
+
+// ComplianceChecker validates a rotation action against the site's Terms of
+// Service. It is usually backed by ACVS.
+type ComplianceChecker interface {
+	CheckCompliance(ctx context.Context, action RotationAction) (*ComplianceVerdict, error)
+}
+
+// ComplianceFunc adapts a function to ComplianceChecker.
+type ComplianceFunc func(ctx context.Context, action RotationAction) (*ComplianceVerdict, error)
+
+// CheckCompliance calls f.
+func (f ComplianceFunc) CheckCompliance(ctx context.Context, action RotationAction) (*ComplianceVerdict, error) {
+	return f(ctx, action)
+}
+
+// Override is a user-configured HIM decision for a site.
+type Override struct {
+	// Site matches the site and its subdomains.
+	Site string `json:"site"`
+
+	// ActionType limits the override to one action type (empty matches all).
+	ActionType ActionType `json:"action_type,omitempty"`
+
+	// Type is the HIM type to require. Ignored when Automate is set.
+	Type HIMType `json:"him_type,omitempty"`
+
+	// Automate declares that no human is needed for matching actions.
+	Automate bool `json:"automate,omitempty"`
+}
+
+// Policy configures how RequiresHIM decides.
+type Policy struct {
+	// Overrides are checked first, in order; the first match wins.
+	Overrides []Override `json:"overrides,omitempty"`
+
+	// ManualCategories are site categories whose passwords the user always
+	// changes by hand.
+	ManualCategories []SiteCategory `json:"manual_categories,omitempty"`
+
+	// AutoFillTOTP lets the manager answer TOTP prompts with the code from
+	// the vault, after the user confirms, for credentials that store a TOTP
+	// seed. Off unless the user opts in.
+	AutoFillTOTP bool `json:"auto_fill_totp,omitempty"`
+
+	// Approval, if set, requires sign-off from several people before a
+	// shared credential is rotated.
+	Approval *ApprovalPolicy `json:"approval,omitempty"`
+}
+
+// ApprovalPolicy configures multi-party approval of shared credentials.
+// Durations use Go syntax, such as "30m" or "24h".
+type ApprovalPolicy struct {
+	// Required is the number of distinct approvers needed (at least 1).
+	Required int `json:"required"`
+
+	// Approvers lists the client certificate common names allowed to
+	// approve. Empty allows any certificate issued by the ACM CA.
+	Approvers []string `json:"approvers,omitempty"`
+
+	// Timeout is how long approvals are collected. Defaults to 24h.
+	Timeout string `json:"timeout,omitempty"`
+
+	// EscalateAfter is when to notify and admit EscalationApprovers if
+	// approvals are still missing. Empty disables escalation.
+	EscalateAfter string `json:"escalate_after,omitempty"`
+
+	// EscalationApprovers may also approve once the request escalates.
+	EscalationApprovers []string `json:"escalation_approvers,omitempty"`
+}
+
+// defaultApprovalTimeout is how long approvals are collected by default.
+const defaultApprovalTimeout = 24 * time.Hour
+
+// requirement converts the policy into a session requirement and timeout.
+func (a ApprovalPolicy) requirement() (ApprovalRequirement, time.Duration, error) {
+	if a.Required < 1 {
+		return ApprovalRequirement{}, 0, fmt.Errorf("approval: required must be at least 1")
+	}
+	if len(a.Approvers) > 0 && len(a.Approvers) < a.Required {
+		return ApprovalRequirement{}, 0, fmt.Errorf("approval: %d approvers listed but %d required", len(a.Approvers), a.Required)
+	}
+
+	timeout := defaultApprovalTimeout
+	if a.Timeout != "" {
+		d, err := time.ParseDuration(a.Timeout)
+		if err != nil || d <= 0 {
+			return ApprovalRequirement{}, 0, fmt.Errorf("approval: invalid timeout %q", a.Timeout)
+		}
+		timeout = d
+	}
+
+	var escalateAfter time.Duration
+	if a.EscalateAfter != "" {
+		d, err := time.ParseDuration(a.EscalateAfter)
+		if err != nil || d <= 0 || d >= timeout {
+			return ApprovalRequirement{}, 0, fmt.Errorf("approval: escalate_after must be a duration shorter than the timeout")
+		}
+		escalateAfter = d
+	}
+
+	return ApprovalRequirement{
+		Required:            a.Required,
+		Approvers:           a.Approvers,
+		EscalateAfter:       escalateAfter,
+		EscalationApprovers: a.EscalationApprovers,
+	}, timeout, nil
+}
+
+// DefaultPolicy returns the policy used when the user has not configured one.
+func DefaultPolicy() Policy {
+	return Policy{
+		ManualCategories: []SiteCategory{CategoryFinancial, CategoryGovernment, CategoryHealthcare},
+	}
+}
+
+// LoadPolicy reads a HIM policy file. Fields missing from the file keep
+// their DefaultPolicy values.
+func LoadPolicy(path string) (Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, fmt.Errorf("failed to read HIM policy: %w", err)
+	}
+
+	policy := DefaultPolicy()
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return Policy{}, fmt.Errorf("failed to parse HIM policy: %w", err)
+	}
+
+	for i, o := range policy.Overrides {
+		if audit.NormalizeSite(o.Site) == "" {
+			return Policy{}, fmt.Errorf("override %d: site is required", i+1)
+		}
+		if !o.Automate && o.Type == "" {
+			return Policy{}, fmt.Errorf("override %d: him_type or automate is required", i+1)
+		}
+	}
+	if policy.Approval != nil {
+		if _, _, err := policy.Approval.requirement(); err != nil {
+			return Policy{}, err
+		}
+	}
+	return policy, nil
+}
+
+// Decide chooses whether action needs a human and which kind. verdict may
+// be nil when no compliance check was made. The order is: approval of
+// shared credentials, user overrides, ACVS, manual rotation (by method or
+// site category), then the challenge the site will raise for the action.
+//
+// Approval comes first so that neither an override nor an ACVS verdict can
+// waive it. Once action carries an ApprovalSessionID the rest of the order
+// applies, so callers decide again after approval.
+func (p Policy) Decide(action RotationAction, verdict *ComplianceVerdict) (bool, HIMType, error) {
+	if action.Credential.Shared && p.Approval != nil && action.ApprovalSessionID == "" {
+		return true, HIMApproval, nil
+	}
+
+	if o, ok := p.override(action); ok {
+		if o.Automate {
+			return false, "", nil
+		}
+		return true, o.Type, nil
+	}
+
+	acvsRequiresHIM := false
+	if verdict != nil {
+		switch verdict.Result {
+		case acmv1.ValidationResult_VALIDATION_RESULT_BLOCKED:
+			return true, HIMToSReview, nil
+		case acmv1.ValidationResult_VALIDATION_RESULT_RATE_LIMITED:
+			return false, "", fmt.Errorf("rotation for %s is rate limited by site policy", action.Site)
+		case acmv1.ValidationResult_VALIDATION_RESULT_HIM_REQUIRED:
+			if verdict.RecommendedMethod == acmv1.AutomationMethod_AUTOMATION_METHOD_MANUAL {
+				return true, HIMManualRotation, nil
+			}
+			acvsRequiresHIM = true
+		}
+	}
+
+	if strings.EqualFold(action.Method, "manual") || p.isManualCategory(action.Credential.Category) {
+		return true, HIMManualRotation, nil
+	}
+
+	if action.Credential.HasTOTP {
+		return true, HIMTOTP, nil
+	}
+
+	switch action.ActionType {
+	case ActionAccountRecovery, ActionEmailChange:
+		// Without a second factor, sites confirm these by email
+		return true, HIMEmail, nil
+	}
+
+	if acvsRequiresHIM {
+		return true, HIMManualRotation, nil
+	}
+	return false, "", nil
+}
+
+// override returns the first override matching action.
+func (p Policy) override(action RotationAction) (Override, bool) {
+	site := audit.NormalizeSite(action.Site)
+	for _, o := range p.Overrides {
+		if o.ActionType != "" && o.ActionType != action.ActionType {
+			continue
+		}
+		target := audit.NormalizeSite(o.Site)
+		if site == target || strings.HasSuffix(site, "."+target) {
+			return o, true
+		}
+	}
+	return Override{}, false
+}
+
+func (p Policy) isManualCategory(category SiteCategory) bool {
+	if category == CategoryUnknown {
+		return false
+	}
+	for _, c := range p.ManualCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
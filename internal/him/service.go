@@ -9,18 +9,78 @@
 package him
 
 import (
+	"container/heap"
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/logging"
 )
 
 // Service manages HIM sessions and user prompts.
+//
+// Each session is guarded by its own lock and moves through the state
+// machine in transitions; callers only ever see copies. Expiry is driven by
+// a single timer over a heap of deadlines rather than a goroutine per
+// session. With a SessionStore attached (see Restore), every state change is
+// persisted.
 type Service struct {
-	sessions sync.Map // sessionID -> *Session
+	mu       sync.RWMutex
+	sessions map[string]*sessionEntry
 	timeout  time.Duration
+	logger   *logging.Logger
+
+	// storeMu is separate from mu because sessions are saved while their
+	// entry lock is held.
+	storeMu sync.RWMutex
+	store   SessionStore
+
+	listenersMu         sync.RWMutex
+	listeners           []func(Session)
+	suggestionListeners []func(Session)
+	escalationListeners []func(Session)
+
+	evidenceMu sync.RWMutex
+	evidence   EvidenceRecorder
+
+	validatorsMu sync.RWMutex
+	validators   map[InputType]Validator
+
+	expiryMu  sync.Mutex
+	deadlines deadlineHeap
+	wake      chan struct{}
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// sessionEntry holds a session and the synchronization around it.
+type sessionEntry struct {
+	mu       sync.Mutex
+	session  Session
+	response Response
+
+	// done is closed exactly once, when the session reaches a terminal state.
+	done chan struct{}
+
+	// save persists the session after each transition, if a store is attached.
+	save func(Session)
+
+	// password is the new password to hand off once (see ReleasePassword).
+	// It is held in memory only and dropped when the session ends.
+	password string
+}
+
+// transitions lists the legal state changes. Terminal states have none.
+var transitions = map[SessionState][]SessionState{
+	StateInitialized: {StatePending, StateProcessing, StateCancelled, StateTimeout, StateFailed},
+	StatePending:     {StateProcessing, StateCancelled, StateTimeout, StateFailed},
+	StateProcessing:  {StatePending, StateCompleted, StateCancelled, StateTimeout, StateFailed},
 }
 
 // NewService creates a new HIM service with the specified default timeout.
@@ -29,9 +89,21 @@ func NewService(timeout time.Duration) *Service {
 		timeout = 5 * time.Minute // Default timeout
 	}
 
-	return &Service{
-		timeout: timeout,
+	s := &Service{
+		sessions:   make(map[string]*sessionEntry),
+		timeout:    timeout,
+		logger:     logging.NewLogger("him"),
+		validators: DefaultValidators(),
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
 	}
+	go s.expiryLoop()
+	return s
+}
+
+// Close stops the expiry timer. Sessions still active stay active.
+func (s *Service) Close() {
+	s.closeOnce.Do(func() { close(s.stop) })
 }
 
 // CreateSession creates a new HIM session for user interaction.
@@ -41,195 +113,587 @@ func (s *Service) CreateSession(ctx context.Context, req SessionRequest) (*Sessi
 		return nil, fmt.Errorf("failed to generate session ID: %w", err)
 	}
 
-	session := &Session{
-		ID:              sessionID,
-		Type:            req.Type,
-		CredentialID:    req.CredentialID,
-		Site:            req.Site,
-		Prompt:          req.Prompt,
-		ExpectedInput:   req.ExpectedInput,
-		SecurityToken:   generateSecurityToken(),
-		State:           StateInitialized,
-		CreatedAt:       time.Now(),
-		ExpiresAt:       time.Now().Add(s.timeout),
-		AttemptCount:    0,
-		MaxAttempts:     req.MaxAttempts,
-		responseChannel: make(chan Response, 1),
+	timeout := req.Timeout
+	if timeout == 0 {
+		timeout = s.timeout
+	}
+	var approval *ApprovalRequirement
+	if req.Type == HIMApproval {
+		if req.Approval == nil || req.Approval.Required < 1 {
+			return nil, fmt.Errorf("approval sessions require at least one approver")
+		}
+		copied := *req.Approval
+		copied.Approvers = slices.Clone(copied.Approvers)
+		copied.EscalationApprovers = slices.Clone(copied.EscalationApprovers)
+		approval = &copied
+	}
+	inputType := req.InputType
+	if inputType == "" {
+		inputType = inputTypeFor(req.Type)
+	}
+	expectedInput := req.ExpectedInput
+	if expectedInput == "" {
+		expectedInput = expectedInputFor(inputType)
+	}
+
+	now := time.Now()
+	entry := &sessionEntry{
+		session: Session{
+			ID:            sessionID,
+			Type:          req.Type,
+			CredentialID:  req.CredentialID,
+			OperationID:   req.OperationID,
+			Site:          req.Site,
+			Prompt:        req.Prompt,
+			ActionURL:     req.ActionURL,
+			InputType:     inputType,
+			ExpectedInput: expectedInput,
+			SecurityToken: generateSecurityToken(),
+			State:         StateInitialized,
+			CreatedAt:     now,
+			ExpiresAt:     now.Add(timeout),
+			LastUpdated:   now,
+			MaxAttempts:   req.MaxAttempts,
+			Approval:      approval,
+		},
+		done: make(chan struct{}),
+		save: s.saveSession,
 	}
 
-	if session.MaxAttempts == 0 {
-		session.MaxAttempts = 3 // Default max attempts
+	if entry.session.MaxAttempts == 0 {
+		entry.session.MaxAttempts = 3 // Default max attempts
 	}
+	s.saveSession(entry.session)
+
+	// Snapshot before publishing; from then on the entry is guarded by its lock
+	snapshot := entry.session
 
-	s.sessions.Store(sessionID, session)
+	s.mu.Lock()
+	s.sessions[sessionID] = entry
+	s.mu.Unlock()
 
-	// Start timeout goroutine
-	go s.handleTimeout(ctx, sessionID)
+	s.scheduleExpiry(sessionID, snapshot.ExpiresAt)
+	if approval != nil && approval.EscalateAfter > 0 {
+		s.scheduleEscalation(sessionID, now.Add(approval.EscalateAfter))
+	}
+
+	s.listenersMu.RLock()
+	for _, listener := range s.listeners {
+		go listener(snapshot)
+	}
+	s.listenersMu.RUnlock()
 
-	return session, nil
+	return &snapshot, nil
 }
 
-// GetSession retrieves a session by ID.
-func (s *Service) GetSession(ctx context.Context, sessionID string) (*Session, error) {
-	value, ok := s.sessions.Load(sessionID)
-	if !ok {
-		return nil, fmt.Errorf("session not found: %s", sessionID)
+// OnSessionCreated registers fn to be called, in its own goroutine, with a
+// copy of every new session. The copy includes the SecurityToken, which must
+// only ever be sent to the client answering the prompt.
+func (s *Service) OnSessionCreated(fn func(Session)) {
+	s.listenersMu.Lock()
+	defer s.listenersMu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// OnSuggestion registers fn to be called, in its own goroutine, with a copy
+// of a session whenever Suggest offers a response for it, so clients can
+// re-send the prompt pre-filled.
+func (s *Service) OnSuggestion(fn func(Session)) {
+	s.listenersMu.Lock()
+	defer s.listenersMu.Unlock()
+	s.suggestionListeners = append(s.suggestionListeners, fn)
+}
+
+// Suggest offers value as a pre-filled response for an active session. The
+// user still has to submit it. value must pass the session's validator and
+// is stored in normalized form.
+func (s *Service) Suggest(ctx context.Context, sessionID string, value string) error {
+	entry, err := s.entry(sessionID)
+	if err != nil {
+		return err
 	}
 
-	session, ok := value.(*Session)
-	if !ok {
-		return nil, fmt.Errorf("invalid session data")
+	entry.mu.Lock()
+	if !entry.session.IsActive() {
+		entry.mu.Unlock()
+		return closedError(&entry.session)
+	}
+	data, err := s.validate(entry.session.InputType, ResponseData{TextInput: value})
+	if err != nil {
+		entry.mu.Unlock()
+		return &HIMError{Code: ErrInvalidInput, Message: "invalid suggestion", Cause: err, SessionID: sessionID}
 	}
+	entry.session.Suggestion = data.TextInput
+	entry.session.LastUpdated = time.Now()
+	snapshot := entry.session
+	entry.mu.Unlock()
+
+	s.listenersMu.RLock()
+	for _, listener := range s.suggestionListeners {
+		go listener(snapshot)
+	}
+	s.listenersMu.RUnlock()
 
-	return session, nil
+	return nil
+}
+
+// SetValidator replaces the validator for an input type. A nil validator
+// accepts any input of that type.
+func (s *Service) SetValidator(inputType InputType, v Validator) {
+	s.validatorsMu.Lock()
+	defer s.validatorsMu.Unlock()
+	if v == nil {
+		delete(s.validators, inputType)
+		return
+	}
+	s.validators[inputType] = v
+}
+
+// GetSession returns a copy of a session.
+func (s *Service) GetSession(ctx context.Context, sessionID string) (*Session, error) {
+	entry, err := s.entry(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return entry.snapshot(), nil
 }
 
 // SubmitResponse submits a user response to a HIM session.
 func (s *Service) SubmitResponse(ctx context.Context, sessionID string, response Response) error {
-	session, err := s.GetSession(ctx, sessionID)
+	entry, err := s.entry(sessionID)
 	if err != nil {
 		return err
 	}
 
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	session := &entry.session
+
 	// Verify security token to prevent CSRF
-	if response.SecurityToken != session.SecurityToken {
-		return fmt.Errorf("invalid security token")
+	if subtle.ConstantTimeCompare([]byte(response.SecurityToken), []byte(session.SecurityToken)) != 1 {
+		return &HIMError{Code: ErrInvalidToken, Message: "invalid security token", SessionID: sessionID}
 	}
 
-	// Check if session has expired
-	if time.Now().After(session.ExpiresAt) {
-		session.State = StateTimeout
-		return fmt.Errorf("session expired")
+	if !session.IsActive() {
+		return closedError(session)
+	}
+
+	// The token alone must never satisfy a multi-party approval
+	if session.Type == HIMApproval {
+		return &HIMError{Code: ErrNotAuthorized, Message: "approval requests are answered with Approve", SessionID: sessionID}
+	}
+
+	// The timer may not have fired yet
+	if !time.Now().Before(session.ExpiresAt) {
+		entry.transition(StateTimeout)
+		return closedError(session)
 	}
 
-	// Check if max attempts exceeded
 	if session.AttemptCount >= session.MaxAttempts {
-		session.State = StateFailed
-		return fmt.Errorf("maximum attempts exceeded")
+		entry.transition(StateFailed)
+		return closedError(session)
 	}
 
-	session.AttemptCount++
-	session.LastUpdated = time.Now()
-	session.State = StateProcessing
+	// Malformed input doesn't count as an attempt
+	data, err := s.validate(session.InputType, response.Data)
+	if err != nil {
+		return &HIMError{Code: ErrInvalidInput, Message: "invalid input", Cause: err, SessionID: sessionID}
+	}
+	response.Data = data
 
-	// Send response to waiting channel
-	select {
-	case session.responseChannel <- response:
-		session.State = StateCompleted
-		session.CompletedAt = time.Now()
-		return nil
-	case <-time.After(5 * time.Second):
-		return fmt.Errorf("timeout sending response")
+	session.AttemptCount++
+	if err := entry.transition(StateProcessing); err != nil {
+		return err
 	}
+
+	entry.response = response
+	return entry.transition(StateCompleted)
 }
 
-// WaitForResponse waits for a user response to a HIM session.
-// Returns the response or an error if timeout occurs.
+// WaitForResponse waits for a user response to a HIM session. It returns
+// when the session completes, fails, is cancelled or expires. If ctx is
+// done first, the session is cancelled.
 func (s *Service) WaitForResponse(ctx context.Context, sessionID string) (Response, error) {
-	session, err := s.GetSession(ctx, sessionID)
+	entry, err := s.entry(sessionID)
 	if err != nil {
 		return Response{}, err
 	}
 
 	select {
-	case response := <-session.responseChannel:
-		return response, nil
-	case <-time.After(s.timeout):
-		session.State = StateTimeout
-		return Response{}, fmt.Errorf("timeout waiting for user response")
+	case <-entry.done:
 	case <-ctx.Done():
-		session.State = StateCancelled
+		entry.cancel()
 		return Response{}, ctx.Err()
 	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.session.State != StateCompleted {
+		return Response{}, closedError(&entry.session)
+	}
+	return entry.response, nil
 }
 
-// CancelSession cancels an active HIM session.
+// CancelSession cancels an active HIM session. Cancelling a session that is
+// already cancelled succeeds; cancelling one that ended otherwise fails.
 func (s *Service) CancelSession(ctx context.Context, sessionID string) error {
-	session, err := s.GetSession(ctx, sessionID)
+	entry, err := s.entry(sessionID)
 	if err != nil {
 		return err
 	}
+	return entry.cancel()
+}
 
-	session.State = StateCancelled
-	session.CompletedAt = time.Now()
-
-	// Close response channel to unblock any waiters
-	close(session.responseChannel)
+// MarkPrompted records that a session's prompt was delivered to a client.
+func (s *Service) MarkPrompted(ctx context.Context, sessionID string) error {
+	entry, err := s.entry(sessionID)
+	if err != nil {
+		return err
+	}
 
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.session.State == StateInitialized {
+		return entry.transition(StatePending)
+	}
 	return nil
 }
 
-// ListActiveSessions returns all active (non-completed) HIM sessions.
-func (s *Service) ListActiveSessions(ctx context.Context) ([]*Session, error) {
+// ListSessions returns copies of all sessions still held in memory,
+// including completed ones that have not been cleaned up yet.
+func (s *Service) ListSessions(ctx context.Context) ([]*Session, error) {
 	var sessions []*Session
+	for _, entry := range s.entries() {
+		sessions = append(sessions, entry.snapshot())
+	}
+	return sessions, nil
+}
 
-	s.sessions.Range(func(key, value interface{}) bool {
-		session, ok := value.(*Session)
-		if !ok {
-			return true // Continue iteration
-		}
-
-		// Include only active sessions
-		if session.State != StateCompleted && session.State != StateFailed &&
-			session.State != StateCancelled && session.State != StateTimeout {
+// ListActiveSessions returns copies of all active (non-completed) HIM sessions.
+func (s *Service) ListActiveSessions(ctx context.Context) ([]*Session, error) {
+	var sessions []*Session
+	for _, entry := range s.entries() {
+		if session := entry.snapshot(); session.IsActive() {
 			sessions = append(sessions, session)
 		}
-
-		return true // Continue iteration
-	})
-
+	}
 	return sessions, nil
 }
 
 // CleanupExpiredSessions removes expired sessions from memory.
 func (s *Service) CleanupExpiredSessions(ctx context.Context) {
-	var toDelete []string
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	s.sessions.Range(func(key, value interface{}) bool {
-		sessionID, ok := key.(string)
-		if !ok {
-			return true
+	for sessionID, entry := range s.sessions {
+		session := entry.snapshot()
+
+		// Delete completed or expired sessions older than 1 hour
+		if !session.IsActive() && time.Since(session.CompletedAt) > time.Hour {
+			delete(s.sessions, sessionID)
+			if store := s.sessionStore(); store != nil {
+				if err := store.DeleteSession(ctx, sessionID); err != nil {
+					s.logger.Warn("Failed to delete HIM session", "session_id", sessionID, "error", err)
+				}
+			}
 		}
+	}
+}
 
-		session, ok := value.(*Session)
-		if !ok {
-			return true
+// Restore attaches store to the service and rehydrates the sessions saved
+// in it. Active sessions whose deadline passed while the service was down
+// are timed out and recorded in auditLogger, if not nil. The rest get a
+// fresh security token, since only token hashes are stored, and are offered
+// again to clients as they connect. From then on every state change is
+// saved to store. Restore must be called before any session is created.
+func (s *Service) Restore(ctx context.Context, store SessionStore, auditLogger audit.Logger) (restored, expired int, err error) {
+	saved, err := store.LoadSessions(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load HIM sessions: %w", err)
+	}
+
+	s.storeMu.Lock()
+	s.store = store
+	s.storeMu.Unlock()
+
+	now := time.Now()
+	for _, session := range saved {
+		entry := &sessionEntry{session: session, done: make(chan struct{}), save: s.saveSession}
+
+		switch {
+		case !session.IsActive():
+			close(entry.done)
+
+		case !now.Before(session.ExpiresAt):
+			previous := session.State
+			entry.session.State = StateTimeout
+			entry.session.LastUpdated = now
+			entry.session.CompletedAt = now
+			close(entry.done)
+			s.saveSession(entry.session)
+			expired++
+
+			if auditLogger != nil {
+				auditLogger.LogEvent(ctx, audit.Event{
+					Type:         audit.EventTypeHIM,
+					Status:       audit.StatusFailure,
+					CredentialID: session.CredentialID,
+					Site:         session.Site,
+					Message:      fmt.Sprintf("HIM %s prompt expired while the service was down", session.Type),
+					Metadata: map[string]string{
+						"session_id":     session.ID,
+						"operation_id":   session.OperationID,
+						"previous_state": string(previous),
+					},
+				})
+			}
+
+		default:
+			// A response being processed at shutdown was never applied
+			if session.State == StateProcessing {
+				entry.session.State = StatePending
+			}
+			entry.session.SecurityToken = generateSecurityToken()
+			entry.session.LastUpdated = now
+			s.saveSession(entry.session)
+			s.scheduleExpiry(session.ID, session.ExpiresAt)
+			if session.Approval != nil && session.Approval.EscalateAfter > 0 && !session.Escalated {
+				s.scheduleEscalation(session.ID, session.CreatedAt.Add(session.Approval.EscalateAfter))
+			}
+			restored++
 		}
 
-		// Delete completed or expired sessions older than 1 hour
-		if (session.State == StateCompleted || session.State == StateFailed ||
-			session.State == StateCancelled || session.State == StateTimeout) &&
-			time.Since(session.CompletedAt) > time.Hour {
-			toDelete = append(toDelete, sessionID)
+		s.mu.Lock()
+		s.sessions[session.ID] = entry
+		s.mu.Unlock()
+	}
+
+	return restored, expired, nil
+}
+
+// saveSession persists session if a store is attached. Failures are logged
+// rather than returned so a storage problem never blocks a prompt.
+func (s *Service) saveSession(session Session) {
+	store := s.sessionStore()
+	if store == nil {
+		return
+	}
+
+	if err := store.SaveSession(context.Background(), session); err != nil {
+		s.logger.Error("Failed to persist HIM session", "session_id", session.ID, "error", err)
+	}
+}
+
+func (s *Service) validate(inputType InputType, data ResponseData) (ResponseData, error) {
+	s.validatorsMu.RLock()
+	v, ok := s.validators[inputType]
+	s.validatorsMu.RUnlock()
+	if !ok {
+		return data, nil
+	}
+	return v.Validate(data)
+}
+
+func (s *Service) sessionStore() SessionStore {
+	s.storeMu.RLock()
+	defer s.storeMu.RUnlock()
+	return s.store
+}
+
+// IsActive reports whether the session can still accept a response.
+func (s *Session) IsActive() bool {
+	return s.State == StateInitialized || s.State == StatePending || s.State == StateProcessing
+}
+
+func (s *Service) entry(sessionID string) (*sessionEntry, error) {
+	s.mu.RLock()
+	entry, ok := s.sessions[sessionID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, &HIMError{Code: ErrSessionNotFound, Message: fmt.Sprintf("session not found: %s", sessionID), SessionID: sessionID}
+	}
+	return entry, nil
+}
+
+func (s *Service) entries() []*sessionEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]*sessionEntry, 0, len(s.sessions))
+	for _, entry := range s.sessions {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// snapshot returns a copy of the session.
+func (e *sessionEntry) snapshot() *Session {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	session := e.session
+	return &session
+}
+
+// transition moves the session to state, closing done when the state is
+// terminal. The caller must hold e.mu.
+func (e *sessionEntry) transition(to SessionState) error {
+	from := e.session.State
+	allowed := false
+	for _, next := range transitions[from] {
+		if next == to {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return &HIMError{
+			Code:      ErrInvalidTransition,
+			Message:   fmt.Sprintf("invalid session transition %s -> %s", from, to),
+			SessionID: e.session.ID,
 		}
+	}
 
-		return true
-	})
+	now := time.Now()
+	e.session.State = to
+	e.session.LastUpdated = now
+	if !e.session.IsActive() {
+		e.session.CompletedAt = now
+		e.password = ""
+		e.session.PasswordPending = false
+		close(e.done)
+	}
+	if e.save != nil {
+		e.save(e.session)
+	}
+	return nil
+}
 
-	for _, sessionID := range toDelete {
-		s.sessions.Delete(sessionID)
+// cancel moves an active session to cancelled. It is idempotent.
+func (e *sessionEntry) cancel() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch {
+	case e.session.State == StateCancelled:
+		return nil
+	case !e.session.IsActive():
+		return closedError(&e.session)
 	}
+	return e.transition(StateCancelled)
 }
 
-// handleTimeout monitors a session and marks it as timed out if it expires.
-func (s *Service) handleTimeout(ctx context.Context, sessionID string) {
-	session, err := s.GetSession(ctx, sessionID)
-	if err != nil {
-		return
+// expire times out the session if it is still active.
+func (e *sessionEntry) expire() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.session.IsActive() {
+		e.transition(StateTimeout)
 	}
+}
 
-	// Wait until expiration
-	time.Sleep(time.Until(session.ExpiresAt))
+// closedError describes why a session no longer accepts input.
+func closedError(session *Session) error {
+	code := ErrSessionClosed
+	switch session.State {
+	case StateTimeout:
+		code = ErrSessionExpired
+	case StateCancelled:
+		code = ErrCancelled
+	case StateFailed:
+		if session.AttemptCount >= session.MaxAttempts {
+			code = ErrMaxAttemptsExceeded
+		}
+	}
+	return &HIMError{Code: code, Message: fmt.Sprintf("session is %s", session.State), SessionID: session.ID}
+}
 
-	// Check if still pending
-	currentSession, err := s.GetSession(ctx, sessionID)
-	if err != nil {
-		return
+// Expiry
+
+// deadline is one session expiry, or approval escalation, in the heap.
+type deadline struct {
+	at        time.Time
+	sessionID string
+	escalate  bool
+}
+
+// deadlineHeap orders deadlines earliest first.
+type deadlineHeap []deadline
+
+func (h deadlineHeap) Len() int           { return len(h) }
+func (h deadlineHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h deadlineHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *deadlineHeap) Push(x any)        { *h = append(*h, x.(deadline)) }
+func (h *deadlineHeap) Pop() any {
+	old := *h
+	n := len(old)
+	d := old[n-1]
+	*h = old[:n-1]
+	return d
+}
+
+// scheduleExpiry adds an expiry deadline.
+func (s *Service) scheduleExpiry(sessionID string, at time.Time) {
+	s.schedule(deadline{at: at, sessionID: sessionID})
+}
+
+// scheduleEscalation adds an approval escalation deadline.
+func (s *Service) scheduleEscalation(sessionID string, at time.Time) {
+	s.schedule(deadline{at: at, sessionID: sessionID, escalate: true})
+}
+
+// schedule adds a deadline and wakes the expiry loop if it is now the
+// earliest.
+func (s *Service) schedule(d deadline) {
+	s.expiryMu.Lock()
+	heap.Push(&s.deadlines, d)
+	earliest := s.deadlines[0] == d
+	s.expiryMu.Unlock()
+
+	if earliest {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
 	}
+}
 
-	if currentSession.State == StatePending || currentSession.State == StateInitialized {
-		currentSession.State = StateTimeout
-		currentSession.CompletedAt = time.Now()
+// expiryLoop times out and escalates sessions as their deadlines pass.
+func (s *Service) expiryLoop() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		s.expiryMu.Lock()
+		var due []deadline
+		now := time.Now()
+		for len(s.deadlines) > 0 && !s.deadlines[0].at.After(now) {
+			due = append(due, heap.Pop(&s.deadlines).(deadline))
+		}
+		wait := time.Hour
+		if len(s.deadlines) > 0 {
+			wait = time.Until(s.deadlines[0].at)
+		}
+		s.expiryMu.Unlock()
+
+		for _, d := range due {
+			entry, err := s.entry(d.sessionID)
+			switch {
+			case err != nil:
+			case d.escalate:
+				s.escalateSession(entry)
+			default:
+				entry.expire()
+			}
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-s.stop:
+			return
+		}
 	}
 }
 
@@ -0,0 +1,212 @@
+package him
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func createTestSession(t *testing.T, s *Service, timeout time.Duration) *Session {
+	t.Helper()
+	session, err := s.CreateSession(context.Background(), SessionRequest{
+		Type:    HIMTOTP,
+		Site:    "github.com",
+		Prompt:  "Enter code",
+		Timeout: timeout,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	return session
+}
+
+func himErrorCode(err error) HIMErrorCode {
+	var herr *HIMError
+	if errors.As(err, &herr) {
+		return herr.Code
+	}
+	return ""
+}
+
+// TestSessionLifecycle tests the normal prompt, respond and wait flow
+func TestSessionLifecycle(t *testing.T) {
+	s := NewService(time.Minute)
+	defer s.Close()
+	ctx := context.Background()
+	session := createTestSession(t, s, 0)
+
+	if err := s.MarkPrompted(ctx, session.ID); err != nil {
+		t.Fatalf("Failed to mark prompted: %v", err)
+	}
+	if got, _ := s.GetSession(ctx, session.ID); got.State != StatePending {
+		t.Errorf("Expected pending, got %s", got.State)
+	}
+
+	err := s.SubmitResponse(ctx, session.ID, Response{SecurityToken: "wrong"})
+	if himErrorCode(err) != ErrInvalidToken {
+		t.Errorf("Expected ErrInvalidToken, got %v", err)
+	}
+
+	err = s.SubmitResponse(ctx, session.ID, Response{SecurityToken: session.SecurityToken, Data: ResponseData{TextInput: "123456"}})
+	if err != nil {
+		t.Fatalf("Failed to submit response: %v", err)
+	}
+
+	response, err := s.WaitForResponse(ctx, session.ID)
+	if err != nil || response.Data.TextInput != "123456" {
+		t.Errorf("Unexpected wait result: %+v, %v", response, err)
+	}
+
+	got, _ := s.GetSession(ctx, session.ID)
+	if got.State != StateCompleted || got.CompletedAt.IsZero() || got.AttemptCount != 1 {
+		t.Errorf("Unexpected final session: %+v", got)
+	}
+
+	err = s.SubmitResponse(ctx, session.ID, Response{SecurityToken: session.SecurityToken})
+	if himErrorCode(err) != ErrSessionClosed {
+		t.Errorf("Expected ErrSessionClosed after completion, got %v", err)
+	}
+}
+
+// TestCancelIsIdempotent tests repeated and late cancellation
+func TestCancelIsIdempotent(t *testing.T) {
+	s := NewService(time.Minute)
+	defer s.Close()
+	ctx := context.Background()
+	session := createTestSession(t, s, 0)
+
+	for i := 0; i < 3; i++ {
+		if err := s.CancelSession(ctx, session.ID); err != nil {
+			t.Fatalf("Cancel %d failed: %v", i+1, err)
+		}
+	}
+
+	if _, err := s.WaitForResponse(ctx, session.ID); himErrorCode(err) != ErrCancelled {
+		t.Errorf("Expected ErrCancelled from wait, got %v", err)
+	}
+	err := s.SubmitResponse(ctx, session.ID, Response{SecurityToken: session.SecurityToken})
+	if himErrorCode(err) != ErrCancelled {
+		t.Errorf("Expected ErrCancelled from submit, got %v", err)
+	}
+
+	completed := createTestSession(t, s, 0)
+	s.SubmitResponse(ctx, completed.ID, Response{SecurityToken: completed.SecurityToken, Data: ResponseData{TextInput: "123456"}})
+	if err := s.CancelSession(ctx, completed.ID); himErrorCode(err) != ErrSessionClosed {
+		t.Errorf("Expected ErrSessionClosed cancelling a completed session, got %v", err)
+	}
+
+	if err := s.CancelSession(ctx, "missing"); himErrorCode(err) != ErrSessionNotFound {
+		t.Errorf("Expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+// TestTimerExpiry tests that the timer heap expires sessions in deadline order
+func TestTimerExpiry(t *testing.T) {
+	s := NewService(time.Minute)
+	defer s.Close()
+	ctx := context.Background()
+
+	long := createTestSession(t, s, time.Hour)
+	var short []*Session
+	for i := 0; i < 50; i++ {
+		short = append(short, createTestSession(t, s, time.Duration(10+i)*time.Millisecond))
+	}
+
+	for _, session := range short {
+		if _, err := s.WaitForResponse(ctx, session.ID); himErrorCode(err) != ErrSessionExpired {
+			t.Fatalf("Expected ErrSessionExpired, got %v", err)
+		}
+		if got, _ := s.GetSession(ctx, session.ID); got.State != StateTimeout {
+			t.Fatalf("Expected timeout state, got %s", got.State)
+		}
+	}
+
+	if got, _ := s.GetSession(ctx, long.ID); got.State != StateInitialized {
+		t.Errorf("Expected long session to stay active, got %s", got.State)
+	}
+}
+
+// TestWaitCancelledByContext tests that abandoning a wait cancels the session
+func TestWaitCancelledByContext(t *testing.T) {
+	s := NewService(time.Minute)
+	defer s.Close()
+	session := createTestSession(t, s, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.WaitForResponse(ctx, session.ID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if got, _ := s.GetSession(context.Background(), session.ID); got.State != StateCancelled {
+		t.Errorf("Expected cancelled, got %s", got.State)
+	}
+}
+
+// TestSessionStress races submit, cancel, expiry and reads on the same
+// sessions. Run with -race.
+func TestSessionStress(t *testing.T) {
+	s := NewService(time.Minute)
+	defer s.Close()
+	ctx := context.Background()
+
+	const sessions = 100
+	const workers = 8
+
+	var wg sync.WaitGroup
+	for i := 0; i < sessions; i++ {
+		session := createTestSession(t, s, time.Duration(i%10)*time.Millisecond+time.Millisecond)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.WaitForResponse(ctx, session.ID)
+		}()
+
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				switch w % 4 {
+				case 0:
+					s.SubmitResponse(ctx, session.ID, Response{SecurityToken: session.SecurityToken, Data: ResponseData{TextInput: "123456"}})
+				case 1:
+					s.CancelSession(ctx, session.ID)
+				case 2:
+					s.MarkPrompted(ctx, session.ID)
+				case 3:
+					s.GetSession(ctx, session.ID)
+					s.ListActiveSessions(ctx)
+				}
+			}(w)
+		}
+	}
+	wg.Wait()
+
+	// Every session ends in exactly one terminal state, with its waiter released
+	for _, session := range mustList(t, s) {
+		deadline := time.Now().Add(5 * time.Second)
+		for session.IsActive() && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+			session, _ = s.GetSession(ctx, session.ID)
+		}
+		switch session.State {
+		case StateCompleted, StateCancelled, StateTimeout:
+		default:
+			t.Errorf("Session %s ended in %s", session.ID, session.State)
+		}
+		if session.CompletedAt.IsZero() {
+			t.Errorf("Session %s has no completion time", session.ID)
+		}
+	}
+}
+
+func mustList(t *testing.T, s *Service) []*Session {
+	t.Helper()
+	sessions, err := s.ListSessions(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	return sessions
+}
@@ -0,0 +1,308 @@
+package him
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // SQLite driver
+)
+
+// SessionStore persists HIM sessions so pending prompts survive a restart.
+// Security tokens are never stored, only their SHA-256 hash.
+type SessionStore interface {
+	// SaveSession inserts or updates a session.
+	SaveSession(ctx context.Context, session Session) error
+
+	// LoadSessions returns every stored session. SecurityToken is empty.
+	LoadSessions(ctx context.Context) ([]Session, error)
+
+	// DeleteSession removes a session.
+	DeleteSession(ctx context.Context, sessionID string) error
+}
+
+// SQLiteSessionStore implements SessionStore using SQLite.
+type SQLiteSessionStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteSessionStore creates a new SQLite-backed session store.
+func NewSQLiteSessionStore(db *sql.DB) (*SQLiteSessionStore, error) {
+	store := &SQLiteSessionStore{db: db}
+
+	// Initialize schema if needed
+	if err := store.initSchema(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return store, nil
+}
+
+// initSchema creates the him_sessions table if it doesn't exist.
+func (s *SQLiteSessionStore) initSchema(ctx context.Context) error {
+	schema := `
+CREATE TABLE IF NOT EXISTS him_sessions (
+    id TEXT PRIMARY KEY,
+    him_type TEXT NOT NULL,
+    credential_id TEXT NOT NULL,
+    operation_id TEXT NOT NULL,
+    site TEXT NOT NULL,
+    prompt TEXT NOT NULL,
+    input_type TEXT NOT NULL DEFAULT '',
+    expected_input TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    state TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    completed_at INTEGER NOT NULL,
+    attempt_count INTEGER NOT NULL,
+    max_attempts INTEGER NOT NULL,
+    approval TEXT NOT NULL DEFAULT '',
+    escalated INTEGER NOT NULL DEFAULT 0,
+    action_url TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_him_sessions_state ON him_sessions(state);
+CREATE INDEX IF NOT EXISTS idx_him_sessions_expires_at ON him_sessions(expires_at);
+
+CREATE TABLE IF NOT EXISTS him_approvals (
+    session_id TEXT NOT NULL,
+    approver TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    signature BLOB NOT NULL,
+    signed_at INTEGER NOT NULL,
+    evidence_id TEXT NOT NULL,
+    PRIMARY KEY (session_id, fingerprint)
+);
+	`
+
+	if _, err := s.db.ExecContext(ctx, schema); err != nil {
+		return err
+	}
+
+	// Add columns missing from tables created by earlier versions
+	columns := []struct{ name, definition string }{
+		{"input_type", "TEXT NOT NULL DEFAULT ''"},
+		{"approval", "TEXT NOT NULL DEFAULT ''"},
+		{"escalated", "INTEGER NOT NULL DEFAULT 0"},
+		{"action_url", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, column := range columns {
+		var count int
+		err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info('him_sessions') WHERE name = ?", column.name).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			if _, err := s.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE him_sessions ADD COLUMN %s %s", column.name, column.definition)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SaveSession saves or updates a session and its approvals.
+func (s *SQLiteSessionStore) SaveSession(ctx context.Context, session Session) error {
+	query := `
+INSERT OR REPLACE INTO him_sessions (
+    id, him_type, credential_id, operation_id, site, prompt, input_type,
+    expected_input, token_hash, state, created_at, expires_at, updated_at,
+    completed_at, attempt_count, max_attempts, approval, escalated, action_url
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	var approval string
+	if session.Approval != nil {
+		data, err := json.Marshal(session.Approval)
+		if err != nil {
+			return fmt.Errorf("failed to encode approval requirement: %w", err)
+		}
+		approval = string(data)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query,
+		session.ID,
+		string(session.Type),
+		session.CredentialID,
+		session.OperationID,
+		session.Site,
+		session.Prompt,
+		string(session.InputType),
+		session.ExpectedInput,
+		hashToken(session.SecurityToken),
+		string(session.State),
+		session.CreatedAt.UnixMilli(),
+		session.ExpiresAt.UnixMilli(),
+		session.LastUpdated.UnixMilli(),
+		unixMilliOrZero(session.CompletedAt),
+		session.AttemptCount,
+		session.MaxAttempts,
+		approval,
+		session.Escalated,
+		session.ActionURL,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save HIM session: %w", err)
+	}
+
+	// Approvals are only ever added
+	for _, a := range session.Approvals {
+		_, err := tx.ExecContext(ctx, `
+INSERT OR IGNORE INTO him_approvals (session_id, approver, fingerprint, signature, signed_at, evidence_id)
+VALUES (?, ?, ?, ?, ?, ?)`,
+			session.ID, a.Approver.CommonName, a.Approver.Fingerprint, a.Signature, a.SignedAt.Unix(), a.EvidenceID)
+		if err != nil {
+			return fmt.Errorf("failed to save HIM approval: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit HIM session: %w", err)
+	}
+	return nil
+}
+
+// LoadSessions retrieves all stored sessions, oldest first.
+func (s *SQLiteSessionStore) LoadSessions(ctx context.Context) ([]Session, error) {
+	query := `
+SELECT id, him_type, credential_id, operation_id, site, prompt, input_type,
+       expected_input, state, created_at, expires_at, updated_at, completed_at,
+       attempt_count, max_attempts, approval, escalated, action_url
+FROM him_sessions
+ORDER BY created_at
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query HIM sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		var himType, inputType, state, approval string
+		var createdAt, expiresAt, updatedAt, completedAt int64
+
+		if err := rows.Scan(
+			&session.ID,
+			&himType,
+			&session.CredentialID,
+			&session.OperationID,
+			&session.Site,
+			&session.Prompt,
+			&inputType,
+			&session.ExpectedInput,
+			&state,
+			&createdAt,
+			&expiresAt,
+			&updatedAt,
+			&completedAt,
+			&session.AttemptCount,
+			&session.MaxAttempts,
+			&approval,
+			&session.Escalated,
+			&session.ActionURL,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		session.Type = HIMType(himType)
+		session.InputType = InputType(inputType)
+		if session.InputType == "" {
+			session.InputType = inputTypeFor(session.Type)
+		}
+		session.State = SessionState(state)
+		session.CreatedAt = time.UnixMilli(createdAt)
+		session.ExpiresAt = time.UnixMilli(expiresAt)
+		session.LastUpdated = time.UnixMilli(updatedAt)
+		if completedAt != 0 {
+			session.CompletedAt = time.UnixMilli(completedAt)
+		}
+		if approval != "" {
+			session.Approval = &ApprovalRequirement{}
+			if err := json.Unmarshal([]byte(approval), session.Approval); err != nil {
+				return nil, fmt.Errorf("failed to decode approval requirement: %w", err)
+			}
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	if err := s.loadApprovals(ctx, sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// loadApprovals attaches stored approvals to sessions, in signing order.
+func (s *SQLiteSessionStore) loadApprovals(ctx context.Context, sessions []Session) error {
+	index := make(map[string]int, len(sessions))
+	for i, session := range sessions {
+		index[session.ID] = i
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT session_id, approver, fingerprint, signature, signed_at, evidence_id
+FROM him_approvals
+ORDER BY signed_at, rowid`)
+	if err != nil {
+		return fmt.Errorf("failed to query HIM approvals: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sessionID string
+		var signedAt int64
+		var a Approval
+		if err := rows.Scan(&sessionID, &a.Approver.CommonName, &a.Approver.Fingerprint, &a.Signature, &signedAt, &a.EvidenceID); err != nil {
+			return fmt.Errorf("failed to scan approval: %w", err)
+		}
+		a.SignedAt = time.Unix(signedAt, 0)
+		if i, ok := index[sessionID]; ok {
+			sessions[i].Approvals = append(sessions[i].Approvals, a)
+		}
+	}
+	return rows.Err()
+}
+
+// DeleteSession deletes a session and its approvals by ID. Deleting a
+// missing session is not an error.
+func (s *SQLiteSessionStore) DeleteSession(ctx context.Context, sessionID string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM him_approvals WHERE session_id = ?", sessionID); err != nil {
+		return fmt.Errorf("failed to delete HIM approvals: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM him_sessions WHERE id = ?", sessionID); err != nil {
+		return fmt.Errorf("failed to delete HIM session: %w", err)
+	}
+	return nil
+}
+
+// hashToken returns the hex SHA-256 of a security token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func unixMilliOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
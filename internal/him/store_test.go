@@ -0,0 +1,139 @@
+package him
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+)
+
+func openTestStore(t *testing.T, path string) *SQLiteSessionStore {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewSQLiteSessionStore(db)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	return store
+}
+
+// TestRestoreAfterRestart tests rehydrating, expiring and re-offering sessions
+func TestRestoreAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	// First run: one live, one that expires while the service is down, one completed
+	before := NewService(time.Minute)
+	if _, _, err := before.Restore(ctx, openTestStore(t, path), nil); err != nil {
+		t.Fatalf("Failed to attach store: %v", err)
+	}
+	live, _ := before.CreateSession(ctx, SessionRequest{Type: HIMManualRotation, Site: "bank.com", OperationID: "op-1", Prompt: "Change your password", Timeout: time.Hour})
+	stale, _ := before.CreateSession(ctx, SessionRequest{Type: HIMTOTP, Site: "github.com", Prompt: "Enter code"})
+	done, _ := before.CreateSession(ctx, SessionRequest{Type: HIMTOTP, Site: "gitlab.com", Prompt: "Enter code"})
+	before.MarkPrompted(ctx, live.ID)
+	if err := before.SubmitResponse(ctx, done.ID, Response{SecurityToken: done.SecurityToken, Data: ResponseData{TextInput: "123456"}}); err != nil {
+		t.Fatalf("Failed to submit response: %v", err)
+	}
+	before.Close()
+
+	// Move the stale deadline into the past while nothing is running, so
+	// the first service's expiry loop can never claim it first
+	store := openTestStore(t, path)
+	saved, err := store.LoadSessions(ctx)
+	if err != nil {
+		t.Fatalf("Failed to load sessions: %v", err)
+	}
+	for _, session := range saved {
+		if session.ID == stale.ID {
+			session.ExpiresAt = time.Now().Add(-time.Second)
+			if err := store.SaveSession(ctx, session); err != nil {
+				t.Fatalf("Failed to save session: %v", err)
+			}
+		}
+	}
+
+	// Second run
+	auditLogger, err := audit.NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer auditLogger.Close()
+
+	after := NewService(time.Minute)
+	defer after.Close()
+	restored, expired, err := after.Restore(ctx, openTestStore(t, path), auditLogger)
+	if err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if restored != 1 || expired != 1 {
+		t.Fatalf("Expected 1 restored and 1 expired, got %d and %d", restored, expired)
+	}
+
+	active, _ := after.ListActiveSessions(ctx)
+	if len(active) != 1 || active[0].ID != live.ID || active[0].State != StatePending || active[0].OperationID != "op-1" {
+		t.Fatalf("Unexpected active sessions: %+v", active)
+	}
+	if active[0].SecurityToken == "" || active[0].SecurityToken == live.SecurityToken {
+		t.Error("Expected a fresh security token for the restored session")
+	}
+
+	if got, _ := after.GetSession(ctx, stale.ID); got.State != StateTimeout {
+		t.Errorf("Expected stale session to time out, got %s", got.State)
+	}
+	if got, _ := after.GetSession(ctx, done.ID); got.State != StateCompleted {
+		t.Errorf("Expected completed session to stay completed, got %s", got.State)
+	}
+
+	events, _ := auditLogger.QueryEvents(ctx, audit.Filter{EventType: audit.EventTypeHIM})
+	if len(events) != 1 || events[0].Metadata["session_id"] != stale.ID || events[0].Status != audit.StatusFailure {
+		t.Errorf("Expected one expiry audit event, got %+v", events)
+	}
+
+	// The old token no longer works; the new one does and is persisted
+	if err := after.SubmitResponse(ctx, live.ID, Response{SecurityToken: live.SecurityToken}); himErrorCode(err) != ErrInvalidToken {
+		t.Errorf("Expected old token to be rejected, got %v", err)
+	}
+	if err := after.SubmitResponse(ctx, live.ID, Response{SecurityToken: active[0].SecurityToken, Data: ResponseData{TextInput: "yes"}}); err != nil {
+		t.Fatalf("Failed to submit with new token: %v", err)
+	}
+
+	saved, _ = openTestStore(t, path).LoadSessions(ctx)
+	for _, session := range saved {
+		if session.ID == live.ID && session.State != StateCompleted {
+			t.Errorf("Expected completion to be persisted, got %s", session.State)
+		}
+	}
+}
+
+// TestStoreKeepsOnlyTokenHash tests that security tokens are never stored
+func TestStoreKeepsOnlyTokenHash(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.db")
+	store := openTestStore(t, path)
+
+	s := NewService(time.Minute)
+	defer s.Close()
+	s.Restore(ctx, store, nil)
+	session, _ := s.CreateSession(ctx, SessionRequest{Type: HIMTOTP, Site: "github.com"})
+
+	var tokenHash string
+	if err := store.db.QueryRowContext(ctx, "SELECT token_hash FROM him_sessions WHERE id = ?", session.ID).Scan(&tokenHash); err != nil {
+		t.Fatalf("Failed to read session: %v", err)
+	}
+	if tokenHash != hashToken(session.SecurityToken) {
+		t.Errorf("Expected token hash, got %q", tokenHash)
+	}
+
+	saved, _ := store.LoadSessions(ctx)
+	if len(saved) != 1 || saved[0].SecurityToken != "" {
+		t.Errorf("Expected loaded session without token, got %+v", saved)
+	}
+}
@@ -0,0 +1,47 @@
+// Counts down each prompt and reloads the page when prompts arrive or go
+// away, unless the user has started typing an answer.
+(function () {
+  "use strict";
+
+  function tick() {
+    document.querySelectorAll(".countdown").forEach(function (el) {
+      var left = Math.round((Number(el.dataset.expires) - Date.now()) / 1000);
+      if (left <= 0) {
+        el.textContent = "expired";
+        return;
+      }
+      var m = Math.floor(left / 60), s = left % 60;
+      el.textContent = m + ":" + (s < 10 ? "0" : "") + s + " left";
+      el.classList.toggle("urgent", left < 60);
+    });
+  }
+
+  function shown() {
+    return Array.prototype.map.call(document.querySelectorAll(".prompt"), function (el) {
+      return el.dataset.session;
+    }).join(",");
+  }
+
+  function typing() {
+    return Array.prototype.some.call(document.querySelectorAll("input[type=text]"), function (el) {
+      return el.value !== el.defaultValue;
+    });
+  }
+
+  function refresh() {
+    fetch("/prompts.json", { credentials: "same-origin", cache: "no-store" })
+      .then(function (resp) { return resp.ok ? resp.json() : null; })
+      .then(function (data) {
+        if (data && data.sessions.join(",") !== shown() && !typing()) {
+          window.location.replace("/");
+        }
+      })
+      .catch(function () {});
+  }
+
+  document.addEventListener("DOMContentLoaded", function () {
+    tick();
+    setInterval(tick, 1000);
+    setInterval(refresh, 3000);
+  });
+})();
@@ -0,0 +1,109 @@
+package him
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/pwmanager"
+)
+
+// SetTOTPSource enables TOTP auto-fill for policies that opt in with
+// AutoFillTOTP, reading codes from source. Auto-fills are recorded in
+// auditLogger, if not nil.
+func (m *Manager) SetTOTPSource(source pwmanager.TOTPGenerator, auditLogger audit.Logger) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.totp = source
+	m.auditLogger = auditLogger
+}
+
+// autoFillApplies reports whether a prompt of himType for action should
+// ask to fill the code from the vault instead of asking for the code.
+func (m *Manager) autoFillApplies(himType HIMType, action RotationAction) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.policy.AutoFillTOTP &&
+		m.totp != nil &&
+		(himType == HIMTOTP || himType == HIMMFA) &&
+		action.Credential.HasTOTP &&
+		action.CredentialID != ""
+}
+
+// autoFillPrompt turns a TOTP prompt into the confirmation shown instead.
+func autoFillPrompt(prompt HIMPrompt, site string) HIMPrompt {
+	prompt.InputType = InputConfirmation
+	prompt.Message = fmt.Sprintf("Fill the current TOTP code for %s from your vault?", site)
+	return prompt
+}
+
+// takeAutoFill reports whether sessionID is an auto-fill confirmation and
+// forgets it, so each confirmation is acted on once.
+func (m *Manager) takeAutoFill(sessionID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ok := m.autoFill[sessionID]
+	delete(m.autoFill, sessionID)
+	return ok
+}
+
+// fillFromVault turns a confirmed auto-fill session into a response
+// carrying the vault's current code. It returns false when the user
+// declined or the vault could not produce a code, in which case the caller
+// falls back to asking for the code. The code itself is never logged,
+// audited or stored in the session.
+func (m *Manager) fillFromVault(ctx context.Context, sessionID string, confirmed *HIMResponse) (*HIMResponse, bool) {
+	if !confirmed.Confirmed {
+		return nil, false
+	}
+
+	m.mu.Lock()
+	action := m.actions[sessionID]
+	source := m.totp
+	auditLogger := m.auditLogger
+	m.mu.Unlock()
+
+	code, err := source.GetTOTP(ctx, action.CredentialID)
+	if err == nil {
+		_, err = DefaultValidators()[InputTOTP].Validate(ResponseData{TextInput: code})
+	}
+	if err != nil {
+		m.logger.Warn("TOTP auto-fill failed, asking for the code instead", "session_id", sessionID, "site", action.Site, "error", err)
+		return nil, false
+	}
+
+	if auditLogger != nil {
+		auditLogger.LogEvent(ctx, audit.Event{
+			Type:         audit.EventTypeHIM,
+			Status:       audit.StatusSuccess,
+			CredentialID: hashToken(action.CredentialID),
+			Site:         action.Site,
+			Message:      "TOTP code auto-filled from vault after user confirmation",
+			Metadata: map[string]string{
+				"session_id": sessionID,
+				"him_type":   string(HIMTOTP),
+				"autofill":   "vault_totp",
+			},
+		})
+	}
+
+	return &HIMResponse{
+		SessionID:   sessionID,
+		Input:       code,
+		Confirmed:   true,
+		AutoFilled:  true,
+		RespondedAt: time.Now(),
+	}, true
+}
+
+// manualTOTPPrompt is the prompt used when auto-fill is declined or fails.
+func manualTOTPPrompt(site string, timeout time.Duration) HIMPrompt {
+	return HIMPrompt{
+		Type:      HIMTOTP,
+		Site:      site,
+		Message:   fmt.Sprintf("Enter the TOTP code for %s", site),
+		InputType: InputTOTP,
+		Timeout:   timeout,
+	}
+}
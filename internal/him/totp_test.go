@@ -0,0 +1,165 @@
+package him
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/pwmanager"
+)
+
+type fakeTOTPGenerator struct {
+	code string
+	err  error
+}
+
+func (f fakeTOTPGenerator) GetTOTP(ctx context.Context, credentialID string) (string, error) {
+	return f.code, f.err
+}
+
+func newAutoFillManager(t *testing.T, source pwmanager.TOTPGenerator) (*Manager, *Service, audit.Logger) {
+	t.Helper()
+	auditLogger, err := audit.NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	t.Cleanup(func() { auditLogger.Close() })
+
+	service := NewService(time.Minute)
+	t.Cleanup(service.Close)
+
+	policy := DefaultPolicy()
+	policy.AutoFillTOTP = true
+	m := NewManager(service, policy, nil)
+	m.SetTOTPSource(source, auditLogger)
+	return m, service, auditLogger
+}
+
+func pauseTOTP(t *testing.T, m *Manager) (string, chan *HIMResponse) {
+	t.Helper()
+	resumed := make(chan *HIMResponse, 1)
+	action := RotationAction{CredentialID: "cred-1", Site: "github.com", Credential: CredentialMetadata{HasTOTP: true}}
+	sessionID, err := m.Pause(context.Background(), action, HIMPrompt{Type: HIMTOTP, Message: "Enter code"}, func(ctx context.Context, response *HIMResponse) error {
+		resumed <- response
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to pause: %v", err)
+	}
+	return sessionID, resumed
+}
+
+func respond(t *testing.T, service *Service, sessionID string, data ResponseData) {
+	t.Helper()
+	session, _ := service.GetSession(context.Background(), sessionID)
+	if err := service.SubmitResponse(context.Background(), sessionID, Response{SecurityToken: session.SecurityToken, Data: data}); err != nil {
+		t.Fatalf("Failed to submit response: %v", err)
+	}
+}
+
+func waitResumed(t *testing.T, resumed chan *HIMResponse) *HIMResponse {
+	t.Helper()
+	select {
+	case response := <-resumed:
+		return response
+	case <-time.After(5 * time.Second):
+		t.Fatal("Continuation was not called")
+		return nil
+	}
+}
+
+// TestTOTPAutoFillConfirmed tests that a confirmed auto-fill resumes with the vault code
+func TestTOTPAutoFillConfirmed(t *testing.T) {
+	m, service, auditLogger := newAutoFillManager(t, fakeTOTPGenerator{code: "654321"})
+	sessionID, resumed := pauseTOTP(t, m)
+
+	session, _ := service.GetSession(context.Background(), sessionID)
+	if session.InputType != InputConfirmation || !strings.Contains(session.Prompt, "vault") {
+		t.Fatalf("Expected a confirmation prompt, got %+v", session)
+	}
+
+	respond(t, service, sessionID, ResponseData{TextInput: "yes"})
+
+	response := waitResumed(t, resumed)
+	if response.Input != "654321" || !response.AutoFilled || response.CancelRequested {
+		t.Errorf("Unexpected response: %+v", response)
+	}
+
+	events, _ := auditLogger.QueryEvents(context.Background(), audit.Filter{EventType: audit.EventTypeHIM})
+	if len(events) != 1 || events[0].Metadata["session_id"] != sessionID || events[0].CredentialID == "cred-1" {
+		t.Fatalf("Expected one auto-fill audit event with a hashed credential, got %+v", events)
+	}
+	if strings.Contains(events[0].Message, "654321") {
+		t.Error("Audit event must not contain the code")
+	}
+	for _, v := range events[0].Metadata {
+		if strings.Contains(v, "654321") {
+			t.Error("Audit metadata must not contain the code")
+		}
+	}
+}
+
+// TestTOTPAutoFillFallback tests that declining or a vault failure asks for the code
+func TestTOTPAutoFillFallback(t *testing.T) {
+	tests := []struct {
+		name   string
+		source fakeTOTPGenerator
+		answer string
+	}{
+		{"declined", fakeTOTPGenerator{code: "654321"}, "no"},
+		{"vault error", fakeTOTPGenerator{err: errors.New("vault locked")}, "yes"},
+		{"malformed code", fakeTOTPGenerator{code: "not a code"}, "yes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, service, auditLogger := newAutoFillManager(t, tt.source)
+			sessionID, resumed := pauseTOTP(t, m)
+			respond(t, service, sessionID, ResponseData{TextInput: tt.answer})
+
+			// A prompt for the code replaces the confirmation
+			var next *Session
+			deadline := time.Now().Add(5 * time.Second)
+			for next == nil && time.Now().Before(deadline) {
+				active, _ := service.ListActiveSessions(context.Background())
+				for _, session := range active {
+					if session.InputType == InputTOTP {
+						next = session
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			if next == nil {
+				t.Fatal("Expected a TOTP prompt after fallback")
+			}
+
+			respond(t, service, next.ID, ResponseData{TextInput: "111222"})
+			response := waitResumed(t, resumed)
+			if response.Input != "111222" || response.AutoFilled {
+				t.Errorf("Unexpected response: %+v", response)
+			}
+
+			events, _ := auditLogger.QueryEvents(context.Background(), audit.Filter{EventType: audit.EventTypeHIM})
+			if len(events) != 0 {
+				t.Errorf("Expected no auto-fill audit events, got %+v", events)
+			}
+		})
+	}
+}
+
+// TestTOTPAutoFillRequiresOptIn tests that auto-fill is off by default
+func TestTOTPAutoFillRequiresOptIn(t *testing.T) {
+	service := NewService(time.Minute)
+	defer service.Close()
+	m := NewManager(service, DefaultPolicy(), nil)
+	m.SetTOTPSource(fakeTOTPGenerator{code: "654321"}, nil)
+
+	sessionID, _ := pauseTOTP(t, m)
+	session, _ := service.GetSession(context.Background(), sessionID)
+	if session.InputType != InputTOTP {
+		t.Errorf("Expected a TOTP prompt without opt-in, got %s", session.InputType)
+	}
+}
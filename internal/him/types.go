@@ -13,12 +13,23 @@ type Session struct {
 	// CredentialID is the ID of the credential requiring intervention.
 	CredentialID string
 
+	// OperationID is the rotation operation that triggered this session.
+	OperationID string
+
 	// Site is the website/service associated with this HIM session.
 	Site string
 
 	// Prompt is the message shown to the user.
 	Prompt string
 
+	// ActionURL is a page the user should open to act on the prompt, such
+	// as the site's change-password page.
+	ActionURL string
+
+	// InputType is the kind of input the user must provide; responses are
+	// validated against it.
+	InputType InputType
+
 	// ExpectedInput describes what input the user should provide.
 	ExpectedInput string
 
@@ -46,8 +57,24 @@ type Session struct {
 	// MaxAttempts is the maximum allowed attempts.
 	MaxAttempts int
 
-	// responseChannel is used internally to communicate responses.
-	responseChannel chan Response
+	// Suggestion is a response ACM found on its own (for example, a code
+	// from a verification email) and offers for the user to confirm. It is
+	// not persisted.
+	Suggestion string
+
+	// Approval is the sign-off required by a HIMApproval session.
+	Approval *ApprovalRequirement
+
+	// Approvals are the signed approvals received so far, in order.
+	Approvals []Approval
+
+	// Escalated indicates the escalation approvers have been asked to
+	// sign off because the required approvals did not arrive in time.
+	Escalated bool
+
+	// PasswordPending indicates a new password is attached and has not
+	// been released yet. The password itself is never part of a Session.
+	PasswordPending bool
 }
 
 // SessionRequest contains parameters for creating a new HIM session.
@@ -58,12 +85,21 @@ type SessionRequest struct {
 	// CredentialID is the credential requiring intervention.
 	CredentialID string
 
+	// OperationID is the rotation operation that triggered this session.
+	OperationID string
+
 	// Site is the website/service name.
 	Site string
 
 	// Prompt is the message to show the user.
 	Prompt string
 
+	// ActionURL is a page the user should open to act on the prompt.
+	ActionURL string
+
+	// InputType is the kind of input expected (default: derived from Type).
+	InputType InputType
+
 	// ExpectedInput describes what input is expected.
 	ExpectedInput string
 
@@ -72,6 +108,9 @@ type SessionRequest struct {
 
 	// Timeout overrides the default session timeout.
 	Timeout time.Duration
+
+	// Approval is required for HIMApproval sessions.
+	Approval *ApprovalRequirement
 }
 
 // Response contains the user's response to a HIM prompt.
@@ -97,6 +136,10 @@ type ResponseData struct {
 	// BooleanInput for yes/no questions.
 	BooleanInput bool
 
+	// BooleanSet reports that BooleanInput was given explicitly, e.g. by a
+	// yes/no button, rather than left at its zero value.
+	BooleanSet bool
+
 	// ChoiceInput for multiple choice (index of selected option).
 	ChoiceInput int
 
@@ -137,6 +180,15 @@ const (
 
 	// HIMSecurityKey indicates hardware security key is required.
 	HIMSecurityKey HIMType = "security_key"
+
+	// HIMBackupCode indicates an MFA backup code is required.
+	HIMBackupCode HIMType = "backup_code"
+
+	// HIMRecoveryCode indicates an account recovery code is required.
+	HIMRecoveryCode HIMType = "recovery_code"
+
+	// HIMApproval indicates several people must sign off before rotating.
+	HIMApproval HIMType = "approval"
 )
 
 // SessionState indicates the current state of a HIM session.
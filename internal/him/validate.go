@@ -0,0 +1,178 @@
+package him
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxTextLength bounds free-text responses, in characters.
+const maxTextLength = 1024
+
+// Validator checks a response for one input type. It returns the response
+// data normalized for the automation that consumes it (for example, a TOTP
+// code with separators removed), or an error describing what is wrong.
+type Validator interface {
+	Validate(data ResponseData) (ResponseData, error)
+}
+
+// ValidatorFunc adapts a function to Validator.
+type ValidatorFunc func(data ResponseData) (ResponseData, error)
+
+// Validate calls f.
+func (f ValidatorFunc) Validate(data ResponseData) (ResponseData, error) {
+	return f(data)
+}
+
+// DefaultValidators returns the built-in validators for each input type.
+func DefaultValidators() map[InputType]Validator {
+	return map[InputType]Validator{
+		InputTOTP:         digitCode("TOTP code", 6, 8),
+		InputSMS:          digitCode("SMS code", 4, 8),
+		InputEmailCode:    alphanumericCode("email code", 4, 12, false),
+		InputBackupCode:   alphanumericCode("backup code", 8, 16, true),
+		InputRecoveryCode: alphanumericCode("recovery code", 16, 64, true),
+		InputCAPTCHA:      boundedText("CAPTCHA solution", 64),
+		InputConfirmation: ValidatorFunc(validateConfirmation),
+		InputText:         boundedText("text", maxTextLength),
+	}
+}
+
+// digitCode accepts min to max digits, ignoring spaces and dashes, and
+// normalizes the input to the digits alone.
+func digitCode(name string, min, max int) Validator {
+	return ValidatorFunc(func(data ResponseData) (ResponseData, error) {
+		code := stripSeparators(data.TextInput)
+		if len(code) < min || len(code) > max {
+			return data, fmt.Errorf("%s must be %d to %d digits", name, min, max)
+		}
+		for _, r := range code {
+			if r < '0' || r > '9' {
+				return data, fmt.Errorf("%s must contain only digits", name)
+			}
+		}
+		data.TextInput = code
+		return data, nil
+	})
+}
+
+// alphanumericCode accepts min to max letters and digits, ignoring spaces
+// and dashes. Codes whose separators are significant to the site keep them
+// (trimmed); others are normalized to the characters alone.
+func alphanumericCode(name string, min, max int, keepSeparators bool) Validator {
+	return ValidatorFunc(func(data ResponseData) (ResponseData, error) {
+		code := stripSeparators(data.TextInput)
+		if n := utf8.RuneCountInString(code); n < min || n > max {
+			return data, fmt.Errorf("%s must be %d to %d letters or digits", name, min, max)
+		}
+		for _, r := range code {
+			if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return data, fmt.Errorf("%s must contain only letters, digits, spaces or dashes", name)
+			}
+		}
+		if keepSeparators {
+			data.TextInput = strings.TrimSpace(data.TextInput)
+		} else {
+			data.TextInput = code
+		}
+		return data, nil
+	})
+}
+
+// boundedText accepts 1 to max characters without control characters.
+func boundedText(name string, max int) Validator {
+	return ValidatorFunc(func(data ResponseData) (ResponseData, error) {
+		text := strings.TrimSpace(data.TextInput)
+		if text == "" {
+			return data, fmt.Errorf("%s must not be empty", name)
+		}
+		if !utf8.ValidString(text) {
+			return data, fmt.Errorf("%s must be valid UTF-8", name)
+		}
+		if utf8.RuneCountInString(text) > max {
+			return data, fmt.Errorf("%s must be at most %d characters", name, max)
+		}
+		for _, r := range text {
+			if unicode.IsControl(r) {
+				return data, fmt.Errorf("%s must not contain control characters", name)
+			}
+		}
+		data.TextInput = text
+		return data, nil
+	})
+}
+
+// validateConfirmation accepts a boolean the client set explicitly
+// (BooleanSet), or text that is exactly yes/no, y/n or true/false in any
+// case. Anything else, including empty text from a text-only client, is
+// ambiguous.
+func validateConfirmation(data ResponseData) (ResponseData, error) {
+	switch strings.ToLower(strings.TrimSpace(data.TextInput)) {
+	case "":
+		if !data.BooleanSet {
+			return data, fmt.Errorf("confirmation must be yes or no")
+		}
+		// BooleanInput is used as given
+	case "yes", "y", "true":
+		data.BooleanInput = true
+	case "no", "n", "false":
+		data.BooleanInput = false
+	default:
+		return data, fmt.Errorf("confirmation must be yes or no")
+	}
+	data.TextInput = ""
+	data.BooleanSet = true
+	return data, nil
+}
+
+func stripSeparators(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+}
+
+// inputTypeFor returns the input a HIM type asks the user for.
+func inputTypeFor(t HIMType) InputType {
+	switch t {
+	case HIMMFA, HIMTOTP:
+		return InputTOTP
+	case HIMSMS:
+		return InputSMS
+	case HIMEmail:
+		return InputEmailCode
+	case HIMBackupCode:
+		return InputBackupCode
+	case HIMRecoveryCode:
+		return InputRecoveryCode
+	case HIMCAPTCHA:
+		return InputCAPTCHA
+	default:
+		return InputConfirmation
+	}
+}
+
+// expectedInputFor describes an input type for display.
+func expectedInputFor(t InputType) string {
+	switch t {
+	case InputTOTP:
+		return "6-digit code"
+	case InputSMS:
+		return "SMS code"
+	case InputEmailCode:
+		return "code from the email"
+	case InputBackupCode:
+		return "backup code"
+	case InputRecoveryCode:
+		return "recovery code"
+	case InputCAPTCHA:
+		return "CAPTCHA solution"
+	case InputConfirmation:
+		return "yes/no"
+	default:
+		return "text"
+	}
+}
@@ -0,0 +1,114 @@
+package him
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDefaultValidators tests accepted and rejected input per type
+func TestDefaultValidators(t *testing.T) {
+	validators := DefaultValidators()
+
+	tests := []struct {
+		name      string
+		inputType InputType
+		data      ResponseData
+		valid     bool
+		want      ResponseData
+	}{
+		{"totp 6 digits", InputTOTP, ResponseData{TextInput: "123456"}, true, ResponseData{TextInput: "123456"}},
+		{"totp with separators", InputTOTP, ResponseData{TextInput: " 123 456 "}, true, ResponseData{TextInput: "123456"}},
+		{"totp 8 digits", InputTOTP, ResponseData{TextInput: "12345678"}, true, ResponseData{TextInput: "12345678"}},
+		{"totp too short", InputTOTP, ResponseData{TextInput: "12345"}, false, ResponseData{}},
+		{"totp letters", InputTOTP, ResponseData{TextInput: "12a456"}, false, ResponseData{}},
+		{"totp unicode digits", InputTOTP, ResponseData{TextInput: "١٢٣٤٥٦"}, false, ResponseData{}},
+		{"sms 4 digits", InputSMS, ResponseData{TextInput: "1234"}, true, ResponseData{TextInput: "1234"}},
+		{"sms too long", InputSMS, ResponseData{TextInput: "123456789"}, false, ResponseData{}},
+		{"email code", InputEmailCode, ResponseData{TextInput: "AB12-CD"}, true, ResponseData{TextInput: "AB12CD"}},
+		{"email code symbols", InputEmailCode, ResponseData{TextInput: "AB12!"}, false, ResponseData{}},
+		{"backup code keeps format", InputBackupCode, ResponseData{TextInput: " a1b2c-d3e4f "}, true, ResponseData{TextInput: "a1b2c-d3e4f"}},
+		{"backup code too short", InputBackupCode, ResponseData{TextInput: "abc-12"}, false, ResponseData{}},
+		{"recovery code", InputRecoveryCode, ResponseData{TextInput: "ABCD-EFGH-IJKL-MNOP"}, true, ResponseData{TextInput: "ABCD-EFGH-IJKL-MNOP"}},
+		{"recovery code too short", InputRecoveryCode, ResponseData{TextInput: "ABCD-EFGH"}, false, ResponseData{}},
+		{"confirmation yes", InputConfirmation, ResponseData{TextInput: "Yes"}, true, ResponseData{BooleanInput: true}},
+		{"confirmation no overrides boolean", InputConfirmation, ResponseData{TextInput: "n", BooleanInput: true}, true, ResponseData{}},
+		{"confirmation explicit boolean", InputConfirmation, ResponseData{BooleanInput: true, BooleanSet: true}, true, ResponseData{BooleanInput: true}},
+		{"confirmation explicit no", InputConfirmation, ResponseData{BooleanSet: true}, true, ResponseData{}},
+		{"confirmation empty text", InputConfirmation, ResponseData{TextInput: "  "}, false, ResponseData{}},
+		{"confirmation unset boolean", InputConfirmation, ResponseData{BooleanInput: true}, false, ResponseData{}},
+		{"confirmation ambiguous", InputConfirmation, ResponseData{TextInput: "sure"}, false, ResponseData{}},
+		{"text trimmed", InputText, ResponseData{TextInput: "  answer  "}, true, ResponseData{TextInput: "answer"}},
+		{"text empty", InputText, ResponseData{TextInput: "   "}, false, ResponseData{}},
+		{"text control characters", InputText, ResponseData{TextInput: "a\x00b"}, false, ResponseData{}},
+		{"text too long", InputText, ResponseData{TextInput: strings.Repeat("x", maxTextLength+1)}, false, ResponseData{}},
+		{"captcha", InputCAPTCHA, ResponseData{TextInput: "xk7Fq"}, true, ResponseData{TextInput: "xk7Fq"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validators[tt.inputType].Validate(tt.data)
+			if tt.valid != (err == nil) {
+				t.Fatalf("Expected valid=%v, got error %v", tt.valid, err)
+			}
+			if tt.valid && (got.TextInput != tt.want.TextInput || got.BooleanInput != tt.want.BooleanInput) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestMalformedInputKeepsAttempts tests that rejected input doesn't consume an attempt
+func TestMalformedInputKeepsAttempts(t *testing.T) {
+	s := NewService(time.Minute)
+	defer s.Close()
+	ctx := context.Background()
+	session, _ := s.CreateSession(ctx, SessionRequest{Type: HIMTOTP, Site: "github.com", MaxAttempts: 1})
+
+	for i := 0; i < 3; i++ {
+		err := s.SubmitResponse(ctx, session.ID, Response{SecurityToken: session.SecurityToken, Data: ResponseData{TextInput: "12-34"}})
+		if himErrorCode(err) != ErrInvalidInput {
+			t.Fatalf("Expected ErrInvalidInput, got %v", err)
+		}
+	}
+
+	got, _ := s.GetSession(ctx, session.ID)
+	if got.AttemptCount != 0 || !got.IsActive() {
+		t.Fatalf("Expected no attempts used and session active, got %+v", got)
+	}
+
+	err := s.SubmitResponse(ctx, session.ID, Response{SecurityToken: session.SecurityToken, Data: ResponseData{TextInput: "123 456"}})
+	if err != nil {
+		t.Fatalf("Failed to submit valid code: %v", err)
+	}
+	response, _ := s.WaitForResponse(ctx, session.ID)
+	if response.Data.TextInput != "123456" {
+		t.Errorf("Expected normalized code, got %q", response.Data.TextInput)
+	}
+}
+
+// TestSetValidator tests replacing and removing validators
+func TestSetValidator(t *testing.T) {
+	s := NewService(time.Minute)
+	defer s.Close()
+	ctx := context.Background()
+
+	s.SetValidator(InputText, ValidatorFunc(func(data ResponseData) (ResponseData, error) {
+		data.TextInput = strings.ToUpper(data.TextInput)
+		return data, nil
+	}))
+	session, _ := s.CreateSession(ctx, SessionRequest{Type: HIMToSReview, InputType: InputText})
+	if err := s.SubmitResponse(ctx, session.ID, Response{SecurityToken: session.SecurityToken, Data: ResponseData{TextInput: "ok"}}); err != nil {
+		t.Fatalf("Failed to submit: %v", err)
+	}
+	if response, _ := s.WaitForResponse(ctx, session.ID); response.Data.TextInput != "OK" {
+		t.Errorf("Expected custom validator to run, got %q", response.Data.TextInput)
+	}
+
+	s.SetValidator(InputTOTP, nil)
+	session, _ = s.CreateSession(ctx, SessionRequest{Type: HIMTOTP})
+	if err := s.SubmitResponse(ctx, session.ID, Response{SecurityToken: session.SecurityToken, Data: ResponseData{TextInput: "anything"}}); err != nil {
+		t.Errorf("Expected input to be accepted without a validator, got %v", err)
+	}
+}
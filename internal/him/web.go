@@ -0,0 +1,417 @@
+package him
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/logging"
+)
+
+//go:embed templates/prompts.html.tmpl
+var promptsHTMLTemplate string
+
+//go:embed templates/prompts.js
+var promptsJS []byte
+
+//go:embed templates/prompts.css
+var promptsCSS []byte
+
+const (
+	// webLoginTTL is how long a one-time login URL stays valid.
+	webLoginTTL = 2 * time.Minute
+
+	// webBrowserTTL is how long a browser stays signed in after using a
+	// login URL.
+	webBrowserTTL = 12 * time.Hour
+
+	// webCookieName is the cookie holding a signed-in browser's token.
+	webCookieName = "acm_him"
+
+	// maxWebFormSize bounds a submitted response form.
+	maxWebFormSize = 64 << 10
+
+	// webContentSecurityPolicy allows nothing but the page's own script,
+	// stylesheet and requests.
+	webContentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; connect-src 'self'; " +
+		"img-src 'self'; form-action 'self'; frame-ancestors 'none'; base-uri 'none'"
+)
+
+// WebServer serves pending HIM prompts as a page in a local browser, for
+// people who don't want to answer them in a terminal. It only listens on
+// 127.0.0.1 over HTTPS and only admits browsers that opened a one-time
+// login URL (see LoginURL). Each response form carries the session's
+// SecurityToken, which doubles as the CSRF token: SubmitResponse rejects a
+// response without it. Approval sessions are not shown; they need a signed
+// approval from a client certificate.
+type WebServer struct {
+	service   *Service
+	listener  net.Listener
+	tlsConfig *tls.Config
+	page      *template.Template
+	logger    *logging.Logger
+
+	mu       sync.Mutex
+	logins   map[string]time.Time // hashed one-time login token -> expiry
+	browsers map[string]time.Time // hashed browser cookie -> expiry
+}
+
+// NewWebServer listens on addr, which must be a 127.0.0.1 address (port 0
+// picks a free port). tlsConfig supplies the server certificate.
+func NewWebServer(service *Service, addr string, tlsConfig *tls.Config) (*WebServer, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid web address %q: %w", addr, err)
+	}
+	if host != "127.0.0.1" {
+		return nil, fmt.Errorf("web prompts must listen on 127.0.0.1, not %q", host)
+	}
+
+	page, err := template.New("prompts").Funcs(template.FuncMap{
+		"unixMilli": func(t time.Time) int64 { return t.UnixMilli() },
+	}).Parse(promptsHTMLTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt page template: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for web prompts: %w", err)
+	}
+
+	return &WebServer{
+		service:   service,
+		listener:  listener,
+		tlsConfig: tlsConfig,
+		page:      page,
+		logger:    logging.NewLogger("him-web"),
+		logins:    make(map[string]time.Time),
+		browsers:  make(map[string]time.Time),
+	}, nil
+}
+
+// Addr returns the address the server listens on.
+func (w *WebServer) Addr() string {
+	return w.listener.Addr().String()
+}
+
+// Serve serves the prompt page until ctx is done.
+func (w *WebServer) Serve(ctx context.Context) error {
+	server := &http.Server{
+		Handler:           w.Handler(),
+		TLSConfig:         w.tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	w.logger.Info("Serving HIM prompts to the browser", "addr", w.Addr())
+	if err := server.ServeTLS(w.listener, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// LoginURL returns a URL that signs a browser in once, and when it stops
+// working. The CLI prints it for the user to open.
+func (w *WebServer) LoginURL() (string, time.Time, error) {
+	token, err := randomWebToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires := time.Now().Add(webLoginTTL)
+
+	w.mu.Lock()
+	w.pruneLocked(time.Now())
+	w.logins[hashToken(token)] = expires
+	w.mu.Unlock()
+
+	_, port, _ := net.SplitHostPort(w.Addr())
+	u := url.URL{
+		Scheme:   "https",
+		Host:     net.JoinHostPort("localhost", port),
+		Path:     "/login",
+		RawQuery: url.Values{"token": {token}}.Encode(),
+	}
+	return u.String(), expires, nil
+}
+
+// Handler returns the HTTP handler for the prompt page.
+func (w *WebServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /login", w.handleLogin)
+	mux.HandleFunc("GET /{$}", w.requireBrowser(w.handlePage))
+	mux.HandleFunc("GET /prompts.json", w.requireBrowser(w.handlePromptList))
+	mux.HandleFunc("POST /respond", w.requireBrowser(w.handleRespond))
+	mux.HandleFunc("GET /static/prompts.js", staticFile("text/javascript; charset=utf-8", promptsJS))
+	mux.HandleFunc("GET /static/prompts.css", staticFile("text/css; charset=utf-8", promptsCSS))
+	return w.secure(mux)
+}
+
+// secure sets the security headers on every response and rejects requests
+// for any host but this machine, so a DNS rebinding page can't reach it.
+func (w *WebServer) secure(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		header := rw.Header()
+		header.Set("Content-Security-Policy", webContentSecurityPolicy)
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Referrer-Policy", "no-referrer")
+		header.Set("Cache-Control", "no-store")
+
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if host != "localhost" && host != "127.0.0.1" {
+			http.Error(rw, "unknown host", http.StatusMisdirectedRequest)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// requireBrowser admits only browsers signed in with a login URL.
+func (w *WebServer) requireBrowser(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(webCookieName)
+		if err != nil || !w.signedIn(cookie.Value) {
+			http.Error(rw, "Open the one-time link printed by `acm him-web` to use this page.", http.StatusUnauthorized)
+			return
+		}
+		next(rw, r)
+	}
+}
+
+// handleLogin exchanges a one-time login token for a browser cookie.
+func (w *WebServer) handleLogin(rw http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	now := time.Now()
+
+	w.mu.Lock()
+	key := hashToken(token)
+	expires, ok := w.logins[key]
+	delete(w.logins, key)
+	w.mu.Unlock()
+
+	if token == "" || !ok || !now.Before(expires) {
+		http.Error(rw, "This link has expired or was already used. Run `acm him-web` for a new one.", http.StatusForbidden)
+		return
+	}
+
+	cookie, err := randomWebToken()
+	if err != nil {
+		http.Error(rw, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.mu.Lock()
+	w.browsers[hashToken(cookie)] = now.Add(webBrowserTTL)
+	w.mu.Unlock()
+
+	http.SetCookie(rw, &http.Cookie{
+		Name:     webCookieName,
+		Value:    cookie,
+		Path:     "/",
+		MaxAge:   int(webBrowserTTL.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.logger.Info("Browser signed in for HIM prompts")
+	http.Redirect(rw, r, "/", http.StatusSeeOther)
+}
+
+// webPrompt is a session as shown on the page.
+type webPrompt struct {
+	Session   *Session
+	Error     string
+	Confirm   bool
+	Suggested string
+}
+
+// handlePage renders the pending prompts.
+func (w *WebServer) handlePage(rw http.ResponseWriter, r *http.Request) {
+	w.render(rw, r, http.StatusOK, "", "")
+}
+
+// render renders the page, with errMessage shown on sessionID's prompt.
+func (w *WebServer) render(rw http.ResponseWriter, r *http.Request, status int, sessionID, errMessage string) {
+	sessions := w.pendingSessions(r.Context())
+
+	prompts := make([]webPrompt, 0, len(sessions))
+	for _, session := range sessions {
+		prompt := webPrompt{
+			Session:   session,
+			Confirm:   session.InputType == InputConfirmation,
+			Suggested: session.Suggestion,
+		}
+		if session.ID == sessionID {
+			prompt.Error = errMessage
+		}
+		prompts = append(prompts, prompt)
+
+		if err := w.service.MarkPrompted(r.Context(), session.ID); err != nil {
+			w.logger.Warn("Failed to mark HIM session prompted", "session_id", session.ID, "error", err)
+		}
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(status)
+	if err := w.page.Execute(rw, struct{ Prompts []webPrompt }{prompts}); err != nil {
+		w.logger.Warn("Failed to render prompt page", "error", err)
+	}
+}
+
+// handlePromptList lists the pending session IDs, so the page can reload
+// when prompts arrive or go away.
+func (w *WebServer) handlePromptList(rw http.ResponseWriter, r *http.Request) {
+	ids := []string{}
+	for _, session := range w.pendingSessions(r.Context()) {
+		ids = append(ids, session.ID)
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(map[string][]string{"sessions": ids})
+}
+
+// handleRespond submits or cancels a prompt. The form's csrf_token is the
+// session's SecurityToken.
+func (w *WebServer) handleRespond(rw http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); origin != "" && origin != "https://"+r.Host {
+		http.Error(rw, "cross-origin request rejected", http.StatusForbidden)
+		return
+	}
+	r.Body = http.MaxBytesReader(rw, r.Body, maxWebFormSize)
+	if err := r.ParseForm(); err != nil {
+		http.Error(rw, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	sessionID := r.PostForm.Get("session_id")
+	token := r.PostForm.Get("csrf_token")
+
+	session, err := w.service.GetSession(ctx, sessionID)
+	if err != nil || session.Type == HIMApproval {
+		w.render(rw, r, http.StatusNotFound, "", "")
+		return
+	}
+
+	if r.PostForm.Get("action") == "cancel" {
+		// CancelSession takes no token, so check it here
+		if subtle.ConstantTimeCompare([]byte(token), []byte(session.SecurityToken)) != 1 {
+			w.render(rw, r, http.StatusForbidden, sessionID, "This page is out of date; reload and try again.")
+			return
+		}
+		if err := w.service.CancelSession(ctx, sessionID); err != nil {
+			w.render(rw, r, http.StatusConflict, sessionID, err.Error())
+			return
+		}
+		w.logger.Info("HIM session cancelled from browser", "session_id", sessionID)
+		http.Redirect(rw, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	// Never log the response data itself
+	err = w.service.SubmitResponse(ctx, sessionID, Response{
+		SessionID:     sessionID,
+		SecurityToken: token,
+		Data:          ResponseData{TextInput: r.PostForm.Get("response")},
+		Timestamp:     time.Now(),
+	})
+	if err != nil {
+		w.logger.Warn("HIM response from browser rejected", "session_id", sessionID, "error", err)
+		w.render(rw, r, http.StatusUnprocessableEntity, sessionID, webErrorMessage(err))
+		return
+	}
+	w.logger.Info("HIM response accepted from browser", "session_id", sessionID)
+	http.Redirect(rw, r, "/", http.StatusSeeOther)
+}
+
+// pendingSessions returns the active sessions the page shows, oldest first.
+func (w *WebServer) pendingSessions(ctx context.Context) []*Session {
+	active, _ := w.service.ListActiveSessions(ctx)
+	sessions := active[:0]
+	for _, session := range active {
+		if session.Type != HIMApproval {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions
+}
+
+// signedIn reports whether cookie belongs to a signed-in browser.
+func (w *WebServer) signedIn(cookie string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	expires, ok := w.browsers[hashToken(cookie)]
+	return ok && time.Now().Before(expires)
+}
+
+// pruneLocked forgets expired logins and browsers. w.mu must be held.
+func (w *WebServer) pruneLocked(now time.Time) {
+	for key, expires := range w.logins {
+		if !now.Before(expires) {
+			delete(w.logins, key)
+		}
+	}
+	for key, expires := range w.browsers {
+		if !now.Before(expires) {
+			delete(w.browsers, key)
+		}
+	}
+}
+
+// webErrorMessage explains a rejected response to the user.
+func webErrorMessage(err error) string {
+	var herr *HIMError
+	if !errors.As(err, &herr) {
+		return "The response could not be submitted."
+	}
+	switch herr.Code {
+	case ErrInvalidToken:
+		return "This page is out of date; reload and try again."
+	case ErrInvalidInput:
+		if herr.Cause != nil {
+			return herr.Cause.Error()
+		}
+	}
+	return herr.Message
+}
+
+func staticFile(contentType string, data []byte) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", contentType)
+		rw.Write(data)
+	}
+}
+
+func randomWebToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
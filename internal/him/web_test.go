@@ -0,0 +1,210 @@
+package him
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestWebServer(t *testing.T) (*WebServer, *Service) {
+	t.Helper()
+	service := NewService(time.Minute)
+	t.Cleanup(service.Close)
+
+	web, err := NewWebServer(service, "127.0.0.1:0", &tls.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create web server: %v", err)
+	}
+	t.Cleanup(func() { web.listener.Close() })
+	return web, service
+}
+
+// webRequest sends a request through the handler as a browser on localhost.
+func webRequest(web *WebServer, method, target string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	var body *strings.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	} else {
+		body = strings.NewReader("")
+	}
+	req := httptest.NewRequest(method, "https://localhost:8444"+target, body)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	web.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+// signIn redeems a login URL and returns the browser cookie.
+func signIn(t *testing.T, web *WebServer) *http.Cookie {
+	t.Helper()
+	loginURL, _, err := web.LoginURL()
+	if err != nil {
+		t.Fatalf("Failed to get login URL: %v", err)
+	}
+	u, _ := url.Parse(loginURL)
+	rec := webRequest(web, http.MethodGet, u.RequestURI(), nil, nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected redirect after login, got %d", rec.Code)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].Secure || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("Unexpected login cookie: %+v", cookies)
+	}
+	return cookies[0]
+}
+
+// TestWebServerLoopbackOnly tests that the page only listens on 127.0.0.1
+func TestWebServerLoopbackOnly(t *testing.T) {
+	service := NewService(time.Minute)
+	defer service.Close()
+
+	for _, addr := range []string{"0.0.0.0:0", ":0", "localhost:0", "192.168.1.10:0"} {
+		if _, err := NewWebServer(service, addr, &tls.Config{}); err == nil {
+			t.Errorf("Expected %s to be rejected", addr)
+		}
+	}
+}
+
+// TestWebServerLogin tests that login URLs work once and are required
+func TestWebServerLogin(t *testing.T) {
+	web, _ := newTestWebServer(t)
+
+	if rec := webRequest(web, http.MethodGet, "/", nil, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without login, got %d", rec.Code)
+	}
+
+	loginURL, _, _ := web.LoginURL()
+	if !strings.HasPrefix(loginURL, "https://localhost:") {
+		t.Errorf("Unexpected login URL %s", loginURL)
+	}
+	u, _ := url.Parse(loginURL)
+	if rec := webRequest(web, http.MethodGet, u.RequestURI(), nil, nil); rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected login to succeed, got %d", rec.Code)
+	}
+	if rec := webRequest(web, http.MethodGet, u.RequestURI(), nil, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected reused login URL to be rejected, got %d", rec.Code)
+	}
+
+	cookie := signIn(t, web)
+	rec := webRequest(web, http.MethodGet, "/", nil, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected page, got %d", rec.Code)
+	}
+	csp := rec.Header().Get("Content-Security-Policy")
+	if !strings.Contains(csp, "default-src 'none'") || !strings.Contains(csp, "frame-ancestors 'none'") {
+		t.Errorf("Expected strict CSP, got %q", csp)
+	}
+
+	if rec := webRequest(web, http.MethodGet, "/", nil, &http.Cookie{Name: webCookieName, Value: "forged"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected forged cookie to be rejected, got %d", rec.Code)
+	}
+}
+
+// TestWebServerRejectsOtherHosts tests the DNS rebinding guard
+func TestWebServerRejectsOtherHosts(t *testing.T) {
+	web, _ := newTestWebServer(t)
+	cookie := signIn(t, web)
+
+	req := httptest.NewRequest(http.MethodGet, "https://attacker.example:8444/", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	web.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusMisdirectedRequest {
+		t.Errorf("Expected foreign host to be rejected, got %d", rec.Code)
+	}
+}
+
+// TestWebServerRespond tests answering and cancelling prompts from the page
+func TestWebServerRespond(t *testing.T) {
+	web, service := newTestWebServer(t)
+	cookie := signIn(t, web)
+	ctx := context.Background()
+
+	totp, _ := service.CreateSession(ctx, SessionRequest{Type: HIMTOTP, Site: "github.com", Prompt: "Enter the code from your app"})
+	manual, _ := service.CreateSession(ctx, SessionRequest{Type: HIMManualRotation, Site: "bank.com", Prompt: "Change your password"})
+	approval, _ := service.CreateSession(ctx, SessionRequest{Type: HIMApproval, Site: "shared.com", Prompt: "Approve rotation", Approval: &ApprovalRequirement{Required: 1}})
+
+	page := webRequest(web, http.MethodGet, "/", nil, cookie).Body.String()
+	if !strings.Contains(page, "Enter the code from your app") || !strings.Contains(page, totp.SecurityToken) {
+		t.Error("Expected the TOTP prompt and its token on the page")
+	}
+	if strings.Contains(page, approval.ID) {
+		t.Error("Approval requests must not be shown")
+	}
+	if strings.Contains(page, "<script>") {
+		t.Error("Page must not contain inline script")
+	}
+
+	// Without the session's token the response is rejected
+	rec := webRequest(web, http.MethodPost, "/respond", url.Values{
+		"session_id": {totp.ID},
+		"csrf_token": {"wrong"},
+		"response":   {"123456"},
+	}, cookie)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected wrong token to be rejected, got %d", rec.Code)
+	}
+
+	// A cross-origin post is rejected even with the token
+	form := url.Values{"session_id": {totp.ID}, "csrf_token": {totp.SecurityToken}, "response": {"123456"}}
+	req := httptest.NewRequest(http.MethodPost, "https://localhost:8444/respond", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", "https://evil.example")
+	req.AddCookie(cookie)
+	cross := httptest.NewRecorder()
+	web.Handler().ServeHTTP(cross, req)
+	if cross.Code != http.StatusForbidden {
+		t.Errorf("Expected cross-origin post to be rejected, got %d", cross.Code)
+	}
+
+	// Malformed input is explained on the page
+	rec = webRequest(web, http.MethodPost, "/respond", url.Values{
+		"session_id": {totp.ID},
+		"csrf_token": {totp.SecurityToken},
+		"response":   {"12ab"},
+	}, cookie)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "digits") {
+		t.Errorf("Expected validation error on the page, got %d", rec.Code)
+	}
+
+	rec = webRequest(web, http.MethodPost, "/respond", form, cookie)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected response to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+	response, err := service.WaitForResponse(ctx, totp.ID)
+	if err != nil || response.Data.TextInput != "123456" {
+		t.Errorf("Unexpected response: %+v (%v)", response, err)
+	}
+
+	rec = webRequest(web, http.MethodPost, "/respond", url.Values{
+		"session_id": {manual.ID},
+		"csrf_token": {manual.SecurityToken},
+		"action":     {"cancel"},
+	}, cookie)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected cancel to succeed, got %d", rec.Code)
+	}
+	if current, _ := service.GetSession(ctx, manual.ID); current.State != StateCancelled {
+		t.Errorf("Expected cancelled session, got %s", current.State)
+	}
+
+	// Approvals can't be answered from the page
+	rec = webRequest(web, http.MethodPost, "/respond", url.Values{
+		"session_id": {approval.ID},
+		"csrf_token": {approval.SecurityToken},
+		"response":   {"yes"},
+	}, cookie)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected approval response to be refused, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,74 @@
+// Package nativemsg implements the native messaging protocol browsers use
+// to talk to a native host: each message is a JSON document preceded by its
+// length as a 32-bit unsigned integer in native byte order, on the host's
+// stdin and stdout.
+//
+// Chrome and Firefox both limit messages sent to the browser to 1 MB;
+// messages from the browser are limited here to the same size, which is far
+// more than any ACM request needs.
+package nativemsg
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxMessageSize is the largest message read or written.
+const MaxMessageSize = 1 << 20
+
+// ErrMessageTooLarge indicates a message exceeded MaxMessageSize.
+var ErrMessageTooLarge = errors.New("native message exceeds 1 MB")
+
+// ErrMalformedMessage indicates a complete message that isn't valid JSON for
+// the value it was decoded into. The message has been consumed, so the next
+// Read starts at the following message.
+var ErrMalformedMessage = errors.New("malformed native message")
+
+// Read reads one message from r and decodes it into v. It returns io.EOF
+// when the browser closed the connection between messages, and an error
+// wrapping ErrMalformedMessage when the message was read but can't be
+// decoded. Any other error leaves r at an unknown position.
+func Read(r io.Reader, v interface{}) error {
+	var size uint32
+	if err := binary.Read(r, binary.NativeEndian, &size); err != nil {
+		if err == io.EOF {
+			return io.EOF
+		}
+		return fmt.Errorf("failed to read message length: %w", err)
+	}
+	if size > MaxMessageSize {
+		return ErrMessageTooLarge
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return fmt.Errorf("failed to read message: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedMessage, err)
+	}
+	return nil
+}
+
+// Write encodes v and writes it to w as one message.
+func Write(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	if len(data) > MaxMessageSize {
+		return ErrMessageTooLarge
+	}
+
+	// One write, so a message is never interleaved with another
+	buf := make([]byte, 4+len(data))
+	binary.NativeEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package nativemsg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+type message struct {
+	Type   string `json:"type"`
+	Origin string `json:"origin"`
+}
+
+// TestRoundTrip tests writing and reading several messages
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	sent := []message{{"list_prompts", "https://github.com"}, {"ping", ""}}
+	for _, m := range sent {
+		if err := Write(&buf, m); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	size := binary.NativeEndian.Uint32(buf.Bytes()[:4])
+	if int(size) != len(`{"type":"list_prompts","origin":"https://github.com"}`) {
+		t.Errorf("Unexpected length prefix %d", size)
+	}
+
+	for _, want := range sent {
+		var got message
+		if err := Read(&buf, &got); err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		if got != want {
+			t.Errorf("Expected %+v, got %+v", want, got)
+		}
+	}
+
+	var m message
+	if err := Read(&buf, &m); err != io.EOF {
+		t.Errorf("Expected io.EOF at end of input, got %v", err)
+	}
+}
+
+// TestReadAfterMalformed tests that reading resumes after a malformed message
+func TestReadAfterMalformed(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.NativeEndian, uint32(4))
+	buf.WriteString("nope")
+	if err := Write(&buf, message{Type: "ping"}); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	var m message
+	if err := Read(&buf, &m); !errors.Is(err, ErrMalformedMessage) {
+		t.Fatalf("Expected ErrMalformedMessage, got %v", err)
+	}
+	if err := Read(&buf, &m); err != nil || m.Type != "ping" {
+		t.Errorf("Expected the next message, got %+v (%v)", m, err)
+	}
+}
+
+// TestReadRejectsBadInput tests oversized, truncated and malformed messages
+func TestReadRejectsBadInput(t *testing.T) {
+	frame := func(size uint32, body string) *bytes.Buffer {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.NativeEndian, size)
+		buf.WriteString(body)
+		return &buf
+	}
+
+	var m message
+	if err := Read(frame(MaxMessageSize+1, ""), &m); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("Expected ErrMessageTooLarge, got %v", err)
+	}
+	if err := Read(frame(10, `{"ty`), &m); err == nil || err == io.EOF {
+		t.Errorf("Expected error for truncated message, got %v", err)
+	}
+	if err := Read(frame(4, `nope`), &m); !errors.Is(err, ErrMalformedMessage) {
+		t.Errorf("Expected ErrMalformedMessage, got %v", err)
+	}
+	if err := Read(frame(10, `{"ty`), &m); errors.Is(err, ErrMalformedMessage) {
+		t.Error("Expected a truncated message not to be reported as malformed")
+	}
+	if err := Read(bytes.NewReader([]byte{1, 0}), &m); err == nil || err == io.EOF {
+		t.Errorf("Expected error for truncated length, got %v", err)
+	}
+}
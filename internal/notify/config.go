@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Config is the on-disk notification configuration.
+type Config struct {
+	Sinks []SinkConfig `json:"sinks"`
+}
+
+// SinkConfig configures one sink and its routing. Only the fields for the
+// sink's Type are used.
+type SinkConfig struct {
+	Name     string         `json:"name"`
+	Type     string         `json:"type"`
+	Rule     Rule           `json:"rule"`
+	Throttle ThrottleConfig `json:"throttle"`
+
+	// command
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+
+	// webhook
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// smtp
+	Addr string   `json:"addr,omitempty"`
+	From string   `json:"from,omitempty"`
+	To   []string `json:"to,omitempty"`
+
+	// file
+	Dir string `json:"dir,omitempty"`
+}
+
+// ThrottleConfig is the JSON form of Throttle, with a duration string
+// such as "30s" or "5m".
+type ThrottleConfig struct {
+	Interval string `json:"interval,omitempty"`
+	Burst    int    `json:"burst,omitempty"`
+}
+
+// LoadConfig reads a notification configuration file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification config: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse notification config: %w", err)
+	}
+	return &config, nil
+}
+
+// Routes builds the sinks described by the configuration. On error, any
+// sinks already created are closed.
+func (c *Config) Routes() ([]Route, error) {
+	var routes []Route
+	for i, sc := range c.Sinks {
+		route, err := sc.route()
+		if err != nil {
+			for _, r := range routes {
+				r.Sink.Close()
+			}
+			name := sc.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return nil, fmt.Errorf("sink %s: %w", name, err)
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func (sc SinkConfig) route() (Route, error) {
+	var throttle Throttle
+	if sc.Throttle.Interval != "" {
+		interval, err := time.ParseDuration(sc.Throttle.Interval)
+		if err != nil {
+			return Route{}, fmt.Errorf("invalid throttle interval: %w", err)
+		}
+		throttle = Throttle{Interval: interval, Burst: sc.Throttle.Burst}
+	}
+
+	switch sc.Rule.MinSeverity {
+	case "", SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return Route{}, fmt.Errorf("unknown severity: %s", sc.Rule.MinSeverity)
+	}
+
+	name := sc.Name
+	if name == "" {
+		name = sc.Type
+	}
+
+	var sink Sink
+	var err error
+	switch sc.Type {
+	case "command":
+		sink, err = NewCommandSink(name, sc.Command, sc.Args)
+	case "webhook":
+		sink, err = NewWebhookSink(name, sc.URL, sc.Headers)
+	case "smtp":
+		sink, err = NewSMTPSink(name, sc.Addr, sc.From, sc.To)
+	case "file":
+		sink, err = NewFileSink(name, sc.Dir)
+	default:
+		return Route{}, fmt.Errorf("unknown sink type: %q", sc.Type)
+	}
+	if err != nil {
+		return Route{}, err
+	}
+
+	return Route{Sink: sink, Rule: sc.Rule, Throttle: throttle}, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,52 @@
+// Package notify dispatches security notifications to configured sinks.
+//
+// ACM raises notifications when something needs attention: a breach is
+// detected, a rotation fails, or a Human-in-the-Middle (HIM) prompt is
+// waiting for input. A Dispatcher subscribes to the audit log and to HIM
+// session creation, and routes each Notification to every sink whose rule
+// matches it.
+//
+// # Sinks
+//
+//   - command: runs a local program (e.g. notify-send) without a shell;
+//     the notification JSON is written to its stdin
+//   - webhook: POSTs the notification as JSON to a URL
+//   - smtp: sends a plain-text email through a local relay
+//   - file: drops one JSON file per notification into a directory
+//
+// # Filtering and Throttling
+//
+// Each route has a Rule (minimum severity, kinds, event types, sites and
+// statuses) and an optional Throttle that limits how many notifications a
+// sink receives per interval. Notifications dropped by the throttle are
+// counted and reported with the next one delivered.
+//
+// # Redaction
+//
+// Titles, messages and fields are passed through logging.RedactString
+// before they reach any sink. Usernames and HIM security tokens are never
+// included.
+//
+// # Configuration
+//
+// Routes are loaded from a JSON file:
+//
+//	{
+//	  "sinks": [
+//	    {
+//	      "name": "desktop",
+//	      "type": "command",
+//	      "command": "notify-send",
+//	      "args": ["{title}", "{message}"],
+//	      "rule": {"min_severity": "warning"},
+//	      "throttle": {"interval": "1m", "burst": 3}
+//	    },
+//	    {
+//	      "name": "ops",
+//	      "type": "webhook",
+//	      "url": "https://hooks.example.com/acm",
+//	      "rule": {"kinds": ["audit"], "event_types": ["detection"]}
+//	    }
+//	  ]
+//	}
+package notify
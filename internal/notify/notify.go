@@ -0,0 +1,364 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/him"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/logging"
+)
+
+// Kind identifies the source of a notification.
+type Kind string
+
+const (
+	// KindAudit is a notification raised from an audit event.
+	KindAudit Kind = "audit"
+
+	// KindHIMPrompt is a notification that a HIM prompt awaits input.
+	KindHIMPrompt Kind = "him_prompt"
+)
+
+// Severity ranks how urgently a notification needs attention.
+type Severity string
+
+const (
+	// SeverityInfo is routine activity.
+	SeverityInfo Severity = "info"
+
+	// SeverityWarning needs attention (failures, pending prompts).
+	SeverityWarning Severity = "warning"
+
+	// SeverityCritical needs immediate attention (breach detected).
+	SeverityCritical Severity = "critical"
+)
+
+// rank orders severities for MinSeverity comparisons.
+func (s Severity) rank() int {
+	switch s {
+	case SeverityCritical:
+		return 2
+	case SeverityWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Notification is a single message delivered to sinks.
+type Notification struct {
+	ID        string            `json:"id"`
+	Kind      Kind              `json:"kind"`
+	Severity  Severity          `json:"severity"`
+	Title     string            `json:"title"`
+	Message   string            `json:"message"`
+	Site      string            `json:"site,omitempty"`
+	EventType string            `json:"event_type,omitempty"`
+	Status    string            `json:"status,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+// Sink delivers notifications to one destination.
+type Sink interface {
+	// Name identifies the sink in logs.
+	Name() string
+
+	// Send delivers a notification.
+	Send(ctx context.Context, n Notification) error
+
+	// Close releases any resources held by the sink.
+	Close() error
+}
+
+// Rule selects which notifications a sink receives. Empty lists match
+// everything.
+type Rule struct {
+	MinSeverity Severity `json:"min_severity,omitempty"`
+	Kinds       []Kind   `json:"kinds,omitempty"`
+	EventTypes  []string `json:"event_types,omitempty"`
+	Sites       []string `json:"sites,omitempty"`
+	Statuses    []string `json:"statuses,omitempty"`
+}
+
+// Matches reports whether n passes the rule.
+func (r Rule) Matches(n Notification) bool {
+	if n.Severity.rank() < r.MinSeverity.rank() {
+		return false
+	}
+	if len(r.Kinds) > 0 && !contains(r.Kinds, n.Kind) {
+		return false
+	}
+	if len(r.EventTypes) > 0 && !contains(r.EventTypes, n.EventType) {
+		return false
+	}
+	if len(r.Statuses) > 0 && !contains(r.Statuses, n.Status) {
+		return false
+	}
+	if len(r.Sites) > 0 {
+		matched := false
+		for _, site := range r.Sites {
+			if audit.NormalizeSite(site) == audit.NormalizeSite(n.Site) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Throttle limits a sink to Burst notifications per Interval. A zero
+// Interval disables throttling.
+type Throttle struct {
+	Interval time.Duration
+	Burst    int
+}
+
+// Route connects a sink to the notifications it should receive.
+type Route struct {
+	Sink     Sink
+	Rule     Rule
+	Throttle Throttle
+}
+
+// route is a Route with its throttle state.
+type route struct {
+	Route
+
+	mu          sync.Mutex
+	windowStart time.Time
+	sent        int
+	suppressed  int
+}
+
+// allow applies the throttle and returns how many notifications were
+// suppressed since the last one allowed.
+func (r *route) allow(now time.Time) (bool, int) {
+	if r.Throttle.Interval <= 0 {
+		return true, 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	burst := r.Throttle.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+
+	if now.Sub(r.windowStart) >= r.Throttle.Interval {
+		r.windowStart = now
+		r.sent = 0
+	}
+	if r.sent >= burst {
+		r.suppressed++
+		return false, 0
+	}
+
+	r.sent++
+	suppressed := r.suppressed
+	r.suppressed = 0
+	return true, suppressed
+}
+
+// Dispatcher routes notifications to sinks.
+type Dispatcher struct {
+	routes    []*route
+	redaction logging.RedactionConfig
+	log       *logging.Logger
+	now       func() time.Time
+}
+
+// NewDispatcher creates a dispatcher for routes.
+func NewDispatcher(routes []Route) *Dispatcher {
+	d := &Dispatcher{
+		redaction: logging.DefaultRedactionConfig(),
+		log:       logging.NewLogger("notify"),
+		now:       time.Now,
+	}
+	for _, r := range routes {
+		d.routes = append(d.routes, &route{Route: r})
+	}
+	return d
+}
+
+// Dispatch redacts n and sends it to every matching sink. Sink failures are
+// logged and returned together; one failing sink does not stop the others.
+func (d *Dispatcher) Dispatch(ctx context.Context, n Notification) error {
+	n = d.redact(n)
+
+	var errs []error
+	for _, r := range d.routes {
+		if !r.Rule.Matches(n) {
+			continue
+		}
+
+		ok, suppressed := r.allow(d.now())
+		if !ok {
+			continue
+		}
+
+		delivered := n
+		if suppressed > 0 {
+			delivered.Fields = make(map[string]string, len(n.Fields)+1)
+			for k, v := range n.Fields {
+				delivered.Fields[k] = v
+			}
+			delivered.Fields["suppressed"] = fmt.Sprint(suppressed)
+		}
+
+		if err := r.Sink.Send(ctx, delivered); err != nil {
+			d.log.Warn("Failed to send notification", "sink", r.Sink.Name(), "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", r.Sink.Name(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// WatchAudit dispatches a notification for every audit event logged until
+// ctx is cancelled. A subscription that falls behind is resumed from the
+// last event delivered.
+func (d *Dispatcher) WatchAudit(ctx context.Context, watcher audit.Watcher) error {
+	var opts audit.SubscribeOptions
+
+	for {
+		sub, err := watcher.Subscribe(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to audit events: %w", err)
+		}
+
+		for delivery := range sub.Events() {
+			d.Dispatch(ctx, FromAuditEvent(delivery.Event))
+		}
+
+		err = sub.Err()
+		if last := sub.LastEventID(); last != "" {
+			opts.FromEventID = last
+		}
+		sub.Close()
+
+		if !errors.Is(err, audit.ErrSubscriberLagged) {
+			return err
+		}
+		d.log.Warn("Notification subscriber fell behind, resuming", "from_event", opts.FromEventID)
+	}
+}
+
+// NotifyHIMSession dispatches a notification that session awaits input.
+// It matches the him.Service session listener signature.
+func (d *Dispatcher) NotifyHIMSession(session him.Session) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	d.Dispatch(ctx, FromHIMSession(session))
+}
+
+// Close closes every sink.
+func (d *Dispatcher) Close() error {
+	var errs []error
+	for _, r := range d.routes {
+		if err := r.Sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// redact removes secrets from the free-text parts of n.
+func (d *Dispatcher) redact(n Notification) Notification {
+	n.Title = logging.RedactString(n.Title, d.redaction)
+	n.Message = logging.RedactString(n.Message, d.redaction)
+	if len(n.Fields) > 0 {
+		fields := make(map[string]string, len(n.Fields))
+		for k, v := range n.Fields {
+			fields[k] = logging.RedactString(v, d.redaction)
+		}
+		n.Fields = fields
+	}
+	return n
+}
+
+// FromAuditEvent converts an audit event to a notification. Breach
+// detections are critical, failures and HIM events are warnings.
+func FromAuditEvent(event audit.Event) Notification {
+	severity := SeverityInfo
+	switch {
+	case event.Type == audit.EventTypeDetection:
+		severity = SeverityCritical
+	case event.Status == audit.StatusFailure, event.Type == audit.EventTypeHIM:
+		severity = SeverityWarning
+	}
+
+	title := fmt.Sprintf("ACM %s %s", event.Type, event.Status)
+	if event.Site != "" {
+		title += ": " + event.Site
+	}
+
+	n := Notification{
+		ID:        event.ID,
+		Kind:      KindAudit,
+		Severity:  severity,
+		Title:     title,
+		Message:   event.Message,
+		Site:      event.Site,
+		EventType: string(event.Type),
+		Status:    string(event.Status),
+		Timestamp: event.Timestamp,
+	}
+	if event.CredentialID != "" || event.Metadata["action"] != "" {
+		n.Fields = map[string]string{}
+		if event.CredentialID != "" {
+			n.Fields["credential_id"] = event.CredentialID
+		}
+		if action := event.Metadata["action"]; action != "" {
+			n.Fields["action"] = action
+		}
+	}
+	return n
+}
+
+// FromHIMSession converts a new HIM session to a notification. The
+// session's security token is never included.
+func FromHIMSession(session him.Session) Notification {
+	title := "ACM needs your input"
+	if session.Escalated {
+		title = "ACM approval escalated"
+	}
+	if session.Site != "" {
+		title += ": " + session.Site
+	}
+
+	return Notification{
+		ID:        session.ID,
+		Kind:      KindHIMPrompt,
+		Severity:  SeverityWarning,
+		Title:     title,
+		Message:   session.Prompt,
+		Site:      session.Site,
+		EventType: string(session.Type),
+		Status:    string(session.State),
+		Timestamp: session.CreatedAt,
+		Fields: map[string]string{
+			"session_id": session.ID,
+			"him_type":   string(session.Type),
+			"expires_at": session.ExpiresAt.UTC().Format(time.RFC3339),
+		},
+	}
+}
+
+func contains[T ~string](values []T, v T) bool {
+	for _, value := range values {
+		if strings.EqualFold(string(value), string(v)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,299 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultSinkTimeout bounds a single delivery.
+const defaultSinkTimeout = 10 * time.Second
+
+// CommandSink runs a local program for each notification. Arguments may
+// contain the placeholders {title}, {message}, {severity}, {site}, {kind}
+// and {event_type}. The program is executed directly, never through a
+// shell, and receives the notification JSON on stdin.
+type CommandSink struct {
+	name    string
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+// NewCommandSink creates a command sink.
+func NewCommandSink(name, command string, args []string) (*CommandSink, error) {
+	if command == "" {
+		return nil, fmt.Errorf("command is required")
+	}
+	return &CommandSink{name: name, command: command, args: args, timeout: defaultSinkTimeout}, nil
+}
+
+// Name returns the sink name.
+func (s *CommandSink) Name() string { return s.name }
+
+// Send runs the command.
+func (s *CommandSink) Send(ctx context.Context, n Notification) error {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	replacer := strings.NewReplacer(
+		"{title}", n.Title,
+		"{message}", n.Message,
+		"{severity}", string(n.Severity),
+		"{site}", n.Site,
+		"{kind}", string(n.Kind),
+		"{event_type}", n.EventType,
+	)
+	args := make([]string, len(s.args))
+	for i, arg := range s.args {
+		args[i] = replacer.Replace(arg)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.command, args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("command failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Close is a no-op.
+func (s *CommandSink) Close() error { return nil }
+
+// WebhookSink POSTs each notification as JSON to a URL.
+type WebhookSink struct {
+	name    string
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewWebhookSink creates a webhook sink. headers are added to every request
+// (e.g. an Authorization header for the receiver).
+func NewWebhookSink(name, url string, headers map[string]string) (*WebhookSink, error) {
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return nil, fmt.Errorf("webhook URL must be http or https: %s", url)
+	}
+	return &WebhookSink{
+		name:    name,
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: defaultSinkTimeout},
+	}, nil
+}
+
+// Name returns the sink name.
+func (s *WebhookSink) Name() string { return s.name }
+
+// Send posts the notification.
+func (s *WebhookSink) Send(ctx context.Context, n Notification) error {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "acm-notify/1")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close releases idle connections.
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// SMTPSink emails each notification through an SMTP relay. It is intended
+// for a local relay and does not authenticate.
+type SMTPSink struct {
+	name string
+	addr string
+	from string
+	to   []string
+}
+
+// NewSMTPSink creates an SMTP sink sending from one address to recipients
+// via the relay at addr (host:port).
+func NewSMTPSink(name, addr, from string, to []string) (*SMTPSink, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid SMTP address %q: %w", addr, err)
+	}
+	if from == "" || len(to) == 0 {
+		return nil, fmt.Errorf("SMTP sender and recipients are required")
+	}
+	for _, addr := range append([]string{from}, to...) {
+		if strings.ContainsAny(addr, "\r\n") {
+			return nil, fmt.Errorf("invalid email address %q", addr)
+		}
+	}
+	return &SMTPSink{name: name, addr: addr, from: from, to: to}, nil
+}
+
+// Name returns the sink name.
+func (s *SMTPSink) Name() string { return s.name }
+
+// Send delivers the notification as a plain-text email.
+func (s *SMTPSink) Send(ctx context.Context, n Notification) error {
+	dialer := net.Dialer{Timeout: defaultSinkTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP relay: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(defaultSinkTimeout))
+
+	host, _, _ := net.SplitHostPort(s.addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if err := client.Mail(s.from); err != nil {
+		return fmt.Errorf("SMTP MAIL failed: %w", err)
+	}
+	for _, rcpt := range s.to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("SMTP RCPT %s failed: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(s.message(n)); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP message rejected: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// message renders n as an RFC 5322 message.
+func (s *SMTPSink) message(n Notification) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&buf, "Subject: [%s] %s\r\n", strings.ToUpper(string(n.Severity)), headerSafe(n.Title))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+
+	fmt.Fprintf(&buf, "%s\r\n\r\n", n.Message)
+	fmt.Fprintf(&buf, "Severity:   %s\r\n", n.Severity)
+	fmt.Fprintf(&buf, "Kind:       %s\r\n", n.Kind)
+	if n.Site != "" {
+		fmt.Fprintf(&buf, "Site:       %s\r\n", n.Site)
+	}
+	if n.EventType != "" {
+		fmt.Fprintf(&buf, "Event type: %s\r\n", n.EventType)
+	}
+	if n.Status != "" {
+		fmt.Fprintf(&buf, "Status:     %s\r\n", n.Status)
+	}
+	fmt.Fprintf(&buf, "Time:       %s\r\n", n.Timestamp.UTC().Format(time.RFC3339))
+	for _, k := range sortedKeys(n.Fields) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, n.Fields[k])
+	}
+	return buf.Bytes()
+}
+
+// Close is a no-op; a connection is opened per message.
+func (s *SMTPSink) Close() error { return nil }
+
+// FileSink writes each notification as a JSON file in a directory, for
+// pickup by other tools.
+type FileSink struct {
+	name string
+	dir  string
+}
+
+// NewFileSink creates a file sink, creating dir if needed.
+func NewFileSink(name, dir string) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create notification directory: %w", err)
+	}
+	return &FileSink{name: name, dir: dir}, nil
+}
+
+// Name returns the sink name.
+func (s *FileSink) Name() string { return s.name }
+
+// Send writes the notification atomically; readers never see a partial file.
+func (s *FileSink) Send(ctx context.Context, n Notification) error {
+	payload, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := fmt.Sprintf("%s-%s.json", n.Timestamp.UTC().Format("20060102T150405.000000000Z"), hex.EncodeToString(suffix))
+
+	tmp, err := os.CreateTemp(s.dir, ".notify-*")
+	if err != nil {
+		return fmt.Errorf("failed to create notification file: %w", err)
+	}
+	if _, err := tmp.Write(payload); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write notification: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write notification: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to publish notification: %w", err)
+	}
+	return nil
+}
+
+// Close is a no-op.
+func (s *FileSink) Close() error { return nil }
+
+// headerSafe strips line breaks so a value cannot inject mail headers.
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,240 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testNotification() Notification {
+	return Notification{
+		ID:        "evt-1",
+		Kind:      KindAudit,
+		Severity:  SeverityCritical,
+		Title:     "ACM detection success: github.com",
+		Message:   "Credential found in breach",
+		Site:      "github.com",
+		EventType: "detection",
+		Timestamp: time.Now(),
+	}
+}
+
+// TestWebhookSink tests JSON delivery and error statuses
+func TestWebhookSink(t *testing.T) {
+	var got Notification
+	var auth string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink("hook", server.URL, map[string]string{"Authorization": "Bearer test"})
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Send(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if got.ID != "evt-1" || got.Severity != SeverityCritical || auth != "Bearer test" {
+		t.Errorf("Unexpected request: %+v (auth %q)", got, auth)
+	}
+
+	status = http.StatusInternalServerError
+	if err := sink.Send(context.Background(), testNotification()); err == nil {
+		t.Error("Expected error for 500 response")
+	}
+
+	if _, err := NewWebhookSink("bad", "ftp://example.com", nil); err == nil {
+		t.Error("Expected error for non-HTTP URL")
+	}
+}
+
+// TestFileSink tests that each notification becomes a JSON file
+func TestFileSink(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "drop")
+	sink, err := NewFileSink("drop", dir)
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := sink.Send(context.Background(), testNotification()); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files, got %d", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	var got Notification
+	if err := json.Unmarshal(data, &got); err != nil || got.Title != testNotification().Title {
+		t.Errorf("Unexpected file content: %s", data)
+	}
+}
+
+// TestCommandSink tests placeholder expansion and JSON on stdin
+func TestCommandSink(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	sink, err := NewCommandSink("cmd", "sh", []string{"-c", `printf '%s|' "$1" > "$2"; cat >> "$2"`, "sh", "{severity}:{site}", out})
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+
+	if err := sink.Send(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	prefix, payload, _ := strings.Cut(string(data), "|")
+	if prefix != "critical:github.com" {
+		t.Errorf("Unexpected argument: %q", prefix)
+	}
+	if !strings.Contains(payload, `"id":"evt-1"`) {
+		t.Errorf("Expected notification JSON on stdin, got %q", payload)
+	}
+
+	failing, _ := NewCommandSink("fail", "sh", []string{"-c", "exit 3"})
+	if err := failing.Send(context.Background(), testNotification()); err == nil {
+		t.Error("Expected error for failing command")
+	}
+}
+
+// TestSMTPSink tests delivery to a minimal SMTP relay
+func TestSMTPSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go serveSMTP(listener, received)
+
+	sink, err := NewSMTPSink("mail", listener.Addr().String(), "acm@localhost", []string{"me@localhost"})
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+
+	if err := sink.Send(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if !strings.Contains(msg, "Subject: [CRITICAL] ACM detection success: github.com") {
+			t.Errorf("Missing subject in message:\n%s", msg)
+		}
+		if !strings.Contains(msg, "Credential found in breach") {
+			t.Errorf("Missing body in message:\n%s", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for message")
+	}
+
+	if _, err := NewSMTPSink("bad", "localhost:25", "acm@localhost\r\nBcc: x", []string{"me@localhost"}); err == nil {
+		t.Error("Expected error for header injection in address")
+	}
+}
+
+// serveSMTP accepts one connection and records the message data.
+func serveSMTP(listener net.Listener, received chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 localhost ESMTP test")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			var msg strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				msg.WriteString(line)
+			}
+			received <- msg.String()
+			reply("250 queued")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// TestConfigRoutes tests building routes from a JSON configuration
+func TestConfigRoutes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notifications.json")
+	config := fmt.Sprintf(`{
+	  "sinks": [
+	    {"name": "desktop", "type": "command", "command": "notify-send", "args": ["{title}"],
+	     "rule": {"min_severity": "warning"}, "throttle": {"interval": "1m", "burst": 3}},
+	    {"type": "file", "dir": %q}
+	  ]
+	}`, filepath.Join(dir, "drop"))
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	routes, err := loaded.Routes()
+	if err != nil {
+		t.Fatalf("Failed to build routes: %v", err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("Expected 2 routes, got %d", len(routes))
+	}
+	if routes[0].Throttle.Interval != time.Minute || routes[0].Rule.MinSeverity != SeverityWarning {
+		t.Errorf("Unexpected first route: %+v", routes[0])
+	}
+	if routes[1].Sink.Name() != "file" {
+		t.Errorf("Expected default sink name, got %q", routes[1].Sink.Name())
+	}
+
+	bad := Config{Sinks: []SinkConfig{{Name: "x", Type: "pager"}}}
+	if _, err := bad.Routes(); err == nil || !strings.Contains(err.Error(), "sink x") {
+		t.Errorf("Expected unknown sink type error, got %v", err)
+	}
+}
@@ -150,9 +150,50 @@ func (m *Manager) GetCredential(ctx context.Context, id string) (*pwmanager.Cred
 		LastModified: parseTime(item.RevisionDate),
 		Notes:        item.Notes,
 		CustomFields: make(map[string]string), // TODO: Parse fields
+		HasTOTP:      item.Login.TOTP != "",
+		Shared:       item.OrganizationID != "",
 	}, nil
 }
 
+// GetTOTP returns the current TOTP code for a credential.
+// Uses: bw get totp <id>
+// The code is returned to the caller only; it is never logged.
+func (m *Manager) GetTOTP(ctx context.Context, id string) (string, error) {
+	locked, err := m.IsVaultLocked(ctx)
+	if err != nil {
+		return "", err
+	}
+	if locked {
+		return "", &pwmanager.PasswordManagerError{
+			Code:      pwmanager.ErrVaultLocked,
+			Message:   "Bitwarden vault is locked",
+			Retryable: true,
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, m.cliPath, "get", "totp", id)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && strings.Contains(strings.ToLower(string(exitErr.Stderr)), "no totp") {
+			return "", &pwmanager.PasswordManagerError{
+				Code:    pwmanager.ErrNoTOTP,
+				Message: fmt.Sprintf("Credential %s has no TOTP", id),
+				Cause:   err,
+			}
+		}
+		return "", m.wrapCLIError("get totp", err)
+	}
+
+	code := strings.TrimSpace(string(output))
+	if code == "" {
+		return "", &pwmanager.PasswordManagerError{
+			Code:    pwmanager.ErrNoTOTP,
+			Message: fmt.Sprintf("Credential %s has no TOTP", id),
+		}
+	}
+	return code, nil
+}
+
 // UpdatePassword updates the password for a credential in the vault.
 func (m *Manager) UpdatePassword(ctx context.Context, id string, newPassword string) error {
 	locked, err := m.IsVaultLocked(ctx)
@@ -215,6 +256,120 @@ func (m *Manager) UpdatePassword(ctx context.Context, id string, newPassword str
 	return nil
 }
 
+// StagePassword stores a new password in the item's hidden
+// acm_pending_password field, leaving its login password unchanged.
+func (m *Manager) StagePassword(ctx context.Context, id string, password string) error {
+	item, err := m.getItem(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	item.setField(pwmanager.StagedPasswordField, password)
+	return m.editItem(ctx, id, item)
+}
+
+// CommitStagedPassword moves the staged password into the login password.
+func (m *Manager) CommitStagedPassword(ctx context.Context, id string) error {
+	item, err := m.getItem(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	staged, ok := item.removeField(pwmanager.StagedPasswordField)
+	if !ok || staged == "" {
+		return &pwmanager.PasswordManagerError{
+			Code:    pwmanager.ErrNoStagedPassword,
+			Message: fmt.Sprintf("Credential %s has no staged password", id),
+		}
+	}
+	item.Login.Password = staged
+	return m.editItem(ctx, id, item)
+}
+
+// DiscardStagedPassword removes the staged password, if any.
+func (m *Manager) DiscardStagedPassword(ctx context.Context, id string) error {
+	item, err := m.getItem(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := item.removeField(pwmanager.StagedPasswordField); !ok {
+		return nil
+	}
+	return m.editItem(ctx, id, item)
+}
+
+// StagedPassword returns the password staged for the item.
+func (m *Manager) StagedPassword(ctx context.Context, id string) (string, error) {
+	item, err := m.getItem(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	staged, ok := item.field(pwmanager.StagedPasswordField)
+	if !ok || staged == "" {
+		return "", &pwmanager.PasswordManagerError{
+			Code:    pwmanager.ErrNoStagedPassword,
+			Message: fmt.Sprintf("Credential %s has no staged password", id),
+		}
+	}
+	return staged, nil
+}
+
+// getItem loads an item from an unlocked vault.
+func (m *Manager) getItem(ctx context.Context, id string) (*bitwardenItem, error) {
+	locked, err := m.IsVaultLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if locked {
+		return nil, &pwmanager.PasswordManagerError{
+			Code:      pwmanager.ErrVaultLocked,
+			Message:   "Bitwarden vault is locked",
+			Retryable: true,
+		}
+	}
+
+	output, err := exec.CommandContext(ctx, m.cliPath, "get", "item", id).Output()
+	if err != nil {
+		return nil, m.wrapCLIError("get item", err)
+	}
+
+	var item bitwardenItem
+	if err := json.Unmarshal(output, &item); err != nil {
+		return nil, &pwmanager.PasswordManagerError{
+			Code:    pwmanager.ErrUpdateFailed,
+			Message: "Failed to parse Bitwarden item JSON",
+			Cause:   err,
+		}
+	}
+	return &item, nil
+}
+
+// editItem saves item and syncs the vault.
+func (m *Manager) editItem(ctx context.Context, id string, item *bitwardenItem) error {
+	updatedJSON, err := json.Marshal(item)
+	if err != nil {
+		return &pwmanager.PasswordManagerError{
+			Code:    pwmanager.ErrUpdateFailed,
+			Message: "Failed to encode updated item",
+			Cause:   err,
+		}
+	}
+
+	if err := exec.CommandContext(ctx, m.cliPath, "edit", "item", id, string(updatedJSON)).Run(); err != nil {
+		return &pwmanager.PasswordManagerError{
+			Code:      pwmanager.ErrUpdateFailed,
+			Message:   fmt.Sprintf("Failed to update credential %s", id),
+			Cause:     err,
+			Retryable: true,
+		}
+	}
+
+	_ = exec.CommandContext(ctx, m.cliPath, "sync").Run() // Ignore sync errors
+	return nil
+}
+
 // VerifyUpdate confirms that a password was successfully updated.
 func (m *Manager) VerifyUpdate(ctx context.Context, id string, expectedModifiedAfter time.Time) (bool, error) {
 	cred, err := m.GetCredential(ctx, id)
@@ -297,14 +452,14 @@ func (m *Manager) wrapCLIError(operation string, err error) error {
 
 // bitwardenItem represents a Bitwarden vault item.
 type bitwardenItem struct {
-	ID           string `json:"id"`
+	ID             string `json:"id"`
 	OrganizationID string `json:"organizationId,omitempty"`
-	FolderID     string `json:"folderId,omitempty"`
-	Type         int    `json:"type"` // 1 = Login, 2 = Note, 3 = Card, 4 = Identity
-	Name         string `json:"name"`
-	Notes        string `json:"notes,omitempty"`
-	Favorite     bool   `json:"favorite"`
-	Login        struct {
+	FolderID       string `json:"folderId,omitempty"`
+	Type           int    `json:"type"` // 1 = Login, 2 = Note, 3 = Card, 4 = Identity
+	Name           string `json:"name"`
+	Notes          string `json:"notes,omitempty"`
+	Favorite       bool   `json:"favorite"`
+	Login          struct {
 		Username string `json:"username,omitempty"`
 		Password string `json:"password,omitempty"`
 		TOTP     string `json:"totp,omitempty"`
@@ -313,7 +468,48 @@ type bitwardenItem struct {
 			URI   string `json:"uri"`
 		} `json:"uris,omitempty"`
 	} `json:"login,omitempty"`
-	RevisionDate string `json:"revisionDate"`
+	Fields       []bitwardenField `json:"fields,omitempty"`
+	RevisionDate string           `json:"revisionDate"`
+}
+
+// bitwardenField is a custom field on a Bitwarden item.
+type bitwardenField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Type  int    `json:"type"` // 0 = Text, 1 = Hidden, 2 = Boolean
+}
+
+// setField sets a hidden custom field, adding it if missing.
+func (item *bitwardenItem) setField(name, value string) {
+	for i := range item.Fields {
+		if item.Fields[i].Name == name {
+			item.Fields[i].Value = value
+			item.Fields[i].Type = 1
+			return
+		}
+	}
+	item.Fields = append(item.Fields, bitwardenField{Name: name, Value: value, Type: 1})
+}
+
+// field returns the value of a custom field.
+func (item *bitwardenItem) field(name string) (string, bool) {
+	for _, field := range item.Fields {
+		if field.Name == name {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// removeField removes a custom field and returns its value.
+func (item *bitwardenItem) removeField(name string) (string, bool) {
+	for i, field := range item.Fields {
+		if field.Name == name {
+			item.Fields = append(item.Fields[:i], item.Fields[i+1:]...)
+			return field.Value, true
+		}
+	}
+	return "", false
 }
 
 // Helper functions
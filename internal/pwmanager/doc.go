@@ -81,6 +81,13 @@
 //   - ErrCredentialNotFound: Credential ID does not exist
 //   - ErrUpdateFailed: Password update operation failed
 //   - ErrPermissionDenied: Insufficient permissions
+//   - ErrNoStagedPassword: No password is staged for the credential
+//
+// # Staged Passwords
+//
+// Managers that implement PasswordStager can stage a new password in a
+// hidden field (StagedPasswordField) while the user changes it on the site,
+// then commit or discard it. The item's password is untouched until commit.
 //
 // # Example Usage
 //
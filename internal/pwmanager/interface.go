@@ -49,6 +49,47 @@ type PasswordManager interface {
 	Type() string
 }
 
+// TOTPGenerator is implemented by password managers that can produce the
+// current TOTP code for an item that stores a TOTP seed. The seed never
+// leaves the password manager; only the short-lived code is returned, and
+// callers must not persist or log it.
+type TOTPGenerator interface {
+	// GetTOTP returns the current TOTP code for a credential.
+	//
+	// Example CLI invocations:
+	//   - Bitwarden: `bw get totp <id>`
+	//   - 1Password: `op item get <id> --otp`
+	GetTOTP(ctx context.Context, id string) (string, error)
+}
+
+// StagedPasswordField is the hidden field PasswordStager implementations
+// keep a staged password in, next to the item's current password.
+const StagedPasswordField = "acm_pending_password"
+
+// PasswordStager is implemented by password managers that can hold a new
+// password for an item without replacing the current one. It lets a user
+// change the password on the site first: the new password is staged, and
+// only committed once the site has accepted it. Until then the vault keeps
+// working with the old password, and a staged password survives a restart.
+type PasswordStager interface {
+	// StagePassword stores password as the item's pending password,
+	// replacing any password already staged for it.
+	StagePassword(ctx context.Context, id string, password string) error
+
+	// CommitStagedPassword makes the staged password the item's password
+	// and clears the staged one. It fails with ErrNoStagedPassword if
+	// nothing is staged.
+	CommitStagedPassword(ctx context.Context, id string) error
+
+	// DiscardStagedPassword clears the staged password, leaving the item's
+	// password unchanged. Discarding when nothing is staged is not an error.
+	DiscardStagedPassword(ctx context.Context, id string) error
+
+	// StagedPassword returns the staged password. It fails with
+	// ErrNoStagedPassword if nothing is staged.
+	StagedPassword(ctx context.Context, id string) (string, error)
+}
+
 // CompromisedCredential represents a credential that has been exposed in a data breach.
 type CompromisedCredential struct {
 	// ID is the unique identifier for this credential in the password manager.
@@ -99,6 +140,14 @@ type Credential struct {
 
 	// CustomFields contains any custom fields defined for this credential.
 	CustomFields map[string]string
+
+	// HasTOTP indicates the vault item stores a TOTP seed.
+	HasTOTP bool
+
+	// Shared indicates the item is shared with other people: it belongs to
+	// a Bitwarden organization or to a 1Password vault other than the
+	// account's personal one.
+	Shared bool
 }
 
 // PasswordPolicy defines the requirements for generated passwords.
@@ -185,4 +234,10 @@ const (
 
 	// ErrPermissionDenied indicates insufficient permissions to perform the operation.
 	ErrPermissionDenied ErrorCode = "PERMISSION_DENIED"
+
+	// ErrNoTOTP indicates the credential has no TOTP seed.
+	ErrNoTOTP ErrorCode = "NO_TOTP"
+
+	// ErrNoStagedPassword indicates the credential has no staged password.
+	ErrNoStagedPassword ErrorCode = "NO_STAGED_PASSWORD"
 )
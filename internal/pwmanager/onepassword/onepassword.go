@@ -139,9 +139,62 @@ func (m *Manager) GetCredential(ctx context.Context, id string) (*pwmanager.Cred
 		LastModified: parseTime(item.UpdatedAt),
 		Notes:        getNotesSection(item.Fields),
 		CustomFields: make(map[string]string), // TODO: Parse custom fields
+		HasTOTP:      hasOTPField(item.Fields),
+		Shared:       m.isSharedVault(ctx, item.Vault.ID),
 	}, nil
 }
 
+// isSharedVault reports whether a vault is shared, that is, anything but
+// the account's personal vault.
+// Uses: op vault get <id> --format json
+// A vault that can't be looked up counts as shared, so that a failed
+// lookup never skips the approval shared items may need.
+func (m *Manager) isSharedVault(ctx context.Context, vaultID string) bool {
+	if vaultID == "" {
+		return true
+	}
+	cmd := exec.CommandContext(ctx, m.cliPath, "vault", "get", vaultID, "--format", "json")
+	output, err := cmd.Output()
+	if err != nil {
+		return true
+	}
+
+	var vault struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(output, &vault); err != nil {
+		return true
+	}
+	return vault.Type != "PERSONAL" && vault.Type != "PRIVATE"
+}
+
+// GetTOTP returns the current TOTP code for a credential.
+// Uses: op item get <id> --otp
+// The code is returned to the caller only; it is never logged.
+func (m *Manager) GetTOTP(ctx context.Context, id string) (string, error) {
+	cmd := exec.CommandContext(ctx, m.cliPath, "item", "get", id, "--otp")
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && strings.Contains(strings.ToLower(string(exitErr.Stderr)), "one-time password") {
+			return "", &pwmanager.PasswordManagerError{
+				Code:    pwmanager.ErrNoTOTP,
+				Message: fmt.Sprintf("Credential %s has no one-time password", id),
+				Cause:   err,
+			}
+		}
+		return "", m.wrapCLIError("get otp", err)
+	}
+
+	code := strings.TrimSpace(string(output))
+	if code == "" {
+		return "", &pwmanager.PasswordManagerError{
+			Code:    pwmanager.ErrNoTOTP,
+			Message: fmt.Sprintf("Credential %s has no one-time password", id),
+		}
+	}
+	return code, nil
+}
+
 // UpdatePassword updates the password for a credential in the vault.
 func (m *Manager) UpdatePassword(ctx context.Context, id string, newPassword string) error {
 	// 1Password CLI v2 uses: op item edit <id> password=<new_password>
@@ -158,6 +211,102 @@ func (m *Manager) UpdatePassword(ctx context.Context, id string, newPassword str
 	return nil
 }
 
+// StagePassword stores a new password in the item's concealed
+// acm_pending_password field, leaving its password unchanged.
+// Uses: op item edit <id> acm_pending_password[password]=<new_password>
+func (m *Manager) StagePassword(ctx context.Context, id string, password string) error {
+	field := fmt.Sprintf("%s[password]=%s", pwmanager.StagedPasswordField, password)
+	if err := exec.CommandContext(ctx, m.cliPath, "item", "edit", id, field).Run(); err != nil {
+		return &pwmanager.PasswordManagerError{
+			Code:      pwmanager.ErrUpdateFailed,
+			Message:   fmt.Sprintf("Failed to stage password for credential %s", id),
+			Cause:     err,
+			Retryable: true,
+		}
+	}
+	return nil
+}
+
+// CommitStagedPassword moves the staged password into the item's password.
+// Uses: op item edit <id> password=<staged> acm_pending_password[delete]
+func (m *Manager) CommitStagedPassword(ctx context.Context, id string) error {
+	staged, err := m.stagedPassword(ctx, id)
+	if err != nil {
+		return err
+	}
+	if staged == "" {
+		return &pwmanager.PasswordManagerError{
+			Code:    pwmanager.ErrNoStagedPassword,
+			Message: fmt.Sprintf("Credential %s has no staged password", id),
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, m.cliPath, "item", "edit", id,
+		fmt.Sprintf("password=%s", staged), pwmanager.StagedPasswordField+"[delete]")
+	if err := cmd.Run(); err != nil {
+		return &pwmanager.PasswordManagerError{
+			Code:      pwmanager.ErrUpdateFailed,
+			Message:   fmt.Sprintf("Failed to commit staged password for credential %s", id),
+			Cause:     err,
+			Retryable: true,
+		}
+	}
+	return nil
+}
+
+// StagedPassword returns the password staged for the item.
+func (m *Manager) StagedPassword(ctx context.Context, id string) (string, error) {
+	staged, err := m.stagedPassword(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if staged == "" {
+		return "", &pwmanager.PasswordManagerError{
+			Code:    pwmanager.ErrNoStagedPassword,
+			Message: fmt.Sprintf("Credential %s has no staged password", id),
+		}
+	}
+	return staged, nil
+}
+
+// DiscardStagedPassword removes the staged password, if any.
+// Uses: op item edit <id> acm_pending_password[delete]
+func (m *Manager) DiscardStagedPassword(ctx context.Context, id string) error {
+	staged, err := m.stagedPassword(ctx, id)
+	if err != nil {
+		return err
+	}
+	if staged == "" {
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, m.cliPath, "item", "edit", id, pwmanager.StagedPasswordField+"[delete]")
+	if err := cmd.Run(); err != nil {
+		return &pwmanager.PasswordManagerError{
+			Code:      pwmanager.ErrUpdateFailed,
+			Message:   fmt.Sprintf("Failed to discard staged password for credential %s", id),
+			Cause:     err,
+			Retryable: true,
+		}
+	}
+	return nil
+}
+
+// stagedPassword returns the staged password, or "" if none is staged.
+// Uses: op item get <id> --fields label=acm_pending_password --reveal
+func (m *Manager) stagedPassword(ctx context.Context, id string) (string, error) {
+	cmd := exec.CommandContext(ctx, m.cliPath, "item", "get", id,
+		"--fields", "label="+pwmanager.StagedPasswordField, "--reveal")
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && strings.Contains(string(exitErr.Stderr), "no fields") {
+			return "", nil
+		}
+		return "", m.wrapCLIError("get staged password", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
 // VerifyUpdate confirms that a password was successfully updated.
 func (m *Manager) VerifyUpdate(ctx context.Context, id string, expectedModifiedAfter time.Time) (bool, error) {
 	cred, err := m.GetCredential(ctx, id)
@@ -239,8 +388,11 @@ type onePasswordItem struct {
 
 // onePasswordDetailedItem represents a detailed 1Password item from get operation.
 type onePasswordDetailedItem struct {
-	ID        string `json:"id"`
-	Title     string `json:"title"`
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Vault struct {
+		ID string `json:"id"`
+	} `json:"vault"`
 	Category  string `json:"category"`
 	UpdatedAt string `json:"updated_at"`
 	URLs      []struct {
@@ -311,3 +463,18 @@ func getNotesSection(fields []struct {
 	}
 	return ""
 }
+
+func hasOTPField(fields []struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Purpose string `json:"purpose,omitempty"`
+	Label   string `json:"label"`
+	Value   string `json:"value,omitempty"`
+}) bool {
+	for _, field := range fields {
+		if field.Type == "OTP" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation"
+)
+
+// Input keys of GitHub rotations.
+const (
+	InputCurrentToken = "current_token" // Start: the token being rotated
+	InputNewToken     = "new_token"     // Verify, or Advance while waiting for the new token
+)
+
+// Rotator is a rotation.Provider:
+//
+//   - Start validates the current token and guides the user to create a new one
+//   - Advance takes the new token (see Verify), then confirms the old one is deleted
+//   - Revoke cancels the rotation
+var _ rotation.Provider = (*Rotator)(nil)
+
+// Name implements rotation.Provider.
+func (r *Rotator) Name() string {
+	return ProviderName
+}
+
+// Start implements rotation.Provider. The current token is
+// req.Input[InputCurrentToken].
+func (r *Rotator) Start(ctx context.Context, req rotation.StartRequest) (*rotation.Progress, error) {
+	result, err := r.StartRotation(ctx, RotationRequest{
+		CredentialID: req.CredentialID,
+		CurrentToken: req.Input[InputCurrentToken],
+		Site:         req.Site,
+		Username:     req.Username,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return progress(result), nil
+}
+
+// Advance implements rotation.Provider. While the rotation waits for the
+// new token, input must hold it under InputNewToken; once the new token is
+// verified, advancing confirms the old token was deleted.
+func (r *Rotator) Advance(ctx context.Context, rotationID string, input map[string]string) (*rotation.Progress, error) {
+	state, err := r.stateStore.GetState(ctx, rotationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rotation state: %w", err)
+	}
+
+	switch state.State {
+	case StateValidating, StateVerifying:
+		return r.Verify(ctx, rotationID, input)
+	case StateWaitingDeletion:
+		result, err := r.ConfirmDeletion(ctx, rotationID)
+		if err != nil {
+			return nil, err
+		}
+		return progress(result), nil
+	default:
+		return nil, fmt.Errorf("rotation %s cannot advance from %s", rotationID, state.State)
+	}
+}
+
+// Verify implements rotation.Provider. The new token is
+// input[InputNewToken].
+func (r *Rotator) Verify(ctx context.Context, rotationID string, input map[string]string) (*rotation.Progress, error) {
+	if input[InputNewToken] == "" {
+		return nil, fmt.Errorf("%s is required", InputNewToken)
+	}
+	result, err := r.VerifyNewToken(ctx, rotationID, input[InputNewToken])
+	if err != nil {
+		return nil, err
+	}
+	return progress(result), nil
+}
+
+// Revoke implements rotation.Provider by cancelling the rotation.
+func (r *Rotator) Revoke(ctx context.Context, rotationID string) error {
+	return r.CancelRotation(ctx, rotationID)
+}
+
+// Status implements rotation.Provider.
+func (r *Rotator) Status(ctx context.Context, rotationID string) (*rotation.Progress, error) {
+	result, err := r.GetRotationStatus(ctx, rotationID)
+	if err != nil {
+		return nil, err
+	}
+	return progress(result), nil
+}
+
+// progress converts a rotation result to provider-neutral progress.
+func progress(result *RotationResult) *rotation.Progress {
+	metadata := make(map[string]string, len(result.State.Metadata))
+	for k, v := range result.State.Metadata {
+		metadata[k] = v
+	}
+
+	return &rotation.Progress{
+		RotationID:   result.State.ID,
+		Provider:     ProviderName,
+		CredentialID: result.State.CredentialID,
+		State:        result.State.State,
+		NextStep:     string(result.NextStep),
+		Instructions: result.Instructions,
+		Done:         result.NextStep == StepComplete,
+		Error:        result.Error,
+		Metadata:     metadata,
+	}
+}
@@ -0,0 +1,87 @@
+package github
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation"
+)
+
+// TestProviderWorkflow tests a full rotation through the rotation.Provider interface.
+func TestProviderWorkflow(t *testing.T) {
+	env := createTestEnv(false)
+	defer env.Close()
+
+	ctx := context.Background()
+	registry := rotation.NewRegistry()
+	if err := registry.Register(env.rotator); err != nil {
+		t.Fatalf("failed to register provider: %v", err)
+	}
+	provider, err := registry.Get(ProviderName)
+	if err != nil {
+		t.Fatalf("failed to get provider: %v", err)
+	}
+
+	progress, err := provider.Start(ctx, rotation.StartRequest{
+		CredentialID: "cred-123",
+		Input:        map[string]string{InputCurrentToken: "ghp_old_token"},
+	})
+	if err != nil || progress.Error != nil {
+		t.Fatalf("failed to start: %v, %v", err, progress)
+	}
+	if progress.RotationID == "" || progress.Instructions == "" || progress.Done {
+		t.Fatalf("unexpected progress: %+v", progress)
+	}
+	id := progress.RotationID
+
+	if _, err := provider.Advance(ctx, id, nil); err == nil {
+		t.Error("expected advancing without the new token to fail")
+	}
+
+	progress, err = provider.Advance(ctx, id, map[string]string{InputNewToken: "ghp_new_token"})
+	if err != nil || progress.Error != nil {
+		t.Fatalf("failed to verify new token: %v, %v", err, progress)
+	}
+	if progress.State != "waiting_deletion" {
+		t.Errorf("expected waiting_deletion, got %s", progress.State)
+	}
+
+	progress, err = provider.Advance(ctx, id, nil)
+	if err != nil {
+		t.Fatalf("failed to confirm deletion: %v", err)
+	}
+	if !progress.Done {
+		t.Errorf("expected rotation to be done, got %+v", progress)
+	}
+
+	status, err := provider.Status(ctx, id)
+	if err != nil || !status.Done || status.Metadata["username"] != "testuser" {
+		t.Errorf("unexpected status: %+v, %v", status, err)
+	}
+	if _, err := provider.Advance(ctx, id, nil); err == nil {
+		t.Error("expected a completed rotation not to advance")
+	}
+}
+
+// TestProviderRevoke tests revoking a rotation through the rotation.Provider interface.
+func TestProviderRevoke(t *testing.T) {
+	env := createTestEnv(false)
+	defer env.Close()
+
+	ctx := context.Background()
+	progress, err := env.rotator.Start(ctx, rotation.StartRequest{
+		CredentialID: "cred-123",
+		Input:        map[string]string{InputCurrentToken: "ghp_old_token"},
+	})
+	if err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+
+	if err := env.rotator.Revoke(ctx, progress.RotationID); err != nil {
+		t.Fatalf("failed to revoke: %v", err)
+	}
+	status, _ := env.rotator.Status(ctx, progress.RotationID)
+	if status.State != "cancelled" {
+		t.Errorf("expected cancelled, got %s", status.State)
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 
 	acmv1 "github.com/ferg-cod3s/automated-compromise-mitigation/api/proto/acm/v1"
 	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/acvsif"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/logging"
 	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation"
 )
 
@@ -20,6 +22,8 @@ type Rotator struct {
 	client     *Client
 	stateStore rotation.StateStore
 	acvs       acvsif.Service
+	journal    *rotation.Journal
+	locks      *rotation.LockManager
 }
 
 // NewRotator creates a new GitHub PAT rotator.
@@ -31,6 +35,23 @@ func NewRotator(stateStore rotation.StateStore, acvsService acvsif.Service) *Rot
 	}
 }
 
+// ProviderName is the name of GitHub rotations in the provider registry
+// and the rotation journal.
+const ProviderName = "github"
+
+// SetJournal records every rotation in journal, under its state ID, so that
+// rotations cut short by a crash can be recovered on startup (see Recover).
+func (r *Rotator) SetJournal(journal *rotation.Journal) {
+	r.journal = journal
+}
+
+// SetLockManager makes every rotation lease its credential until it
+// completes, fails or is cancelled, so a credential is rotated once at a
+// time.
+func (r *Rotator) SetLockManager(locks *rotation.LockManager) {
+	r.locks = locks
+}
+
 // RotationRequest represents a request to rotate a GitHub PAT.
 type RotationRequest struct {
 	CredentialID string
@@ -61,6 +82,33 @@ const (
 	StepFailed       RotationStep = "failed"
 )
 
+// States of GitHub rotations, as saved in the state store.
+const (
+	StateValidating      = string(StepValidating)
+	StateVerifying       = string(StepVerifying)
+	StateWaitingDeletion = "waiting_deletion"
+	StateComplete        = string(StepComplete)
+	StateFailed          = string(StepFailed)
+	StateCancelled       = "cancelled"
+)
+
+// stateMachine is the GitHub rotation workflow. A rotation can be
+// cancelled until it completes, but a failed or cancelled rotation can't
+// be picked up again.
+var stateMachine = rotation.MustStateMachine(rotation.StateMachineSpec{
+	Provider: ProviderName,
+	Initial:  StateValidating,
+	States: []string{
+		StateValidating, StateVerifying, StateWaitingDeletion,
+		StateComplete, StateFailed, StateCancelled,
+	},
+	Transitions: map[string][]string{
+		StateValidating:      {StateVerifying, StateCancelled},
+		StateVerifying:       {StateWaitingDeletion, StateFailed, StateCancelled},
+		StateWaitingDeletion: {StateComplete, StateCancelled},
+	},
+})
+
 // StartRotation initiates a GitHub PAT rotation workflow.
 // This performs pre-flight validation and returns instructions for the user.
 func (r *Rotator) StartRotation(ctx context.Context, req RotationRequest) (*RotationResult, error) {
@@ -124,8 +172,7 @@ func (r *Rotator) StartRotation(ctx context.Context, req RotationRequest) (*Rota
 	state := rotation.RotationState{
 		ID:           rotation.GenerateStateID(),
 		CredentialID: req.CredentialID,
-		Provider:     "github",
-		State:        string(StepValidating),
+		Provider:     ProviderName,
 		StartedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 		ExpiresAt:    time.Now().Add(24 * time.Hour), // 24 hour timeout
@@ -136,8 +183,36 @@ func (r *Rotator) StartRotation(ctx context.Context, req RotationRequest) (*Rota
 		},
 	}
 
+	if r.locks != nil {
+		lease := rotation.Lease{ID: state.ID, CredentialID: req.CredentialID}
+		if _, err := r.locks.Acquire(ctx, lease, time.Until(state.ExpiresAt)); err != nil {
+			return &RotationResult{
+				Success:  false,
+				NextStep: StepFailed,
+				Error:    fmt.Errorf("cannot start rotation: %w", err),
+			}, nil
+		}
+	}
+
+	if r.journal != nil {
+		_, err := r.journal.Begin(ctx, rotation.JournalEntry{
+			ID:           state.ID,
+			CredentialID: req.CredentialID,
+			Provider:     ProviderName,
+			Site:         site,
+			Metadata:     map[string]string{"username": user.Login},
+		})
+		if err != nil {
+			r.release(ctx, state)
+			return nil, err
+		}
+	}
+
 	// Save initial state
-	if err := r.stateStore.SaveState(ctx, state); err != nil {
+	state, err = stateMachine.Transition(ctx, r.stateStore, state, StateValidating, "rotation started")
+	if err != nil {
+		r.record(ctx, state.ID, rotation.JournalRolledBack, "failed to save rotation state")
+		r.release(ctx, state)
 		return nil, fmt.Errorf("failed to save rotation state: %w", err)
 	}
 
@@ -161,18 +236,24 @@ func (r *Rotator) VerifyNewToken(ctx context.Context, stateID, newToken string)
 	}
 
 	// Update state to verifying
-	state.State = string(StepVerifying)
-	state.UpdatedAt = time.Now()
-	if err := r.stateStore.SaveState(ctx, state); err != nil {
-		return nil, fmt.Errorf("failed to update state: %w", err)
+	if state.State != StateVerifying {
+		state, err = stateMachine.Transition(ctx, r.stateStore, state, StateVerifying, "new token received")
+		if err != nil {
+			return nil, fmt.Errorf("failed to update state: %w", err)
+		}
 	}
 
 	// Verify new token works
 	user, err := r.client.GetUser(ctx, newToken)
 	if err != nil {
-		state.State = string(StepFailed)
 		state.Metadata["error"] = err.Error()
-		r.stateStore.SaveState(ctx, state)
+		failed, saveErr := stateMachine.Transition(ctx, r.stateStore, state, StateFailed, state.Metadata["error"])
+		if saveErr != nil {
+			return nil, fmt.Errorf("failed to update state: %w", saveErr)
+		}
+		state = failed
+		r.record(ctx, state.ID, rotation.JournalFailed, state.Metadata["error"])
+		r.release(ctx, state)
 
 		return &RotationResult{
 			Success:  false,
@@ -185,9 +266,12 @@ func (r *Rotator) VerifyNewToken(ctx context.Context, stateID, newToken string)
 	// Verify it's the same user
 	expectedUsername := state.Metadata["username"]
 	if user.Login != expectedUsername {
-		state.State = string(StepFailed)
 		state.Metadata["error"] = "token belongs to different user"
-		r.stateStore.SaveState(ctx, state)
+		if state, err = stateMachine.Transition(ctx, r.stateStore, state, StateFailed, state.Metadata["error"]); err != nil {
+			return nil, fmt.Errorf("failed to update state: %w", err)
+		}
+		r.record(ctx, state.ID, rotation.JournalFailed, state.Metadata["error"])
+		r.release(ctx, state)
 
 		return &RotationResult{
 			Success:  false,
@@ -201,12 +285,12 @@ func (r *Rotator) VerifyNewToken(ctx context.Context, stateID, newToken string)
 	instructions := r.generateDeletionInstructions(state.Metadata["site"])
 
 	// Update state to waiting for deletion
-	state.State = "waiting_deletion"
-	state.UpdatedAt = time.Now()
 	state.Metadata["new_token_verified_at"] = time.Now().Format(time.RFC3339)
-	if err := r.stateStore.SaveState(ctx, state); err != nil {
+	state, err = stateMachine.Transition(ctx, r.stateStore, state, StateWaitingDeletion, "new token verified")
+	if err != nil {
 		return nil, fmt.Errorf("failed to update state: %w", err)
 	}
+	r.record(ctx, state.ID, rotation.JournalStaged, "")
 
 	return &RotationResult{
 		Success:      true,
@@ -224,15 +308,18 @@ func (r *Rotator) ConfirmDeletion(ctx context.Context, stateID string) (*Rotatio
 		return nil, fmt.Errorf("failed to load rotation state: %w", err)
 	}
 
-	// Mark as complete
-	state.State = string(StepComplete)
-	state.UpdatedAt = time.Now()
+	// Mark as complete. Only a rotation whose new token was verified can
+	// complete; cancelled and failed ones are rejected.
 	completedAt := time.Now()
 	state.Metadata["completed_at"] = completedAt.Format(time.RFC3339)
+	// Clean up state after 7 days (keep for audit purposes)
+	state.ExpiresAt = completedAt.Add(7 * 24 * time.Hour)
 
-	if err := r.stateStore.SaveState(ctx, state); err != nil {
-		return nil, fmt.Errorf("failed to update state: %w", err)
+	state, err = stateMachine.Transition(ctx, r.stateStore, state, StateComplete, "old token deleted")
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete rotation: %w", err)
 	}
+	r.record(ctx, state.ID, rotation.JournalVerified, "")
 
 	// Add evidence chain entry (if ACVS enabled)
 	if r.acvs != nil && r.acvs.IsEnabled() {
@@ -268,9 +355,8 @@ func (r *Rotator) ConfirmDeletion(ctx context.Context, stateID string) (*Rotatio
 		}
 	}
 
-	// Clean up state after 7 days (keep for audit purposes)
-	state.ExpiresAt = time.Now().Add(7 * 24 * time.Hour)
-	r.stateStore.SaveState(ctx, state)
+	r.record(ctx, state.ID, rotation.JournalAudited, "")
+	r.release(ctx, state)
 
 	return &RotationResult{
 		Success:     true,
@@ -289,20 +375,20 @@ func (r *Rotator) GetRotationStatus(ctx context.Context, stateID string) (*Rotat
 
 	var nextStep RotationStep
 	switch state.State {
-	case string(StepValidating):
+	case StateValidating:
 		nextStep = StepGuiding
-	case "waiting_deletion":
+	case StateWaitingDeletion:
 		nextStep = StepGuiding
-	case string(StepComplete):
+	case StateComplete:
 		nextStep = StepComplete
-	case string(StepFailed):
+	case StateFailed:
 		nextStep = StepFailed
 	default:
 		nextStep = RotationStep(state.State)
 	}
 
 	return &RotationResult{
-		Success:  state.State == string(StepComplete),
+		Success:  state.State == StateComplete,
 		State:    state,
 		NextStep: nextStep,
 	}, nil
@@ -315,11 +401,75 @@ func (r *Rotator) CancelRotation(ctx context.Context, stateID string) error {
 		return fmt.Errorf("failed to load rotation state: %w", err)
 	}
 
-	state.State = "cancelled"
-	state.UpdatedAt = time.Now()
 	state.Metadata["cancelled_at"] = time.Now().Format(time.RFC3339)
 
-	return r.stateStore.SaveState(ctx, state)
+	if _, err := stateMachine.Transition(ctx, r.stateStore, state, StateCancelled, "cancelled by user"); err != nil {
+		return err
+	}
+	r.record(ctx, state.ID, rotation.JournalRolledBack, "cancelled")
+	r.release(ctx, state)
+	return nil
+}
+
+// Recover implements rotation.Recoverer for GitHub rotations. The
+// rotation's state is the source of truth: a rotation the state store
+// completed is completed, one still waiting on the user is resumed, since
+// its state survives restarts, and one that failed, was cancelled or
+// expired before a new token was verified is rolled back.
+func (r *Rotator) Recover(ctx context.Context, entry rotation.JournalEntry) (rotation.RecoveryOutcome, error) {
+	outcome, err := r.recoverRotation(ctx, entry)
+	if outcome != rotation.RecoveryResumed {
+		r.release(ctx, rotation.RotationState{ID: entry.ID, CredentialID: entry.CredentialID})
+	}
+	return outcome, err
+}
+
+// recoverRotation works out the outcome of the rotation recorded in entry.
+func (r *Rotator) recoverRotation(ctx context.Context, entry rotation.JournalEntry) (rotation.RecoveryOutcome, error) {
+	state, err := r.stateStore.GetState(ctx, entry.ID)
+	if err == nil && state.State != StateComplete && time.Now().After(state.ExpiresAt) {
+		err = rotation.ErrStateNotFound
+	}
+	if errors.Is(err, rotation.ErrStateNotFound) {
+		if entry.Step == rotation.JournalIntent {
+			return rotation.RecoveryRolledBack, nil
+		}
+		return rotation.RecoveryFailed, fmt.Errorf("rotation expired after the new token was verified; check that the old token was deleted")
+	}
+	if err != nil {
+		return rotation.RecoveryFailed, fmt.Errorf("failed to load rotation state: %w", err)
+	}
+
+	switch state.State {
+	case StateComplete:
+		return rotation.RecoveryCompleted, nil
+	case StateFailed, StateCancelled:
+		return rotation.RecoveryRolledBack, nil
+	default:
+		return rotation.RecoveryResumed, nil
+	}
+}
+
+// release gives up the lease of the rotation state, if locking is enabled.
+// A lease that can't be released expires with the state.
+func (r *Rotator) release(ctx context.Context, state rotation.RotationState) {
+	if r.locks == nil {
+		return
+	}
+	_ = r.locks.Release(ctx, rotation.Lease{ID: state.ID, CredentialID: state.CredentialID})
+}
+
+// record records a step of the rotation stateID in the journal, if one is
+// set. A failed write is logged but not fatal: recovery trusts the state
+// store.
+func (r *Rotator) record(ctx context.Context, stateID string, step rotation.JournalStep, detail string) {
+	if r.journal == nil {
+		return
+	}
+	if err := r.journal.Record(ctx, stateID, step, detail, nil); err != nil {
+		logging.NewLogger("github-rotation").Error("Failed to record rotation journal step",
+			"journal_id", stateID, "step", string(step), "error", err)
+	}
 }
 
 // generateCreationInstructions generates step-by-step instructions for creating a new PAT.
@@ -378,8 +528,8 @@ before deleting the old one!
 // ListActiveRotations returns all active (incomplete) rotations.
 func (r *Rotator) ListActiveRotations(ctx context.Context) ([]rotation.RotationState, error) {
 	return r.stateStore.ListStates(ctx, rotation.StateFilter{
-		Provider:      "github",
-		ExcludeStates: []string{string(StepComplete), "cancelled"},
+		Provider:      ProviderName,
+		ExcludeStates: []string{StateComplete, StateCancelled},
 	})
 }
 
@@ -3,9 +3,11 @@ package github
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 	"time"
 
@@ -104,7 +106,8 @@ func (m *mockACVSService) AddEvidenceEntry(ctx context.Context, entry *acvsif.Ev
 
 // mockStateStore is a mock state store for testing.
 type mockStateStore struct {
-	states map[string]rotation.RotationState
+	states      map[string]rotation.RotationState
+	transitions []rotation.Transition
 }
 
 func newMockStateStore() *mockStateStore {
@@ -114,6 +117,10 @@ func newMockStateStore() *mockStateStore {
 }
 
 func (m *mockStateStore) SaveState(ctx context.Context, state rotation.RotationState) error {
+	if stored, ok := m.states[state.ID]; ok && stored.Version != state.Version || !ok && state.Version != 0 {
+		return rotation.ErrStateConflict
+	}
+	state.Version++
 	m.states[state.ID] = state
 	return nil
 }
@@ -169,6 +176,24 @@ func (m *mockStateStore) CleanupExpired(ctx context.Context) (int, error) {
 	return count, nil
 }
 
+func (m *mockStateStore) SaveTransition(ctx context.Context, state rotation.RotationState, transition rotation.Transition) error {
+	if err := m.SaveState(ctx, state); err != nil {
+		return err
+	}
+	m.transitions = append(m.transitions, transition)
+	return nil
+}
+
+func (m *mockStateStore) ListTransitions(ctx context.Context, rotationID string) ([]rotation.Transition, error) {
+	var result []rotation.Transition
+	for _, transition := range m.transitions {
+		if transition.RotationID == rotationID {
+			result = append(result, transition)
+		}
+	}
+	return result, nil
+}
+
 // TestStartRotation tests the StartRotation workflow.
 func TestStartRotation(t *testing.T) {
 	tests := []struct {
@@ -410,3 +435,43 @@ func TestGetRotationStatus(t *testing.T) {
 		t.Errorf("expected state ID %v, got %v", stateID, statusResult.State.ID)
 	}
 }
+
+// TestConfirmDeletionAfterCancel tests that a cancelled rotation can't be completed.
+func TestConfirmDeletionAfterCancel(t *testing.T) {
+	env := createTestEnv(false)
+	defer env.Close()
+
+	ctx := context.Background()
+	result, err := env.rotator.StartRotation(ctx, RotationRequest{
+		CredentialID: "cred-123",
+		CurrentToken: "ghp_old_token",
+	})
+	if err != nil || !result.Success {
+		t.Fatalf("StartRotation failed: %v", err)
+	}
+	stateID := result.State.ID
+
+	if _, err := env.rotator.VerifyNewToken(ctx, stateID, "ghp_new_token"); err != nil {
+		t.Fatalf("VerifyNewToken failed: %v", err)
+	}
+	if err := env.rotator.CancelRotation(ctx, stateID); err != nil {
+		t.Fatalf("CancelRotation failed: %v", err)
+	}
+
+	if _, err := env.rotator.ConfirmDeletion(ctx, stateID); !errors.Is(err, rotation.ErrInvalidTransition) {
+		t.Errorf("expected ErrInvalidTransition, got %v", err)
+	}
+	if err := env.rotator.CancelRotation(ctx, stateID); !errors.Is(err, rotation.ErrInvalidTransition) {
+		t.Errorf("expected cancelling twice to fail, got %v", err)
+	}
+
+	transitions, _ := env.stateStore.ListTransitions(ctx, stateID)
+	var states []string
+	for _, transition := range transitions {
+		states = append(states, transition.To)
+	}
+	want := []string{StateValidating, StateVerifying, StateWaitingDeletion, StateCancelled}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("expected transitions %v, got %v", want, states)
+	}
+}
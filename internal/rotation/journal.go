@@ -0,0 +1,450 @@
+package rotation
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+)
+
+// JournalStep is a step of a rotation recorded in the journal.
+type JournalStep string
+
+const (
+	// JournalIntent is recorded before anything is changed.
+	JournalIntent JournalStep = "intent"
+
+	// JournalStaged means the new credential exists alongside the old one
+	// (a staged vault password, or a new token not yet in use).
+	JournalStaged JournalStep = "staged"
+
+	// JournalVaultWritten means the new credential was written to the vault.
+	JournalVaultWritten JournalStep = "vault_written"
+
+	// JournalVerified means the new credential was verified.
+	JournalVerified JournalStep = "verified"
+
+	// JournalAudited means the rotation was recorded in the audit log. It
+	// is the last step of a successful rotation.
+	JournalAudited JournalStep = "audited"
+
+	// JournalRolledBack means the rotation was abandoned and the old
+	// credential is still in use.
+	JournalRolledBack JournalStep = "rolled_back"
+
+	// JournalFailed means the rotation stopped in a state that needs the
+	// user's attention.
+	JournalFailed JournalStep = "failed"
+)
+
+// journalRank orders the steps of a successful rotation. Steps may be
+// skipped, but never taken backwards.
+var journalRank = map[JournalStep]int{
+	JournalIntent:       0,
+	JournalStaged:       1,
+	JournalVaultWritten: 2,
+	JournalVerified:     3,
+	JournalAudited:      4,
+}
+
+// Terminal reports whether a rotation at step s has finished.
+func (s JournalStep) Terminal() bool {
+	return s == JournalAudited || s == JournalRolledBack || s == JournalFailed
+}
+
+// JournalEntry is the journal's record of one rotation.
+type JournalEntry struct {
+	ID           string
+	CredentialID string
+	Provider     string // "vault", "github", etc.
+	Site         string
+	Step         JournalStep
+	StartedAt    time.Time
+	UpdatedAt    time.Time
+	Metadata     map[string]string
+}
+
+// JournalRecord is one step in a rotation's history.
+type JournalRecord struct {
+	Step       JournalStep
+	RecordedAt time.Time
+	Detail     string
+}
+
+// Journal is a write-ahead log of rotations. Every step is committed with
+// a full fsync before the caller moves on, so after a crash the journal
+// tells which rotations were cut short and how far they got. Recover
+// finishes or rolls them back on startup.
+type Journal struct {
+	db *sql.DB
+}
+
+// NewJournal creates a rotation journal in db, creating its tables if needed.
+func NewJournal(db *sql.DB) (*Journal, error) {
+	journal := &Journal{db: db}
+
+	if err := journal.initSchema(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to initialize journal schema: %w", err)
+	}
+
+	return journal, nil
+}
+
+// initSchema creates the rotation_journal tables if they don't exist.
+func (j *Journal) initSchema(ctx context.Context) error {
+	schema := `
+CREATE TABLE IF NOT EXISTS rotation_journal (
+    id TEXT PRIMARY KEY,
+    credential_id TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    site TEXT NOT NULL,
+    step TEXT NOT NULL,
+    started_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    metadata_json TEXT NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS idx_rotation_journal_step ON rotation_journal(step);
+
+CREATE TABLE IF NOT EXISTS rotation_journal_steps (
+    journal_id TEXT NOT NULL,
+    step TEXT NOT NULL,
+    recorded_at INTEGER NOT NULL,
+    detail TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_rotation_journal_steps_journal_id ON rotation_journal_steps(journal_id);
+	`
+
+	_, err := j.db.ExecContext(ctx, schema)
+	return err
+}
+
+// Begin records the intent to rotate entry.CredentialID and returns the
+// entry as stored. An ID is generated if entry.ID is empty. Nothing may be
+// changed until Begin returns successfully.
+func (j *Journal) Begin(ctx context.Context, entry JournalEntry) (JournalEntry, error) {
+	if entry.ID == "" {
+		entry.ID = GenerateStateID()
+	}
+	if entry.Metadata == nil {
+		entry.Metadata = make(map[string]string)
+	}
+	now := time.Now()
+	entry.Step = JournalIntent
+	entry.StartedAt = now
+	entry.UpdatedAt = now
+
+	metadataJSON, err := json.Marshal(entry.Metadata)
+	if err != nil {
+		return entry, fmt.Errorf("failed to serialize metadata: %w", err)
+	}
+
+	err = j.write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO rotation_journal (id, credential_id, provider, site, step, started_at, updated_at, metadata_json)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			entry.ID, entry.CredentialID, entry.Provider, entry.Site, string(entry.Step),
+			now.UnixMilli(), now.UnixMilli(), string(metadataJSON))
+		if err != nil {
+			return err
+		}
+		return appendStep(ctx, tx, entry.ID, entry.Step, now, "")
+	})
+	if err != nil {
+		return entry, fmt.Errorf("failed to record rotation intent: %w", err)
+	}
+	return entry, nil
+}
+
+// Record moves a rotation to step, merging metadata into the entry's
+// metadata. Recording the current step again only updates the metadata.
+// A finished rotation can't be changed, and steps can't go backwards.
+func (j *Journal) Record(ctx context.Context, id string, step JournalStep, detail string, metadata map[string]string) error {
+	now := time.Now()
+
+	err := j.write(ctx, func(tx *sql.Tx) error {
+		var current, metadataJSON string
+		err := tx.QueryRowContext(ctx, "SELECT step, metadata_json FROM rotation_journal WHERE id = ?", id).Scan(&current, &metadataJSON)
+		if err == sql.ErrNoRows {
+			return ErrJournalNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		from := JournalStep(current)
+		if from.Terminal() {
+			return fmt.Errorf("%w: rotation already %s", ErrInvalidJournalStep, from)
+		}
+		if rank, ok := journalRank[step]; ok && rank < journalRank[from] {
+			return fmt.Errorf("%w: %s after %s", ErrInvalidJournalStep, step, from)
+		}
+		if _, ok := journalRank[step]; !ok && !step.Terminal() {
+			return fmt.Errorf("%w: unknown step %q", ErrInvalidJournalStep, step)
+		}
+
+		merged := make(map[string]string)
+		if err := json.Unmarshal([]byte(metadataJSON), &merged); err != nil {
+			return fmt.Errorf("failed to deserialize metadata: %w", err)
+		}
+		for k, v := range metadata {
+			merged[k] = v
+		}
+		data, err := json.Marshal(merged)
+		if err != nil {
+			return fmt.Errorf("failed to serialize metadata: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE rotation_journal SET step = ?, updated_at = ?, metadata_json = ? WHERE id = ?",
+			string(step), now.UnixMilli(), string(data), id)
+		if err != nil {
+			return err
+		}
+		if step == from && detail == "" {
+			return nil
+		}
+		return appendStep(ctx, tx, id, step, now, detail)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record rotation step %s: %w", step, err)
+	}
+	return nil
+}
+
+// Get returns a journal entry by ID.
+func (j *Journal) Get(ctx context.Context, id string) (JournalEntry, error) {
+	entries, err := j.query(ctx, "WHERE id = ?", id)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+	if len(entries) == 0 {
+		return JournalEntry{}, ErrJournalNotFound
+	}
+	return entries[0], nil
+}
+
+// Incomplete returns the rotations that have not finished, oldest first.
+func (j *Journal) Incomplete(ctx context.Context) ([]JournalEntry, error) {
+	return j.query(ctx, "WHERE step NOT IN (?, ?, ?) ORDER BY started_at",
+		string(JournalAudited), string(JournalRolledBack), string(JournalFailed))
+}
+
+// History returns the steps recorded for a rotation, in order.
+func (j *Journal) History(ctx context.Context, id string) ([]JournalRecord, error) {
+	rows, err := j.db.QueryContext(ctx, "SELECT step, recorded_at, detail FROM rotation_journal_steps WHERE journal_id = ? ORDER BY rowid", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query journal history: %w", err)
+	}
+	defer rows.Close()
+
+	var records []JournalRecord
+	for rows.Next() {
+		var record JournalRecord
+		var step string
+		var recordedAt int64
+		if err := rows.Scan(&step, &recordedAt, &record.Detail); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		record.Step = JournalStep(step)
+		record.RecordedAt = time.UnixMilli(recordedAt)
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// query returns the entries matching a WHERE clause.
+func (j *Journal) query(ctx context.Context, where string, args ...interface{}) ([]JournalEntry, error) {
+	rows, err := j.db.QueryContext(ctx, `
+SELECT id, credential_id, provider, site, step, started_at, updated_at, metadata_json
+FROM rotation_journal `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rotation journal: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []JournalEntry
+	for rows.Next() {
+		var entry JournalEntry
+		var step, metadataJSON string
+		var startedAt, updatedAt int64
+
+		if err := rows.Scan(&entry.ID, &entry.CredentialID, &entry.Provider, &entry.Site,
+			&step, &startedAt, &updatedAt, &metadataJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		entry.Step = JournalStep(step)
+		entry.StartedAt = time.UnixMilli(startedAt)
+		entry.UpdatedAt = time.UnixMilli(updatedAt)
+		entry.Metadata = make(map[string]string)
+		if err := json.Unmarshal([]byte(metadataJSON), &entry.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to deserialize metadata: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return entries, nil
+}
+
+// write runs fn in a transaction that is fsync'd to disk before it returns.
+// synchronous is a per-connection setting, so the transaction runs on a
+// connection of its own with synchronous = FULL.
+func (j *Journal) write(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	conn, err := j.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA synchronous = FULL"); err != nil {
+		return fmt.Errorf("failed to enable synchronous writes: %w", err)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// appendStep adds a step to a rotation's history.
+func appendStep(ctx context.Context, tx *sql.Tx, id string, step JournalStep, at time.Time, detail string) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO rotation_journal_steps (journal_id, step, recorded_at, detail) VALUES (?, ?, ?, ?)",
+		id, string(step), at.UnixMilli(), detail)
+	return err
+}
+
+// RecoveryOutcome is what a Recoverer did with an incomplete rotation.
+type RecoveryOutcome string
+
+const (
+	// RecoveryCompleted means the new credential is verified in use.
+	RecoveryCompleted RecoveryOutcome = "completed"
+
+	// RecoveryRolledBack means the rotation was undone and the old
+	// credential is still in use.
+	RecoveryRolledBack RecoveryOutcome = "rolled_back"
+
+	// RecoveryResumed means the rotation is waiting on the user again and
+	// will finish on its own.
+	RecoveryResumed RecoveryOutcome = "resumed"
+
+	// RecoveryFailed means the rotation could be neither finished nor
+	// undone, and the user must check the credential.
+	RecoveryFailed RecoveryOutcome = "failed"
+)
+
+// Recoverer finishes or rolls back incomplete rotations of one provider.
+// Recover re-checks the credential against the vault or the provider
+// rather than trusting the journal's last step, since a crash can fall
+// between a change and the step recording it.
+type Recoverer interface {
+	Recover(ctx context.Context, entry JournalEntry) (RecoveryOutcome, error)
+}
+
+// RecoveryReport counts the outcomes of a recovery pass.
+type RecoveryReport struct {
+	Completed  int
+	RolledBack int
+	Resumed    int
+	Failed     int
+}
+
+// Recover runs the recovery pass: every incomplete rotation is handed to
+// the Recoverer for its provider, the outcome is recorded in the journal,
+// and reported in auditLogger.
+func (j *Journal) Recover(ctx context.Context, recoverers map[string]Recoverer, auditLogger audit.Logger) (RecoveryReport, error) {
+	var report RecoveryReport
+
+	entries, err := j.Incomplete(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	for _, entry := range entries {
+		outcome := RecoveryFailed
+		var recoverErr error
+		if recoverer, ok := recoverers[entry.Provider]; ok {
+			outcome, recoverErr = recoverer.Recover(ctx, entry)
+			if recoverErr != nil {
+				outcome = RecoveryFailed
+			}
+		} else {
+			recoverErr = fmt.Errorf("no recoverer for provider %q", entry.Provider)
+		}
+
+		event := audit.Event{
+			Type:         audit.EventTypeRotation,
+			CredentialID: hashCredentialID(entry.CredentialID),
+			Site:         entry.Site,
+			Timestamp:    time.Now(),
+			Metadata: map[string]string{
+				"journal_id":  entry.ID,
+				"provider":    entry.Provider,
+				"recovery":    string(outcome),
+				"interrupted": string(entry.Step),
+			},
+		}
+
+		var step JournalStep
+		detail := "recovery: " + string(outcome)
+		switch outcome {
+		case RecoveryCompleted:
+			report.Completed++
+			event.Status = audit.StatusSuccess
+			event.Message = "Interrupted rotation completed after restart"
+			if journalRank[entry.Step] < journalRank[JournalVerified] {
+				if err := j.Record(ctx, entry.ID, JournalVerified, detail, nil); err != nil {
+					return report, err
+				}
+			}
+			step = JournalAudited
+		case RecoveryRolledBack:
+			report.RolledBack++
+			event.Status = audit.StatusFailure
+			event.Message = "Interrupted rotation rolled back after restart"
+			step = JournalRolledBack
+		case RecoveryResumed:
+			report.Resumed++
+			event.Status = audit.StatusPending
+			event.Message = "Interrupted rotation resumed after restart"
+		default:
+			report.Failed++
+			event.Status = audit.StatusFailure
+			event.Message = "Interrupted rotation needs attention: " + recoverErr.Error()
+			detail += ": " + recoverErr.Error()
+			step = JournalFailed
+		}
+
+		if auditLogger != nil {
+			if err := auditLogger.LogEvent(ctx, event); err != nil {
+				return report, fmt.Errorf("failed to audit recovery of %s: %w", entry.ID, err)
+			}
+		}
+		if step != "" {
+			if err := j.Record(ctx, entry.ID, step, detail, nil); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// hashCredentialID creates a SHA-256 hash of a credential ID for privacy.
+func hashCredentialID(credentialID string) string {
+	hash := sha256.Sum256([]byte(credentialID))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,159 @@
+package rotation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite" // SQLite driver
+
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+)
+
+func openTestJournal(t *testing.T, path string) *Journal {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	journal, err := NewJournal(db)
+	if err != nil {
+		t.Fatalf("Failed to create journal: %v", err)
+	}
+	return journal
+}
+
+// fakeRecoverer returns a fixed outcome for every rotation.
+type fakeRecoverer struct {
+	outcome RecoveryOutcome
+}
+
+func (r *fakeRecoverer) Recover(ctx context.Context, entry JournalEntry) (RecoveryOutcome, error) {
+	return r.outcome, nil
+}
+
+// TestJournalSteps tests that steps only move forward and finished rotations are immutable
+func TestJournalSteps(t *testing.T) {
+	ctx := context.Background()
+	journal := openTestJournal(t, filepath.Join(t.TempDir(), "state.db"))
+
+	entry, err := journal.Begin(ctx, JournalEntry{CredentialID: "item-1", Provider: "vault", Site: "github.com"})
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if entry.ID == "" || entry.Step != JournalIntent {
+		t.Fatalf("Expected a new entry at intent, got %+v", entry)
+	}
+
+	if err := journal.Record(ctx, entry.ID, JournalStaged, "", map[string]string{"him_session_id": "s-1"}); err != nil {
+		t.Fatalf("Failed to record staged: %v", err)
+	}
+	if err := journal.Record(ctx, entry.ID, JournalStaged, "", map[string]string{"him_session_id": "s-2"}); err != nil {
+		t.Fatalf("Failed to update metadata: %v", err)
+	}
+	if err := journal.Record(ctx, entry.ID, JournalIntent, "", nil); !errors.Is(err, ErrInvalidJournalStep) {
+		t.Errorf("Expected going back to be rejected, got %v", err)
+	}
+	if err := journal.Record(ctx, entry.ID, JournalVaultWritten, "", nil); err != nil {
+		t.Fatalf("Failed to record vault_written: %v", err)
+	}
+	if err := journal.Record(ctx, entry.ID, JournalAudited, "", nil); err != nil {
+		t.Fatalf("Failed to record audited: %v", err)
+	}
+	if err := journal.Record(ctx, entry.ID, JournalFailed, "too late", nil); !errors.Is(err, ErrInvalidJournalStep) {
+		t.Errorf("Expected a finished rotation to be immutable, got %v", err)
+	}
+	if err := journal.Record(ctx, "missing", JournalStaged, "", nil); !errors.Is(err, ErrJournalNotFound) {
+		t.Errorf("Expected ErrJournalNotFound, got %v", err)
+	}
+
+	got, err := journal.Get(ctx, entry.ID)
+	if err != nil {
+		t.Fatalf("Failed to get entry: %v", err)
+	}
+	if got.Step != JournalAudited || got.Metadata["him_session_id"] != "s-2" {
+		t.Errorf("Unexpected entry: %+v", got)
+	}
+
+	history, err := journal.History(ctx, entry.ID)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	want := []JournalStep{JournalIntent, JournalStaged, JournalVaultWritten, JournalAudited}
+	if len(history) != len(want) {
+		t.Fatalf("Expected %d steps, got %+v", len(want), history)
+	}
+	for i, step := range want {
+		if history[i].Step != step {
+			t.Errorf("Step %d: expected %s, got %s", i, step, history[i].Step)
+		}
+	}
+}
+
+// TestJournalRecover tests the recovery pass after a restart
+func TestJournalRecover(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	// First run: rotations cut short at different steps
+	before := openTestJournal(t, path)
+	written, _ := before.Begin(ctx, JournalEntry{CredentialID: "item-1", Provider: "vault", Site: "github.com"})
+	_ = before.Record(ctx, written.ID, JournalVaultWritten, "", nil)
+	staged, _ := before.Begin(ctx, JournalEntry{CredentialID: "item-2", Provider: "github", Site: "github.com"})
+	_ = before.Record(ctx, staged.ID, JournalStaged, "", nil)
+	orphan, _ := before.Begin(ctx, JournalEntry{CredentialID: "item-3", Provider: "gitlab", Site: "gitlab.com"})
+	done, _ := before.Begin(ctx, JournalEntry{CredentialID: "item-4", Provider: "vault", Site: "example.com"})
+	_ = before.Record(ctx, done.ID, JournalAudited, "", nil)
+
+	// Second run
+	after := openTestJournal(t, path)
+	incomplete, err := after.Incomplete(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list incomplete rotations: %v", err)
+	}
+	if len(incomplete) != 3 {
+		t.Fatalf("Expected 3 incomplete rotations, got %d", len(incomplete))
+	}
+
+	auditLogger, _ := audit.NewMemoryLogger()
+	vault := &fakeRecoverer{outcome: RecoveryCompleted}
+	github := &fakeRecoverer{outcome: RecoveryResumed}
+	report, err := after.Recover(ctx, map[string]Recoverer{"vault": vault, "github": github}, auditLogger)
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	if report != (RecoveryReport{Completed: 1, Resumed: 1, Failed: 1}) {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	steps := map[string]JournalStep{written.ID: JournalAudited, staged.ID: JournalStaged, orphan.ID: JournalFailed}
+	for id, want := range steps {
+		entry, _ := after.Get(ctx, id)
+		if entry.Step != want {
+			t.Errorf("Expected %s at %s, got %s", id, want, entry.Step)
+		}
+	}
+
+	events, _ := auditLogger.QueryEvents(ctx, audit.Filter{EventType: audit.EventTypeRotation})
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 recovery events, got %d", len(events))
+	}
+	for _, event := range events {
+		if event.Metadata["journal_id"] == "" || event.Metadata["recovery"] == "" {
+			t.Errorf("Event missing recovery metadata: %+v", event.Metadata)
+		}
+		if event.CredentialID == "item-1" {
+			t.Error("Expected credential IDs to be hashed")
+		}
+	}
+
+	// Only the resumed rotation is still incomplete
+	incomplete, _ = after.Incomplete(ctx)
+	if len(incomplete) != 1 || incomplete[0].ID != staged.ID {
+		t.Errorf("Expected only the resumed rotation to remain, got %+v", incomplete)
+	}
+}
@@ -0,0 +1,202 @@
+package rotation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultLeaseTTL is how long a rotation lease lasts unless renewed.
+const DefaultLeaseTTL = 5 * time.Minute
+
+// Lease is a lock on rotating one credential. Only the holder of a lease's
+// ID can renew or release it; anyone can take it over once it expires, so
+// a crashed process never blocks a credential for longer than the lease.
+type Lease struct {
+	ID           string
+	CredentialID string
+	Holder       string // who is rotating, e.g. the client certificate's common name
+	AcquiredAt   time.Time
+	ExpiresAt    time.Time
+}
+
+// LockHeldError is returned when a credential is already being rotated.
+type LockHeldError struct {
+	Holder     string
+	AcquiredAt time.Time
+	ExpiresAt  time.Time
+}
+
+func (e *LockHeldError) Error() string {
+	return fmt.Sprintf("rotation in progress: held by %s since %s (lease expires %s)",
+		e.Holder, e.AcquiredAt.Format(time.RFC3339), e.ExpiresAt.Format(time.RFC3339))
+}
+
+func (e *LockHeldError) Unwrap() error {
+	return ErrRotationInProgress
+}
+
+// LockManager hands out per-credential rotation leases. Leases live in
+// SQLite, so they hold across every process sharing the database.
+type LockManager struct {
+	db *sql.DB
+}
+
+// NewLockManager creates a lock manager in db, creating its table if needed.
+func NewLockManager(db *sql.DB) (*LockManager, error) {
+	locks := &LockManager{db: db}
+
+	if err := locks.initSchema(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to initialize lock schema: %w", err)
+	}
+
+	return locks, nil
+}
+
+// initSchema creates the rotation_locks table if it doesn't exist.
+func (m *LockManager) initSchema(ctx context.Context) error {
+	schema := `
+CREATE TABLE IF NOT EXISTS rotation_locks (
+    credential_id TEXT PRIMARY KEY,
+    lease_id TEXT NOT NULL,
+    holder TEXT NOT NULL,
+    acquired_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL
+);
+	`
+
+	_, err := m.db.ExecContext(ctx, schema)
+	return err
+}
+
+// Acquire takes the lease on lease.CredentialID for ttl. An ID is generated
+// if lease.ID is empty, and the holder defaults to HolderFromContext. If
+// another unexpired lease holds the credential, Acquire fails with a
+// *LockHeldError naming its holder.
+func (m *LockManager) Acquire(ctx context.Context, lease Lease, ttl time.Duration) (Lease, error) {
+	if lease.CredentialID == "" {
+		return lease, fmt.Errorf("credential ID is required")
+	}
+	if lease.ID == "" {
+		lease.ID = GenerateStateID()
+	}
+	if lease.Holder == "" {
+		lease.Holder = HolderFromContext(ctx)
+	}
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+	now := time.Now()
+	lease.AcquiredAt = now
+	lease.ExpiresAt = now.Add(ttl)
+
+	// Insert, or take over an expired lease, in one statement
+	res, err := m.db.ExecContext(ctx, `
+INSERT INTO rotation_locks (credential_id, lease_id, holder, acquired_at, expires_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(credential_id) DO UPDATE SET
+    lease_id = excluded.lease_id,
+    holder = excluded.holder,
+    acquired_at = excluded.acquired_at,
+    expires_at = excluded.expires_at
+WHERE rotation_locks.expires_at <= excluded.acquired_at`,
+		lease.CredentialID, lease.ID, lease.Holder, now.UnixMilli(), lease.ExpiresAt.UnixMilli())
+	if err != nil {
+		return lease, fmt.Errorf("failed to acquire rotation lease: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return lease, nil
+	}
+
+	held, err := m.get(ctx, lease.CredentialID)
+	if err == sql.ErrNoRows {
+		// Released between the two statements
+		return m.Acquire(ctx, lease, ttl)
+	}
+	if err != nil {
+		return lease, fmt.Errorf("failed to load rotation lease: %w", err)
+	}
+	return lease, &LockHeldError{Holder: held.Holder, AcquiredAt: held.AcquiredAt, ExpiresAt: held.ExpiresAt}
+}
+
+// Renew extends lease by ttl from now. It fails with ErrLeaseLost if the
+// lease expired and was taken over, or released.
+func (m *LockManager) Renew(ctx context.Context, lease Lease, ttl time.Duration) (Lease, error) {
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+	now := time.Now()
+
+	res, err := m.db.ExecContext(ctx,
+		"UPDATE rotation_locks SET expires_at = ? WHERE credential_id = ? AND lease_id = ?",
+		now.Add(ttl).UnixMilli(), lease.CredentialID, lease.ID)
+	if err != nil {
+		return lease, fmt.Errorf("failed to renew rotation lease: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return lease, ErrLeaseLost
+	}
+
+	return m.get(ctx, lease.CredentialID)
+}
+
+// Release gives up lease. Releasing a lease that is no longer held is not
+// an error.
+func (m *LockManager) Release(ctx context.Context, lease Lease) error {
+	_, err := m.db.ExecContext(ctx,
+		"DELETE FROM rotation_locks WHERE credential_id = ? AND lease_id = ?",
+		lease.CredentialID, lease.ID)
+	if err != nil {
+		return fmt.Errorf("failed to release rotation lease: %w", err)
+	}
+	return nil
+}
+
+// Held returns the unexpired lease on credentialID, if any.
+func (m *LockManager) Held(ctx context.Context, credentialID string) (Lease, bool, error) {
+	lease, err := m.get(ctx, credentialID)
+	if err == sql.ErrNoRows || (err == nil && !time.Now().Before(lease.ExpiresAt)) {
+		return Lease{}, false, nil
+	}
+	if err != nil {
+		return Lease{}, false, fmt.Errorf("failed to load rotation lease: %w", err)
+	}
+	return lease, true, nil
+}
+
+// get loads the lease row for credentialID, expired or not.
+func (m *LockManager) get(ctx context.Context, credentialID string) (Lease, error) {
+	lease := Lease{CredentialID: credentialID}
+	var acquiredAt, expiresAt int64
+
+	err := m.db.QueryRowContext(ctx,
+		"SELECT lease_id, holder, acquired_at, expires_at FROM rotation_locks WHERE credential_id = ?",
+		credentialID).Scan(&lease.ID, &lease.Holder, &acquiredAt, &expiresAt)
+	if err != nil {
+		return lease, err
+	}
+
+	lease.AcquiredAt = time.UnixMilli(acquiredAt)
+	lease.ExpiresAt = time.UnixMilli(expiresAt)
+	return lease, nil
+}
+
+type holderKey struct{}
+
+// WithHolder returns a context naming holder as the one rotating, for
+// leases acquired with it.
+func WithHolder(ctx context.Context, holder string) context.Context {
+	return context.WithValue(ctx, holderKey{}, holder)
+}
+
+// HolderFromContext returns the holder set by WithHolder, or this process
+// if none was set.
+func HolderFromContext(ctx context.Context) string {
+	if holder, ok := ctx.Value(holderKey{}).(string); ok && holder != "" {
+		return holder
+	}
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("pid %d on %s", os.Getpid(), hostname)
+}
@@ -0,0 +1,123 @@
+package rotation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTestLocks(t *testing.T) *LockManager {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	locks, err := NewLockManager(db)
+	if err != nil {
+		t.Fatalf("Failed to create lock manager: %v", err)
+	}
+	return locks
+}
+
+// TestLockManagerAcquire tests that a held lease refuses others and names its holder
+func TestLockManagerAcquire(t *testing.T) {
+	ctx := context.Background()
+	locks := openTestLocks(t)
+
+	first, err := locks.Acquire(WithHolder(ctx, "acm-cli"), Lease{CredentialID: "item-1"}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to acquire: %v", err)
+	}
+	if first.ID == "" || first.Holder != "acm-cli" {
+		t.Errorf("Unexpected lease: %+v", first)
+	}
+
+	_, err = locks.Acquire(ctx, Lease{CredentialID: "item-1", Holder: "scheduler"}, time.Minute)
+	var held *LockHeldError
+	if !errors.As(err, &held) || !errors.Is(err, ErrRotationInProgress) {
+		t.Fatalf("Expected LockHeldError, got %v", err)
+	}
+	if held.Holder != "acm-cli" || held.AcquiredAt.Unix() != first.AcquiredAt.Unix() {
+		t.Errorf("Expected the first holder, got %+v", held)
+	}
+
+	// Other credentials are independent
+	if _, err := locks.Acquire(ctx, Lease{CredentialID: "item-2"}, time.Minute); err != nil {
+		t.Errorf("Failed to acquire another credential: %v", err)
+	}
+
+	// Only the holder can release
+	_ = locks.Release(ctx, Lease{ID: "someone-else", CredentialID: "item-1"})
+	if _, ok, _ := locks.Held(ctx, "item-1"); !ok {
+		t.Error("Expected the lease to survive a release by another holder")
+	}
+	if err := locks.Release(ctx, first); err != nil {
+		t.Fatalf("Failed to release: %v", err)
+	}
+	if _, err := locks.Acquire(ctx, Lease{CredentialID: "item-1", Holder: "scheduler"}, time.Minute); err != nil {
+		t.Errorf("Failed to acquire after release: %v", err)
+	}
+}
+
+// TestLockManagerExpiry tests that an expired lease can be taken over and is lost to its holder
+func TestLockManagerExpiry(t *testing.T) {
+	ctx := context.Background()
+	locks := openTestLocks(t)
+
+	stale, err := locks.Acquire(ctx, Lease{CredentialID: "item-1", Holder: "crashed"}, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to acquire: %v", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+
+	if _, ok, _ := locks.Held(ctx, "item-1"); ok {
+		t.Error("Expected the lease to have expired")
+	}
+	fresh, err := locks.Acquire(ctx, Lease{CredentialID: "item-1", Holder: "acm-cli"}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to take over expired lease: %v", err)
+	}
+	if _, err := locks.Renew(ctx, stale, time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Expected ErrLeaseLost, got %v", err)
+	}
+	renewed, err := locks.Renew(ctx, fresh, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to renew: %v", err)
+	}
+	if !renewed.ExpiresAt.After(fresh.ExpiresAt) {
+		t.Errorf("Expected the lease to be extended, got %v", renewed.ExpiresAt)
+	}
+}
+
+// TestLockManagerConcurrent tests that only one of many concurrent rotations gets the lease
+func TestLockManagerConcurrent(t *testing.T) {
+	ctx := context.Background()
+	locks := openTestLocks(t)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	acquired := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := locks.Acquire(ctx, Lease{CredentialID: "item-1"}, time.Minute); err == nil {
+				mu.Lock()
+				acquired++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 1 {
+		t.Errorf("Expected exactly one lease, got %d", acquired)
+	}
+}
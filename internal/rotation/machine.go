@@ -0,0 +1,144 @@
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// StateMachineSpec declares a provider's rotation states and the
+// transitions allowed between them. A state with no transitions out of it
+// is terminal.
+type StateMachineSpec struct {
+	Provider    string
+	Initial     string              // the state a rotation starts in
+	States      []string            // every state, including terminal ones
+	Transitions map[string][]string // from state -> allowed next states
+}
+
+// StateMachine enforces a StateMachineSpec on a provider's rotations. All
+// state changes go through Transition, which rejects the ones the spec
+// doesn't allow and appends every change to the rotation's history.
+type StateMachine struct {
+	provider string
+	initial  string
+	states   map[string]bool
+	next     map[string]map[string]bool
+}
+
+// Transition is one state change in a rotation's history.
+type Transition struct {
+	RotationID string
+	Provider   string
+	From       string // "" when the rotation starts
+	To         string
+	Actor      string // who made the change, see HolderFromContext
+	Reason     string
+	At         time.Time
+}
+
+// NewStateMachine checks spec and creates its state machine.
+func NewStateMachine(spec StateMachineSpec) (*StateMachine, error) {
+	m := &StateMachine{
+		provider: spec.Provider,
+		initial:  spec.Initial,
+		states:   make(map[string]bool),
+		next:     make(map[string]map[string]bool),
+	}
+
+	for _, state := range spec.States {
+		if state == "" {
+			return nil, fmt.Errorf("state names must not be empty")
+		}
+		m.states[state] = true
+	}
+	if !m.states[spec.Initial] {
+		return nil, fmt.Errorf("initial state %q is not a declared state", spec.Initial)
+	}
+
+	for from, targets := range spec.Transitions {
+		if !m.states[from] {
+			return nil, fmt.Errorf("transition from undeclared state %q", from)
+		}
+		for _, to := range targets {
+			if !m.states[to] {
+				return nil, fmt.Errorf("transition from %q to undeclared state %q", from, to)
+			}
+			if m.next[from] == nil {
+				m.next[from] = make(map[string]bool)
+			}
+			m.next[from][to] = true
+		}
+	}
+
+	return m, nil
+}
+
+// MustStateMachine is like NewStateMachine but panics if spec is invalid.
+// It is meant for a provider's package-level state machine.
+func MustStateMachine(spec StateMachineSpec) *StateMachine {
+	m, err := NewStateMachine(spec)
+	if err != nil {
+		panic(fmt.Sprintf("rotation: invalid %s state machine: %v", spec.Provider, err))
+	}
+	return m
+}
+
+// Initial returns the state rotations start in.
+func (m *StateMachine) Initial() string {
+	return m.initial
+}
+
+// IsTerminal reports whether state is declared and has no way out.
+func (m *StateMachine) IsTerminal(state string) bool {
+	return m.states[state] && len(m.next[state]) == 0
+}
+
+// Validate checks that a rotation may move from one state to another. A
+// rotation starts by moving from "" to the initial state.
+func (m *StateMachine) Validate(from, to string) error {
+	switch {
+	case from == "" && to == m.initial:
+		return nil
+	case !m.states[to]:
+		return fmt.Errorf("%w: unknown %s state %q", ErrInvalidTransition, m.provider, to)
+	case !m.next[from][to]:
+		if m.IsTerminal(from) {
+			return fmt.Errorf("%w: %s rotation is already %s", ErrInvalidTransition, m.provider, from)
+		}
+		return fmt.Errorf("%w: %s rotation cannot go from %q to %q", ErrInvalidTransition, m.provider, from, to)
+	}
+	return nil
+}
+
+// Transition moves state to the state to, saving it together with the
+// transition in store, and returns the updated state. Changes to the
+// state's other fields are saved with it. The actor is the holder named
+// in ctx (see WithHolder). If the stored state has moved since state was
+// loaded, nothing is saved and the error wraps ErrStateConflict. On error,
+// state is returned unchanged.
+func (m *StateMachine) Transition(ctx context.Context, store StateStore, state RotationState, to, reason string) (RotationState, error) {
+	if err := m.Validate(state.State, to); err != nil {
+		return state, err
+	}
+
+	now := time.Now()
+	transition := Transition{
+		RotationID: state.ID,
+		Provider:   m.provider,
+		From:       state.State,
+		To:         to,
+		Actor:      HolderFromContext(ctx),
+		Reason:     reason,
+		At:         now,
+	}
+
+	next := state
+	next.State = to
+	next.UpdatedAt = now
+	if err := store.SaveTransition(ctx, next, transition); err != nil {
+		return state, err
+	}
+	next.Version++
+	return next, nil
+}
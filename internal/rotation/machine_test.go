@@ -0,0 +1,162 @@
+package rotation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStateStore(t *testing.T) (*SQLiteStateStore, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewSQLiteStateStore(db)
+	if err != nil {
+		t.Fatalf("Failed to create state store: %v", err)
+	}
+	return store, db
+}
+
+var testSpec = StateMachineSpec{
+	Provider: "test",
+	Initial:  "pending",
+	States:   []string{"pending", "active", "done", "cancelled"},
+	Transitions: map[string][]string{
+		"pending": {"active", "cancelled"},
+		"active":  {"done", "cancelled"},
+	},
+}
+
+// TestNewStateMachine tests that invalid specs are rejected
+func TestNewStateMachine(t *testing.T) {
+	tests := []struct {
+		name string
+		spec StateMachineSpec
+	}{
+		{"undeclared initial", StateMachineSpec{Initial: "x", States: []string{"a"}}},
+		{"empty state", StateMachineSpec{Initial: "a", States: []string{"a", ""}}},
+		{"undeclared from", StateMachineSpec{Initial: "a", States: []string{"a"}, Transitions: map[string][]string{"b": {"a"}}}},
+		{"undeclared to", StateMachineSpec{Initial: "a", States: []string{"a"}, Transitions: map[string][]string{"a": {"b"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewStateMachine(tt.spec); err == nil {
+				t.Error("Expected the spec to be rejected")
+			}
+		})
+	}
+
+	machine, err := NewStateMachine(testSpec)
+	if err != nil {
+		t.Fatalf("Failed to create state machine: %v", err)
+	}
+	if machine.Initial() != "pending" || machine.IsTerminal("active") || !machine.IsTerminal("done") {
+		t.Error("Expected pending to be initial and done to be terminal")
+	}
+}
+
+// TestStateMachineValidate tests which transitions are allowed
+func TestStateMachineValidate(t *testing.T) {
+	machine := MustStateMachine(testSpec)
+
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{"", "pending", true},
+		{"", "active", false},
+		{"pending", "active", true},
+		{"pending", "done", false},
+		{"active", "done", true},
+		{"active", "unknown", false},
+		{"cancelled", "done", false},
+		{"done", "cancelled", false},
+	}
+
+	for _, tt := range tests {
+		err := machine.Validate(tt.from, tt.to)
+		if tt.allowed && err != nil {
+			t.Errorf("Expected %q -> %q to be allowed, got %v", tt.from, tt.to, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("Expected %q -> %q to be rejected, got %v", tt.from, tt.to, err)
+		}
+	}
+}
+
+// TestStateMachineTransition tests that transitions are saved with their history
+func TestStateMachineTransition(t *testing.T) {
+	store, db := openTestStateStore(t)
+	machine := MustStateMachine(testSpec)
+	ctx := WithHolder(context.Background(), "alice")
+
+	state := RotationState{
+		ID:           GenerateStateID(),
+		CredentialID: "cred-1",
+		Provider:     "test",
+		StartedAt:    time.Now(),
+		ExpiresAt:    time.Now().Add(time.Hour),
+		Metadata:     map[string]string{},
+	}
+
+	var err error
+	var stale RotationState
+	for _, to := range []string{"pending", "active"} {
+		stale = state
+		state, err = machine.Transition(ctx, store, state, to, "step "+to)
+		if err != nil {
+			t.Fatalf("Failed to transition to %s: %v", to, err)
+		}
+	}
+	if _, err := machine.Transition(ctx, store, state, "pending", ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition, got %v", err)
+	}
+
+	// A transition that fails to save leaves the state as it was
+	unchanged, err := machine.Transition(ctx, store, stale, "active", "")
+	if !errors.Is(err, ErrStateConflict) {
+		t.Errorf("Expected ErrStateConflict, got %v", err)
+	}
+	if unchanged.State != "pending" || unchanged.Version != stale.Version {
+		t.Errorf("Expected the state unchanged, got %+v", unchanged)
+	}
+
+	saved, err := store.GetState(ctx, state.ID)
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if saved.State != "active" {
+		t.Errorf("Expected active, got %s", saved.State)
+	}
+
+	transitions, err := store.ListTransitions(ctx, state.ID)
+	if err != nil {
+		t.Fatalf("Failed to list transitions: %v", err)
+	}
+	if len(transitions) != 2 {
+		t.Fatalf("Expected 2 transitions, got %d", len(transitions))
+	}
+	first, second := transitions[0], transitions[1]
+	if first.From != "" || first.To != "pending" || second.From != "pending" || second.To != "active" {
+		t.Errorf("Unexpected history: %+v", transitions)
+	}
+	if second.Actor != "alice" || second.Reason != "step active" || second.At.IsZero() {
+		t.Errorf("Unexpected transition: %+v", second)
+	}
+
+	if _, err := db.ExecContext(ctx, `UPDATE rotation_transitions SET actor = 'mallory'`); err == nil {
+		t.Error("Expected the history to be append-only")
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM rotation_transitions`); err == nil {
+		t.Error("Expected history not to be deletable")
+	}
+}
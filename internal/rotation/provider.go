@@ -0,0 +1,107 @@
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Provider rotates one kind of credential (GitHub tokens, AWS keys, ...)
+// through a workflow of one or more steps, each of which may wait on the
+// user. Rotations are identified by the ID returned from Start.
+//
+// A rejected request, such as a token that doesn't work, is reported in
+// Progress.Error. The returned error is for failures of the provider
+// itself, like a state store that can't be reached.
+type Provider interface {
+	// Name returns the provider's registry name, e.g. "github".
+	Name() string
+
+	// Start validates the request and starts a rotation.
+	Start(ctx context.Context, req StartRequest) (*Progress, error)
+
+	// Advance completes the rotation's current step with input, the
+	// values that step asked for in its instructions.
+	Advance(ctx context.Context, rotationID string, input map[string]string) (*Progress, error)
+
+	// Verify checks that the new credential in input works.
+	Verify(ctx context.Context, rotationID string, input map[string]string) (*Progress, error)
+
+	// Revoke abandons the rotation, leaving the old credential in use.
+	Revoke(ctx context.Context, rotationID string) error
+
+	// Status returns the rotation's progress.
+	Status(ctx context.Context, rotationID string) (*Progress, error)
+}
+
+// StartRequest is a request to rotate a credential.
+type StartRequest struct {
+	CredentialID string
+	Site         string
+	Username     string
+	Input        map[string]string // provider-specific, e.g. "current_token"
+}
+
+// Progress is where a rotation stands.
+type Progress struct {
+	RotationID   string
+	Provider     string
+	CredentialID string
+	State        string // the provider's current state
+	NextStep     string // what the user does next
+	Instructions string
+	Done         bool
+	Error        error // why the last step was rejected, if it was
+	Metadata     map[string]string
+}
+
+// Registry holds the rotation providers by name.
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+// NewRegistry creates an empty provider registry.
+func NewRegistry() *Registry {
+	return &Registry{providers: make(map[string]Provider)}
+}
+
+// Register adds provider under its name.
+func (r *Registry) Register(provider Provider) error {
+	name := provider.Name()
+	if name == "" {
+		return fmt.Errorf("provider name is required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.providers[name]; exists {
+		return fmt.Errorf("%w: %s", ErrProviderExists, name)
+	}
+	r.providers[name] = provider
+	return nil
+}
+
+// Get returns the provider registered under name.
+func (r *Registry) Get(name string) (Provider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrProviderNotFound, name)
+	}
+	return provider, nil
+}
+
+// Names returns the registered provider names, sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
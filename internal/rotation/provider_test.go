@@ -0,0 +1,43 @@
+package rotation
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// namedProvider is a provider that only has a name.
+type namedProvider struct {
+	Provider
+	name string
+}
+
+func (p namedProvider) Name() string { return p.name }
+
+// TestRegistry tests registering and looking up providers
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+
+	for _, name := range []string{"github", "aws"} {
+		if err := registry.Register(namedProvider{name: name}); err != nil {
+			t.Fatalf("Failed to register %s: %v", name, err)
+		}
+	}
+	if err := registry.Register(namedProvider{name: "github"}); !errors.Is(err, ErrProviderExists) {
+		t.Errorf("Expected ErrProviderExists, got %v", err)
+	}
+	if err := registry.Register(namedProvider{}); err == nil {
+		t.Error("Expected an unnamed provider to be rejected")
+	}
+
+	provider, err := registry.Get("aws")
+	if err != nil || provider.Name() != "aws" {
+		t.Errorf("Expected the aws provider, got %v (%v)", provider, err)
+	}
+	if _, err := registry.Get("gitlab"); !errors.Is(err, ErrProviderNotFound) {
+		t.Errorf("Expected ErrProviderNotFound, got %v", err)
+	}
+	if names := registry.Names(); !reflect.DeepEqual(names, []string{"aws", "github"}) {
+		t.Errorf("Expected sorted names, got %v", names)
+	}
+}
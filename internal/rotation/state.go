@@ -5,17 +5,30 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 )
 
 // StateStore provides persistence for rotation state.
 type StateStore interface {
+	// SaveState saves state if the stored state is still at state.Version,
+	// or doesn't exist yet when the version is 0, and moves the stored
+	// version to state.Version+1. Otherwise it fails with ErrStateConflict;
+	// reload the state and try again, or use UpdateState.
 	SaveState(ctx context.Context, state RotationState) error
 	GetState(ctx context.Context, id string) (RotationState, error)
 	ListStates(ctx context.Context, filter StateFilter) ([]RotationState, error)
 	DeleteState(ctx context.Context, id string) error
 	CleanupExpired(ctx context.Context) (int, error)
+
+	// SaveTransition saves state and appends transition, the change that
+	// led to it, to the rotation's history in one write. Use
+	// StateMachine.Transition rather than calling it directly.
+	SaveTransition(ctx context.Context, state RotationState, transition Transition) error
+
+	// ListTransitions returns a rotation's history, oldest first.
+	ListTransitions(ctx context.Context, rotationID string) ([]Transition, error)
 }
 
 // SQLiteStateStore implements StateStore using SQLite.
@@ -47,57 +60,251 @@ CREATE TABLE IF NOT EXISTS rotation_state (
     updated_at INTEGER NOT NULL,
     expires_at INTEGER NOT NULL,
     metadata_json TEXT,
-    created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
+    created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+    version INTEGER NOT NULL DEFAULT 1
 );
 
 CREATE INDEX IF NOT EXISTS idx_rotation_credential_id ON rotation_state(credential_id);
 CREATE INDEX IF NOT EXISTS idx_rotation_provider ON rotation_state(provider);
 CREATE INDEX IF NOT EXISTS idx_rotation_state ON rotation_state(state);
 CREATE INDEX IF NOT EXISTS idx_rotation_expires_at ON rotation_state(expires_at);
+
+CREATE TABLE IF NOT EXISTS rotation_transitions (
+    rotation_id TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    from_state TEXT NOT NULL,
+    to_state TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    transitioned_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_rotation_transitions_rotation_id ON rotation_transitions(rotation_id);
+
+-- The history is append-only
+CREATE TRIGGER IF NOT EXISTS rotation_transitions_no_update
+BEFORE UPDATE ON rotation_transitions
+BEGIN
+    SELECT RAISE(ABORT, 'rotation transitions are append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS rotation_transitions_no_delete
+BEFORE DELETE ON rotation_transitions
+BEGIN
+    SELECT RAISE(ABORT, 'rotation transitions are append-only');
+END;
 	`
 
-	_, err := s.db.ExecContext(ctx, schema)
-	return err
+	if _, err := s.db.ExecContext(ctx, schema); err != nil {
+		return err
+	}
+
+	return s.migrateVersion(ctx)
 }
 
-// SaveState saves or updates a rotation state.
+// migrateVersion adds the version column to rotation_state tables created
+// before SaveState compared versions. Existing states start at version 1.
+func (s *SQLiteStateStore) migrateVersion(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, "PRAGMA table_info(rotation_state)")
+	if err != nil {
+		return fmt.Errorf("failed to read rotation_state columns: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan column: %w", err)
+		}
+		if name == "version" {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating columns: %w", err)
+	}
+	rows.Close()
+
+	_, err = s.db.ExecContext(ctx, "ALTER TABLE rotation_state ADD COLUMN version INTEGER NOT NULL DEFAULT 1")
+	if err != nil {
+		return fmt.Errorf("failed to add version column: %w", err)
+	}
+	return nil
+}
+
+// SaveState saves or updates a rotation state, failing with
+// ErrStateConflict if the stored version has moved.
 func (s *SQLiteStateStore) SaveState(ctx context.Context, state RotationState) error {
+	return saveState(ctx, s.db, state)
+}
+
+// SaveTransition saves state and appends transition to its history in one
+// transaction. Like SaveState, it fails with ErrStateConflict if the stored
+// version has moved, and then records nothing.
+func (s *SQLiteStateStore) SaveTransition(ctx context.Context, state RotationState, transition Transition) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := saveState(ctx, tx, state); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+INSERT INTO rotation_transitions (rotation_id, provider, from_state, to_state, actor, reason, transitioned_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		transition.RotationID, transition.Provider, transition.From, transition.To,
+		transition.Actor, transition.Reason, transition.At.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to record rotation transition: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ListTransitions returns a rotation's history, oldest first.
+func (s *SQLiteStateStore) ListTransitions(ctx context.Context, rotationID string) ([]Transition, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT rotation_id, provider, from_state, to_state, actor, reason, transitioned_at
+FROM rotation_transitions
+WHERE rotation_id = ?
+ORDER BY rowid`, rotationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rotation transitions: %w", err)
+	}
+	defer rows.Close()
+
+	var transitions []Transition
+	for rows.Next() {
+		var t Transition
+		var at int64
+		if err := rows.Scan(&t.RotationID, &t.Provider, &t.From, &t.To, &t.Actor, &t.Reason, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		t.At = time.UnixMilli(at)
+		transitions = append(transitions, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return transitions, nil
+}
+
+// execer is a *sql.DB or *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// saveState writes state with db if the stored version is still
+// state.Version: a new state is inserted unless its ID is taken, an
+// existing one is updated only at its version.
+func saveState(ctx context.Context, db execer, state RotationState) error {
 	// Serialize metadata
 	metadataJSON, err := json.Marshal(state.Metadata)
 	if err != nil {
 		return fmt.Errorf("failed to serialize metadata: %w", err)
 	}
 
-	query := `
-INSERT OR REPLACE INTO rotation_state (
+	var result sql.Result
+	if state.Version == 0 {
+		result, err = db.ExecContext(ctx, `
+INSERT INTO rotation_state (
     id, credential_id, provider, state,
-    started_at, updated_at, expires_at, metadata_json
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`
-
-	_, err = s.db.ExecContext(ctx, query,
-		state.ID,
-		state.CredentialID,
-		state.Provider,
-		state.State,
-		state.StartedAt.Unix(),
-		state.UpdatedAt.Unix(),
-		state.ExpiresAt.Unix(),
-		string(metadataJSON),
-	)
+    started_at, updated_at, expires_at, metadata_json, version
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1)
+ON CONFLICT(id) DO NOTHING
+	`,
+			state.ID,
+			state.CredentialID,
+			state.Provider,
+			state.State,
+			state.StartedAt.Unix(),
+			state.UpdatedAt.Unix(),
+			state.ExpiresAt.Unix(),
+			string(metadataJSON),
+		)
+	} else {
+		result, err = db.ExecContext(ctx, `
+UPDATE rotation_state
+SET credential_id = ?, provider = ?, state = ?,
+    started_at = ?, updated_at = ?, expires_at = ?, metadata_json = ?,
+    version = version + 1
+WHERE id = ? AND version = ?
+	`,
+			state.CredentialID,
+			state.Provider,
+			state.State,
+			state.StartedAt.Unix(),
+			state.UpdatedAt.Unix(),
+			state.ExpiresAt.Unix(),
+			string(metadataJSON),
+			state.ID,
+			state.Version,
+		)
+	}
 
 	if err != nil {
 		return fmt.Errorf("failed to save rotation state: %w", err)
 	}
 
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: %s is no longer at version %d", ErrStateConflict, state.ID, state.Version)
+	}
+
 	return nil
 }
 
+// maxUpdateAttempts is how many times UpdateState tries to save before
+// giving up on a state that keeps changing under it.
+const maxUpdateAttempts = 5
+
+// UpdateState loads the state id, applies mutate to it and saves it,
+// starting over from a fresh load whenever another writer saved first.
+// mutate may run more than once and should only change the state it is
+// given. An error from mutate aborts the update. The saved state is
+// returned.
+func UpdateState(ctx context.Context, store StateStore, id string, mutate func(*RotationState) error) (RotationState, error) {
+	var err error
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		var state RotationState
+		state, err = store.GetState(ctx, id)
+		if err != nil {
+			return state, err
+		}
+
+		if err := mutate(&state); err != nil {
+			return state, err
+		}
+
+		err = store.SaveState(ctx, state)
+		if err == nil {
+			state.Version++
+			return state, nil
+		}
+		if !errors.Is(err, ErrStateConflict) {
+			return state, err
+		}
+	}
+	return RotationState{}, fmt.Errorf("failed to update rotation state after %d attempts: %w", maxUpdateAttempts, err)
+}
+
 // GetState retrieves a rotation state by ID.
 func (s *SQLiteStateStore) GetState(ctx context.Context, id string) (RotationState, error) {
 	query := `
 SELECT id, credential_id, provider, state,
-       started_at, updated_at, expires_at, metadata_json
+       started_at, updated_at, expires_at, metadata_json, version
 FROM rotation_state
 WHERE id = ?
 	`
@@ -115,10 +322,11 @@ WHERE id = ?
 		&updatedAt,
 		&expiresAt,
 		&metadataJSON,
+		&state.Version,
 	)
 
 	if err == sql.ErrNoRows {
-		return state, fmt.Errorf("rotation state not found: %s", id)
+		return state, fmt.Errorf("%w: %s", ErrStateNotFound, id)
 	}
 
 	if err != nil {
@@ -146,7 +354,7 @@ WHERE id = ?
 func (s *SQLiteStateStore) ListStates(ctx context.Context, filter StateFilter) ([]RotationState, error) {
 	query := `
 SELECT id, credential_id, provider, state,
-       started_at, updated_at, expires_at, metadata_json
+       started_at, updated_at, expires_at, metadata_json, version
 FROM rotation_state
 WHERE 1=1
 	`
@@ -210,6 +418,7 @@ WHERE 1=1
 			&updatedAt,
 			&expiresAt,
 			&metadataJSON,
+			&state.Version,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
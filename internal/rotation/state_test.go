@@ -0,0 +1,168 @@
+package rotation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestState() RotationState {
+	return RotationState{
+		ID:           GenerateStateID(),
+		CredentialID: "cred-1",
+		Provider:     "test",
+		State:        "pending",
+		StartedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		ExpiresAt:    time.Now().Add(time.Hour),
+		Metadata:     map[string]string{},
+	}
+}
+
+// TestSaveStateConflict tests that a save from a stale version is rejected
+func TestSaveStateConflict(t *testing.T) {
+	store, _ := openTestStateStore(t)
+	ctx := context.Background()
+
+	state := newTestState()
+	if err := store.SaveState(ctx, state); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+	if err := store.SaveState(ctx, state); !errors.Is(err, ErrStateConflict) {
+		t.Errorf("Expected saving a new state twice to conflict, got %v", err)
+	}
+
+	first, err := store.GetState(ctx, state.ID)
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if first.Version != 1 {
+		t.Errorf("Expected version 1, got %d", first.Version)
+	}
+	second := first
+
+	first.Metadata["owner"] = "first"
+	if err := store.SaveState(ctx, first); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+	second.Metadata = map[string]string{"owner": "second"}
+	if err := store.SaveState(ctx, second); !errors.Is(err, ErrStateConflict) {
+		t.Errorf("Expected a stale save to conflict, got %v", err)
+	}
+
+	saved, err := store.GetState(ctx, state.ID)
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if saved.Version != 2 || saved.Metadata["owner"] != "first" {
+		t.Errorf("Expected the first save at version 2, got %d with %v", saved.Version, saved.Metadata)
+	}
+}
+
+// TestUpdateState tests that concurrent updates retry instead of losing writes
+func TestUpdateState(t *testing.T) {
+	store, _ := openTestStateStore(t)
+	ctx := context.Background()
+
+	state := newTestState()
+	state.Metadata["count"] = "0"
+	if err := store.SaveState(ctx, state); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	const writers = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := UpdateState(ctx, store, state.ID, func(s *RotationState) error {
+				count, _ := strconv.Atoi(s.Metadata["count"])
+				s.Metadata["count"] = strconv.Itoa(count + 1)
+				s.Metadata[fmt.Sprintf("writer_%d", i)] = "done"
+				return nil
+			})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Failed to update state: %v", err)
+		}
+	}
+
+	saved, err := store.GetState(ctx, state.ID)
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if saved.Metadata["count"] != strconv.Itoa(writers) || len(saved.Metadata) != writers+1 {
+		t.Errorf("Expected every update to be kept, got %v", saved.Metadata)
+	}
+
+	stop := errors.New("stop")
+	if _, err := UpdateState(ctx, store, state.ID, func(*RotationState) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("Expected the mutate error, got %v", err)
+	}
+	if _, err := UpdateState(ctx, store, "missing", func(*RotationState) error { return nil }); !errors.Is(err, ErrStateNotFound) {
+		t.Errorf("Expected ErrStateNotFound, got %v", err)
+	}
+}
+
+// TestStateStoreMigration tests that a database without versions is migrated in place
+func TestStateStoreMigration(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+CREATE TABLE rotation_state (
+    id TEXT PRIMARY KEY,
+    credential_id TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    state TEXT NOT NULL,
+    started_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    metadata_json TEXT,
+    created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
+);
+INSERT INTO rotation_state (id, credential_id, provider, state, started_at, updated_at, expires_at, metadata_json)
+VALUES ('old', 'cred-1', 'test', 'pending', 0, 0, 0, '{}');`)
+	if err != nil {
+		t.Fatalf("Failed to create old schema: %v", err)
+	}
+
+	// Opening the store again must not migrate twice
+	var store *SQLiteStateStore
+	for i := 0; i < 2; i++ {
+		if store, err = NewSQLiteStateStore(db); err != nil {
+			t.Fatalf("Failed to migrate state store: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	state, err := store.GetState(ctx, "old")
+	if err != nil {
+		t.Fatalf("Failed to get migrated state: %v", err)
+	}
+	if state.Version != 1 {
+		t.Errorf("Expected migrated state at version 1, got %d", state.Version)
+	}
+
+	state.State = "active"
+	if err := store.SaveState(ctx, state); err != nil {
+		t.Errorf("Failed to save migrated state: %v", err)
+	}
+}
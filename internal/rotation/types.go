@@ -10,7 +10,15 @@ import (
 
 // Common errors
 var (
-	ErrStateNotFound = errors.New("rotation state not found")
+	ErrStateNotFound      = errors.New("rotation state not found")
+	ErrJournalNotFound    = errors.New("rotation journal entry not found")
+	ErrInvalidJournalStep = errors.New("invalid rotation journal step")
+	ErrRotationInProgress = errors.New("rotation in progress")
+	ErrLeaseLost          = errors.New("rotation lease lost")
+	ErrProviderNotFound   = errors.New("rotation provider not found")
+	ErrProviderExists     = errors.New("rotation provider already registered")
+	ErrInvalidTransition  = errors.New("invalid rotation state transition")
+	ErrStateConflict      = errors.New("rotation state was modified concurrently")
 )
 
 // RotationState represents the persistent state of a credential rotation.
@@ -23,6 +31,11 @@ type RotationState struct {
 	UpdatedAt    time.Time         `json:"updated_at"`
 	ExpiresAt    time.Time         `json:"expires_at"` // for cleanup
 	Metadata     map[string]string `json:"metadata"`   // provider-specific data
+
+	// Version is the version of the state as loaded from the store, 0 for
+	// a state that was never saved. Saving a state whose stored version has
+	// since moved fails with ErrStateConflict.
+	Version int64 `json:"version"`
 }
 
 // StateFilter represents filter criteria for querying rotation states.
@@ -0,0 +1,621 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	acmv1 "github.com/ferg-cod3s/automated-compromise-mitigation/api/proto/acm/v1"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+)
+
+// Page sizes for QueryLogs.
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+// AuditServiceServer implements the gRPC AuditService.
+type AuditServiceServer struct {
+	acmv1.UnimplementedAuditServiceServer
+	logger     audit.Logger
+	aggregator *audit.Aggregator
+}
+
+// NewAuditServiceServer creates a new audit service server.
+func NewAuditServiceServer(logger audit.Logger) *AuditServiceServer {
+	return &AuditServiceServer{
+		logger:     logger,
+		aggregator: audit.NewAggregator(logger),
+	}
+}
+
+// GetStatistics returns aggregate statistics about audit events.
+func (s *AuditServiceServer) GetStatistics(ctx context.Context, req *acmv1.StatisticsRequest) (*acmv1.StatisticsResponse, error) {
+	var start, end time.Time
+	if req.StartTime > 0 {
+		start = time.Unix(req.StartTime, 0)
+	}
+	if req.EndTime > 0 {
+		end = time.Unix(req.EndTime, 0)
+	}
+
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		return &acmv1.StatisticsResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: "end_time must not be before start_time",
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST,
+				Message: "end_time must not be before start_time",
+			},
+		}, nil
+	}
+
+	stats, err := s.aggregator.Statistics(ctx, start, end, mapTimePeriodFromProto(req.GroupBy))
+	if err != nil {
+		return &acmv1.StatisticsResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: fmt.Sprintf("Failed to compute statistics: %v", err),
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_INTERNAL,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	eventsByType := make(map[string]int64, len(stats.EventsByType))
+	for eventType, count := range stats.EventsByType {
+		eventsByType[string(eventType)] = count
+	}
+
+	eventsByStatus := make(map[string]int64, len(stats.EventsByStatus))
+	for status, count := range stats.EventsByStatus {
+		eventsByStatus[string(status)] = count
+	}
+
+	timeSeries := make([]*acmv1.TimeSeriesDataPoint, 0, len(stats.TimeSeries))
+	for _, point := range stats.TimeSeries {
+		byType := make(map[string]int64, len(point.EventsByType))
+		for eventType, count := range point.EventsByType {
+			byType[string(eventType)] = count
+		}
+
+		timeSeries = append(timeSeries, &acmv1.TimeSeriesDataPoint{
+			Timestamp:    point.Timestamp.Unix(),
+			EventCount:   point.EventCount,
+			EventsByType: byType,
+			SuccessCount: point.SuccessCount,
+			FailureCount: point.FailureCount,
+		})
+	}
+
+	return &acmv1.StatisticsResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_SUCCESS,
+			Message: fmt.Sprintf("Aggregated %d audit events", stats.TotalEvents),
+		},
+		TotalEvents:           stats.TotalEvents,
+		EventsByType:          eventsByType,
+		EventsByStatus:        eventsByStatus,
+		SuccessfulRotations:   stats.SuccessfulRotations,
+		FailedRotations:       stats.FailedRotations,
+		HimInterventions:      stats.HIMInterventions,
+		ComplianceChecks:      stats.ComplianceChecks,
+		AvgRotationDurationMs: stats.AvgRotationDuration.Milliseconds(),
+		TimeSeries:            timeSeries,
+	}, nil
+}
+
+// QueryLogs returns one page of audit events matching the request filter.
+func (s *AuditServiceServer) QueryLogs(ctx context.Context, req *acmv1.QueryRequest) (*acmv1.QueryResponse, error) {
+	filter, err := mapAuditFilterFromProto(req.Filter)
+	if err != nil {
+		return &acmv1.QueryResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: fmt.Sprintf("Invalid filter: %v", err),
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	filter.Order = audit.SortDescending
+	if req.SortOrder == acmv1.SortOrder_SORT_ORDER_ASC {
+		filter.Order = audit.SortAscending
+	}
+
+	filter.Limit = defaultAuditPageSize
+	if req.Pagination != nil {
+		if req.Pagination.PageSize > 0 {
+			filter.Limit = int(req.Pagination.PageSize)
+		}
+		filter.Cursor = req.Pagination.PageToken
+	}
+	if filter.Limit > maxAuditPageSize {
+		filter.Limit = maxAuditPageSize
+	}
+
+	page, err := s.logger.QueryPage(ctx, filter)
+	if err != nil {
+		code := acmv1.ErrorCode_ERROR_CODE_INTERNAL
+		if errors.Is(err, audit.ErrInvalidCursor) {
+			code = acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST
+		}
+		return &acmv1.QueryResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: fmt.Sprintf("Failed to query audit logs: %v", err),
+			},
+			Error: &acmv1.Error{
+				Code:    code,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	events := make([]*acmv1.AuditEvent, 0, len(page.Events))
+	for _, event := range page.Events {
+		events = append(events, mapAuditEventToProto(event))
+	}
+
+	return &acmv1.QueryResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_SUCCESS,
+			Message: fmt.Sprintf("Found %d events", len(events)),
+		},
+		Events: events,
+		Pagination: &acmv1.PaginationResponse{
+			NextPageToken: page.NextCursor,
+			ItemsInPage:   int32(len(events)),
+		},
+	}, nil
+}
+
+// ExportReport generates an audit report in the requested format.
+func (s *AuditServiceServer) ExportReport(ctx context.Context, req *acmv1.ExportRequest) (*acmv1.ExportResponse, error) {
+	format, ext, ok := mapReportFormatFromProto(req.Format)
+	if !ok {
+		return &acmv1.ExportResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: "format is required",
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST,
+				Message: "format is required",
+			},
+		}, nil
+	}
+
+	filter, err := mapAuditFilterFromProto(req.Filter)
+	if err != nil {
+		return &acmv1.ExportResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: fmt.Sprintf("Invalid filter: %v", err),
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	// Loggers that can't render options don't report the event count
+	var content []byte
+	var count int
+	if exporter, ok := s.logger.(audit.ReportExporter); ok {
+		content, count, err = exporter.ExportReportWithOptions(ctx, filter, format, audit.ReportOptions{
+			Title:    req.ReportTitle,
+			Metadata: req.ReportMetadata,
+		})
+	} else {
+		content, err = s.logger.ExportReport(ctx, filter, format)
+	}
+	if err != nil {
+		return &acmv1.ExportResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: fmt.Sprintf("Failed to export report: %v", err),
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_INTERNAL,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	now := time.Now()
+	hash := sha256.Sum256(content)
+
+	return &acmv1.ExportResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_SUCCESS,
+			Message: "Report generated successfully",
+		},
+		ReportContent: content,
+		Format:        req.Format,
+		Filename:      fmt.Sprintf("acm-audit-report-%s.%s", now.UTC().Format("20060102-150405"), ext),
+		SizeBytes:     int64(len(content)),
+		EventsCount:   int64(count),
+		GeneratedAt:   now.Unix(),
+		ContentHash:   hex.EncodeToString(hash[:]),
+	}, nil
+}
+
+// GetSignedTreeHead returns the latest published tree head of the audit transparency log.
+func (s *AuditServiceServer) GetSignedTreeHead(ctx context.Context, req *acmv1.SignedTreeHeadRequest) (*acmv1.SignedTreeHeadResponse, error) {
+	provider, ok := s.logger.(audit.TransparencyProvider)
+	if !ok {
+		return &acmv1.SignedTreeHeadResponse{
+			Status: transparencyUnavailableStatus(),
+			Error:  transparencyUnavailableError(),
+		}, nil
+	}
+
+	head, err := provider.TransparencyLog().LatestTreeHead()
+	if err != nil {
+		return &acmv1.SignedTreeHeadResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: fmt.Sprintf("Failed to sign tree head: %v", err),
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_INTERNAL,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	return &acmv1.SignedTreeHeadResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_SUCCESS,
+			Message: fmt.Sprintf("Tree head at size %d", head.TreeSize),
+		},
+		TreeHead:  mapTreeHeadToProto(head),
+		PublicKey: provider.PublicKey(),
+	}, nil
+}
+
+// GetInclusionProof returns a Merkle audit path for an event.
+func (s *AuditServiceServer) GetInclusionProof(ctx context.Context, req *acmv1.InclusionProofRequest) (*acmv1.InclusionProofResponse, error) {
+	provider, ok := s.logger.(audit.TransparencyProvider)
+	if !ok {
+		return &acmv1.InclusionProofResponse{
+			Status: transparencyUnavailableStatus(),
+			Error:  transparencyUnavailableError(),
+		}, nil
+	}
+
+	if req.EventId == "" {
+		return &acmv1.InclusionProofResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: "event_id is required",
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST,
+				Message: "event_id is required",
+			},
+		}, nil
+	}
+
+	proof, err := provider.EventInclusionProof(ctx, req.EventId, req.TreeSize)
+	if err != nil {
+		code := acmv1.ErrorCode_ERROR_CODE_NOT_FOUND
+		if errors.Is(err, audit.ErrInvalidTreeSize) {
+			code = acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST
+		}
+		return &acmv1.InclusionProofResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: fmt.Sprintf("Failed to build inclusion proof: %v", err),
+			},
+			Error: &acmv1.Error{
+				Code:    code,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	return &acmv1.InclusionProofResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_SUCCESS,
+			Message: fmt.Sprintf("Event is leaf %d of %d", proof.LeafIndex, proof.TreeHead.TreeSize),
+		},
+		EventId:   proof.EventID,
+		LeafIndex: proof.LeafIndex,
+		LeafData:  proof.LeafData,
+		AuditPath: proof.AuditPath,
+		TreeHead:  mapTreeHeadToProto(&proof.TreeHead),
+	}, nil
+}
+
+// GetConsistencyProof returns a consistency proof between two tree sizes.
+func (s *AuditServiceServer) GetConsistencyProof(ctx context.Context, req *acmv1.ConsistencyProofRequest) (*acmv1.ConsistencyProofResponse, error) {
+	provider, ok := s.logger.(audit.TransparencyProvider)
+	if !ok {
+		return &acmv1.ConsistencyProofResponse{
+			Status: transparencyUnavailableStatus(),
+			Error:  transparencyUnavailableError(),
+		}, nil
+	}
+
+	proof, err := provider.TransparencyLog().ConsistencyProof(req.FirstTreeSize, req.SecondTreeSize)
+	if err != nil {
+		return &acmv1.ConsistencyProofResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: fmt.Sprintf("Failed to build consistency proof: %v", err),
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	return &acmv1.ConsistencyProofResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_SUCCESS,
+			Message: fmt.Sprintf("Consistency proof from %d to %d", proof.FirstTreeHead.TreeSize, proof.SecondTreeHead.TreeSize),
+		},
+		FirstTreeHead:  mapTreeHeadToProto(&proof.FirstTreeHead),
+		SecondTreeHead: mapTreeHeadToProto(&proof.SecondTreeHead),
+		Proof:          proof.Proof,
+	}, nil
+}
+
+// WatchEvents streams audit events as they are logged.
+func (s *AuditServiceServer) WatchEvents(req *acmv1.WatchEventsRequest, stream acmv1.AuditService_WatchEventsServer) error {
+	watcher, ok := s.logger.(audit.Watcher)
+	if !ok {
+		return status.Error(codes.Unimplemented, "audit logger does not support event streaming")
+	}
+
+	eventTypes, err := mapAuditEventTypesFromProto(req.EventTypes)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	opts := audit.SubscribeOptions{
+		EventTypes:  eventTypes,
+		Sites:       req.Sites,
+		FromEventID: req.FromEventId,
+	}
+	for _, st := range req.Statuses {
+		opts.Statuses = append(opts.Statuses, audit.EventStatus(st))
+	}
+	if req.FromTime > 0 {
+		opts.FromTime = time.Unix(req.FromTime, 0)
+	}
+
+	sub, err := watcher.Subscribe(stream.Context(), opts)
+	if err != nil {
+		if errors.Is(err, audit.ErrBrokerClosed) {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		return status.Errorf(codes.InvalidArgument, "failed to subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	for delivery := range sub.Events() {
+		if err := stream.Send(&acmv1.WatchEventsResponse{
+			EventId:  delivery.Event.ID,
+			Event:    mapAuditEventToProto(delivery.Event),
+			Message:  delivery.Event.Message,
+			Replayed: delivery.Replayed,
+		}); err != nil {
+			return err
+		}
+	}
+
+	switch err := sub.Err(); {
+	case errors.Is(err, audit.ErrSubscriberLagged):
+		return status.Errorf(codes.ResourceExhausted, "%v; resume from event %s", err, sub.LastEventID())
+	case errors.Is(err, audit.ErrBrokerClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	case err != nil:
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	return stream.Context().Err()
+}
+
+// mapAuditEventToProto converts an audit event to its proto form.
+func mapAuditEventToProto(event audit.Event) *acmv1.AuditEvent {
+	details, _ := json.Marshal(event.Metadata)
+
+	var durationMs int64
+	if d, err := time.ParseDuration(event.Metadata["duration"]); err == nil {
+		durationMs = d.Milliseconds()
+	}
+
+	return &acmv1.AuditEvent{
+		Timestamp:        event.Timestamp.Unix(),
+		EventType:        mapAuditEventTypeToProto(event.Type),
+		CredentialIdHash: event.CredentialID,
+		Action:           event.Metadata["action"],
+		Status:           string(event.Status),
+		Site:             event.Site,
+		Username:         event.Username,
+		DetailsJson:      string(details),
+		Signature:        hex.EncodeToString(event.Signature),
+		RequiredHim:      event.Type == audit.EventTypeHIM,
+		DurationMs:       durationMs,
+	}
+}
+
+// mapAuditEventTypeToProto converts an audit event type to its proto form.
+func mapAuditEventTypeToProto(t audit.EventType) acmv1.AuditEventType {
+	switch t {
+	case audit.EventTypeRotation:
+		return acmv1.AuditEventType_AUDIT_EVENT_TYPE_ROTATION
+	case audit.EventTypeDetection:
+		return acmv1.AuditEventType_AUDIT_EVENT_TYPE_DETECTION
+	case audit.EventTypeCompliance:
+		return acmv1.AuditEventType_AUDIT_EVENT_TYPE_COMPLIANCE_CHECK
+	case audit.EventTypeHIM:
+		return acmv1.AuditEventType_AUDIT_EVENT_TYPE_HIM_PROMPT
+	case audit.EventTypeAuth:
+		return acmv1.AuditEventType_AUDIT_EVENT_TYPE_AUTHENTICATION
+	case audit.EventTypeSystem:
+		return acmv1.AuditEventType_AUDIT_EVENT_TYPE_SERVICE_LIFECYCLE
+	default:
+		return acmv1.AuditEventType_AUDIT_EVENT_TYPE_UNSPECIFIED
+	}
+}
+
+func transparencyUnavailableStatus() *acmv1.Status {
+	return &acmv1.Status{
+		Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+		Message: "Audit logger does not maintain a transparency log",
+	}
+}
+
+func transparencyUnavailableError() *acmv1.Error {
+	return &acmv1.Error{
+		Code:    acmv1.ErrorCode_ERROR_CODE_UNAVAILABLE,
+		Message: "transparency log not available",
+	}
+}
+
+// mapTreeHeadToProto converts a signed tree head to its proto form.
+func mapTreeHeadToProto(head *audit.SignedTreeHead) *acmv1.SignedTreeHead {
+	return &acmv1.SignedTreeHead{
+		TreeSize:    head.TreeSize,
+		TimestampMs: head.Timestamp.UnixMilli(),
+		RootHash:    head.RootHash,
+		Signature:   head.Signature,
+	}
+}
+
+// mapReportFormatFromProto converts the proto report format to the audit
+// package type and a file extension.
+func mapReportFormatFromProto(format acmv1.ReportFormat) (audit.ReportFormat, string, bool) {
+	switch format {
+	case acmv1.ReportFormat_REPORT_FORMAT_JSON:
+		return audit.ReportFormatJSON, "json", true
+	case acmv1.ReportFormat_REPORT_FORMAT_CSV:
+		return audit.ReportFormatCSV, "csv", true
+	case acmv1.ReportFormat_REPORT_FORMAT_HTML:
+		return audit.ReportFormatHTML, "html", true
+	case acmv1.ReportFormat_REPORT_FORMAT_PDF:
+		return audit.ReportFormatPDF, "pdf", true
+	case acmv1.ReportFormat_REPORT_FORMAT_NDJSON:
+		return audit.ReportFormatNDJSON, "ndjson", true
+	case acmv1.ReportFormat_REPORT_FORMAT_CEF:
+		return audit.ReportFormatCEF, "cef", true
+	case acmv1.ReportFormat_REPORT_FORMAT_OCSF:
+		return audit.ReportFormatOCSF, "ocsf.ndjson", true
+	default:
+		return "", "", false
+	}
+}
+
+// mapAuditFilterFromProto converts a proto audit filter to an audit.Filter.
+func mapAuditFilterFromProto(f *acmv1.AuditFilter) (audit.Filter, error) {
+	var filter audit.Filter
+	if f == nil {
+		return filter, nil
+	}
+
+	if f.StartTime > 0 {
+		filter.StartTime = time.Unix(f.StartTime, 0)
+	}
+	if f.EndTime > 0 {
+		filter.EndTime = time.Unix(f.EndTime, 0)
+	}
+	eventTypes, err := mapAuditEventTypesFromProto(f.EventTypes)
+	if err != nil {
+		return audit.Filter{}, err
+	}
+	filter.EventTypes = eventTypes
+	filter.CredentialIDs = f.CredentialIdHashes
+	for _, status := range f.Statuses {
+		filter.Statuses = append(filter.Statuses, audit.EventStatus(status))
+	}
+	if f.OnlyHimEvents {
+		filter.EventType = audit.EventTypeHIM
+	}
+	if f.OnlyComplianceEvents {
+		filter.EventType = audit.EventTypeCompliance
+	}
+
+	filter.Site = f.Site
+	if f.SiteMatchDomain {
+		filter.SiteMatch = audit.SiteMatchDomain
+	}
+	for key, value := range f.Metadata {
+		filter.Metadata = append(filter.Metadata, audit.MetadataPredicate{Key: key, Op: audit.MetadataEquals, Value: value})
+	}
+	filter.MessageContains = f.SearchQuery
+	filter.UsernameHash = f.UsernameHash
+
+	return filter, nil
+}
+
+// mapAuditEventTypesFromProto converts proto event types to audit package
+// types. UNSPECIFIED entries are skipped. Password generation is not
+// audited as an event of its own, so filtering on it is an error rather
+// than a match on rotations.
+func mapAuditEventTypesFromProto(types []acmv1.AuditEventType) ([]audit.EventType, error) {
+	var result []audit.EventType
+	for _, t := range types {
+		switch t {
+		case acmv1.AuditEventType_AUDIT_EVENT_TYPE_UNSPECIFIED:
+			continue
+		case acmv1.AuditEventType_AUDIT_EVENT_TYPE_PASSWORD_GENERATION:
+			return nil, fmt.Errorf("event type %s is not recorded in the audit log", t)
+		}
+		result = append(result, mapAuditEventTypeFromProto(t))
+	}
+	return result, nil
+}
+
+// mapAuditEventTypeFromProto converts a proto event type to the audit package type.
+func mapAuditEventTypeFromProto(t acmv1.AuditEventType) audit.EventType {
+	switch t {
+	case acmv1.AuditEventType_AUDIT_EVENT_TYPE_ROTATION:
+		return audit.EventTypeRotation
+	case acmv1.AuditEventType_AUDIT_EVENT_TYPE_DETECTION:
+		return audit.EventTypeDetection
+	case acmv1.AuditEventType_AUDIT_EVENT_TYPE_COMPLIANCE_CHECK:
+		return audit.EventTypeCompliance
+	case acmv1.AuditEventType_AUDIT_EVENT_TYPE_HIM_PROMPT:
+		return audit.EventTypeHIM
+	case acmv1.AuditEventType_AUDIT_EVENT_TYPE_AUTHENTICATION, acmv1.AuditEventType_AUDIT_EVENT_TYPE_CERTIFICATE_OPERATION:
+		return audit.EventTypeAuth
+	default:
+		return audit.EventTypeSystem
+	}
+}
+
+// mapTimePeriodFromProto converts the proto time period to the audit package type.
+func mapTimePeriodFromProto(period acmv1.TimePeriod) audit.TimePeriod {
+	switch period {
+	case acmv1.TimePeriod_TIME_PERIOD_HOUR:
+		return audit.PeriodHour
+	case acmv1.TimePeriod_TIME_PERIOD_DAY:
+		return audit.PeriodDay
+	case acmv1.TimePeriod_TIME_PERIOD_WEEK:
+		return audit.PeriodWeek
+	case acmv1.TimePeriod_TIME_PERIOD_MONTH:
+		return audit.PeriodMonth
+	default:
+		return audit.PeriodNone
+	}
+}
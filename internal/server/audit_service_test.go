@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	acmv1 "github.com/ferg-cod3s/automated-compromise-mitigation/api/proto/acm/v1"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/audit"
+)
+
+// TestQueryLogsEventTypes tests that UNSPECIFIED event types are ignored and
+// password generation is rejected instead of matching rotations
+func TestQueryLogsEventTypes(t *testing.T) {
+	logger, err := audit.NewMemoryLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	for _, eventType := range []audit.EventType{audit.EventTypeRotation, audit.EventTypeHIM} {
+		if err := logger.LogEvent(context.Background(), audit.Event{Type: eventType, Status: audit.StatusSuccess}); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+	server := NewAuditServiceServer(logger)
+
+	tests := []struct {
+		name    string
+		types   []acmv1.AuditEventType
+		want    int
+		invalid bool
+	}{
+		{"unspecified only", []acmv1.AuditEventType{acmv1.AuditEventType_AUDIT_EVENT_TYPE_UNSPECIFIED}, 2, false},
+		{"unspecified and rotation", []acmv1.AuditEventType{acmv1.AuditEventType_AUDIT_EVENT_TYPE_UNSPECIFIED, acmv1.AuditEventType_AUDIT_EVENT_TYPE_ROTATION}, 1, false},
+		{"password generation", []acmv1.AuditEventType{acmv1.AuditEventType_AUDIT_EVENT_TYPE_PASSWORD_GENERATION}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := server.QueryLogs(context.Background(), &acmv1.QueryRequest{
+				Filter: &acmv1.AuditFilter{EventTypes: tt.types},
+			})
+			if err != nil {
+				t.Fatalf("Failed to query logs: %v", err)
+			}
+			if tt.invalid {
+				if resp.Error == nil || resp.Error.Code != acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST {
+					t.Errorf("Expected an invalid request error, got %+v", resp.Error)
+				}
+				return
+			}
+			if resp.Error != nil || len(resp.Events) != tt.want {
+				t.Errorf("Expected %d events, got %d (%v)", tt.want, len(resp.Events), resp.Error)
+			}
+		})
+	}
+}
@@ -62,6 +62,8 @@ func (s *CredentialServiceServer) DetectCompromised(ctx context.Context, req *ac
 
 // RotateCredential performs a credential rotation operation.
 func (s *CredentialServiceServer) RotateCredential(ctx context.Context, req *acmv1.RotateRequest) (*acmv1.RotateResponse, error) {
+	ctx = withRotationHolder(ctx)
+
 	// Generate password based on policy
 	policy := pwmanager.PasswordPolicy{
 		Length:           int(req.Policy.Length),
@@ -86,20 +88,28 @@ func (s *CredentialServiceServer) RotateCredential(ctx context.Context, req *acm
 		ID: req.CredentialIdHash,
 	}
 
+	// A guided rotation changes the password on the site first, so the vault
+	// never holds a password the site doesn't know
+	if req.Mode == acmv1.RotationMode_ROTATION_MODE_GUIDED {
+		if !s.crs.ManualRotationEnabled() {
+			return &acmv1.RotateResponse{
+				Status: &acmv1.Status{
+					Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+					Message: "Guided rotation is not available",
+				},
+				Error: &acmv1.Error{
+					Code:    acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST,
+					Message: "guided rotation needs the HIM manager and a password manager that can stage passwords",
+				},
+			}, nil
+		}
+		return s.startManualRotation(ctx, cred, newPassword), nil
+	}
+
 	// Perform rotation
 	result, err := s.crs.RotateCredential(ctx, cred, newPassword)
 	if err != nil {
-		statusCode := acmv1.StatusCode_STATUS_CODE_FAILURE
-		if result != nil && result.Status == crs.RotationHIMRequired {
-			statusCode = acmv1.StatusCode_STATUS_CODE_HIM_REQUIRED
-		}
-
-		return &acmv1.RotateResponse{
-			Status: &acmv1.Status{
-				Code:    statusCode,
-				Message: err.Error(),
-			},
-		}, nil
+		return rotationFailedResponse(result, err), nil
 	}
 
 	return &acmv1.RotateResponse{
@@ -111,6 +121,48 @@ func (s *CredentialServiceServer) RotateCredential(ctx context.Context, req *acm
 	}, nil
 }
 
+// startManualRotation starts a guided site-first rotation. The new password
+// is not returned; the user sees it once in the HIM prompt.
+func (s *CredentialServiceServer) startManualRotation(ctx context.Context, cred pwmanager.CompromisedCredential, newPassword string) *acmv1.RotateResponse {
+	result, err := s.crs.StartManualRotation(ctx, cred, newPassword)
+	if err != nil {
+		return rotationFailedResponse(result, err)
+	}
+
+	return &acmv1.RotateResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_HIM_REQUIRED,
+			Message: "Change the password on the site, then confirm the HIM prompt",
+		},
+		CredentialIdHash: result.CredentialID,
+		Site:             cred.Site,
+		OperationId:      result.HIMSessionID,
+		RequiredHim:      true,
+	}
+}
+
+// rotationFailedResponse reports a rotation that did not complete. A
+// rotation waiting on a HIM session, such as an approval, reports it in
+// OperationId.
+func rotationFailedResponse(result *crs.RotationResult, err error) *acmv1.RotateResponse {
+	resp := &acmv1.RotateResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+			Message: err.Error(),
+		},
+		Error: rotationInProgressError(err),
+	}
+	if result != nil {
+		resp.CredentialIdHash = result.CredentialID
+		if result.Status == crs.RotationHIMRequired {
+			resp.Status.Code = acmv1.StatusCode_STATUS_CODE_HIM_REQUIRED
+			resp.OperationId = result.HIMSessionID
+			resp.RequiredHim = true
+		}
+	}
+	return resp
+}
+
 // GetRotationStatus retrieves the status of a rotation operation.
 func (s *CredentialServiceServer) GetRotationStatus(ctx context.Context, req *acmv1.StatusRequest) (*acmv1.StatusResponse, error) {
 	// For Phase I, rotations are synchronous
@@ -0,0 +1,744 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	acmv1 "github.com/ferg-cod3s/automated-compromise-mitigation/api/proto/acm/v1"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/auth"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/him"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/logging"
+)
+
+// promptBufferSize is the number of prompts queued per connected client.
+// A client that falls further behind receives the dropped prompts when it
+// reconnects.
+const promptBufferSize = 32
+
+// HIMServiceServer implements the gRPC HIMService on top of him.Service.
+type HIMServiceServer struct {
+	acmv1.UnimplementedHIMServiceServer
+	service *him.Service
+	web     *him.WebServer
+	logger  *logging.Logger
+
+	mu      sync.Mutex
+	clients map[*promptClient]struct{}
+}
+
+// promptClient is one connected PromptUser stream.
+type promptClient struct {
+	prompts chan *acmv1.HIMPrompt
+}
+
+// NewHIMServiceServer creates a HIM service server. New sessions created on
+// service are pushed to every connected PromptUser stream.
+func NewHIMServiceServer(service *him.Service) *HIMServiceServer {
+	s := &HIMServiceServer{
+		service: service,
+		logger:  logging.NewLogger("him-server"),
+		clients: make(map[*promptClient]struct{}),
+	}
+	service.OnSessionCreated(s.broadcast)
+	// A suggested response re-sends the prompt, pre-filled
+	service.OnSuggestion(s.broadcast)
+	return s
+}
+
+// SetWebServer enables GetWebPromptURL for the browser prompt page.
+func (s *HIMServiceServer) SetWebServer(web *him.WebServer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.web = web
+}
+
+// PromptUser keeps a long-lived stream with a client: prompts are pushed as
+// sessions are created, and responses are routed to the waiting session.
+// Prompts still pending when the client connects are sent first, and a
+// prompt is sent again when a response is suggested for it. Approval
+// requests are not prompts; they are served by ListApprovals and Approve.
+func (s *HIMServiceServer) PromptUser(stream acmv1.HIMService_PromptUserServer) error {
+	ctx := stream.Context()
+
+	// Register before listing pending sessions so none created in between
+	// is missed; duplicates are skipped by session ID below.
+	client := &promptClient{prompts: make(chan *acmv1.HIMPrompt, promptBufferSize)}
+	s.mu.Lock()
+	s.clients[client] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, client)
+		s.mu.Unlock()
+	}()
+
+	pending, err := s.service.ListActiveSessions(ctx)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to list pending sessions: %v", err)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+
+	// sent records the suggestion each prompt was last sent with, so a
+	// suggestion for a prompt the client already has still goes through.
+	sent := make(map[string]string)
+	for _, session := range pending {
+		if session.Type == him.HIMApproval {
+			continue
+		}
+		if err := s.sendPrompt(ctx, stream, mapSessionToPrompt(session, false, "")); err != nil {
+			return err
+		}
+		sent[session.ID] = session.Suggestion
+	}
+	s.logger.Info("HIM client connected", "pending_prompts", len(pending))
+
+	recvErr := make(chan error, 1)
+	go func() {
+		recvErr <- s.receiveResponses(ctx, stream, client)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case err := <-recvErr:
+			return err
+		case prompt := <-client.prompts:
+			suggestion := prompt.Context["suggested_response"]
+			if last, ok := sent[prompt.SessionId]; ok && !prompt.IsRetry && last == suggestion {
+				continue
+			}
+			if err := s.sendPrompt(ctx, stream, prompt); err != nil {
+				return err
+			}
+			sent[prompt.SessionId] = suggestion
+		}
+	}
+}
+
+// GetHIMStatus returns one session, or all active (optionally also
+// completed) sessions.
+func (s *HIMServiceServer) GetHIMStatus(ctx context.Context, req *acmv1.HIMStatusRequest) (*acmv1.HIMStatusResponse, error) {
+	var sessions []*him.Session
+	if req.SessionId != "" {
+		session, err := s.service.GetSession(ctx, req.SessionId)
+		if err != nil {
+			return &acmv1.HIMStatusResponse{
+				Status: &acmv1.Status{
+					Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+					Message: err.Error(),
+				},
+				Error: &acmv1.Error{
+					Code:    acmv1.ErrorCode_ERROR_CODE_NOT_FOUND,
+					Message: err.Error(),
+				},
+			}, nil
+		}
+		sessions = []*him.Session{session}
+	} else {
+		var err error
+		if req.IncludeCompleted {
+			sessions, err = s.service.ListSessions(ctx)
+		} else {
+			sessions, err = s.service.ListActiveSessions(ctx)
+		}
+		if err != nil {
+			return &acmv1.HIMStatusResponse{
+				Status: &acmv1.Status{
+					Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+					Message: fmt.Sprintf("Failed to list sessions: %v", err),
+				},
+				Error: &acmv1.Error{
+					Code:    acmv1.ErrorCode_ERROR_CODE_INTERNAL,
+					Message: err.Error(),
+				},
+			}, nil
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	resp := &acmv1.HIMStatusResponse{
+		Status: &acmv1.Status{
+			Code: acmv1.StatusCode_STATUS_CODE_SUCCESS,
+		},
+	}
+	for _, session := range sessions {
+		if req.OperationId != "" && session.OperationID != req.OperationId {
+			continue
+		}
+		if session.IsActive() {
+			resp.ActiveSessionsCount++
+		}
+		resp.Sessions = append(resp.Sessions, mapSessionToProto(session))
+	}
+	resp.Status.Message = fmt.Sprintf("%d active HIM sessions", resp.ActiveSessionsCount)
+
+	return resp, nil
+}
+
+// CancelHIM cancels an active HIM session.
+func (s *HIMServiceServer) CancelHIM(ctx context.Context, req *acmv1.CancelHIMRequest) (*acmv1.CancelHIMResponse, error) {
+	if req.SessionId == "" {
+		return &acmv1.CancelHIMResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: "session_id is required",
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST,
+				Message: "session_id is required",
+			},
+		}, nil
+	}
+
+	if err := s.service.CancelSession(ctx, req.SessionId); err != nil {
+		code := acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST
+		var herr *him.HIMError
+		if errors.As(err, &herr) && herr.Code == him.ErrSessionNotFound {
+			code = acmv1.ErrorCode_ERROR_CODE_NOT_FOUND
+		}
+		return &acmv1.CancelHIMResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: err.Error(),
+			},
+			SessionId: req.SessionId,
+			Error: &acmv1.Error{
+				Code:    code,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	s.logger.Info("HIM session cancelled", "session_id", req.SessionId, "reason", req.CancellationReason)
+
+	return &acmv1.CancelHIMResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_SUCCESS,
+			Message: "HIM session cancelled",
+		},
+		SessionId:   req.SessionId,
+		Cancelled:   true,
+		CancelledAt: time.Now().Unix(),
+	}, nil
+}
+
+// ListApprovals lists approval requests, marking those the caller may
+// approve with their client certificate.
+func (s *HIMServiceServer) ListApprovals(ctx context.Context, req *acmv1.ListApprovalsRequest) (*acmv1.ListApprovalsResponse, error) {
+	var (
+		sessions []*him.Session
+		err      error
+	)
+	if req.IncludeCompleted {
+		sessions, err = s.service.ListSessions(ctx)
+	} else {
+		sessions, err = s.service.ListActiveSessions(ctx)
+	}
+	if err != nil {
+		return &acmv1.ListApprovalsResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: fmt.Sprintf("Failed to list sessions: %v", err),
+			},
+		}, nil
+	}
+
+	// Without a client certificate nothing can be approved, but the
+	// requests can still be listed
+	var approver *him.Approver
+	if cert, err := auth.PeerCertificate(ctx); err == nil {
+		a := him.ApproverFromCertificate(cert)
+		approver = &a
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	resp := &acmv1.ListApprovalsResponse{
+		Status: &acmv1.Status{
+			Code: acmv1.StatusCode_STATUS_CODE_SUCCESS,
+		},
+	}
+	for _, session := range sessions {
+		if session.Type != him.HIMApproval || session.Approval == nil {
+			continue
+		}
+		resp.Requests = append(resp.Requests, mapApprovalToProto(session, approver))
+	}
+	resp.Status.Message = fmt.Sprintf("%d approval requests", len(resp.Requests))
+
+	return resp, nil
+}
+
+// Approve records the caller's signed approval. The caller is identified by
+// the verified client certificate of the connection, never by the request.
+func (s *HIMServiceServer) Approve(ctx context.Context, req *acmv1.ApproveRequest) (*acmv1.ApproveResponse, error) {
+	if req.SessionId == "" || len(req.Signature) == 0 || req.SignedAt == 0 {
+		return &acmv1.ApproveResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: "session_id, signed_at and signature are required",
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST,
+				Message: "session_id, signed_at and signature are required",
+			},
+		}, nil
+	}
+
+	cert, err := auth.PeerCertificate(ctx)
+	if err != nil {
+		return &acmv1.ApproveResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: "a client certificate is required to approve",
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_AUTH_FAILED,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	session, err := s.service.Approve(ctx, req.SessionId, cert, time.Unix(req.SignedAt, 0), req.Signature)
+	if err != nil {
+		code := mapHIMErrorToProto(err)
+		s.logger.Warn("HIM approval rejected", "session_id", req.SessionId, "approver", cert.Subject.CommonName, "error", err)
+		return &acmv1.ApproveResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: err.Error(),
+			},
+			Error: &acmv1.Error{
+				Code:    code,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	approver := him.ApproverFromCertificate(cert)
+	approved := session.State == him.StateCompleted
+	message := fmt.Sprintf("Approval recorded (%d of %d)", len(session.Approvals), session.Approval.Required)
+	if approved {
+		message = "Approval recorded; request approved"
+	}
+
+	return &acmv1.ApproveResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_SUCCESS,
+			Message: message,
+		},
+		Request:  mapApprovalToProto(session, &approver),
+		Approved: approved,
+	}, nil
+}
+
+// GetWebPromptURL issues a one-time login URL for the browser prompt page.
+func (s *HIMServiceServer) GetWebPromptURL(ctx context.Context, req *acmv1.GetWebPromptURLRequest) (*acmv1.GetWebPromptURLResponse, error) {
+	s.mu.Lock()
+	web := s.web
+	s.mu.Unlock()
+
+	if web == nil {
+		return &acmv1.GetWebPromptURLResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: "browser prompts are not enabled (set ACM_HIM_WEB_ADDR)",
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_UNAVAILABLE,
+				Message: "browser prompts are not enabled",
+			},
+		}, nil
+	}
+
+	url, expires, err := web.LoginURL()
+	if err != nil {
+		return &acmv1.GetWebPromptURLResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: err.Error(),
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_INTERNAL,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	return &acmv1.GetWebPromptURLResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_SUCCESS,
+			Message: "One-time login URL issued",
+		},
+		Url:       url,
+		ExpiresAt: expires.Unix(),
+	}, nil
+}
+
+// ListOriginPrompts lists the pending prompts for a browser origin.
+func (s *HIMServiceServer) ListOriginPrompts(ctx context.Context, req *acmv1.ListOriginPromptsRequest) (*acmv1.ListOriginPromptsResponse, error) {
+	sessions, err := s.service.SessionsForOrigin(ctx, req.Origin)
+	if err != nil {
+		return &acmv1.ListOriginPromptsResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: fmt.Sprintf("Failed to list sessions: %v", err),
+			},
+		}, nil
+	}
+
+	resp := &acmv1.ListOriginPromptsResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_SUCCESS,
+			Message: fmt.Sprintf("%d pending prompts", len(sessions)),
+		},
+	}
+	for _, session := range sessions {
+		resp.Prompts = append(resp.Prompts, mapSessionToPrompt(session, false, ""))
+		if err := s.service.MarkPrompted(ctx, session.ID); err != nil {
+			s.logger.Warn("Failed to mark HIM session prompted", "session_id", session.ID, "error", err)
+		}
+	}
+	return resp, nil
+}
+
+// RespondHIM answers one prompt, for clients that don't keep a PromptUser
+// stream open.
+func (s *HIMServiceServer) RespondHIM(ctx context.Context, req *acmv1.HIMResponse) (*acmv1.RespondHIMResponse, error) {
+	var err error
+	if req.CancelRequested || req.SkipRequested {
+		err = s.service.CancelSession(ctx, req.SessionId)
+	} else {
+		// Never log the response data itself
+		err = s.service.SubmitResponse(ctx, req.SessionId, mapResponseFromProto(req))
+	}
+	if err != nil {
+		s.logger.Warn("HIM response rejected", "session_id", req.SessionId, "error", err)
+		return &acmv1.RespondHIMResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: err.Error(),
+			},
+			SessionId: req.SessionId,
+			Error: &acmv1.Error{
+				Code:    mapHIMErrorToProto(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	s.logger.Info("HIM response accepted", "session_id", req.SessionId)
+	return &acmv1.RespondHIMResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_SUCCESS,
+			Message: "HIM response accepted",
+		},
+		SessionId: req.SessionId,
+		Accepted:  true,
+	}, nil
+}
+
+// ReleasePassword hands a session's new password, once, to a browser on a
+// matching origin or to a client that shows it. Both present the session's
+// security token.
+func (s *HIMServiceServer) ReleasePassword(ctx context.Context, req *acmv1.ReleasePasswordRequest) (*acmv1.ReleasePasswordResponse, error) {
+	var password string
+	var err error
+	if req.Origin == "" {
+		password, err = s.service.RevealPassword(ctx, req.SessionId, req.SecurityToken)
+	} else {
+		password, err = s.service.ReleasePassword(ctx, req.SessionId, req.Origin, req.SecurityToken)
+	}
+	if err != nil {
+		return &acmv1.ReleasePasswordResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: err.Error(),
+			},
+			Error: &acmv1.Error{
+				Code:    mapHIMErrorToProto(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	return &acmv1.ReleasePasswordResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_SUCCESS,
+			Message: "Password released",
+		},
+		Password: password,
+	}, nil
+}
+
+// receiveResponses routes client responses to sessions until the client
+// closes its side of the stream.
+func (s *HIMServiceServer) receiveResponses(ctx context.Context, stream acmv1.HIMService_PromptUserServer, client *promptClient) error {
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if resp.SessionId == "" {
+			s.logger.Warn("Ignoring HIM response without session ID")
+			continue
+		}
+
+		if resp.CancelRequested || resp.SkipRequested {
+			if err := s.service.CancelSession(ctx, resp.SessionId); err != nil {
+				s.logger.Warn("Failed to cancel HIM session", "session_id", resp.SessionId, "error", err)
+			}
+			continue
+		}
+
+		// Never log the response data itself
+		err = s.service.SubmitResponse(ctx, resp.SessionId, mapResponseFromProto(resp))
+		if err == nil {
+			s.logger.Info("HIM response accepted", "session_id", resp.SessionId)
+			continue
+		}
+		s.logger.Warn("HIM response rejected", "session_id", resp.SessionId, "error", err)
+
+		// Ask again while the session can still accept input
+		session, getErr := s.service.GetSession(ctx, resp.SessionId)
+		if getErr != nil || !session.IsActive() {
+			continue
+		}
+		select {
+		case client.prompts <- mapSessionToPrompt(session, true, err.Error()):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// broadcast queues a new session's prompt for every connected client.
+func (s *HIMServiceServer) broadcast(session him.Session) {
+	if session.Type == him.HIMApproval {
+		return
+	}
+	prompt := mapSessionToPrompt(&session, false, "")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for client := range s.clients {
+		select {
+		case client.prompts <- prompt:
+		default:
+			s.logger.Warn("HIM client is not keeping up, prompt deferred to reconnect", "session_id", session.ID)
+		}
+	}
+}
+
+func (s *HIMServiceServer) sendPrompt(ctx context.Context, stream acmv1.HIMService_PromptUserServer, prompt *acmv1.HIMPrompt) error {
+	prompt.PromptTimestamp = time.Now().Unix()
+	if err := stream.Send(prompt); err != nil {
+		return err
+	}
+	if err := s.service.MarkPrompted(ctx, prompt.SessionId); err != nil {
+		s.logger.Warn("Failed to mark HIM session prompted", "session_id", prompt.SessionId, "error", err)
+	}
+	return nil
+}
+
+// mapSessionToPrompt converts a session to the prompt pushed to clients.
+// A retry prompt carries the reason the previous response was rejected.
+func mapSessionToPrompt(session *him.Session, retry bool, reason string) *acmv1.HIMPrompt {
+	var timeout int64
+	if remaining := time.Until(session.ExpiresAt); remaining > 0 {
+		timeout = int64(remaining.Seconds())
+	}
+
+	prompt := &acmv1.HIMPrompt{
+		SessionId:           session.ID,
+		OperationId:         session.OperationID,
+		HimType:             mapHIMTypeToProto(session.Type),
+		Site:                session.Site,
+		Message:             session.Prompt,
+		ActionUrl:           session.ActionURL,
+		ExpectedInputFormat: session.ExpectedInput,
+		TimeoutSeconds:      timeout,
+		IsRetry:             retry,
+		AttemptsRemaining:   int32(session.MaxAttempts - session.AttemptCount),
+		SecurityToken:       session.SecurityToken,
+	}
+	if reason != "" || session.Suggestion != "" || session.PasswordPending {
+		prompt.Context = make(map[string]string)
+	}
+	if reason != "" {
+		prompt.Context["rejected_reason"] = reason
+	}
+	if session.Suggestion != "" {
+		prompt.Context["suggested_response"] = session.Suggestion
+	}
+	if session.PasswordPending {
+		prompt.Context["password_available"] = "true"
+	}
+	return prompt
+}
+
+// mapResponseFromProto converts a client response to a him.Response.
+func mapResponseFromProto(resp *acmv1.HIMResponse) him.Response {
+	response := him.Response{
+		SessionID:     resp.SessionId,
+		SecurityToken: resp.SecurityToken,
+		Timestamp:     time.Now(),
+	}
+	if data := resp.ResponseData; data != nil {
+		response.Data = him.ResponseData{
+			TextInput:    data.TextInput,
+			BooleanInput: data.BooleanInput || data.ActionCompleted,
+			BooleanSet:   data.BooleanSet || data.ActionCompleted,
+			ChoiceInput:  int(data.ChoiceIndex),
+			FileInput:    data.FileData,
+		}
+	}
+	if resp.ResponseTimestamp > 0 {
+		response.Timestamp = time.Unix(resp.ResponseTimestamp, 0)
+	}
+	return response
+}
+
+// mapSessionToProto converts a session to its status representation.
+func mapSessionToProto(session *him.Session) *acmv1.HIMSession {
+	pb := &acmv1.HIMSession{
+		SessionId:    session.ID,
+		OperationId:  session.OperationID,
+		HimType:      mapHIMTypeToProto(session.Type),
+		State:        mapHIMStateToProto(session.State),
+		Site:         session.Site,
+		StartedAt:    session.CreatedAt.Unix(),
+		AttemptsMade: int32(session.AttemptCount),
+		TimedOut:     session.State == him.StateTimeout,
+		Cancelled:    session.State == him.StateCancelled,
+	}
+	if !session.CompletedAt.IsZero() {
+		pb.CompletedAt = session.CompletedAt.Unix()
+	}
+	return pb
+}
+
+// mapApprovalToProto converts an approval session to its proto form.
+// approver, if not nil, is the caller, for CanApprove.
+func mapApprovalToProto(session *him.Session, approver *him.Approver) *acmv1.ApprovalRequest {
+	pb := &acmv1.ApprovalRequest{
+		SessionId:         session.ID,
+		OperationId:       session.OperationID,
+		Site:              session.Site,
+		Message:           session.Prompt,
+		State:             mapHIMStateToProto(session.State),
+		RequiredApprovals: int32(session.Approval.Required),
+		Escalated:         session.Escalated,
+		CanApprove:        approver != nil && him.CanApprove(session, *approver),
+		ApprovalPayload:   session.ApprovalPayload(),
+		CreatedAt:         session.CreatedAt.Unix(),
+		ExpiresAt:         session.ExpiresAt.Unix(),
+	}
+	for _, a := range session.Approvals {
+		pb.Approvals = append(pb.Approvals, &acmv1.ApprovalRecord{
+			Approver:            a.Approver.CommonName,
+			ApproverFingerprint: a.Approver.Fingerprint,
+			SignedAt:            a.SignedAt.Unix(),
+			EvidenceEntryId:     a.EvidenceID,
+		})
+	}
+	return pb
+}
+
+// mapHIMErrorToProto chooses the error code for an error from him.Service.
+func mapHIMErrorToProto(err error) acmv1.ErrorCode {
+	var herr *him.HIMError
+	if !errors.As(err, &herr) {
+		return acmv1.ErrorCode_ERROR_CODE_INTERNAL
+	}
+	switch herr.Code {
+	case him.ErrSessionNotFound:
+		return acmv1.ErrorCode_ERROR_CODE_NOT_FOUND
+	case him.ErrNotAuthorized, him.ErrOriginMismatch:
+		return acmv1.ErrorCode_ERROR_CODE_PERMISSION_DENIED
+	case him.ErrDuplicateApproval:
+		return acmv1.ErrorCode_ERROR_CODE_ALREADY_EXISTS
+	case him.ErrInvalidSignature:
+		return acmv1.ErrorCode_ERROR_CODE_AUTH_FAILED
+	case him.ErrInvalidToken:
+		return acmv1.ErrorCode_ERROR_CODE_TOKEN_INVALID
+	case him.ErrTimeout, him.ErrSessionExpired:
+		return acmv1.ErrorCode_ERROR_CODE_DEADLINE_EXCEEDED
+	default:
+		return acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST
+	}
+}
+
+// mapHIMTypeToProto converts a him.HIMType to its proto form.
+func mapHIMTypeToProto(t him.HIMType) acmv1.HIMType {
+	switch t {
+	case him.HIMMFA, him.HIMTOTP:
+		return acmv1.HIMType_HIM_TYPE_TOTP
+	case him.HIMSMS:
+		return acmv1.HIMType_HIM_TYPE_SMS
+	case him.HIMPush:
+		return acmv1.HIMType_HIM_TYPE_PUSH_NOTIFICATION
+	case him.HIMEmail:
+		return acmv1.HIMType_HIM_TYPE_EMAIL_CODE
+	case him.HIMCAPTCHA:
+		return acmv1.HIMType_HIM_TYPE_CAPTCHA
+	case him.HIMManualRotation:
+		return acmv1.HIMType_HIM_TYPE_MANUAL_CHANGE
+	case him.HIMToSReview:
+		return acmv1.HIMType_HIM_TYPE_TOS_VIOLATION
+	case him.HIMBiometric:
+		return acmv1.HIMType_HIM_TYPE_BIOMETRIC
+	case him.HIMSecurityKey:
+		return acmv1.HIMType_HIM_TYPE_USER_CONFIRMATION
+	case him.HIMBackupCode:
+		return acmv1.HIMType_HIM_TYPE_BACKUP_CODE
+	case him.HIMRecoveryCode:
+		return acmv1.HIMType_HIM_TYPE_RECOVERY_CODE
+	case him.HIMApproval:
+		return acmv1.HIMType_HIM_TYPE_APPROVAL
+	default:
+		return acmv1.HIMType_HIM_TYPE_UNSPECIFIED
+	}
+}
+
+// mapHIMStateToProto converts a him.SessionState to its proto form.
+func mapHIMStateToProto(state him.SessionState) acmv1.HIMState {
+	switch state {
+	case him.StateInitialized:
+		return acmv1.HIMState_HIM_STATE_INITIALIZED
+	case him.StatePending:
+		return acmv1.HIMState_HIM_STATE_AWAITING_INPUT
+	case him.StateProcessing:
+		return acmv1.HIMState_HIM_STATE_VALIDATING
+	case him.StateCompleted:
+		return acmv1.HIMState_HIM_STATE_COMPLETED
+	case him.StateFailed:
+		return acmv1.HIMState_HIM_STATE_FAILED
+	case him.StateCancelled:
+		return acmv1.HIMState_HIM_STATE_CANCELLED
+	case him.StateTimeout:
+		return acmv1.HIMState_HIM_STATE_TIMEOUT
+	default:
+		return acmv1.HIMState_HIM_STATE_UNSPECIFIED
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	acmv1 "github.com/ferg-cod3s/automated-compromise-mitigation/api/proto/acm/v1"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/him"
+)
+
+// promptStream is a PromptUser stream that records sent prompts and never
+// receives a response.
+type promptStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	prompts chan *acmv1.HIMPrompt
+}
+
+func (s *promptStream) Context() context.Context { return s.ctx }
+
+func (s *promptStream) Send(prompt *acmv1.HIMPrompt) error {
+	s.prompts <- prompt
+	return nil
+}
+
+func (s *promptStream) Recv() (*acmv1.HIMResponse, error) {
+	<-s.ctx.Done()
+	return nil, s.ctx.Err()
+}
+
+func (s *promptStream) next(t *testing.T) *acmv1.HIMPrompt {
+	t.Helper()
+	select {
+	case prompt := <-s.prompts:
+		return prompt
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a prompt")
+		return nil
+	}
+}
+
+// TestPromptUserSendsSuggestion tests that a suggestion re-sends a prompt the
+// client already has
+func TestPromptUserSendsSuggestion(t *testing.T) {
+	service := him.NewService(time.Minute)
+	t.Cleanup(service.Close)
+	server := NewHIMServiceServer(service)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := &promptStream{ctx: ctx, prompts: make(chan *acmv1.HIMPrompt, 4)}
+
+	session, err := service.CreateSession(ctx, him.SessionRequest{Type: him.HIMTOTP, Site: "github.com", Prompt: "Enter the code"})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- server.PromptUser(stream) }()
+
+	first := stream.next(t)
+	if first.SessionId != session.ID || first.Context["suggested_response"] != "" {
+		t.Fatalf("Expected the pending prompt without a suggestion, got %+v", first)
+	}
+
+	if err := service.Suggest(ctx, session.ID, "123456"); err != nil {
+		t.Fatalf("Failed to suggest response: %v", err)
+	}
+	second := stream.next(t)
+	if second.SessionId != session.ID || second.Context["suggested_response"] != "123456" {
+		t.Errorf("Expected the prompt re-sent with the suggestion, got %+v", second)
+	}
+
+	cancel()
+	<-done
+	if len(stream.prompts) != 0 {
+		t.Errorf("Expected no duplicate prompts, got %d", len(stream.prompts))
+	}
+}
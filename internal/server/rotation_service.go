@@ -3,9 +3,13 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	acmv1 "github.com/ferg-cod3s/automated-compromise-mitigation/api/proto/acm/v1"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/auth"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation"
 	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation/github"
 )
 
@@ -13,12 +17,16 @@ import (
 type RotationServiceServer struct {
 	acmv1.UnimplementedRotationServiceServer
 	githubRotator *github.Rotator
+	providers     *rotation.Registry
 }
 
-// NewRotationServiceServer creates a new rotation service server.
-func NewRotationServiceServer(githubRotator *github.Rotator) *RotationServiceServer {
+// NewRotationServiceServer creates a new rotation service server. The
+// GitHub-specific RPCs use githubRotator; StartRotation, AdvanceRotation,
+// GetRotation and RevokeRotation use the provider named in the request.
+func NewRotationServiceServer(githubRotator *github.Rotator, providers *rotation.Registry) *RotationServiceServer {
 	return &RotationServiceServer{
 		githubRotator: githubRotator,
+		providers:     providers,
 	}
 }
 
@@ -60,7 +68,7 @@ func (s *RotationServiceServer) StartGitHubRotation(ctx context.Context, req *ac
 	}
 
 	// Start rotation
-	result, err := s.githubRotator.StartRotation(ctx, rotationReq)
+	result, err := s.githubRotator.StartRotation(withRotationHolder(ctx), rotationReq)
 	if err != nil {
 		return &acmv1.StartGitHubRotationResponse{
 			Status: &acmv1.Status{
@@ -91,15 +99,20 @@ func (s *RotationServiceServer) StartGitHubRotation(ctx context.Context, req *ac
 			}
 		}
 
+		protoErr := rotationInProgressError(result.Error)
+		if protoErr == nil {
+			protoErr = &acmv1.Error{
+				Code:    errorCode,
+				Message: result.Error.Error(),
+			}
+		}
+
 		return &acmv1.StartGitHubRotationResponse{
 			Status: &acmv1.Status{
 				Code:    statusCode,
 				Message: result.Error.Error(),
 			},
-			Error: &acmv1.Error{
-				Code:    errorCode,
-				Message: result.Error.Error(),
-			},
+			Error: protoErr,
 		}, nil
 	}
 
@@ -149,7 +162,7 @@ func (s *RotationServiceServer) VerifyNewToken(ctx context.Context, req *acmv1.V
 	}
 
 	// Verify new token
-	result, err := s.githubRotator.VerifyNewToken(ctx, req.StateId, req.NewToken)
+	result, err := s.githubRotator.VerifyNewToken(withRotationHolder(ctx), req.StateId, req.NewToken)
 	if err != nil {
 		return &acmv1.VerifyNewTokenResponse{
 			Status: &acmv1.Status{
@@ -209,7 +222,7 @@ func (s *RotationServiceServer) ConfirmDeletion(ctx context.Context, req *acmv1.
 	}
 
 	// Confirm deletion
-	result, err := s.githubRotator.ConfirmDeletion(ctx, req.StateId)
+	result, err := s.githubRotator.ConfirmDeletion(withRotationHolder(ctx), req.StateId)
 	if err != nil {
 		return &acmv1.ConfirmDeletionResponse{
 			Status: &acmv1.Status{
@@ -325,7 +338,7 @@ func (s *RotationServiceServer) CancelGitHubRotation(ctx context.Context, req *a
 	}
 
 	// Cancel rotation
-	err := s.githubRotator.CancelRotation(ctx, req.StateId)
+	err := s.githubRotator.CancelRotation(withRotationHolder(ctx), req.StateId)
 	if err != nil {
 		return &acmv1.CancelGitHubRotationResponse{
 			Status: &acmv1.Status{
@@ -418,6 +431,135 @@ func (s *RotationServiceServer) ListActiveGitHubRotations(ctx context.Context, r
 	}, nil
 }
 
+// StartRotation starts a rotation with the provider named in the request.
+func (s *RotationServiceServer) StartRotation(ctx context.Context, req *acmv1.StartRotationRequest) (*acmv1.StartRotationResponse, error) {
+	if req.CredentialId == "" {
+		return &acmv1.StartRotationResponse{
+			Status: &acmv1.Status{
+				Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+				Message: "credential_id is required",
+			},
+			Error: &acmv1.Error{
+				Code:    acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST,
+				Message: "credential_id is required",
+			},
+		}, nil
+	}
+
+	provider, err := s.providers.Get(req.Provider)
+	if err != nil {
+		status, protoErr := rotationFailure(err)
+		return &acmv1.StartRotationResponse{Status: status, Error: protoErr}, nil
+	}
+
+	progress, err := provider.Start(withRotationHolder(ctx), rotation.StartRequest{
+		CredentialID: req.CredentialId,
+		Site:         req.Site,
+		Username:     req.Username,
+		Input:        req.Input,
+	})
+	status, rot, protoErr := progressResponse(progress, err, "Rotation started")
+	return &acmv1.StartRotationResponse{Status: status, Rotation: rot, Error: protoErr}, nil
+}
+
+// AdvanceRotation completes the current step of a rotation.
+func (s *RotationServiceServer) AdvanceRotation(ctx context.Context, req *acmv1.AdvanceRotationRequest) (*acmv1.AdvanceRotationResponse, error) {
+	provider, err := s.providers.Get(req.Provider)
+	if err != nil {
+		status, protoErr := rotationFailure(err)
+		return &acmv1.AdvanceRotationResponse{Status: status, Error: protoErr}, nil
+	}
+
+	progress, err := provider.Advance(withRotationHolder(ctx), req.RotationId, req.Input)
+	status, rot, protoErr := progressResponse(progress, err, "Rotation advanced")
+	return &acmv1.AdvanceRotationResponse{Status: status, Rotation: rot, Error: protoErr}, nil
+}
+
+// GetRotation gets the progress of a rotation.
+func (s *RotationServiceServer) GetRotation(ctx context.Context, req *acmv1.GetRotationRequest) (*acmv1.GetRotationResponse, error) {
+	provider, err := s.providers.Get(req.Provider)
+	if err != nil {
+		status, protoErr := rotationFailure(err)
+		return &acmv1.GetRotationResponse{Status: status, Error: protoErr}, nil
+	}
+
+	progress, err := provider.Status(ctx, req.RotationId)
+	status, rot, protoErr := progressResponse(progress, err, "Rotation found")
+	return &acmv1.GetRotationResponse{Status: status, Rotation: rot, Error: protoErr}, nil
+}
+
+// RevokeRotation abandons a rotation.
+func (s *RotationServiceServer) RevokeRotation(ctx context.Context, req *acmv1.RevokeRotationRequest) (*acmv1.RevokeRotationResponse, error) {
+	provider, err := s.providers.Get(req.Provider)
+	if err == nil {
+		err = provider.Revoke(withRotationHolder(ctx), req.RotationId)
+	}
+	if err != nil {
+		status, protoErr := rotationFailure(err)
+		return &acmv1.RevokeRotationResponse{Status: status, Error: protoErr}, nil
+	}
+
+	return &acmv1.RevokeRotationResponse{
+		Status: &acmv1.Status{
+			Code:    acmv1.StatusCode_STATUS_CODE_SUCCESS,
+			Message: "Rotation revoked successfully",
+		},
+	}, nil
+}
+
+// progressResponse builds the response fields of a provider call. A step
+// the provider rejected fails, but still returns the rotation's progress.
+func progressResponse(progress *rotation.Progress, err error, message string) (*acmv1.Status, *acmv1.RotationProgress, *acmv1.Error) {
+	if err != nil {
+		status, protoErr := rotationFailure(err)
+		return status, nil, protoErr
+	}
+
+	var rot *acmv1.RotationProgress
+	if progress.RotationID != "" {
+		rot = &acmv1.RotationProgress{
+			RotationId:       progress.RotationID,
+			Provider:         progress.Provider,
+			CredentialIdHash: hashString(progress.CredentialID),
+			State:            progress.State,
+			NextStep:         progress.NextStep,
+			Instructions:     progress.Instructions,
+			Done:             progress.Done,
+			Metadata:         progress.Metadata,
+		}
+	}
+
+	if progress.Error != nil {
+		status, protoErr := rotationFailure(progress.Error)
+		return status, rot, protoErr
+	}
+	return &acmv1.Status{
+		Code:    acmv1.StatusCode_STATUS_CODE_SUCCESS,
+		Message: message,
+	}, rot, nil
+}
+
+// rotationFailure builds the status and error of a failed rotation call.
+func rotationFailure(err error) (*acmv1.Status, *acmv1.Error) {
+	protoErr := rotationInProgressError(err)
+	if protoErr == nil {
+		code := acmv1.ErrorCode_ERROR_CODE_UNKNOWN
+		if errors.Is(err, rotation.ErrProviderNotFound) || errors.Is(err, rotation.ErrStateNotFound) {
+			code = acmv1.ErrorCode_ERROR_CODE_NOT_FOUND
+		} else if errors.Is(err, rotation.ErrInvalidTransition) {
+			code = acmv1.ErrorCode_ERROR_CODE_INVALID_REQUEST
+		}
+		protoErr = &acmv1.Error{
+			Code:    code,
+			Message: err.Error(),
+		}
+	}
+	return &acmv1.Status{
+		Code:    acmv1.StatusCode_STATUS_CODE_FAILURE,
+		Message: err.Error(),
+	}, protoErr
+}
+
 // mapRotationStepToProto converts internal rotation step to proto enum.
 func mapRotationStepToProto(step github.RotationStep) acmv1.GitHubRotationStep {
 	switch step {
@@ -438,6 +580,38 @@ func mapRotationStepToProto(step github.RotationStep) acmv1.GitHubRotationStep {
 	}
 }
 
+// rotationInProgressError returns the error for a rotation refused because
+// another rotation holds the credential's lease, or nil for other errors.
+func rotationInProgressError(err error) *acmv1.Error {
+	var held *rotation.LockHeldError
+	if !errors.As(err, &held) {
+		return nil
+	}
+	return &acmv1.Error{
+		Code:      acmv1.ErrorCode_ERROR_CODE_ROTATION_IN_PROGRESS,
+		Message:   err.Error(),
+		Retryable: true,
+		Context: map[string]string{
+			"holder":     held.Holder,
+			"started_at": held.AcquiredAt.Format(time.RFC3339),
+			"expires_at": held.ExpiresAt.Format(time.RFC3339),
+		},
+		Timestamp: time.Now().Unix(),
+	}
+}
+
+// withRotationHolder names the calling client, by its certificate's common
+// name, as the holder of rotation leases taken during the call and the
+// actor of the state transitions it makes. Every RPC that changes a
+// rotation wraps its context with it.
+func withRotationHolder(ctx context.Context) context.Context {
+	cert, err := auth.PeerCertificate(ctx)
+	if err != nil || cert.Subject.CommonName == "" {
+		return ctx
+	}
+	return rotation.WithHolder(ctx, cert.Subject.CommonName)
+}
+
 // contains checks if a string contains a substring.
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr || containsMiddle(s, substr)))
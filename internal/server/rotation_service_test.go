@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	_ "modernc.org/sqlite" // SQLite driver
+
+	acmv1 "github.com/ferg-cod3s/automated-compromise-mitigation/api/proto/acm/v1"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation"
+	"github.com/ferg-cod3s/automated-compromise-mitigation/internal/rotation/github"
+)
+
+// clientContext returns a context for a call from a client whose verified
+// certificate has commonName.
+func clientContext(commonName string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}},
+	})
+}
+
+// TestRotationTransitionActor tests that transitions made through the
+// rotation RPCs after the start name the calling client
+func TestRotationTransitionActor(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	store, err := rotation.NewSQLiteStateStore(db)
+	if err != nil {
+		t.Fatalf("Failed to create state store: %v", err)
+	}
+
+	rotator := github.NewRotator(store, nil)
+	providers := rotation.NewRegistry()
+	if err := providers.Register(rotator); err != nil {
+		t.Fatalf("Failed to register provider: %v", err)
+	}
+	server := NewRotationServiceServer(rotator, providers)
+
+	for _, id := range []string{"cancelled", "revoked"} {
+		err := store.SaveState(context.Background(), rotation.RotationState{
+			ID:           id,
+			CredentialID: "cred-" + id,
+			Provider:     github.ProviderName,
+			State:        github.StateValidating,
+			StartedAt:    time.Now(),
+			ExpiresAt:    time.Now().Add(time.Hour),
+			Metadata:     map[string]string{},
+		})
+		if err != nil {
+			t.Fatalf("Failed to save state: %v", err)
+		}
+	}
+
+	cancelResp, err := server.CancelGitHubRotation(clientContext("alice"), &acmv1.CancelGitHubRotationRequest{StateId: "cancelled"})
+	if err != nil || cancelResp.Status.Code != acmv1.StatusCode_STATUS_CODE_SUCCESS {
+		t.Fatalf("Failed to cancel rotation: %v %v", cancelResp.GetStatus(), err)
+	}
+	revokeResp, err := server.RevokeRotation(clientContext("bob"), &acmv1.RevokeRotationRequest{Provider: github.ProviderName, RotationId: "revoked"})
+	if err != nil || revokeResp.Status.Code != acmv1.StatusCode_STATUS_CODE_SUCCESS {
+		t.Fatalf("Failed to revoke rotation: %v %v", revokeResp.GetStatus(), err)
+	}
+
+	for id, actor := range map[string]string{"cancelled": "alice", "revoked": "bob"} {
+		transitions, err := store.ListTransitions(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Failed to list transitions: %v", err)
+		}
+		if len(transitions) != 1 || transitions[0].To != github.StateCancelled || transitions[0].Actor != actor {
+			t.Errorf("Expected %s's cancellation by %s, got %+v", id, actor, transitions)
+		}
+	}
+}